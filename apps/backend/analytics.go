@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultAnalyticsBucket = 15 * time.Minute
+	maxAnalyticsBucket     = 7 * 24 * time.Hour
+)
+
+type arrivalPoint struct {
+	Bucket     time.Time `json:"bucket"`
+	Admitted   int64     `json:"admitted"`
+	Scans      int64     `json:"scans"`
+	Cumulative int64     `json:"cumulative"`
+}
+
+type gateThroughput struct {
+	Gate          string    `json:"gate"`
+	Admitted      int64     `json:"admitted"`
+	Scans         int64     `json:"scans"`
+	PeakBucket    time.Time `json:"peak_bucket"`
+	PeakAdmitted  int64     `json:"peak_admitted"`
+	PeakPerMinute float64   `json:"peak_per_minute"`
+}
+
+type checkInAnalyticsResponse struct {
+	EventID    int32            `json:"event_id"`
+	Bucket     string           `json:"bucket"`
+	Source     string           `json:"source"`
+	Arrivals   []arrivalPoint   `json:"arrivals"`
+	Gates      []gateThroughput `json:"gates"`
+	Invited    int64            `json:"invited"`
+	Attended   int64            `json:"attended"`
+	NoShows    int64            `json:"no_shows"`
+	NoShowRate float64          `json:"no_show_rate"`
+}
+
+// GetCheckInAnalytics returns the event's arrival curve, peak throughput per
+// gate and no-show rate. The bucket query parameter sets the curve resolution,
+// e.g. 5m, 1h or 1d.
+func (api *API) GetCheckInAnalytics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	bucket := defaultAnalyticsBucket
+	if value := r.URL.Query().Get("bucket"); value != "" {
+		if bucket, err = parseAnalyticsBucket(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	buckets, err := api.analytics.CheckInBuckets(ctx, int32(eventID), bucket)
+	if err != nil {
+		LogError(ctx, "Failed to load check-in analytics", err)
+		http.Error(w, "Failed to load check-in analytics", http.StatusInternalServerError)
+		return
+	}
+
+	attendance, err := api.db.GetEventAttendance(ctx, int32(eventID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := buildCheckInAnalytics(buckets, bucket)
+	response.EventID = int32(eventID)
+	response.Source = api.analytics.Source()
+	response.Invited = attendance.Invited
+	response.Attended = attendance.Attended
+	response.NoShows = attendance.Invited - attendance.Attended
+	if attendance.Invited > 0 {
+		response.NoShowRate = float64(response.NoShows) / float64(attendance.Invited)
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseAnalyticsBucket accepts Go durations plus a "d" suffix for days.
+// Buckets must be whole minutes.
+func parseAnalyticsBucket(value string) (time.Duration, error) {
+	var bucket time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid bucket %q", value)
+		}
+		bucket = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if bucket, err = time.ParseDuration(value); err != nil {
+			return 0, fmt.Errorf("invalid bucket %q", value)
+		}
+	}
+
+	if bucket < time.Minute || bucket > maxAnalyticsBucket || bucket%time.Minute != 0 {
+		return 0, fmt.Errorf("bucket must be a whole number of minutes between 1m and 7d")
+	}
+	return bucket, nil
+}
+
+// buildCheckInAnalytics turns per-gate bucket counts, ordered by bucket, into
+// the arrival curve and gate throughput
+func buildCheckInAnalytics(buckets []checkInBucket, bucket time.Duration) checkInAnalyticsResponse {
+	response := checkInAnalyticsResponse{
+		Bucket:   bucket.String(),
+		Arrivals: []arrivalPoint{},
+		Gates:    []gateThroughput{},
+	}
+
+	gates := map[string]int{}
+	var cumulative int64
+	for _, b := range buckets {
+		if n := len(response.Arrivals); n == 0 || !response.Arrivals[n-1].Bucket.Equal(b.Bucket) {
+			response.Arrivals = append(response.Arrivals, arrivalPoint{Bucket: b.Bucket, Cumulative: cumulative})
+		}
+		point := &response.Arrivals[len(response.Arrivals)-1]
+		point.Admitted += b.Admitted
+		point.Scans += b.Scans
+		cumulative += b.Admitted
+		point.Cumulative = cumulative
+
+		i, ok := gates[b.Gate]
+		if !ok {
+			i = len(response.Gates)
+			gates[b.Gate] = i
+			response.Gates = append(response.Gates, gateThroughput{Gate: b.Gate})
+		}
+		gate := &response.Gates[i]
+		gate.Admitted += b.Admitted
+		gate.Scans += b.Scans
+		if b.Admitted > gate.PeakAdmitted {
+			gate.PeakAdmitted = b.Admitted
+			gate.PeakBucket = b.Bucket
+			gate.PeakPerMinute = float64(b.Admitted) / bucket.Minutes()
+		}
+	}
+
+	return response
+}
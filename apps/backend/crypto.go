@@ -1,5 +1,109 @@
 package main
 
-// Crypto utilities for HMAC operations
-// Note: Currently using inline HMAC operations in main.go for QR code generation
-// These utility functions are available for future use if needed
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"eventpass.pro/apps/backend/signing"
+)
+
+// defaultSigningKeyID names the key derived from HMAC_SECRET when no
+// QR_SIGNING_KEYS are configured
+const defaultSigningKeyID = "default"
+
+// newQRKeyring loads the QR signing keys from the environment.
+// QR_SIGNING_KEYS holds comma separated kid:secret pairs and QR_SIGNING_KEY_ID
+// selects the one new tokens are signed with. To rotate, add the new key,
+// switch QR_SIGNING_KEY_ID to it and drop the old key once its badges expire.
+//
+// Setting QR_ED25519_KEYS (kid:base64 seed pairs) and optionally
+// QR_ED25519_KEY_ID switches signing to Ed25519 so scanners can verify QR
+// codes offline; the HMAC keys are still used to verify existing badges.
+func newQRKeyring() (*signing.Keyring, error) {
+	keyring, err := newHMACKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	spec := os.Getenv("QR_ED25519_KEYS")
+	if spec == "" {
+		return keyring, nil
+	}
+
+	keys, err := signing.ParseEd25519Keys(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	activeKeyID := os.Getenv("QR_ED25519_KEY_ID")
+	if activeKeyID == "" && len(keys) == 1 {
+		for id := range keys {
+			activeKeyID = id
+		}
+	}
+
+	if err := keyring.SetEd25519Keys(activeKeyID, keys); err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+func newHMACKeyring() (*signing.Keyring, error) {
+	spec := os.Getenv("QR_SIGNING_KEYS")
+	if spec == "" {
+		secret := os.Getenv("HMAC_SECRET")
+		if secret == "" {
+			return nil, fmt.Errorf("neither QR_SIGNING_KEYS nor HMAC_SECRET is set")
+		}
+		return signing.NewKeyring(defaultSigningKeyID, map[string][]byte{defaultSigningKeyID: []byte(secret)})
+	}
+
+	keys, err := signing.ParseKeys(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	activeKeyID := os.Getenv("QR_SIGNING_KEY_ID")
+	if activeKeyID == "" && len(keys) == 1 {
+		for id := range keys {
+			activeKeyID = id
+		}
+	}
+
+	return signing.NewKeyring(activeKeyID, keys)
+}
+
+// GetSigningPublicKeys publishes the Ed25519 public keys scanners need to
+// verify QR codes offline. One keyring signs the QR codes of every event, so
+// the keys are the same for all of them.
+func (api *API) GetSigningPublicKeys(w http.ResponseWriter, r *http.Request) {
+	type publicKey struct {
+		KeyID     string `json:"kid"`
+		Algorithm string `json:"alg"`
+		PublicKey string `json:"public_key"`
+	}
+
+	response := struct {
+		TokenFormat string      `json:"token_format"`
+		ActiveKeyID string      `json:"active_kid"`
+		Keys        []publicKey `json:"keys"`
+	}{
+		TokenFormat: signing.VersionEd25519,
+		ActiveKeyID: api.qrKeys.ActiveKeyID(),
+		Keys:        []publicKey{},
+	}
+
+	for _, key := range api.qrKeys.PublicKeys() {
+		response.Keys = append(response.Keys, publicKey{
+			KeyID:     key.KeyID,
+			Algorithm: "Ed25519",
+			PublicKey: base64.RawURLEncoding.EncodeToString(key.Key),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -7,34 +7,72 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const assignUnownedEvents = `-- name: AssignUnownedEvents :execrows
+UPDATE events
+SET owner_id = (SELECT id FROM users WHERE role = 'admin' ORDER BY created_at, id LIMIT 1)
+WHERE owner_id IS NULL
+  AND EXISTS (SELECT 1 FROM users WHERE role = 'admin')
+`
+
+// Hands events created before owners were recorded to the earliest admin,
+// since organizers cannot see them. Leaves them alone while there is no
+// admin yet.
+func (q *Queries) AssignUnownedEvents(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, assignUnownedEvents)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const createEvent = `-- name: CreateEvent :one
 INSERT INTO events (
-  name, date, location
+  name, date, location, owner_id, reentry_policy, capacity, plus_ones_allowed
 )
 VALUES (
-  $1, $2, $3
+  $1, $2, $3, $4, $5, $6, $7
 )
-RETURNING id, name, date, location
+RETURNING id, name, date, location, owner_id, reentry_policy, capacity, tickets_reserved, plus_ones_allowed, registration_open, registration_form
 `
 
 type CreateEventParams struct {
-	Name     string
-	Date     pgtype.Timestamp
-	Location string
+	Name            string
+	Date            pgtype.Timestamp
+	Location        string
+	OwnerID         pgtype.UUID
+	ReentryPolicy   string
+	Capacity        int32
+	PlusOnesAllowed int32
 }
 
 func (q *Queries) CreateEvent(ctx context.Context, arg CreateEventParams) (Event, error) {
-	row := q.db.QueryRow(ctx, createEvent, arg.Name, arg.Date, arg.Location)
+	row := q.db.QueryRow(ctx, createEvent,
+		arg.Name,
+		arg.Date,
+		arg.Location,
+		arg.OwnerID,
+		arg.ReentryPolicy,
+		arg.Capacity,
+		arg.PlusOnesAllowed,
+	)
 	var i Event
 	err := row.Scan(
 		&i.ID,
 		&i.Name,
 		&i.Date,
 		&i.Location,
+		&i.OwnerID,
+		&i.ReentryPolicy,
+		&i.Capacity,
+		&i.TicketsReserved,
+		&i.PlusOnesAllowed,
+		&i.RegistrationOpen,
+		&i.RegistrationForm,
 	)
 	return i, err
 }
@@ -50,7 +88,7 @@ func (q *Queries) DeleteEvent(ctx context.Context, id int32) error {
 }
 
 const getEvent = `-- name: GetEvent :one
-SELECT id, name, date, location FROM events
+SELECT id, name, date, location, owner_id, reentry_policy, capacity, tickets_reserved, plus_ones_allowed, registration_open, registration_form FROM events
 WHERE id = $1 LIMIT 1
 `
 
@@ -62,12 +100,19 @@ func (q *Queries) GetEvent(ctx context.Context, id int32) (Event, error) {
 		&i.Name,
 		&i.Date,
 		&i.Location,
+		&i.OwnerID,
+		&i.ReentryPolicy,
+		&i.Capacity,
+		&i.TicketsReserved,
+		&i.PlusOnesAllowed,
+		&i.RegistrationOpen,
+		&i.RegistrationForm,
 	)
 	return i, err
 }
 
 const listEvents = `-- name: ListEvents :many
-SELECT id, name, date, location FROM events
+SELECT id, name, date, location, owner_id, reentry_policy, capacity, tickets_reserved, plus_ones_allowed, registration_open, registration_form FROM events
 ORDER BY name
 `
 
@@ -85,6 +130,51 @@ func (q *Queries) ListEvents(ctx context.Context) ([]Event, error) {
 			&i.Name,
 			&i.Date,
 			&i.Location,
+			&i.OwnerID,
+			&i.ReentryPolicy,
+			&i.Capacity,
+			&i.TicketsReserved,
+			&i.PlusOnesAllowed,
+			&i.RegistrationOpen,
+			&i.RegistrationForm,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEventsByOwner = `-- name: ListEventsByOwner :many
+SELECT id, name, date, location, owner_id, reentry_policy, capacity, tickets_reserved, plus_ones_allowed, registration_open, registration_form FROM events
+WHERE owner_id = $1
+ORDER BY name
+`
+
+func (q *Queries) ListEventsByOwner(ctx context.Context, ownerID pgtype.UUID) ([]Event, error) {
+	rows, err := q.db.Query(ctx, listEventsByOwner, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Event
+	for rows.Next() {
+		var i Event
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Date,
+			&i.Location,
+			&i.OwnerID,
+			&i.ReentryPolicy,
+			&i.Capacity,
+			&i.TicketsReserved,
+			&i.PlusOnesAllowed,
+			&i.RegistrationOpen,
+			&i.RegistrationForm,
 		); err != nil {
 			return nil, err
 		}
@@ -96,21 +186,52 @@ func (q *Queries) ListEvents(ctx context.Context) ([]Event, error) {
 	return items, nil
 }
 
+const lockEvent = `-- name: LockEvent :one
+SELECT id, name, date, location, owner_id, reentry_policy, capacity, tickets_reserved, plus_ones_allowed, registration_open, registration_form FROM events WHERE id = $1 FOR UPDATE
+`
+
+// Locks the event row until the end of the transaction, serializing changes
+// to its seats.
+func (q *Queries) LockEvent(ctx context.Context, id int32) (Event, error) {
+	row := q.db.QueryRow(ctx, lockEvent, id)
+	var i Event
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Date,
+		&i.Location,
+		&i.OwnerID,
+		&i.ReentryPolicy,
+		&i.Capacity,
+		&i.TicketsReserved,
+		&i.PlusOnesAllowed,
+		&i.RegistrationOpen,
+		&i.RegistrationForm,
+	)
+	return i, err
+}
+
 const updateEvent = `-- name: UpdateEvent :one
 UPDATE events
 SET
   name = $2,
   date = $3,
-  location = $4
+  location = $4,
+  reentry_policy = $5,
+  capacity = $6,
+  plus_ones_allowed = $7
 WHERE id = $1
-RETURNING id, name, date, location
+RETURNING id, name, date, location, owner_id, reentry_policy, capacity, tickets_reserved, plus_ones_allowed, registration_open, registration_form
 `
 
 type UpdateEventParams struct {
-	ID       int32
-	Name     string
-	Date     pgtype.Timestamp
-	Location string
+	ID              int32
+	Name            string
+	Date            pgtype.Timestamp
+	Location        string
+	ReentryPolicy   string
+	Capacity        int32
+	PlusOnesAllowed int32
 }
 
 func (q *Queries) UpdateEvent(ctx context.Context, arg UpdateEventParams) (Event, error) {
@@ -119,6 +240,9 @@ func (q *Queries) UpdateEvent(ctx context.Context, arg UpdateEventParams) (Event
 		arg.Name,
 		arg.Date,
 		arg.Location,
+		arg.ReentryPolicy,
+		arg.Capacity,
+		arg.PlusOnesAllowed,
 	)
 	var i Event
 	err := row.Scan(
@@ -126,6 +250,47 @@ func (q *Queries) UpdateEvent(ctx context.Context, arg UpdateEventParams) (Event
 		&i.Name,
 		&i.Date,
 		&i.Location,
+		&i.OwnerID,
+		&i.ReentryPolicy,
+		&i.Capacity,
+		&i.TicketsReserved,
+		&i.PlusOnesAllowed,
+		&i.RegistrationOpen,
+		&i.RegistrationForm,
+	)
+	return i, err
+}
+
+const updateEventRegistration = `-- name: UpdateEventRegistration :one
+UPDATE events
+SET
+  registration_open = $2,
+  registration_form = $3
+WHERE id = $1
+RETURNING id, name, date, location, owner_id, reentry_policy, capacity, tickets_reserved, plus_ones_allowed, registration_open, registration_form
+`
+
+type UpdateEventRegistrationParams struct {
+	ID               int32
+	RegistrationOpen bool
+	RegistrationForm json.RawMessage
+}
+
+func (q *Queries) UpdateEventRegistration(ctx context.Context, arg UpdateEventRegistrationParams) (Event, error) {
+	row := q.db.QueryRow(ctx, updateEventRegistration, arg.ID, arg.RegistrationOpen, arg.RegistrationForm)
+	var i Event
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Date,
+		&i.Location,
+		&i.OwnerID,
+		&i.ReentryPolicy,
+		&i.Capacity,
+		&i.TicketsReserved,
+		&i.PlusOnesAllowed,
+		&i.RegistrationOpen,
+		&i.RegistrationForm,
 	)
 	return i, err
 }
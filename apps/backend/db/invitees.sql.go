@@ -7,12 +7,13 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const anonymizeInvitee = `-- name: AnonymizeInvitee :exec
-UPDATE invitees SET email = 'anonymized', qr_code_url = NULL, hmac_signature = NULL, deleted_at = NOW(), anonymized_at = NOW() WHERE id = $1
+UPDATE invitees SET email = 'anonymized', plus_one_names = '{}', qr_code_url = NULL, hmac_signature = NULL, deleted_at = NOW(), anonymized_at = NOW(), updated_at = NOW() WHERE id = $1
 `
 
 func (q *Queries) AnonymizeInvitee(ctx context.Context, id int32) error {
@@ -20,25 +21,137 @@ func (q *Queries) AnonymizeInvitee(ctx context.Context, id int32) error {
 	return err
 }
 
+const claimInviteeGift = `-- name: ClaimInviteeGift :one
+UPDATE invitees
+SET
+  gift_claimed_at = COALESCE(gift_claimed_at, now()),
+  updated_at = now()
+WHERE id = $1
+RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
+`
+
+func (q *Queries) ClaimInviteeGift(ctx context.Context, id int32) (Invitee, error) {
+	row := q.db.QueryRow(ctx, claimInviteeGift, id)
+	var i Invitee
+	err := row.Scan(
+		&i.ID,
+		&i.EventID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.QrCodeUrl,
+		&i.HmacSignature,
+		&i.State,
+		&i.GiftClaimedAt,
+		&i.ExpiresAt,
+		&i.Status,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
+	)
+	return i, err
+}
+
+const claimWaitlistInvitee = `-- name: ClaimWaitlistInvitee :one
+UPDATE invitees
+SET
+  expires_at = NULL,
+  updated_at = now()
+WHERE id = $1
+  AND status = 'pending'
+  AND expires_at > now()
+RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
+`
+
+// Keeps a promoted invitee for good. Returns no rows when its claim window
+// has closed.
+func (q *Queries) ClaimWaitlistInvitee(ctx context.Context, id int32) (Invitee, error) {
+	row := q.db.QueryRow(ctx, claimWaitlistInvitee, id)
+	var i Invitee
+	err := row.Scan(
+		&i.ID,
+		&i.EventID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.QrCodeUrl,
+		&i.HmacSignature,
+		&i.State,
+		&i.GiftClaimedAt,
+		&i.ExpiresAt,
+		&i.Status,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
+	)
+	return i, err
+}
+
 const createInvitee = `-- name: CreateInvitee :one
 INSERT INTO invitees (
   event_id,
   email,
   expires_at,
   status,
+  import_job_id,
+  first_name,
+  last_name,
+  phone,
+  company,
+  tier,
+  tags,
+  custom_fields,
+  import_row,
   deleted_at,
   anonymized_at
 ) VALUES (
-  $1, $2, $3, $4, NULL, NULL
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULL, NULL
 )
-RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at
+RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
 `
 
 type CreateInviteeParams struct {
-	EventID   int32
-	Email     string
-	ExpiresAt pgtype.Timestamptz
-	Status    string
+	EventID      int32
+	Email        string
+	ExpiresAt    pgtype.Timestamptz
+	Status       string
+	ImportJobID  pgtype.UUID
+	FirstName    pgtype.Text
+	LastName     pgtype.Text
+	Phone        pgtype.Text
+	Company      pgtype.Text
+	Tier         pgtype.Text
+	Tags         []string
+	CustomFields json.RawMessage
+	ImportRow    pgtype.Int4
 }
 
 func (q *Queries) CreateInvitee(ctx context.Context, arg CreateInviteeParams) (Invitee, error) {
@@ -47,6 +160,210 @@ func (q *Queries) CreateInvitee(ctx context.Context, arg CreateInviteeParams) (I
 		arg.Email,
 		arg.ExpiresAt,
 		arg.Status,
+		arg.ImportJobID,
+		arg.FirstName,
+		arg.LastName,
+		arg.Phone,
+		arg.Company,
+		arg.Tier,
+		arg.Tags,
+		arg.CustomFields,
+		arg.ImportRow,
+	)
+	var i Invitee
+	err := row.Scan(
+		&i.ID,
+		&i.EventID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.QrCodeUrl,
+		&i.HmacSignature,
+		&i.State,
+		&i.GiftClaimedAt,
+		&i.ExpiresAt,
+		&i.Status,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
+	)
+	return i, err
+}
+
+const createOrderInvitee = `-- name: CreateOrderInvitee :one
+INSERT INTO invitees (event_id, email, first_name, last_name, status, order_id)
+VALUES ($1, $2, $3, $4, 'pending', $5)
+RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
+`
+
+type CreateOrderInviteeParams struct {
+	EventID   int32
+	Email     string
+	FirstName pgtype.Text
+	LastName  pgtype.Text
+	OrderID   pgtype.Int4
+}
+
+func (q *Queries) CreateOrderInvitee(ctx context.Context, arg CreateOrderInviteeParams) (Invitee, error) {
+	row := q.db.QueryRow(ctx, createOrderInvitee,
+		arg.EventID,
+		arg.Email,
+		arg.FirstName,
+		arg.LastName,
+		arg.OrderID,
+	)
+	var i Invitee
+	err := row.Scan(
+		&i.ID,
+		&i.EventID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.QrCodeUrl,
+		&i.HmacSignature,
+		&i.State,
+		&i.GiftClaimedAt,
+		&i.ExpiresAt,
+		&i.Status,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
+	)
+	return i, err
+}
+
+const createRegistrationInvitee = `-- name: CreateRegistrationInvitee :one
+INSERT INTO invitees (
+  event_id, email, first_name, last_name, phone, company, custom_fields,
+  status, rsvp_status, rsvp_at
+)
+SELECT $1, $2, $3, $4, $5, $6, $7, 'pending', 'accepted', now()
+FROM events
+WHERE events.id = $1
+  AND (
+    events.capacity = 0
+    OR events.tickets_reserved + (
+      SELECT COALESCE(SUM(1 + invitees.plus_ones), 0) FROM invitees
+      WHERE invitees.event_id = $1
+        AND invitees.order_id IS NULL
+        AND invitees.deleted_at IS NULL
+        AND invitees.status NOT IN ('cancelled', 'refunded', 'expired')
+        AND invitees.rsvp_status <> 'declined'
+    ) < events.capacity
+  )
+RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
+`
+
+type CreateRegistrationInviteeParams struct {
+	EventID      int32
+	Email        string
+	FirstName    pgtype.Text
+	LastName     pgtype.Text
+	Phone        pgtype.Text
+	Company      pgtype.Text
+	CustomFields json.RawMessage
+}
+
+// Creates the invitee of an approved registration, who accepted by
+// registering, when the event has a free seat. Returns no rows when the
+// event is full.
+func (q *Queries) CreateRegistrationInvitee(ctx context.Context, arg CreateRegistrationInviteeParams) (Invitee, error) {
+	row := q.db.QueryRow(ctx, createRegistrationInvitee,
+		arg.EventID,
+		arg.Email,
+		arg.FirstName,
+		arg.LastName,
+		arg.Phone,
+		arg.Company,
+		arg.CustomFields,
+	)
+	var i Invitee
+	err := row.Scan(
+		&i.ID,
+		&i.EventID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.QrCodeUrl,
+		&i.HmacSignature,
+		&i.State,
+		&i.GiftClaimedAt,
+		&i.ExpiresAt,
+		&i.Status,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
+	)
+	return i, err
+}
+
+const createWaitlistInvitee = `-- name: CreateWaitlistInvitee :one
+INSERT INTO invitees (event_id, email, first_name, last_name, status, expires_at)
+VALUES ($1, $2, $3, $4, 'pending', $5)
+ON CONFLICT (event_id, email) DO NOTHING
+RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
+`
+
+type CreateWaitlistInviteeParams struct {
+	EventID   int32
+	Email     string
+	FirstName pgtype.Text
+	LastName  pgtype.Text
+	ExpiresAt pgtype.Timestamptz
+}
+
+// Creates the invitee of a promoted waitlist entry, expiring at the end of
+// its claim window. Returns no rows when the email was invited some other
+// way since joining.
+func (q *Queries) CreateWaitlistInvitee(ctx context.Context, arg CreateWaitlistInviteeParams) (Invitee, error) {
+	row := q.db.QueryRow(ctx, createWaitlistInvitee,
+		arg.EventID,
+		arg.Email,
+		arg.FirstName,
+		arg.LastName,
+		arg.ExpiresAt,
 	)
 	var i Invitee
 	err := row.Scan(
@@ -63,12 +380,27 @@ func (q *Queries) CreateInvitee(ctx context.Context, arg CreateInviteeParams) (I
 		&i.Status,
 		&i.DeletedAt,
 		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
 	)
 	return i, err
 }
 
 const getExpiredInvitees = `-- name: GetExpiredInvitees :many
-SELECT id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at
+SELECT id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
 FROM invitees
 WHERE expires_at < now() AND status = 'pending'
 `
@@ -96,6 +428,21 @@ func (q *Queries) GetExpiredInvitees(ctx context.Context) ([]Invitee, error) {
 			&i.Status,
 			&i.DeletedAt,
 			&i.AnonymizedAt,
+			&i.ImportJobID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Phone,
+			&i.Company,
+			&i.Tier,
+			&i.Tags,
+			&i.CustomFields,
+			&i.QrIssuedAt,
+			&i.OrderID,
+			&i.RsvpStatus,
+			&i.RsvpAt,
+			&i.PlusOnes,
+			&i.PlusOneNames,
+			&i.ImportRow,
 		); err != nil {
 			return nil, err
 		}
@@ -108,7 +455,7 @@ func (q *Queries) GetExpiredInvitees(ctx context.Context) ([]Invitee, error) {
 }
 
 const getInvitee = `-- name: GetInvitee :one
-SELECT id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at
+SELECT id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
 FROM invitees
 WHERE id = $1
 LIMIT 1
@@ -131,12 +478,75 @@ func (q *Queries) GetInvitee(ctx context.Context, id int32) (Invitee, error) {
 		&i.Status,
 		&i.DeletedAt,
 		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
+	)
+	return i, err
+}
+
+const getInviteeByEventAndEmail = `-- name: GetInviteeByEventAndEmail :one
+SELECT id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
+FROM invitees
+WHERE event_id = $1 AND email = $2
+LIMIT 1
+`
+
+type GetInviteeByEventAndEmailParams struct {
+	EventID int32
+	Email   string
+}
+
+func (q *Queries) GetInviteeByEventAndEmail(ctx context.Context, arg GetInviteeByEventAndEmailParams) (Invitee, error) {
+	row := q.db.QueryRow(ctx, getInviteeByEventAndEmail, arg.EventID, arg.Email)
+	var i Invitee
+	err := row.Scan(
+		&i.ID,
+		&i.EventID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.QrCodeUrl,
+		&i.HmacSignature,
+		&i.State,
+		&i.GiftClaimedAt,
+		&i.ExpiresAt,
+		&i.Status,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
 	)
 	return i, err
 }
 
 const getInviteeBySignature = `-- name: GetInviteeBySignature :one
-SELECT id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at
+SELECT id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
 FROM invitees
 WHERE hmac_signature = $1
 LIMIT 1
@@ -159,12 +569,27 @@ func (q *Queries) GetInviteeBySignature(ctx context.Context, hmacSignature pgtyp
 		&i.Status,
 		&i.DeletedAt,
 		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
 	)
 	return i, err
 }
 
 const getInviteesByEvent = `-- name: GetInviteesByEvent :many
-SELECT id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at
+SELECT id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
 FROM invitees
 WHERE event_id = $1
 ORDER BY id
@@ -193,6 +618,21 @@ func (q *Queries) GetInviteesByEvent(ctx context.Context, eventID int32) ([]Invi
 			&i.Status,
 			&i.DeletedAt,
 			&i.AnonymizedAt,
+			&i.ImportJobID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Phone,
+			&i.Company,
+			&i.Tier,
+			&i.Tags,
+			&i.CustomFields,
+			&i.QrIssuedAt,
+			&i.OrderID,
+			&i.RsvpStatus,
+			&i.RsvpAt,
+			&i.PlusOnes,
+			&i.PlusOneNames,
+			&i.ImportRow,
 		); err != nil {
 			return nil, err
 		}
@@ -204,23 +644,126 @@ func (q *Queries) GetInviteesByEvent(ctx context.Context, eventID int32) ([]Invi
 	return items, nil
 }
 
-const updateInvitee = `-- name: UpdateInvitee :one
+const listInviteesChangedSince = `-- name: ListInviteesChangedSince :many
+SELECT id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
+FROM invitees
+WHERE event_id = $1 AND (
+  updated_at > $2
+  OR id IN (
+    SELECT perk_balances.invitee_id
+    FROM perk_balances
+    JOIN perks ON perks.id = perk_balances.perk_id
+    WHERE perks.event_id = $1 AND perks.name = 'gift' AND perk_balances.updated_at > $2
+  )
+)
+ORDER BY updated_at, id
+`
+
+type ListInviteesChangedSinceParams struct {
+	EventID   int32
+	UpdatedAt pgtype.Timestamptz
+}
+
+// Returns the event's invitees changed after the given time, including those
+// whose gift perk balance changed.
+func (q *Queries) ListInviteesChangedSince(ctx context.Context, arg ListInviteesChangedSinceParams) ([]Invitee, error) {
+	rows, err := q.db.Query(ctx, listInviteesChangedSince, arg.EventID, arg.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Invitee
+	for rows.Next() {
+		var i Invitee
+		if err := rows.Scan(
+			&i.ID,
+			&i.EventID,
+			&i.Email,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.QrCodeUrl,
+			&i.HmacSignature,
+			&i.State,
+			&i.GiftClaimedAt,
+			&i.ExpiresAt,
+			&i.Status,
+			&i.DeletedAt,
+			&i.AnonymizedAt,
+			&i.ImportJobID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Phone,
+			&i.Company,
+			&i.Tier,
+			&i.Tags,
+			&i.CustomFields,
+			&i.QrIssuedAt,
+			&i.OrderID,
+			&i.RsvpStatus,
+			&i.RsvpAt,
+			&i.PlusOnes,
+			&i.PlusOneNames,
+			&i.ImportRow,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const respondInviteeRSVP = `-- name: RespondInviteeRSVP :one
 UPDATE invitees
 SET
-  qr_code_url = $2,
-  hmac_signature = $3
-WHERE id = $1
-RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at
+  rsvp_status = $2,
+  plus_ones = $3,
+  plus_one_names = $4,
+  rsvp_at = now(),
+  updated_at = now()
+FROM events
+WHERE invitees.id = $1
+  AND events.id = invitees.event_id
+  AND invitees.deleted_at IS NULL
+  AND invitees.status NOT IN ('cancelled', 'refunded', 'expired')
+  AND (
+    $2 = 'declined'
+    OR events.capacity = 0
+    OR (invitees.rsvp_status <> 'declined' AND $3 <= invitees.plus_ones)
+    OR events.tickets_reserved + (
+      SELECT COALESCE(SUM(1 + others.plus_ones), 0) FROM invitees others
+      WHERE others.event_id = events.id
+        AND others.id <> invitees.id
+        AND others.order_id IS NULL
+        AND others.deleted_at IS NULL
+        AND others.status NOT IN ('cancelled', 'refunded', 'expired')
+        AND others.rsvp_status <> 'declined'
+    ) + 1 + $3 <= events.capacity
+  )
+RETURNING invitees.*
 `
 
-type UpdateInviteeParams struct {
-	ID            int32
-	QrCodeUrl     pgtype.Text
-	HmacSignature pgtype.Text
+type RespondInviteeRSVPParams struct {
+	ID           int32
+	RsvpStatus   string
+	PlusOnes     int32
+	PlusOneNames []string
 }
 
-func (q *Queries) UpdateInvitee(ctx context.Context, arg UpdateInviteeParams) (Invitee, error) {
-	row := q.db.QueryRow(ctx, updateInvitee, arg.ID, arg.QrCodeUrl, arg.HmacSignature)
+// Records the invitee's answer to the invitation. Unless it declines, the
+// answer takes a seat for the invitee and one per plus-one, and is refused
+// when the event has no room for more seats than the invitee already holds.
+// Returns no rows when it is refused or the invitee was cancelled, refunded,
+// expired or removed.
+func (q *Queries) RespondInviteeRSVP(ctx context.Context, arg RespondInviteeRSVPParams) (Invitee, error) {
+	row := q.db.QueryRow(ctx, respondInviteeRSVP,
+		arg.ID,
+		arg.RsvpStatus,
+		arg.PlusOnes,
+		arg.PlusOneNames,
+	)
 	var i Invitee
 	err := row.Scan(
 		&i.ID,
@@ -236,25 +779,50 @@ func (q *Queries) UpdateInvitee(ctx context.Context, arg UpdateInviteeParams) (I
 		&i.Status,
 		&i.DeletedAt,
 		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
 	)
 	return i, err
 }
 
-const updateInviteeState = `-- name: UpdateInviteeState :one
+const updateInvitee = `-- name: UpdateInvitee :one
 UPDATE invitees
 SET
-  state = $2
+  qr_code_url = $2,
+  hmac_signature = $3,
+  qr_issued_at = $4,
+  updated_at = now()
 WHERE id = $1
-RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at
+RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
 `
 
-type UpdateInviteeStateParams struct {
-	ID    int32
-	State string
+type UpdateInviteeParams struct {
+	ID            int32
+	QrCodeUrl     pgtype.Text
+	HmacSignature pgtype.Text
+	QrIssuedAt    pgtype.Timestamptz
 }
 
-func (q *Queries) UpdateInviteeState(ctx context.Context, arg UpdateInviteeStateParams) (Invitee, error) {
-	row := q.db.QueryRow(ctx, updateInviteeState, arg.ID, arg.State)
+func (q *Queries) UpdateInvitee(ctx context.Context, arg UpdateInviteeParams) (Invitee, error) {
+	row := q.db.QueryRow(ctx, updateInvitee,
+		arg.ID,
+		arg.QrCodeUrl,
+		arg.HmacSignature,
+		arg.QrIssuedAt,
+	)
 	var i Invitee
 	err := row.Scan(
 		&i.ID,
@@ -270,26 +838,41 @@ func (q *Queries) UpdateInviteeState(ctx context.Context, arg UpdateInviteeState
 		&i.Status,
 		&i.DeletedAt,
 		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
 	)
 	return i, err
 }
 
-const updateInviteeStateAndClaimGift = `-- name: UpdateInviteeStateAndClaimGift :one
+const updateInviteeState = `-- name: UpdateInviteeState :one
 UPDATE invitees
 SET
   state = $2,
-  gift_claimed_at = now()
+  updated_at = now()
 WHERE id = $1
-RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at
+RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
 `
 
-type UpdateInviteeStateAndClaimGiftParams struct {
+type UpdateInviteeStateParams struct {
 	ID    int32
 	State string
 }
 
-func (q *Queries) UpdateInviteeStateAndClaimGift(ctx context.Context, arg UpdateInviteeStateAndClaimGiftParams) (Invitee, error) {
-	row := q.db.QueryRow(ctx, updateInviteeStateAndClaimGift, arg.ID, arg.State)
+func (q *Queries) UpdateInviteeState(ctx context.Context, arg UpdateInviteeStateParams) (Invitee, error) {
+	row := q.db.QueryRow(ctx, updateInviteeState, arg.ID, arg.State)
 	var i Invitee
 	err := row.Scan(
 		&i.ID,
@@ -305,6 +888,21 @@ func (q *Queries) UpdateInviteeStateAndClaimGift(ctx context.Context, arg Update
 		&i.Status,
 		&i.DeletedAt,
 		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
 	)
 	return i, err
 }
@@ -312,9 +910,10 @@ func (q *Queries) UpdateInviteeStateAndClaimGift(ctx context.Context, arg Update
 const updateInviteeStatus = `-- name: UpdateInviteeStatus :one
 UPDATE invitees
 SET
-  status = $2
+  status = $2,
+  updated_at = now()
 WHERE id = $1
-RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at
+RETURNING id, event_id, email, created_at, updated_at, qr_code_url, hmac_signature, state, gift_claimed_at, expires_at, status, deleted_at, anonymized_at, import_job_id, first_name, last_name, phone, company, tier, tags, custom_fields, qr_issued_at, order_id, rsvp_status, rsvp_at, plus_ones, plus_one_names, import_row
 `
 
 type UpdateInviteeStatusParams struct {
@@ -339,6 +938,21 @@ func (q *Queries) UpdateInviteeStatus(ctx context.Context, arg UpdateInviteeStat
 		&i.Status,
 		&i.DeletedAt,
 		&i.AnonymizedAt,
+		&i.ImportJobID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Phone,
+		&i.Company,
+		&i.Tier,
+		&i.Tags,
+		&i.CustomFields,
+		&i.QrIssuedAt,
+		&i.OrderID,
+		&i.RsvpStatus,
+		&i.RsvpAt,
+		&i.PlusOnes,
+		&i.PlusOneNames,
+		&i.ImportRow,
 	)
 	return i, err
 }
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'organizer';
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE events DROP COLUMN owner_id;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE events ADD COLUMN owner_id UUID REFERENCES users(id) ON DELETE SET NULL;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE invitees DROP COLUMN import_job_id;
+DROP TABLE import_job_errors;
+DROP TABLE import_jobs;
@@ -0,0 +1,10 @@
+ALTER TABLE import_jobs DROP COLUMN column_mapping;
+
+ALTER TABLE invitees
+DROP COLUMN first_name,
+DROP COLUMN last_name,
+DROP COLUMN phone,
+DROP COLUMN company,
+DROP COLUMN tier,
+DROP COLUMN tags,
+DROP COLUMN custom_fields;
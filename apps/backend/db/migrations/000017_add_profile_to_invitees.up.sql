@@ -0,0 +1,10 @@
+ALTER TABLE invitees
+ADD COLUMN first_name TEXT,
+ADD COLUMN last_name TEXT,
+ADD COLUMN phone TEXT,
+ADD COLUMN company TEXT,
+ADD COLUMN tier VARCHAR(64),
+ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}',
+ADD COLUMN custom_fields JSONB NOT NULL DEFAULT '{}';
+
+ALTER TABLE import_jobs ADD COLUMN column_mapping JSONB;
@@ -0,0 +1 @@
+ALTER TABLE invitees DROP COLUMN qr_issued_at;
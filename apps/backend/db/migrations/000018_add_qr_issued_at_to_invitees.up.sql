@@ -0,0 +1 @@
+ALTER TABLE invitees ADD COLUMN qr_issued_at TIMESTAMPTZ;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS check_ins_device_scan_idx;
+
+ALTER TABLE check_ins
+DROP COLUMN device_id,
+DROP COLUMN outcome,
+DROP COLUMN conflict_device_id;
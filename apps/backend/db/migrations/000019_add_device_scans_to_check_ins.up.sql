@@ -0,0 +1,8 @@
+ALTER TABLE check_ins
+ADD COLUMN device_id TEXT,
+ADD COLUMN outcome VARCHAR(32) NOT NULL DEFAULT 'admitted',
+ADD COLUMN conflict_device_id TEXT;
+
+-- Identifies a scan captured on a device so offline batches can be resent safely.
+-- Unique indexes on a hypertable must include the partitioning column.
+CREATE UNIQUE INDEX check_ins_device_scan_idx ON check_ins (device_id, invitee_id, checked_in_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS invitees_event_updated_at_idx;
@@ -0,0 +1 @@
+CREATE INDEX invitees_event_updated_at_idx ON invitees (event_id, updated_at);
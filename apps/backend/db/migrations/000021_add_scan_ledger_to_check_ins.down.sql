@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS check_ins_invitee_idx;
+DROP INDEX IF EXISTS check_ins_event_idx;
+
+ALTER TABLE check_ins
+DROP COLUMN operator_id,
+DROP COLUMN gate;
+
+DELETE FROM check_ins WHERE event_id IS NULL;
+ALTER TABLE check_ins ALTER COLUMN event_id SET NOT NULL;
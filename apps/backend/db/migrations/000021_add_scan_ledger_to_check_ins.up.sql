@@ -0,0 +1,9 @@
+-- Scans with a forged or unreadable token cannot be attributed to an event
+ALTER TABLE check_ins ALTER COLUMN event_id DROP NOT NULL;
+
+ALTER TABLE check_ins
+ADD COLUMN operator_id UUID REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN gate TEXT;
+
+CREATE INDEX check_ins_event_idx ON check_ins (event_id, checked_in_at DESC);
+CREATE INDEX check_ins_invitee_idx ON check_ins (invitee_id, checked_in_at DESC);
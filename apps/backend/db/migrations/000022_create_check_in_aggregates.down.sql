@@ -0,0 +1,2 @@
+DROP MATERIALIZED VIEW IF EXISTS check_ins_daily;
+DROP MATERIALIZED VIEW IF EXISTS check_ins_hourly;
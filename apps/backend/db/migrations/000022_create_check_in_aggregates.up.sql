@@ -0,0 +1,42 @@
+-- requires: timescaledb
+-- Hypertable unique constraints must include the partitioning column
+ALTER TABLE check_ins DROP CONSTRAINT IF EXISTS check_ins_pkey;
+ALTER TABLE check_ins ADD PRIMARY KEY (id, checked_in_at);
+
+SELECT create_hypertable('check_ins', 'checked_in_at', if_not_exists => TRUE, migrate_data => TRUE);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS check_ins_hourly
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    event_id,
+    gate,
+    time_bucket(INTERVAL '1 hour', checked_in_at) AS bucket,
+    SUM(CASE WHEN outcome = 'admitted' THEN 1 ELSE 0 END) AS admitted,
+    COUNT(*) AS scans
+FROM check_ins
+GROUP BY event_id, gate, time_bucket(INTERVAL '1 hour', checked_in_at)
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS check_ins_daily
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    event_id,
+    gate,
+    time_bucket(INTERVAL '1 day', checked_in_at) AS bucket,
+    SUM(CASE WHEN outcome = 'admitted' THEN 1 ELSE 0 END) AS admitted,
+    COUNT(*) AS scans
+FROM check_ins
+GROUP BY event_id, gate, time_bucket(INTERVAL '1 day', checked_in_at)
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('check_ins_hourly',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '15 minutes',
+    if_not_exists => TRUE);
+
+SELECT add_continuous_aggregate_policy('check_ins_daily',
+    start_offset => INTERVAL '30 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE);
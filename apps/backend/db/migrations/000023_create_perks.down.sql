@@ -0,0 +1,7 @@
+ALTER TABLE check_ins DROP COLUMN perk;
+
+DROP TABLE IF EXISTS perk_redemptions;
+DROP TABLE IF EXISTS perk_balances;
+DROP TABLE IF EXISTS perks;
+
+ALTER TABLE events DROP COLUMN reentry_policy;
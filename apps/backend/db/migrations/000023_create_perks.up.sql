@@ -0,0 +1,46 @@
+-- How often an invitee may enter: once, any number of times, or alternating
+-- entry and exit scans
+ALTER TABLE events ADD COLUMN reentry_policy VARCHAR(16) NOT NULL DEFAULT 'single';
+
+CREATE TABLE perks (
+    id SERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(event_id, name)
+);
+
+-- Redemptions used per invitee and perk. The conditional upsert on this row
+-- keeps concurrent scans from redeeming more than the perk's quantity
+CREATE TABLE perk_balances (
+    invitee_id INTEGER NOT NULL REFERENCES invitees(id) ON DELETE CASCADE,
+    perk_id INTEGER NOT NULL REFERENCES perks(id) ON DELETE CASCADE,
+    redeemed INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (invitee_id, perk_id)
+);
+
+CREATE TABLE perk_redemptions (
+    id SERIAL PRIMARY KEY,
+    perk_id INTEGER NOT NULL REFERENCES perks(id) ON DELETE CASCADE,
+    invitee_id INTEGER NOT NULL REFERENCES invitees(id) ON DELETE CASCADE,
+    redeemed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    device_id TEXT,
+    operator_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    gate TEXT
+);
+
+CREATE INDEX perk_redemptions_invitee_idx ON perk_redemptions (invitee_id, redeemed_at);
+
+-- Perk scans are recorded in the scan ledger too, entry scans leave it NULL
+ALTER TABLE check_ins ADD COLUMN perk VARCHAR(64);
+
+-- Existing events keep one gift per invitee
+INSERT INTO perks (event_id, name, quantity) SELECT id, 'gift', 1 FROM events;
+
+INSERT INTO perk_balances (invitee_id, perk_id, redeemed)
+SELECT invitees.id, perks.id, 1
+FROM invitees JOIN perks ON perks.event_id = invitees.event_id AND perks.name = 'gift'
+WHERE invitees.gift_claimed_at IS NOT NULL;
@@ -0,0 +1,6 @@
+ALTER TABLE check_ins
+DROP COLUMN zone_id,
+DROP COLUMN reason;
+
+DROP TABLE IF EXISTS gates;
+DROP TABLE IF EXISTS zones;
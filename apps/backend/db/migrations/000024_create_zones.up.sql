@@ -0,0 +1,25 @@
+-- Areas of a venue with their own access rules. A zone without tiers is open
+-- to every invitee.
+CREATE TABLE zones (
+    id SERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL,
+    tiers TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(event_id, name)
+);
+
+-- Scanning points, each leading into one zone
+CREATE TABLE gates (
+    id SERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    zone_id INTEGER NOT NULL REFERENCES zones(id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(event_id, name)
+);
+
+ALTER TABLE check_ins
+ADD COLUMN zone_id INTEGER REFERENCES zones(id) ON DELETE SET NULL,
+ADD COLUMN reason TEXT;
@@ -0,0 +1,5 @@
+ALTER TABLE zones
+DROP COLUMN capacity;
+
+ALTER TABLE events
+DROP COLUMN capacity;
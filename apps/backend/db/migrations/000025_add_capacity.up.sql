@@ -0,0 +1,7 @@
+-- Fire-code limits on how many invitees may be inside at once. Zero means no
+-- limit.
+ALTER TABLE events
+ADD COLUMN capacity INTEGER NOT NULL DEFAULT 0 CHECK (capacity >= 0);
+
+ALTER TABLE zones
+ADD COLUMN capacity INTEGER NOT NULL DEFAULT 0 CHECK (capacity >= 0);
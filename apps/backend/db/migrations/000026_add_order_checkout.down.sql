@@ -0,0 +1,14 @@
+ALTER TABLE events
+DROP COLUMN tickets_reserved;
+
+ALTER TABLE invitees
+DROP COLUMN order_id;
+
+DROP TABLE IF EXISTS order_tickets;
+
+DROP INDEX IF EXISTS orders_user_idx;
+
+ALTER TABLE orders
+DROP COLUMN quantity,
+DROP COLUMN created_at,
+DROP COLUMN updated_at;
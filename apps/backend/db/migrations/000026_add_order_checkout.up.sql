@@ -0,0 +1,26 @@
+ALTER TABLE orders
+ADD COLUMN quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX orders_user_idx ON orders (user_id, id DESC);
+
+-- Ticket holders named when reserving. Each becomes an invitee once the
+-- order is confirmed.
+CREATE TABLE order_tickets (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    first_name VARCHAR(255),
+    last_name VARCHAR(255),
+    invitee_id INTEGER REFERENCES invitees(id) ON DELETE SET NULL,
+    UNIQUE(order_id, email)
+);
+
+ALTER TABLE invitees
+ADD COLUMN order_id INTEGER REFERENCES orders(id) ON DELETE SET NULL;
+
+-- Tickets held by pending orders or sold by confirmed ones, kept as a
+-- counter so concurrent reservations are checked against capacity atomically
+ALTER TABLE events
+ADD COLUMN tickets_reserved INTEGER NOT NULL DEFAULT 0 CHECK (tickets_reserved >= 0);
@@ -0,0 +1,9 @@
+ALTER TABLE orders
+DROP COLUMN amount,
+DROP COLUMN currency;
+
+ALTER TABLE order_tickets
+DROP COLUMN ticket_type_id;
+
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS ticket_types;
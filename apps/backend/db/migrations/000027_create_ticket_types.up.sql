@@ -0,0 +1,36 @@
+-- Kinds of tickets sold for an event. Prices are in minor units of the
+-- currency, e.g. cents. reserved counts tickets held by pending orders or
+-- sold by confirmed ones.
+CREATE TABLE ticket_types (
+    id SERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL,
+    price BIGINT NOT NULL DEFAULT 0 CHECK (price >= 0),
+    currency CHAR(3) NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity >= 0),
+    reserved INTEGER NOT NULL DEFAULT 0 CHECK (reserved >= 0),
+    sales_start TIMESTAMPTZ,
+    sales_end TIMESTAMPTZ,
+    max_per_order INTEGER NOT NULL DEFAULT 10 CHECK (max_per_order > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(event_id, name)
+);
+
+-- Line items of an order, priced when the order was placed
+CREATE TABLE order_items (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    ticket_type_id INTEGER NOT NULL REFERENCES ticket_types(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    UNIQUE(order_id, ticket_type_id)
+);
+
+ALTER TABLE order_tickets
+ADD COLUMN ticket_type_id INTEGER REFERENCES ticket_types(id);
+
+ALTER TABLE orders
+ADD COLUMN amount BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN currency CHAR(3);
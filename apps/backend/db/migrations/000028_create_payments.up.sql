@@ -0,0 +1,24 @@
+-- Payment intents created with a payment provider for orders
+CREATE TABLE payments (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    provider VARCHAR(32) NOT NULL,
+    intent_id VARCHAR(255) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(provider, intent_id)
+);
+
+CREATE INDEX payments_order_idx ON payments (order_id);
+
+-- Webhook deliveries already handled, so redeliveries are ignored
+CREATE TABLE payment_webhook_events (
+    provider VARCHAR(32) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, event_id)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE payments DROP COLUMN IF EXISTS refunded_amount;
+DROP TABLE IF EXISTS ticket_changes;
@@ -0,0 +1,21 @@
+-- Audit trail of cancelled, transferred and refunded tickets
+CREATE TABLE ticket_changes (
+    id SERIAL PRIMARY KEY,
+    invitee_id INTEGER NOT NULL REFERENCES invitees(id) ON DELETE CASCADE,
+    event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    action VARCHAR(16) NOT NULL,
+    previous_email VARCHAR(255),
+    previous_first_name TEXT,
+    previous_last_name TEXT,
+    new_email VARCHAR(255),
+    amount BIGINT NOT NULL DEFAULT 0,
+    currency CHAR(3),
+    reason TEXT,
+    user_id UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ticket_changes_invitee_idx ON ticket_changes (invitee_id, id);
+
+-- Part of a captured payment returned by ticket refunds
+ALTER TABLE payments ADD COLUMN refunded_amount BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,21 @@
+-- People waiting for a seat at a full event, promoted to invitees as seats free up
+CREATE TABLE waitlist_entries (
+    id SERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    first_name TEXT,
+    last_name TEXT,
+    priority INTEGER NOT NULL DEFAULT 0,
+    status VARCHAR(16) NOT NULL DEFAULT 'waiting',
+    user_id UUID REFERENCES users(id),
+    invitee_id INTEGER REFERENCES invitees(id) ON DELETE SET NULL,
+    claim_token_hash VARCHAR(64) UNIQUE,
+    claim_expires_at TIMESTAMPTZ,
+    promoted_at TIMESTAMPTZ,
+    claimed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(event_id, email)
+);
+
+CREATE INDEX waitlist_entries_queue_idx ON waitlist_entries (event_id, priority DESC, created_at, id) WHERE status = 'waiting';
+CREATE INDEX waitlist_entries_invitee_idx ON waitlist_entries (invitee_id);
@@ -0,0 +1,8 @@
+ALTER TABLE events
+DROP COLUMN plus_ones_allowed;
+
+ALTER TABLE invitees
+DROP COLUMN plus_one_names,
+DROP COLUMN plus_ones,
+DROP COLUMN rsvp_at,
+DROP COLUMN rsvp_status;
@@ -0,0 +1,11 @@
+-- Invitees answer their invitation through signed RSVP links. Declined
+-- invitees give their seat back and accepted ones may bring plus-ones, up to
+-- the event's allowance, who take seats too.
+ALTER TABLE invitees
+ADD COLUMN rsvp_status VARCHAR(16) NOT NULL DEFAULT 'awaiting',
+ADD COLUMN rsvp_at TIMESTAMPTZ,
+ADD COLUMN plus_ones INTEGER NOT NULL DEFAULT 0 CHECK (plus_ones >= 0),
+ADD COLUMN plus_one_names TEXT[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE events
+ADD COLUMN plus_ones_allowed INTEGER NOT NULL DEFAULT 0 CHECK (plus_ones_allowed >= 0);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS registrations;
+
+ALTER TABLE events
+DROP COLUMN registration_form,
+DROP COLUMN registration_open;
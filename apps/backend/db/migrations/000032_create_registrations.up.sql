@@ -0,0 +1,31 @@
+-- Events open to self-registration and the form registrants fill in
+ALTER TABLE events
+ADD COLUMN registration_open BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN registration_form JSONB NOT NULL DEFAULT '{}';
+
+-- Self-registrations for open events. They become invitees once the email
+-- address is verified and, when the event requires it, an organizer approved
+-- them.
+CREATE TABLE registrations (
+    id SERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    first_name TEXT,
+    last_name TEXT,
+    phone TEXT,
+    company TEXT,
+    custom_fields JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(16) NOT NULL DEFAULT 'unverified',
+    verification_token_hash VARCHAR(64) NOT NULL UNIQUE,
+    verification_expires_at TIMESTAMPTZ NOT NULL,
+    verified_at TIMESTAMPTZ,
+    reviewed_by UUID REFERENCES users(id),
+    reviewed_at TIMESTAMPTZ,
+    invitee_id INTEGER REFERENCES invitees(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(event_id, email)
+);
+
+CREATE INDEX registrations_event_status_idx ON registrations (event_id, status, id);
+CREATE INDEX registrations_invitee_idx ON registrations (invitee_id);
@@ -0,0 +1,3 @@
+ALTER TABLE import_jobs DROP COLUMN lease_id;
+
+ALTER TABLE invitees DROP COLUMN import_row;
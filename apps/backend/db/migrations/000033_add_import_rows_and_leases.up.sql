@@ -0,0 +1,8 @@
+-- The CSV row each imported invitee came from, so later rows repeating its
+-- email address are reported as duplicates, also when an import resumes
+ALTER TABLE invitees ADD COLUMN import_row INTEGER;
+
+-- The worker run holding an import job. Progress is only recorded under the
+-- current lease, so a worker whose lease lapsed stops instead of running the
+-- job alongside the worker that claimed it next.
+ALTER TABLE import_jobs ADD COLUMN lease_id UUID;
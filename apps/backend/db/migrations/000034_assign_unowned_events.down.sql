@@ -0,0 +1 @@
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'organizer';
@@ -0,0 +1,8 @@
+-- Events created before owners were recorded are invisible to organizers,
+-- so hand them to the earliest admin until an admin reassigns them
+UPDATE events
+SET owner_id = (SELECT id FROM users WHERE role = 'admin' ORDER BY created_at, id LIMIT 1)
+WHERE owner_id IS NULL;
+
+-- Accounts that sign up themselves get no access to events
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'attendee';
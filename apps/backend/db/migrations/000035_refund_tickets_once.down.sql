@@ -0,0 +1 @@
+DROP INDEX IF EXISTS ticket_changes_refunded_once;
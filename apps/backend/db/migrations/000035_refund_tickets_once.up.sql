@@ -0,0 +1,4 @@
+-- A ticket is refunded at most once. Recording a refund inserts its change
+-- and adds to the payment in one statement, so a concurrent retry that loses
+-- the insert leaves the payment alone.
+CREATE UNIQUE INDEX ticket_changes_refunded_once ON ticket_changes (invitee_id) WHERE action = 'refunded';
@@ -0,0 +1 @@
+COMMENT ON COLUMN events.capacity IS NULL;
@@ -0,0 +1,6 @@
+-- An event's capacity is both the fire-code limit on how many invitees may
+-- be inside at once and the limit on the seats handed out through sold
+-- tickets, accepted invitations with their plus-ones, registrations and
+-- waitlist promotions. A venue seats no more people than it may hold, so
+-- both limits are the same number. Zero means no limit.
+COMMENT ON COLUMN events.capacity IS 'Limit on invitees inside at once and on seats handed out, 0 for no limit';
@@ -5,23 +5,76 @@
 package db
 
 import (
+	"encoding/json"
+
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type CheckIn struct {
-	ID          int32
-	EventID     int32
-	InviteeID   pgtype.Int4
-	CheckedInAt pgtype.Timestamptz
-	CreatedAt   pgtype.Timestamptz
-	UpdatedAt   pgtype.Timestamptz
+	ID               int32
+	EventID          pgtype.Int4
+	InviteeID        pgtype.Int4
+	CheckedInAt      pgtype.Timestamptz
+	CreatedAt        pgtype.Timestamptz
+	UpdatedAt        pgtype.Timestamptz
+	DeviceID         pgtype.Text
+	Outcome          string
+	ConflictDeviceID pgtype.Text
+	OperatorID       pgtype.UUID
+	Gate             pgtype.Text
+	Perk             pgtype.Text
+	ZoneID           pgtype.Int4
+	Reason           pgtype.Text
 }
 
 type Event struct {
-	ID       int32
-	Name     string
-	Date     pgtype.Timestamp
-	Location string
+	ID               int32
+	Name             string
+	Date             pgtype.Timestamp
+	Location         string
+	OwnerID          pgtype.UUID
+	ReentryPolicy    string
+	Capacity         int32
+	TicketsReserved  int32
+	PlusOnesAllowed  int32
+	RegistrationOpen bool
+	RegistrationForm json.RawMessage
+}
+
+type Gate struct {
+	ID        int32
+	EventID   int32
+	ZoneID    int32
+	Name      string
+	CreatedAt pgtype.Timestamptz
+}
+
+type ImportJob struct {
+	ID            pgtype.UUID
+	EventID       int32
+	CreatedBy     pgtype.UUID
+	ObjectName    string
+	Status        string
+	TotalRows     int32
+	ProcessedRows int32
+	SucceededRows int32
+	FailedRows    int32
+	Error         pgtype.Text
+	LockedUntil   pgtype.Timestamptz
+	CreatedAt     pgtype.Timestamptz
+	UpdatedAt     pgtype.Timestamptz
+	CompletedAt   pgtype.Timestamptz
+	ColumnMapping json.RawMessage
+	LeaseID       pgtype.UUID
+}
+
+type ImportJobError struct {
+	ID        int32
+	JobID     pgtype.UUID
+	RowNumber int32
+	Email     string
+	Reason    string
+	CreatedAt pgtype.Timestamptz
 }
 
 type Invitee struct {
@@ -38,6 +91,21 @@ type Invitee struct {
 	Status        string
 	DeletedAt     pgtype.Timestamptz
 	AnonymizedAt  pgtype.Timestamptz
+	ImportJobID   pgtype.UUID
+	FirstName     pgtype.Text
+	LastName      pgtype.Text
+	Phone         pgtype.Text
+	Company       pgtype.Text
+	Tier          pgtype.Text
+	Tags          []string
+	CustomFields  json.RawMessage
+	QrIssuedAt    pgtype.Timestamptz
+	OrderID       pgtype.Int4
+	RsvpStatus    string
+	RsvpAt        pgtype.Timestamptz
+	PlusOnes      int32
+	PlusOneNames  []string
+	ImportRow     pgtype.Int4
 }
 
 type Order struct {
@@ -48,6 +116,96 @@ type Order struct {
 	ExpiresAt    pgtype.Timestamptz
 	DeletedAt    pgtype.Timestamptz
 	AnonymizedAt pgtype.Timestamptz
+	Quantity     int32
+	CreatedAt    pgtype.Timestamptz
+	UpdatedAt    pgtype.Timestamptz
+	Amount       int64
+	Currency     pgtype.Text
+}
+
+type OrderItem struct {
+	ID           int32
+	OrderID      int32
+	TicketTypeID int32
+	Quantity     int32
+	UnitPrice    int64
+	Currency     string
+}
+
+type OrderTicket struct {
+	ID           int32
+	OrderID      int32
+	Email        string
+	FirstName    pgtype.Text
+	LastName     pgtype.Text
+	InviteeID    pgtype.Int4
+	TicketTypeID pgtype.Int4
+}
+
+type Payment struct {
+	ID             int32
+	OrderID        int32
+	Provider       string
+	IntentID       string
+	Status         string
+	Amount         int64
+	Currency       string
+	CreatedAt      pgtype.Timestamptz
+	UpdatedAt      pgtype.Timestamptz
+	RefundedAmount int64
+}
+
+type PaymentWebhookEvent struct {
+	Provider   string
+	EventID    string
+	EventType  string
+	ReceivedAt pgtype.Timestamptz
+}
+
+type Perk struct {
+	ID        int32
+	EventID   int32
+	Name      string
+	Quantity  int32
+	CreatedAt pgtype.Timestamptz
+	UpdatedAt pgtype.Timestamptz
+}
+
+type PerkBalance struct {
+	InviteeID int32
+	PerkID    int32
+	Redeemed  int32
+	UpdatedAt pgtype.Timestamptz
+}
+
+type PerkRedemption struct {
+	ID         int32
+	PerkID     int32
+	InviteeID  int32
+	RedeemedAt pgtype.Timestamptz
+	DeviceID   pgtype.Text
+	OperatorID pgtype.UUID
+	Gate       pgtype.Text
+}
+
+type Registration struct {
+	ID                    int32
+	EventID               int32
+	Email                 string
+	FirstName             pgtype.Text
+	LastName              pgtype.Text
+	Phone                 pgtype.Text
+	Company               pgtype.Text
+	CustomFields          json.RawMessage
+	Status                string
+	VerificationTokenHash string
+	VerificationExpiresAt pgtype.Timestamptz
+	VerifiedAt            pgtype.Timestamptz
+	ReviewedBy            pgtype.UUID
+	ReviewedAt            pgtype.Timestamptz
+	InviteeID             pgtype.Int4
+	CreatedAt             pgtype.Timestamptz
+	UpdatedAt             pgtype.Timestamptz
 }
 
 type ReprintRequest struct {
@@ -57,6 +215,37 @@ type ReprintRequest struct {
 	CreatedAt pgtype.Timestamp
 }
 
+type TicketChange struct {
+	ID                int32
+	InviteeID         int32
+	EventID           int32
+	Action            string
+	PreviousEmail     pgtype.Text
+	PreviousFirstName pgtype.Text
+	PreviousLastName  pgtype.Text
+	NewEmail          pgtype.Text
+	Amount            int64
+	Currency          pgtype.Text
+	Reason            pgtype.Text
+	UserID            pgtype.UUID
+	CreatedAt         pgtype.Timestamptz
+}
+
+type TicketType struct {
+	ID          int32
+	EventID     int32
+	Name        string
+	Price       int64
+	Currency    string
+	Quantity    int32
+	Reserved    int32
+	SalesStart  pgtype.Timestamptz
+	SalesEnd    pgtype.Timestamptz
+	MaxPerOrder int32
+	CreatedAt   pgtype.Timestamptz
+	UpdatedAt   pgtype.Timestamptz
+}
+
 type User struct {
 	ID           pgtype.UUID
 	Email        string
@@ -65,4 +254,32 @@ type User struct {
 	UpdatedAt    pgtype.Timestamptz
 	DeletedAt    pgtype.Timestamptz
 	AnonymizedAt pgtype.Timestamptz
+	Role         string
+}
+
+type WaitlistEntry struct {
+	ID             int32
+	EventID        int32
+	Email          string
+	FirstName      pgtype.Text
+	LastName       pgtype.Text
+	Priority       int32
+	Status         string
+	UserID         pgtype.UUID
+	InviteeID      pgtype.Int4
+	ClaimTokenHash pgtype.Text
+	ClaimExpiresAt pgtype.Timestamptz
+	PromotedAt     pgtype.Timestamptz
+	ClaimedAt      pgtype.Timestamptz
+	CreatedAt      pgtype.Timestamptz
+}
+
+type Zone struct {
+	ID        int32
+	EventID   int32
+	Name      string
+	Tiers     []string
+	CreatedAt pgtype.Timestamptz
+	UpdatedAt pgtype.Timestamptz
+	Capacity  int32
 }
@@ -20,8 +20,40 @@ func (q *Queries) AnonymizeOrder(ctx context.Context, id int32) error {
 	return err
 }
 
+const confirmOrder = `-- name: ConfirmOrder :one
+UPDATE orders
+SET
+  status = 'confirmed',
+  updated_at = now()
+WHERE id = $1
+  AND status = 'pending'
+  AND expires_at > now()
+RETURNING id, user_id, event_id, status, expires_at, deleted_at, anonymized_at, quantity, created_at, updated_at, amount, currency
+`
+
+// Returns no rows unless the order is pending and its hold has not expired.
+func (q *Queries) ConfirmOrder(ctx context.Context, id int32) (Order, error) {
+	row := q.db.QueryRow(ctx, confirmOrder, id)
+	var i Order
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.EventID,
+		&i.Status,
+		&i.ExpiresAt,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.Quantity,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Amount,
+		&i.Currency,
+	)
+	return i, err
+}
+
 const createOrder = `-- name: CreateOrder :one
-INSERT INTO orders (user_id, event_id, status, expires_at, deleted_at, anonymized_at) VALUES ($1, $2, $3, $4, NULL, NULL) RETURNING id, user_id, event_id, status, expires_at, deleted_at, anonymized_at
+INSERT INTO orders (user_id, event_id, status, expires_at, deleted_at, anonymized_at) VALUES ($1, $2, $3, $4, NULL, NULL) RETURNING id, user_id, event_id, status, expires_at, deleted_at, anonymized_at, quantity, created_at, updated_at, amount, currency
 `
 
 type CreateOrderParams struct {
@@ -47,12 +79,52 @@ func (q *Queries) CreateOrder(ctx context.Context, arg CreateOrderParams) (Order
 		&i.ExpiresAt,
 		&i.DeletedAt,
 		&i.AnonymizedAt,
+		&i.Quantity,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Amount,
+		&i.Currency,
+	)
+	return i, err
+}
+
+const createOrderTicket = `-- name: CreateOrderTicket :one
+INSERT INTO order_tickets (order_id, email, first_name, last_name, ticket_type_id)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, order_id, email, first_name, last_name, invitee_id, ticket_type_id
+`
+
+type CreateOrderTicketParams struct {
+	OrderID      int32
+	Email        string
+	FirstName    pgtype.Text
+	LastName     pgtype.Text
+	TicketTypeID pgtype.Int4
+}
+
+func (q *Queries) CreateOrderTicket(ctx context.Context, arg CreateOrderTicketParams) (OrderTicket, error) {
+	row := q.db.QueryRow(ctx, createOrderTicket,
+		arg.OrderID,
+		arg.Email,
+		arg.FirstName,
+		arg.LastName,
+		arg.TicketTypeID,
+	)
+	var i OrderTicket
+	err := row.Scan(
+		&i.ID,
+		&i.OrderID,
+		&i.Email,
+		&i.FirstName,
+		&i.LastName,
+		&i.InviteeID,
+		&i.TicketTypeID,
 	)
 	return i, err
 }
 
 const getExpiredOrders = `-- name: GetExpiredOrders :many
-SELECT id, user_id, event_id, status, expires_at, deleted_at, anonymized_at
+SELECT id, user_id, event_id, status, expires_at, deleted_at, anonymized_at, quantity, created_at, updated_at, amount, currency
 FROM orders
 WHERE expires_at < now() AND status = 'pending'
 `
@@ -74,6 +146,109 @@ func (q *Queries) GetExpiredOrders(ctx context.Context) ([]Order, error) {
 			&i.ExpiresAt,
 			&i.DeletedAt,
 			&i.AnonymizedAt,
+			&i.Quantity,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Amount,
+			&i.Currency,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOrder = `-- name: GetOrder :one
+SELECT id, user_id, event_id, status, expires_at, deleted_at, anonymized_at, quantity, created_at, updated_at, amount, currency FROM orders
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetOrder(ctx context.Context, id int32) (Order, error) {
+	row := q.db.QueryRow(ctx, getOrder, id)
+	var i Order
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.EventID,
+		&i.Status,
+		&i.ExpiresAt,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.Quantity,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Amount,
+		&i.Currency,
+	)
+	return i, err
+}
+
+const listOrderTickets = `-- name: ListOrderTickets :many
+SELECT id, order_id, email, first_name, last_name, invitee_id, ticket_type_id FROM order_tickets
+WHERE order_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListOrderTickets(ctx context.Context, orderID int32) ([]OrderTicket, error) {
+	rows, err := q.db.Query(ctx, listOrderTickets, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []OrderTicket
+	for rows.Next() {
+		var i OrderTicket
+		if err := rows.Scan(
+			&i.ID,
+			&i.OrderID,
+			&i.Email,
+			&i.FirstName,
+			&i.LastName,
+			&i.InviteeID,
+			&i.TicketTypeID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOrdersByUser = `-- name: ListOrdersByUser :many
+SELECT id, user_id, event_id, status, expires_at, deleted_at, anonymized_at, quantity, created_at, updated_at, amount, currency FROM orders
+WHERE user_id = $1 AND deleted_at IS NULL
+ORDER BY id DESC
+`
+
+func (q *Queries) ListOrdersByUser(ctx context.Context, userID pgtype.UUID) ([]Order, error) {
+	rows, err := q.db.Query(ctx, listOrdersByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Order
+	for rows.Next() {
+		var i Order
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.EventID,
+			&i.Status,
+			&i.ExpiresAt,
+			&i.DeletedAt,
+			&i.AnonymizedAt,
+			&i.Quantity,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Amount,
+			&i.Currency,
 		); err != nil {
 			return nil, err
 		}
@@ -85,12 +260,207 @@ func (q *Queries) GetExpiredOrders(ctx context.Context) ([]Order, error) {
 	return items, nil
 }
 
+const markOrderPaid = `-- name: MarkOrderPaid :one
+UPDATE orders
+SET
+  status = 'paid',
+  updated_at = now()
+WHERE id = $1
+  AND status = 'pending'
+RETURNING id, user_id, event_id, status, expires_at, deleted_at, anonymized_at, quantity, created_at, updated_at, amount, currency
+`
+
+// Returns no rows unless the order is pending.
+func (q *Queries) MarkOrderPaid(ctx context.Context, id int32) (Order, error) {
+	row := q.db.QueryRow(ctx, markOrderPaid, id)
+	var i Order
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.EventID,
+		&i.Status,
+		&i.ExpiresAt,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.Quantity,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Amount,
+		&i.Currency,
+	)
+	return i, err
+}
+
+const releaseOrder = `-- name: ReleaseOrder :one
+WITH released AS (
+  UPDATE orders
+  SET
+    status = $2,
+    updated_at = now()
+  WHERE orders.id = $1
+    AND orders.status = 'pending'
+  RETURNING id, user_id, event_id, status, expires_at, deleted_at, anonymized_at, quantity, created_at, updated_at, amount, currency
+), restocked AS (
+  UPDATE events
+  SET tickets_reserved = GREATEST(events.tickets_reserved - released.quantity, 0)
+  FROM released
+  WHERE events.id = released.event_id
+), restocked_types AS (
+  UPDATE ticket_types
+  SET reserved = GREATEST(ticket_types.reserved - order_items.quantity, 0)
+  FROM order_items, released
+  WHERE order_items.order_id = released.id
+    AND ticket_types.id = order_items.ticket_type_id
+)
+SELECT id, user_id, event_id, status, expires_at, deleted_at, anonymized_at, quantity, created_at, updated_at, amount, currency FROM released
+`
+
+type ReleaseOrderParams struct {
+	ID     int32
+	Status string
+}
+
+// Moves a pending order to the given status and returns its tickets to the
+// event and its ticket types. Returns no rows when the order is not pending.
+func (q *Queries) ReleaseOrder(ctx context.Context, arg ReleaseOrderParams) (Order, error) {
+	row := q.db.QueryRow(ctx, releaseOrder, arg.ID, arg.Status)
+	var i Order
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.EventID,
+		&i.Status,
+		&i.ExpiresAt,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.Quantity,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Amount,
+		&i.Currency,
+	)
+	return i, err
+}
+
+const reserveOrder = `-- name: ReserveOrder :one
+WITH reserved AS (
+  UPDATE events
+  SET tickets_reserved = events.tickets_reserved + $3
+  WHERE events.id = $2
+    AND (
+      events.capacity = 0
+      OR events.tickets_reserved + $3 + (
+        SELECT COALESCE(SUM(1 + invitees.plus_ones), 0) FROM invitees
+        WHERE invitees.event_id = $2
+          AND invitees.order_id IS NULL
+          AND invitees.deleted_at IS NULL
+          AND invitees.status NOT IN ('cancelled', 'refunded', 'expired')
+          AND invitees.rsvp_status <> 'declined'
+      ) <= events.capacity
+    )
+  RETURNING events.id
+)
+INSERT INTO orders (user_id, event_id, status, quantity, expires_at)
+SELECT $1, reserved.id, 'pending', $3, $4
+FROM reserved
+RETURNING id, user_id, event_id, status, expires_at, deleted_at, anonymized_at, quantity, created_at, updated_at, amount, currency
+`
+
+type ReserveOrderParams struct {
+	UserID    pgtype.UUID
+	EventID   int32
+	Quantity  int32
+	ExpiresAt pgtype.Timestamptz
+}
+
+// Holds the tickets against the event's capacity and creates the pending
+// order in one statement. Returns no rows when the event does not exist or
+// has too few tickets left. Invitees added without an order count against
+// the capacity too with their plus-ones, unless they were cancelled, expired
+// or declined.
+func (q *Queries) ReserveOrder(ctx context.Context, arg ReserveOrderParams) (Order, error) {
+	row := q.db.QueryRow(ctx, reserveOrder,
+		arg.UserID,
+		arg.EventID,
+		arg.Quantity,
+		arg.ExpiresAt,
+	)
+	var i Order
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.EventID,
+		&i.Status,
+		&i.ExpiresAt,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.Quantity,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Amount,
+		&i.Currency,
+	)
+	return i, err
+}
+
+const setOrderTicketInvitee = `-- name: SetOrderTicketInvitee :exec
+UPDATE order_tickets
+SET invitee_id = $2
+WHERE id = $1
+`
+
+type SetOrderTicketInviteeParams struct {
+	ID        int32
+	InviteeID pgtype.Int4
+}
+
+func (q *Queries) SetOrderTicketInvitee(ctx context.Context, arg SetOrderTicketInviteeParams) error {
+	_, err := q.db.Exec(ctx, setOrderTicketInvitee, arg.ID, arg.InviteeID)
+	return err
+}
+
+const setOrderTotal = `-- name: SetOrderTotal :one
+UPDATE orders
+SET
+  amount = $2,
+  currency = $3,
+  updated_at = now()
+WHERE id = $1
+RETURNING id, user_id, event_id, status, expires_at, deleted_at, anonymized_at, quantity, created_at, updated_at, amount, currency
+`
+
+type SetOrderTotalParams struct {
+	ID       int32
+	Amount   int64
+	Currency pgtype.Text
+}
+
+func (q *Queries) SetOrderTotal(ctx context.Context, arg SetOrderTotalParams) (Order, error) {
+	row := q.db.QueryRow(ctx, setOrderTotal, arg.ID, arg.Amount, arg.Currency)
+	var i Order
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.EventID,
+		&i.Status,
+		&i.ExpiresAt,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.Quantity,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Amount,
+		&i.Currency,
+	)
+	return i, err
+}
+
 const updateOrderStatus = `-- name: UpdateOrderStatus :one
 UPDATE orders
 SET
   status = $2
 WHERE id = $1
-RETURNING id, user_id, event_id, status, expires_at, deleted_at, anonymized_at
+RETURNING id, user_id, event_id, status, expires_at, deleted_at, anonymized_at, quantity, created_at, updated_at, amount, currency
 `
 
 type UpdateOrderStatusParams struct {
@@ -109,6 +479,11 @@ func (q *Queries) UpdateOrderStatus(ctx context.Context, arg UpdateOrderStatusPa
 		&i.ExpiresAt,
 		&i.DeletedAt,
 		&i.AnonymizedAt,
+		&i.Quantity,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Amount,
+		&i.Currency,
 	)
 	return i, err
 }
@@ -8,30 +8,133 @@ import (
 )
 
 type Querier interface {
+	AdmitInvitee(ctx context.Context, arg AdmitInviteeParams) (CheckIn, error)
 	AnonymizeInvitee(ctx context.Context, id int32) error
 	AnonymizeOrder(ctx context.Context, id int32) error
+	AnonymizeTicketChanges(ctx context.Context, inviteeID int32) error
 	AnonymizeUser(ctx context.Context, id pgtype.UUID) error
+	AssignUnownedEvents(ctx context.Context) (int64, error)
+	CancelInvitee(ctx context.Context, id int32) (Invitee, error)
+	ClaimImportJob(ctx context.Context, leaseID pgtype.UUID) (ImportJob, error)
+	ClaimInviteeGift(ctx context.Context, id int32) (Invitee, error)
+	ClaimPaymentWebhookEvent(ctx context.Context, arg ClaimPaymentWebhookEventParams) (PaymentWebhookEvent, error)
+	ClaimWaitlistEntry(ctx context.Context, id int32) (WaitlistEntry, error)
+	ClaimWaitlistInvitee(ctx context.Context, id int32) (Invitee, error)
+	CompleteImportJob(ctx context.Context, arg CompleteImportJobParams) (int64, error)
+	ConfirmOrder(ctx context.Context, id int32) (Order, error)
+	CreateCheckIn(ctx context.Context, arg CreateCheckInParams) (CheckIn, error)
 	CreateEvent(ctx context.Context, arg CreateEventParams) (Event, error)
+	CreateGate(ctx context.Context, arg CreateGateParams) (Gate, error)
+	CreateImportJob(ctx context.Context, arg CreateImportJobParams) (ImportJob, error)
+	CreateImportJobError(ctx context.Context, arg CreateImportJobErrorParams) error
 	CreateInvitee(ctx context.Context, arg CreateInviteeParams) (Invitee, error)
 	CreateOrder(ctx context.Context, arg CreateOrderParams) (Order, error)
+	CreateOrderInvitee(ctx context.Context, arg CreateOrderInviteeParams) (Invitee, error)
+	CreateOrderTicket(ctx context.Context, arg CreateOrderTicketParams) (OrderTicket, error)
+	CreatePerk(ctx context.Context, arg CreatePerkParams) (Perk, error)
+	CreateRegistration(ctx context.Context, arg CreateRegistrationParams) (Registration, error)
+	CreateRegistrationInvitee(ctx context.Context, arg CreateRegistrationInviteeParams) (Invitee, error)
 	CreateReprintRequest(ctx context.Context, arg CreateReprintRequestParams) (ReprintRequest, error)
+	CreateTicketChange(ctx context.Context, arg CreateTicketChangeParams) (TicketChange, error)
+	CreateTicketType(ctx context.Context, arg CreateTicketTypeParams) (TicketType, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateWaitlistInvitee(ctx context.Context, arg CreateWaitlistInviteeParams) (Invitee, error)
+	CreateZone(ctx context.Context, arg CreateZoneParams) (Zone, error)
 	DeleteEvent(ctx context.Context, id int32) error
+	DeleteGate(ctx context.Context, id int32) error
+	DeletePerk(ctx context.Context, id int32) error
+	DeleteRegistrationsByInvitee(ctx context.Context, inviteeID pgtype.Int4) error
+	DeleteTicketType(ctx context.Context, id int32) error
+	DeleteZone(ctx context.Context, id int32) error
+	ExitInvitee(ctx context.Context, arg ExitInviteeParams) (CheckIn, error)
+	FailImportJob(ctx context.Context, arg FailImportJobParams) error
+	GetAdmissionCheckIn(ctx context.Context, inviteeID pgtype.Int4) (CheckIn, error)
+	GetCapturedPaymentByOrder(ctx context.Context, orderID int32) (Payment, error)
+	GetCheckInByDeviceScan(ctx context.Context, arg GetCheckInByDeviceScanParams) (CheckIn, error)
 	GetEvent(ctx context.Context, id int32) (Event, error)
+	GetEventAttendance(ctx context.Context, eventID int32) (GetEventAttendanceRow, error)
 	GetExpiredInvitees(ctx context.Context) ([]Invitee, error)
 	GetExpiredOrders(ctx context.Context) ([]Order, error)
+	GetGate(ctx context.Context, id int32) (Gate, error)
+	GetGateByName(ctx context.Context, arg GetGateByNameParams) (Gate, error)
+	GetImportJob(ctx context.Context, id pgtype.UUID) (ImportJob, error)
 	GetInvitee(ctx context.Context, id int32) (Invitee, error)
+	GetInviteeByEventAndEmail(ctx context.Context, arg GetInviteeByEventAndEmailParams) (Invitee, error)
 	GetInviteeBySignature(ctx context.Context, hmacSignature pgtype.Text) (Invitee, error)
 	GetInviteesByEvent(ctx context.Context, eventID int32) ([]Invitee, error)
+	GetOrder(ctx context.Context, id int32) (Order, error)
+	GetOrderTicketByInvitee(ctx context.Context, inviteeID pgtype.Int4) (OrderTicket, error)
+	GetPaymentByIntent(ctx context.Context, arg GetPaymentByIntentParams) (Payment, error)
+	GetPerk(ctx context.Context, id int32) (Perk, error)
+	GetRegistration(ctx context.Context, id int32) (Registration, error)
+	GetRegistrationByVerificationToken(ctx context.Context, verificationTokenHash string) (Registration, error)
+	GetTicketType(ctx context.Context, id int32) (TicketType, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	GetUserByID(ctx context.Context, id pgtype.UUID) (User, error)
+	GetWaitlistEntry(ctx context.Context, id int32) (WaitlistEntry, error)
+	GetWaitlistEntryByClaimToken(ctx context.Context, claimTokenHash pgtype.Text) (WaitlistEntry, error)
+	GetWaitlistEntryByInvitee(ctx context.Context, inviteeID pgtype.Int4) (WaitlistEntry, error)
+	GetZone(ctx context.Context, id int32) (Zone, error)
+	GetZoneByName(ctx context.Context, arg GetZoneByNameParams) (Zone, error)
+	JoinWaitlist(ctx context.Context, arg JoinWaitlistParams) (WaitlistEntry, error)
+	LapseWaitlistEntry(ctx context.Context, id int32) error
+	LeaveWaitlist(ctx context.Context, id int32) (WaitlistEntry, error)
+	ListCheckInConflictsByEvent(ctx context.Context, eventID pgtype.Int4) ([]CheckIn, error)
+	ListCheckInsByEvent(ctx context.Context, arg ListCheckInsByEventParams) ([]CheckIn, error)
+	ListCheckInsByInvitee(ctx context.Context, inviteeID pgtype.Int4) ([]CheckIn, error)
+	ListEventOccupants(ctx context.Context, eventID pgtype.Int4) ([]ListEventOccupantsRow, error)
 	ListEvents(ctx context.Context) ([]Event, error)
+	ListEventsByOwner(ctx context.Context, ownerID pgtype.UUID) ([]Event, error)
+	ListEventsWithRecentCheckIns(ctx context.Context, checkedInAt pgtype.Timestamptz) ([]pgtype.Int4, error)
+	ListGatesByEvent(ctx context.Context, eventID int32) ([]Gate, error)
+	ListGiftBalancesByEvent(ctx context.Context, eventID int32) ([]ListGiftBalancesByEventRow, error)
+	ListImportJobErrors(ctx context.Context, jobID pgtype.UUID) ([]ImportJobError, error)
+	ListInviteePerks(ctx context.Context, arg ListInviteePerksParams) ([]ListInviteePerksRow, error)
+	ListInviteesChangedSince(ctx context.Context, arg ListInviteesChangedSinceParams) ([]Invitee, error)
+	ListOrderItems(ctx context.Context, orderID int32) ([]OrderItem, error)
+	ListOrderTickets(ctx context.Context, orderID int32) ([]OrderTicket, error)
+	ListOrdersByUser(ctx context.Context, userID pgtype.UUID) ([]Order, error)
+	ListPaymentsByOrder(ctx context.Context, orderID int32) ([]Payment, error)
+	ListPerkRedemptionsByInvitee(ctx context.Context, inviteeID int32) ([]PerkRedemption, error)
+	ListPerksByEvent(ctx context.Context, eventID int32) ([]Perk, error)
+	ListRegistrationsByEvent(ctx context.Context, eventID int32) ([]Registration, error)
+	ListTicketChanges(ctx context.Context, inviteeID int32) ([]TicketChange, error)
+	ListTicketTypesByEvent(ctx context.Context, eventID int32) ([]TicketType, error)
+	ListWaitlistByEvent(ctx context.Context, eventID int32) ([]WaitlistEntry, error)
+	ListZonesByEvent(ctx context.Context, eventID int32) ([]Zone, error)
+	LockEvent(ctx context.Context, id int32) (Event, error)
+	MarkOrderPaid(ctx context.Context, id int32) (Order, error)
+	PromoteWaitlistEntry(ctx context.Context, arg PromoteWaitlistEntryParams) (WaitlistEntry, error)
+	RecordTicketRefund(ctx context.Context, arg RecordTicketRefundParams) (TicketChange, error)
+	RedeemPerk(ctx context.Context, arg RedeemPerkParams) (PerkRedemption, error)
+	RefundInvitee(ctx context.Context, id int32) (Invitee, error)
+	ReleaseOrder(ctx context.Context, arg ReleaseOrderParams) (Order, error)
+	ReleasePaymentWebhookEvent(ctx context.Context, arg ReleasePaymentWebhookEventParams) error
+	ReserveOrder(ctx context.Context, arg ReserveOrderParams) (Order, error)
+	ReserveOrderItem(ctx context.Context, arg ReserveOrderItemParams) (OrderItem, error)
+	RespondInviteeRSVP(ctx context.Context, arg RespondInviteeRSVPParams) (Invitee, error)
+	RetryImportJob(ctx context.Context, id pgtype.UUID) (ImportJob, error)
+	ReviewRegistration(ctx context.Context, arg ReviewRegistrationParams) (Registration, error)
+	SetImportJobTotalRows(ctx context.Context, arg SetImportJobTotalRowsParams) error
+	SetOrderTicketInvitee(ctx context.Context, arg SetOrderTicketInviteeParams) error
+	SetOrderTotal(ctx context.Context, arg SetOrderTotalParams) (Order, error)
+	SetPaymentStatus(ctx context.Context, arg SetPaymentStatusParams) (Payment, error)
+	SetRegistrationOutcome(ctx context.Context, arg SetRegistrationOutcomeParams) (Registration, error)
+	SetWaitlistEntryInvitee(ctx context.Context, arg SetWaitlistEntryInviteeParams) error
+	TransferInvitee(ctx context.Context, arg TransferInviteeParams) (Invitee, error)
 	UpdateEvent(ctx context.Context, arg UpdateEventParams) (Event, error)
+	UpdateEventRegistration(ctx context.Context, arg UpdateEventRegistrationParams) (Event, error)
+	UpdateImportJobProgress(ctx context.Context, arg UpdateImportJobProgressParams) (int64, error)
 	UpdateInvitee(ctx context.Context, arg UpdateInviteeParams) (Invitee, error)
 	UpdateInviteeState(ctx context.Context, arg UpdateInviteeStateParams) (Invitee, error)
-	UpdateInviteeStateAndClaimGift(ctx context.Context, arg UpdateInviteeStateAndClaimGiftParams) (Invitee, error)
 	UpdateInviteeStatus(ctx context.Context, arg UpdateInviteeStatusParams) (Invitee, error)
 	UpdateOrderStatus(ctx context.Context, arg UpdateOrderStatusParams) (Order, error)
+	UpdatePerk(ctx context.Context, arg UpdatePerkParams) (Perk, error)
+	UpdateTicketType(ctx context.Context, arg UpdateTicketTypeParams) (TicketType, error)
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error)
+	UpdateZone(ctx context.Context, arg UpdateZoneParams) (Zone, error)
+	UpsertPayment(ctx context.Context, arg UpsertPaymentParams) (Payment, error)
+	VerifyRegistration(ctx context.Context, arg VerifyRegistrationParams) (Registration, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -9,30 +9,137 @@ import (
 var _ Querier = (*MockQuerier)(nil)
 
 type MockQuerier struct {
+	AdmitInviteeFunc                 func(ctx context.Context, arg AdmitInviteeParams) (CheckIn, error)
 	AnonymizeInviteeFunc             func(ctx context.Context, id int32) error
 	AnonymizeOrderFunc               func(ctx context.Context, id int32) error
+	AnonymizeTicketChangesFunc       func(ctx context.Context, inviteeID int32) error
 	AnonymizeUserFunc                func(ctx context.Context, id pgtype.UUID) error
+	AssignUnownedEventsFunc          func(ctx context.Context) (int64, error)
+	CancelInviteeFunc                func(ctx context.Context, id int32) (Invitee, error)
+	ClaimImportJobFunc               func(ctx context.Context, leaseID pgtype.UUID) (ImportJob, error)
+	ClaimInviteeGiftFunc             func(ctx context.Context, id int32) (Invitee, error)
+	ClaimPaymentWebhookEventFunc     func(ctx context.Context, arg ClaimPaymentWebhookEventParams) (PaymentWebhookEvent, error)
+	ClaimWaitlistEntryFunc           func(ctx context.Context, id int32) (WaitlistEntry, error)
+	ClaimWaitlistInviteeFunc         func(ctx context.Context, id int32) (Invitee, error)
+	CompleteImportJobFunc            func(ctx context.Context, arg CompleteImportJobParams) (int64, error)
+	ConfirmOrderFunc                 func(ctx context.Context, id int32) (Order, error)
+	CreateCheckInFunc                func(ctx context.Context, arg CreateCheckInParams) (CheckIn, error)
 	CreateEventFunc                  func(ctx context.Context, arg CreateEventParams) (Event, error)
+	CreateGateFunc                   func(ctx context.Context, arg CreateGateParams) (Gate, error)
+	CreateImportJobFunc              func(ctx context.Context, arg CreateImportJobParams) (ImportJob, error)
+	CreateImportJobErrorFunc         func(ctx context.Context, arg CreateImportJobErrorParams) error
 	CreateInviteeFunc                func(ctx context.Context, arg CreateInviteeParams) (Invitee, error)
 	CreateOrderFunc                  func(ctx context.Context, arg CreateOrderParams) (Order, error)
+	CreateOrderInviteeFunc           func(ctx context.Context, arg CreateOrderInviteeParams) (Invitee, error)
+	CreateOrderTicketFunc            func(ctx context.Context, arg CreateOrderTicketParams) (OrderTicket, error)
+	CreatePerkFunc                   func(ctx context.Context, arg CreatePerkParams) (Perk, error)
+	CreateRegistrationFunc           func(ctx context.Context, arg CreateRegistrationParams) (Registration, error)
+	CreateRegistrationInviteeFunc    func(ctx context.Context, arg CreateRegistrationInviteeParams) (Invitee, error)
 	CreateReprintRequestFunc         func(ctx context.Context, arg CreateReprintRequestParams) (ReprintRequest, error)
+	CreateTicketChangeFunc           func(ctx context.Context, arg CreateTicketChangeParams) (TicketChange, error)
+	CreateTicketTypeFunc             func(ctx context.Context, arg CreateTicketTypeParams) (TicketType, error)
 	CreateUserFunc                   func(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateWaitlistInviteeFunc        func(ctx context.Context, arg CreateWaitlistInviteeParams) (Invitee, error)
+	CreateZoneFunc                   func(ctx context.Context, arg CreateZoneParams) (Zone, error)
 	DeleteEventFunc                  func(ctx context.Context, id int32) error
+	DeleteGateFunc                   func(ctx context.Context, id int32) error
+	DeletePerkFunc                   func(ctx context.Context, id int32) error
+	DeleteRegistrationsByInviteeFunc func(ctx context.Context, inviteeID pgtype.Int4) error
+	DeleteTicketTypeFunc             func(ctx context.Context, id int32) error
+	DeleteZoneFunc                   func(ctx context.Context, id int32) error
+	ExitInviteeFunc                  func(ctx context.Context, arg ExitInviteeParams) (CheckIn, error)
+	FailImportJobFunc                func(ctx context.Context, arg FailImportJobParams) error
+	GetAdmissionCheckInFunc          func(ctx context.Context, inviteeID pgtype.Int4) (CheckIn, error)
+	GetCapturedPaymentByOrderFunc    func(ctx context.Context, orderID int32) (Payment, error)
+	GetCheckInByDeviceScanFunc       func(ctx context.Context, arg GetCheckInByDeviceScanParams) (CheckIn, error)
 	GetEventFunc                     func(ctx context.Context, id int32) (Event, error)
+	GetEventAttendanceFunc           func(ctx context.Context, eventID int32) (GetEventAttendanceRow, error)
 	GetExpiredInviteesFunc           func(ctx context.Context) ([]Invitee, error)
 	GetExpiredOrdersFunc             func(ctx context.Context) ([]Order, error)
+	GetGateFunc                      func(ctx context.Context, id int32) (Gate, error)
+	GetGateByNameFunc                func(ctx context.Context, arg GetGateByNameParams) (Gate, error)
+	GetImportJobFunc                 func(ctx context.Context, id pgtype.UUID) (ImportJob, error)
 	GetInviteeFunc                   func(ctx context.Context, id int32) (Invitee, error)
+	GetInviteeByEventAndEmailFunc    func(ctx context.Context, arg GetInviteeByEventAndEmailParams) (Invitee, error)
 	GetInviteeBySignatureFunc        func(ctx context.Context, hmacSignature pgtype.Text) (Invitee, error)
 	GetInviteesByEventFunc           func(ctx context.Context, eventID int32) ([]Invitee, error)
+	GetOrderFunc                     func(ctx context.Context, id int32) (Order, error)
+	GetOrderTicketByInviteeFunc      func(ctx context.Context, inviteeID pgtype.Int4) (OrderTicket, error)
+	GetPaymentByIntentFunc           func(ctx context.Context, arg GetPaymentByIntentParams) (Payment, error)
+	GetPerkFunc                      func(ctx context.Context, id int32) (Perk, error)
+	GetRegistrationFunc              func(ctx context.Context, id int32) (Registration, error)
+	GetRegistrationByVerificationTokenFunc func(ctx context.Context, verificationTokenHash string) (Registration, error)
+	GetTicketTypeFunc                func(ctx context.Context, id int32) (TicketType, error)
 	GetUserByEmailFunc               func(ctx context.Context, email string) (User, error)
 	GetUserByIDFunc                  func(ctx context.Context, id pgtype.UUID) (User, error)
+	GetWaitlistEntryFunc             func(ctx context.Context, id int32) (WaitlistEntry, error)
+	GetWaitlistEntryByClaimTokenFunc func(ctx context.Context, claimTokenHash pgtype.Text) (WaitlistEntry, error)
+	GetWaitlistEntryByInviteeFunc    func(ctx context.Context, inviteeID pgtype.Int4) (WaitlistEntry, error)
+	GetZoneFunc                      func(ctx context.Context, id int32) (Zone, error)
+	GetZoneByNameFunc                func(ctx context.Context, arg GetZoneByNameParams) (Zone, error)
+	JoinWaitlistFunc                 func(ctx context.Context, arg JoinWaitlistParams) (WaitlistEntry, error)
+	LapseWaitlistEntryFunc           func(ctx context.Context, id int32) error
+	LeaveWaitlistFunc                func(ctx context.Context, id int32) (WaitlistEntry, error)
+	ListCheckInConflictsByEventFunc  func(ctx context.Context, eventID pgtype.Int4) ([]CheckIn, error)
+	ListCheckInsByEventFunc          func(ctx context.Context, arg ListCheckInsByEventParams) ([]CheckIn, error)
+	ListCheckInsByInviteeFunc        func(ctx context.Context, inviteeID pgtype.Int4) ([]CheckIn, error)
+	ListEventOccupantsFunc           func(ctx context.Context, eventID pgtype.Int4) ([]ListEventOccupantsRow, error)
 	ListEventsFunc                   func(ctx context.Context) ([]Event, error)
+	ListEventsByOwnerFunc            func(ctx context.Context, ownerID pgtype.UUID) ([]Event, error)
+	ListEventsWithRecentCheckInsFunc func(ctx context.Context, checkedInAt pgtype.Timestamptz) ([]pgtype.Int4, error)
+	ListGatesByEventFunc             func(ctx context.Context, eventID int32) ([]Gate, error)
+	ListGiftBalancesByEventFunc      func(ctx context.Context, eventID int32) ([]ListGiftBalancesByEventRow, error)
+	ListImportJobErrorsFunc          func(ctx context.Context, jobID pgtype.UUID) ([]ImportJobError, error)
+	ListInviteePerksFunc             func(ctx context.Context, arg ListInviteePerksParams) ([]ListInviteePerksRow, error)
+	ListInviteesChangedSinceFunc     func(ctx context.Context, arg ListInviteesChangedSinceParams) ([]Invitee, error)
+	ListOrderItemsFunc               func(ctx context.Context, orderID int32) ([]OrderItem, error)
+	ListOrderTicketsFunc             func(ctx context.Context, orderID int32) ([]OrderTicket, error)
+	ListOrdersByUserFunc             func(ctx context.Context, userID pgtype.UUID) ([]Order, error)
+	ListPaymentsByOrderFunc          func(ctx context.Context, orderID int32) ([]Payment, error)
+	ListPerkRedemptionsByInviteeFunc func(ctx context.Context, inviteeID int32) ([]PerkRedemption, error)
+	ListPerksByEventFunc             func(ctx context.Context, eventID int32) ([]Perk, error)
+	ListRegistrationsByEventFunc     func(ctx context.Context, eventID int32) ([]Registration, error)
+	ListTicketChangesFunc            func(ctx context.Context, inviteeID int32) ([]TicketChange, error)
+	ListTicketTypesByEventFunc       func(ctx context.Context, eventID int32) ([]TicketType, error)
+	ListWaitlistByEventFunc          func(ctx context.Context, eventID int32) ([]WaitlistEntry, error)
+	ListZonesByEventFunc             func(ctx context.Context, eventID int32) ([]Zone, error)
+	LockEventFunc                    func(ctx context.Context, id int32) (Event, error)
+	MarkOrderPaidFunc                func(ctx context.Context, id int32) (Order, error)
+	PromoteWaitlistEntryFunc         func(ctx context.Context, arg PromoteWaitlistEntryParams) (WaitlistEntry, error)
+	RecordTicketRefundFunc           func(ctx context.Context, arg RecordTicketRefundParams) (TicketChange, error)
+	RedeemPerkFunc                   func(ctx context.Context, arg RedeemPerkParams) (PerkRedemption, error)
+	RefundInviteeFunc                func(ctx context.Context, id int32) (Invitee, error)
+	ReleaseOrderFunc                 func(ctx context.Context, arg ReleaseOrderParams) (Order, error)
+	ReleasePaymentWebhookEventFunc   func(ctx context.Context, arg ReleasePaymentWebhookEventParams) error
+	ReserveOrderFunc                 func(ctx context.Context, arg ReserveOrderParams) (Order, error)
+	ReserveOrderItemFunc             func(ctx context.Context, arg ReserveOrderItemParams) (OrderItem, error)
+	RespondInviteeRSVPFunc           func(ctx context.Context, arg RespondInviteeRSVPParams) (Invitee, error)
+	RetryImportJobFunc               func(ctx context.Context, id pgtype.UUID) (ImportJob, error)
+	ReviewRegistrationFunc           func(ctx context.Context, arg ReviewRegistrationParams) (Registration, error)
+	SetImportJobTotalRowsFunc        func(ctx context.Context, arg SetImportJobTotalRowsParams) error
+	SetOrderTicketInviteeFunc        func(ctx context.Context, arg SetOrderTicketInviteeParams) error
+	SetOrderTotalFunc                func(ctx context.Context, arg SetOrderTotalParams) (Order, error)
+	SetPaymentStatusFunc             func(ctx context.Context, arg SetPaymentStatusParams) (Payment, error)
+	SetRegistrationOutcomeFunc       func(ctx context.Context, arg SetRegistrationOutcomeParams) (Registration, error)
+	SetWaitlistEntryInviteeFunc      func(ctx context.Context, arg SetWaitlistEntryInviteeParams) error
+	TransferInviteeFunc              func(ctx context.Context, arg TransferInviteeParams) (Invitee, error)
 	UpdateEventFunc                  func(ctx context.Context, arg UpdateEventParams) (Event, error)
+	UpdateEventRegistrationFunc      func(ctx context.Context, arg UpdateEventRegistrationParams) (Event, error)
+	UpdateImportJobProgressFunc      func(ctx context.Context, arg UpdateImportJobProgressParams) (int64, error)
 	UpdateInviteeFunc                func(ctx context.Context, arg UpdateInviteeParams) (Invitee, error)
 	UpdateInviteeStateFunc           func(ctx context.Context, arg UpdateInviteeStateParams) (Invitee, error)
-	UpdateInviteeStateAndClaimGiftFunc func(ctx context.Context, arg UpdateInviteeStateAndClaimGiftParams) (Invitee, error)
 	UpdateInviteeStatusFunc          func(ctx context.Context, arg UpdateInviteeStatusParams) (Invitee, error)
 	UpdateOrderStatusFunc            func(ctx context.Context, arg UpdateOrderStatusParams) (Order, error)
+	UpdatePerkFunc                   func(ctx context.Context, arg UpdatePerkParams) (Perk, error)
+	UpdateTicketTypeFunc             func(ctx context.Context, arg UpdateTicketTypeParams) (TicketType, error)
+	UpdateUserRoleFunc               func(ctx context.Context, arg UpdateUserRoleParams) (User, error)
+	UpdateZoneFunc                   func(ctx context.Context, arg UpdateZoneParams) (Zone, error)
+	UpsertPaymentFunc                func(ctx context.Context, arg UpsertPaymentParams) (Payment, error)
+	VerifyRegistrationFunc           func(ctx context.Context, arg VerifyRegistrationParams) (Registration, error)
+}
+
+func (m *MockQuerier) AdmitInvitee(ctx context.Context, arg AdmitInviteeParams) (CheckIn, error) {
+	return m.AdmitInviteeFunc(ctx, arg)
 }
 
 func (m *MockQuerier) AnonymizeInvitee(ctx context.Context, id int32) error {
@@ -43,14 +150,70 @@ func (m *MockQuerier) AnonymizeOrder(ctx context.Context, id int32) error {
 	return m.AnonymizeOrderFunc(ctx, id)
 }
 
+func (m *MockQuerier) AnonymizeTicketChanges(ctx context.Context, inviteeID int32) error {
+	return m.AnonymizeTicketChangesFunc(ctx, inviteeID)
+}
+
 func (m *MockQuerier) AnonymizeUser(ctx context.Context, id pgtype.UUID) error {
 	return m.AnonymizeUserFunc(ctx, id)
 }
 
+func (m *MockQuerier) AssignUnownedEvents(ctx context.Context) (int64, error) {
+	return m.AssignUnownedEventsFunc(ctx)
+}
+
+func (m *MockQuerier) CancelInvitee(ctx context.Context, id int32) (Invitee, error) {
+	return m.CancelInviteeFunc(ctx, id)
+}
+
+func (m *MockQuerier) ClaimImportJob(ctx context.Context, leaseID pgtype.UUID) (ImportJob, error) {
+	return m.ClaimImportJobFunc(ctx, leaseID)
+}
+
+func (m *MockQuerier) ClaimInviteeGift(ctx context.Context, id int32) (Invitee, error) {
+	return m.ClaimInviteeGiftFunc(ctx, id)
+}
+
+func (m *MockQuerier) ClaimPaymentWebhookEvent(ctx context.Context, arg ClaimPaymentWebhookEventParams) (PaymentWebhookEvent, error) {
+	return m.ClaimPaymentWebhookEventFunc(ctx, arg)
+}
+
+func (m *MockQuerier) ClaimWaitlistEntry(ctx context.Context, id int32) (WaitlistEntry, error) {
+	return m.ClaimWaitlistEntryFunc(ctx, id)
+}
+
+func (m *MockQuerier) ClaimWaitlistInvitee(ctx context.Context, id int32) (Invitee, error) {
+	return m.ClaimWaitlistInviteeFunc(ctx, id)
+}
+
+func (m *MockQuerier) CompleteImportJob(ctx context.Context, arg CompleteImportJobParams) (int64, error) {
+	return m.CompleteImportJobFunc(ctx, arg)
+}
+
+func (m *MockQuerier) ConfirmOrder(ctx context.Context, id int32) (Order, error) {
+	return m.ConfirmOrderFunc(ctx, id)
+}
+
+func (m *MockQuerier) CreateCheckIn(ctx context.Context, arg CreateCheckInParams) (CheckIn, error) {
+	return m.CreateCheckInFunc(ctx, arg)
+}
+
 func (m *MockQuerier) CreateEvent(ctx context.Context, arg CreateEventParams) (Event, error) {
 	return m.CreateEventFunc(ctx, arg)
 }
 
+func (m *MockQuerier) CreateGate(ctx context.Context, arg CreateGateParams) (Gate, error) {
+	return m.CreateGateFunc(ctx, arg)
+}
+
+func (m *MockQuerier) CreateImportJob(ctx context.Context, arg CreateImportJobParams) (ImportJob, error) {
+	return m.CreateImportJobFunc(ctx, arg)
+}
+
+func (m *MockQuerier) CreateImportJobError(ctx context.Context, arg CreateImportJobErrorParams) error {
+	return m.CreateImportJobErrorFunc(ctx, arg)
+}
+
 func (m *MockQuerier) CreateInvitee(ctx context.Context, arg CreateInviteeParams) (Invitee, error) {
 	return m.CreateInviteeFunc(ctx, arg)
 }
@@ -59,22 +222,102 @@ func (m *MockQuerier) CreateOrder(ctx context.Context, arg CreateOrderParams) (O
 	return m.CreateOrderFunc(ctx, arg)
 }
 
+func (m *MockQuerier) CreateOrderInvitee(ctx context.Context, arg CreateOrderInviteeParams) (Invitee, error) {
+	return m.CreateOrderInviteeFunc(ctx, arg)
+}
+
+func (m *MockQuerier) CreateOrderTicket(ctx context.Context, arg CreateOrderTicketParams) (OrderTicket, error) {
+	return m.CreateOrderTicketFunc(ctx, arg)
+}
+
+func (m *MockQuerier) CreatePerk(ctx context.Context, arg CreatePerkParams) (Perk, error) {
+	return m.CreatePerkFunc(ctx, arg)
+}
+
+func (m *MockQuerier) CreateRegistration(ctx context.Context, arg CreateRegistrationParams) (Registration, error) {
+	return m.CreateRegistrationFunc(ctx, arg)
+}
+
+func (m *MockQuerier) CreateRegistrationInvitee(ctx context.Context, arg CreateRegistrationInviteeParams) (Invitee, error) {
+	return m.CreateRegistrationInviteeFunc(ctx, arg)
+}
+
 func (m *MockQuerier) CreateReprintRequest(ctx context.Context, arg CreateReprintRequestParams) (ReprintRequest, error) {
 	return m.CreateReprintRequestFunc(ctx, arg)
 }
 
+func (m *MockQuerier) CreateTicketChange(ctx context.Context, arg CreateTicketChangeParams) (TicketChange, error) {
+	return m.CreateTicketChangeFunc(ctx, arg)
+}
+
+func (m *MockQuerier) CreateTicketType(ctx context.Context, arg CreateTicketTypeParams) (TicketType, error) {
+	return m.CreateTicketTypeFunc(ctx, arg)
+}
+
 func (m *MockQuerier) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
 	return m.CreateUserFunc(ctx, arg)
 }
 
+func (m *MockQuerier) CreateWaitlistInvitee(ctx context.Context, arg CreateWaitlistInviteeParams) (Invitee, error) {
+	return m.CreateWaitlistInviteeFunc(ctx, arg)
+}
+
+func (m *MockQuerier) CreateZone(ctx context.Context, arg CreateZoneParams) (Zone, error) {
+	return m.CreateZoneFunc(ctx, arg)
+}
+
 func (m *MockQuerier) DeleteEvent(ctx context.Context, id int32) error {
 	return m.DeleteEventFunc(ctx, id)
 }
 
+func (m *MockQuerier) DeleteGate(ctx context.Context, id int32) error {
+	return m.DeleteGateFunc(ctx, id)
+}
+
+func (m *MockQuerier) DeletePerk(ctx context.Context, id int32) error {
+	return m.DeletePerkFunc(ctx, id)
+}
+
+func (m *MockQuerier) DeleteRegistrationsByInvitee(ctx context.Context, inviteeID pgtype.Int4) error {
+	return m.DeleteRegistrationsByInviteeFunc(ctx, inviteeID)
+}
+
+func (m *MockQuerier) DeleteTicketType(ctx context.Context, id int32) error {
+	return m.DeleteTicketTypeFunc(ctx, id)
+}
+
+func (m *MockQuerier) DeleteZone(ctx context.Context, id int32) error {
+	return m.DeleteZoneFunc(ctx, id)
+}
+
+func (m *MockQuerier) ExitInvitee(ctx context.Context, arg ExitInviteeParams) (CheckIn, error) {
+	return m.ExitInviteeFunc(ctx, arg)
+}
+
+func (m *MockQuerier) FailImportJob(ctx context.Context, arg FailImportJobParams) error {
+	return m.FailImportJobFunc(ctx, arg)
+}
+
+func (m *MockQuerier) GetAdmissionCheckIn(ctx context.Context, inviteeID pgtype.Int4) (CheckIn, error) {
+	return m.GetAdmissionCheckInFunc(ctx, inviteeID)
+}
+
+func (m *MockQuerier) GetCapturedPaymentByOrder(ctx context.Context, orderID int32) (Payment, error) {
+	return m.GetCapturedPaymentByOrderFunc(ctx, orderID)
+}
+
+func (m *MockQuerier) GetCheckInByDeviceScan(ctx context.Context, arg GetCheckInByDeviceScanParams) (CheckIn, error) {
+	return m.GetCheckInByDeviceScanFunc(ctx, arg)
+}
+
 func (m *MockQuerier) GetEvent(ctx context.Context, id int32) (Event, error) {
 	return m.GetEventFunc(ctx, id)
 }
 
+func (m *MockQuerier) GetEventAttendance(ctx context.Context, eventID int32) (GetEventAttendanceRow, error) {
+	return m.GetEventAttendanceFunc(ctx, eventID)
+}
+
 func (m *MockQuerier) GetExpiredInvitees(ctx context.Context) ([]Invitee, error) {
 	return m.GetExpiredInviteesFunc(ctx)
 }
@@ -83,10 +326,26 @@ func (m *MockQuerier) GetExpiredOrders(ctx context.Context) ([]Order, error) {
 	return m.GetExpiredOrdersFunc(ctx)
 }
 
+func (m *MockQuerier) GetGate(ctx context.Context, id int32) (Gate, error) {
+	return m.GetGateFunc(ctx, id)
+}
+
+func (m *MockQuerier) GetGateByName(ctx context.Context, arg GetGateByNameParams) (Gate, error) {
+	return m.GetGateByNameFunc(ctx, arg)
+}
+
+func (m *MockQuerier) GetImportJob(ctx context.Context, id pgtype.UUID) (ImportJob, error) {
+	return m.GetImportJobFunc(ctx, id)
+}
+
 func (m *MockQuerier) GetInvitee(ctx context.Context, id int32) (Invitee, error) {
 	return m.GetInviteeFunc(ctx, id)
 }
 
+func (m *MockQuerier) GetInviteeByEventAndEmail(ctx context.Context, arg GetInviteeByEventAndEmailParams) (Invitee, error) {
+	return m.GetInviteeByEventAndEmailFunc(ctx, arg)
+}
+
 func (m *MockQuerier) GetInviteeBySignature(ctx context.Context, hmacSignature pgtype.Text) (Invitee, error) {
 	return m.GetInviteeBySignatureFunc(ctx, hmacSignature)
 }
@@ -95,6 +354,34 @@ func (m *MockQuerier) GetInviteesByEvent(ctx context.Context, eventID int32) ([]
 	return m.GetInviteesByEventFunc(ctx, eventID)
 }
 
+func (m *MockQuerier) GetOrder(ctx context.Context, id int32) (Order, error) {
+	return m.GetOrderFunc(ctx, id)
+}
+
+func (m *MockQuerier) GetOrderTicketByInvitee(ctx context.Context, inviteeID pgtype.Int4) (OrderTicket, error) {
+	return m.GetOrderTicketByInviteeFunc(ctx, inviteeID)
+}
+
+func (m *MockQuerier) GetPaymentByIntent(ctx context.Context, arg GetPaymentByIntentParams) (Payment, error) {
+	return m.GetPaymentByIntentFunc(ctx, arg)
+}
+
+func (m *MockQuerier) GetPerk(ctx context.Context, id int32) (Perk, error) {
+	return m.GetPerkFunc(ctx, id)
+}
+
+func (m *MockQuerier) GetRegistration(ctx context.Context, id int32) (Registration, error) {
+	return m.GetRegistrationFunc(ctx, id)
+}
+
+func (m *MockQuerier) GetRegistrationByVerificationToken(ctx context.Context, verificationTokenHash string) (Registration, error) {
+	return m.GetRegistrationByVerificationTokenFunc(ctx, verificationTokenHash)
+}
+
+func (m *MockQuerier) GetTicketType(ctx context.Context, id int32) (TicketType, error) {
+	return m.GetTicketTypeFunc(ctx, id)
+}
+
 func (m *MockQuerier) GetUserByEmail(ctx context.Context, email string) (User, error) {
 	return m.GetUserByEmailFunc(ctx, email)
 }
@@ -103,14 +390,222 @@ func (m *MockQuerier) GetUserByID(ctx context.Context, id pgtype.UUID) (User, er
 	return m.GetUserByIDFunc(ctx, id)
 }
 
+func (m *MockQuerier) GetWaitlistEntry(ctx context.Context, id int32) (WaitlistEntry, error) {
+	return m.GetWaitlistEntryFunc(ctx, id)
+}
+
+func (m *MockQuerier) GetWaitlistEntryByClaimToken(ctx context.Context, claimTokenHash pgtype.Text) (WaitlistEntry, error) {
+	return m.GetWaitlistEntryByClaimTokenFunc(ctx, claimTokenHash)
+}
+
+func (m *MockQuerier) GetWaitlistEntryByInvitee(ctx context.Context, inviteeID pgtype.Int4) (WaitlistEntry, error) {
+	return m.GetWaitlistEntryByInviteeFunc(ctx, inviteeID)
+}
+
+func (m *MockQuerier) GetZone(ctx context.Context, id int32) (Zone, error) {
+	return m.GetZoneFunc(ctx, id)
+}
+
+func (m *MockQuerier) GetZoneByName(ctx context.Context, arg GetZoneByNameParams) (Zone, error) {
+	return m.GetZoneByNameFunc(ctx, arg)
+}
+
+func (m *MockQuerier) JoinWaitlist(ctx context.Context, arg JoinWaitlistParams) (WaitlistEntry, error) {
+	return m.JoinWaitlistFunc(ctx, arg)
+}
+
+func (m *MockQuerier) LapseWaitlistEntry(ctx context.Context, id int32) error {
+	return m.LapseWaitlistEntryFunc(ctx, id)
+}
+
+func (m *MockQuerier) LeaveWaitlist(ctx context.Context, id int32) (WaitlistEntry, error) {
+	return m.LeaveWaitlistFunc(ctx, id)
+}
+
+func (m *MockQuerier) ListCheckInConflictsByEvent(ctx context.Context, eventID pgtype.Int4) ([]CheckIn, error) {
+	return m.ListCheckInConflictsByEventFunc(ctx, eventID)
+}
+
+func (m *MockQuerier) ListCheckInsByEvent(ctx context.Context, arg ListCheckInsByEventParams) ([]CheckIn, error) {
+	return m.ListCheckInsByEventFunc(ctx, arg)
+}
+
+func (m *MockQuerier) ListCheckInsByInvitee(ctx context.Context, inviteeID pgtype.Int4) ([]CheckIn, error) {
+	return m.ListCheckInsByInviteeFunc(ctx, inviteeID)
+}
+
+func (m *MockQuerier) ListEventOccupants(ctx context.Context, eventID pgtype.Int4) ([]ListEventOccupantsRow, error) {
+	return m.ListEventOccupantsFunc(ctx, eventID)
+}
+
 func (m *MockQuerier) ListEvents(ctx context.Context) ([]Event, error) {
 	return m.ListEventsFunc(ctx)
 }
 
+func (m *MockQuerier) ListEventsByOwner(ctx context.Context, ownerID pgtype.UUID) ([]Event, error) {
+	return m.ListEventsByOwnerFunc(ctx, ownerID)
+}
+
+func (m *MockQuerier) ListEventsWithRecentCheckIns(ctx context.Context, checkedInAt pgtype.Timestamptz) ([]pgtype.Int4, error) {
+	return m.ListEventsWithRecentCheckInsFunc(ctx, checkedInAt)
+}
+
+func (m *MockQuerier) ListGatesByEvent(ctx context.Context, eventID int32) ([]Gate, error) {
+	return m.ListGatesByEventFunc(ctx, eventID)
+}
+
+func (m *MockQuerier) ListGiftBalancesByEvent(ctx context.Context, eventID int32) ([]ListGiftBalancesByEventRow, error) {
+	return m.ListGiftBalancesByEventFunc(ctx, eventID)
+}
+
+func (m *MockQuerier) ListImportJobErrors(ctx context.Context, jobID pgtype.UUID) ([]ImportJobError, error) {
+	return m.ListImportJobErrorsFunc(ctx, jobID)
+}
+
+func (m *MockQuerier) ListInviteePerks(ctx context.Context, arg ListInviteePerksParams) ([]ListInviteePerksRow, error) {
+	return m.ListInviteePerksFunc(ctx, arg)
+}
+
+func (m *MockQuerier) ListInviteesChangedSince(ctx context.Context, arg ListInviteesChangedSinceParams) ([]Invitee, error) {
+	return m.ListInviteesChangedSinceFunc(ctx, arg)
+}
+
+func (m *MockQuerier) ListOrderItems(ctx context.Context, orderID int32) ([]OrderItem, error) {
+	return m.ListOrderItemsFunc(ctx, orderID)
+}
+
+func (m *MockQuerier) ListOrderTickets(ctx context.Context, orderID int32) ([]OrderTicket, error) {
+	return m.ListOrderTicketsFunc(ctx, orderID)
+}
+
+func (m *MockQuerier) ListOrdersByUser(ctx context.Context, userID pgtype.UUID) ([]Order, error) {
+	return m.ListOrdersByUserFunc(ctx, userID)
+}
+
+func (m *MockQuerier) ListPaymentsByOrder(ctx context.Context, orderID int32) ([]Payment, error) {
+	return m.ListPaymentsByOrderFunc(ctx, orderID)
+}
+
+func (m *MockQuerier) ListPerkRedemptionsByInvitee(ctx context.Context, inviteeID int32) ([]PerkRedemption, error) {
+	return m.ListPerkRedemptionsByInviteeFunc(ctx, inviteeID)
+}
+
+func (m *MockQuerier) ListPerksByEvent(ctx context.Context, eventID int32) ([]Perk, error) {
+	return m.ListPerksByEventFunc(ctx, eventID)
+}
+
+func (m *MockQuerier) ListRegistrationsByEvent(ctx context.Context, eventID int32) ([]Registration, error) {
+	return m.ListRegistrationsByEventFunc(ctx, eventID)
+}
+
+func (m *MockQuerier) ListTicketChanges(ctx context.Context, inviteeID int32) ([]TicketChange, error) {
+	return m.ListTicketChangesFunc(ctx, inviteeID)
+}
+
+func (m *MockQuerier) ListTicketTypesByEvent(ctx context.Context, eventID int32) ([]TicketType, error) {
+	return m.ListTicketTypesByEventFunc(ctx, eventID)
+}
+
+func (m *MockQuerier) ListWaitlistByEvent(ctx context.Context, eventID int32) ([]WaitlistEntry, error) {
+	return m.ListWaitlistByEventFunc(ctx, eventID)
+}
+
+func (m *MockQuerier) ListZonesByEvent(ctx context.Context, eventID int32) ([]Zone, error) {
+	return m.ListZonesByEventFunc(ctx, eventID)
+}
+
+func (m *MockQuerier) LockEvent(ctx context.Context, id int32) (Event, error) {
+	return m.LockEventFunc(ctx, id)
+}
+
+func (m *MockQuerier) MarkOrderPaid(ctx context.Context, id int32) (Order, error) {
+	return m.MarkOrderPaidFunc(ctx, id)
+}
+
+func (m *MockQuerier) PromoteWaitlistEntry(ctx context.Context, arg PromoteWaitlistEntryParams) (WaitlistEntry, error) {
+	return m.PromoteWaitlistEntryFunc(ctx, arg)
+}
+
+func (m *MockQuerier) RecordTicketRefund(ctx context.Context, arg RecordTicketRefundParams) (TicketChange, error) {
+	return m.RecordTicketRefundFunc(ctx, arg)
+}
+
+func (m *MockQuerier) RedeemPerk(ctx context.Context, arg RedeemPerkParams) (PerkRedemption, error) {
+	return m.RedeemPerkFunc(ctx, arg)
+}
+
+func (m *MockQuerier) RefundInvitee(ctx context.Context, id int32) (Invitee, error) {
+	return m.RefundInviteeFunc(ctx, id)
+}
+
+func (m *MockQuerier) ReleaseOrder(ctx context.Context, arg ReleaseOrderParams) (Order, error) {
+	return m.ReleaseOrderFunc(ctx, arg)
+}
+
+func (m *MockQuerier) ReleasePaymentWebhookEvent(ctx context.Context, arg ReleasePaymentWebhookEventParams) error {
+	return m.ReleasePaymentWebhookEventFunc(ctx, arg)
+}
+
+func (m *MockQuerier) ReserveOrder(ctx context.Context, arg ReserveOrderParams) (Order, error) {
+	return m.ReserveOrderFunc(ctx, arg)
+}
+
+func (m *MockQuerier) ReserveOrderItem(ctx context.Context, arg ReserveOrderItemParams) (OrderItem, error) {
+	return m.ReserveOrderItemFunc(ctx, arg)
+}
+
+func (m *MockQuerier) RespondInviteeRSVP(ctx context.Context, arg RespondInviteeRSVPParams) (Invitee, error) {
+	return m.RespondInviteeRSVPFunc(ctx, arg)
+}
+
+func (m *MockQuerier) RetryImportJob(ctx context.Context, id pgtype.UUID) (ImportJob, error) {
+	return m.RetryImportJobFunc(ctx, id)
+}
+
+func (m *MockQuerier) ReviewRegistration(ctx context.Context, arg ReviewRegistrationParams) (Registration, error) {
+	return m.ReviewRegistrationFunc(ctx, arg)
+}
+
+func (m *MockQuerier) SetImportJobTotalRows(ctx context.Context, arg SetImportJobTotalRowsParams) error {
+	return m.SetImportJobTotalRowsFunc(ctx, arg)
+}
+
+func (m *MockQuerier) SetOrderTicketInvitee(ctx context.Context, arg SetOrderTicketInviteeParams) error {
+	return m.SetOrderTicketInviteeFunc(ctx, arg)
+}
+
+func (m *MockQuerier) SetOrderTotal(ctx context.Context, arg SetOrderTotalParams) (Order, error) {
+	return m.SetOrderTotalFunc(ctx, arg)
+}
+
+func (m *MockQuerier) SetPaymentStatus(ctx context.Context, arg SetPaymentStatusParams) (Payment, error) {
+	return m.SetPaymentStatusFunc(ctx, arg)
+}
+
+func (m *MockQuerier) SetRegistrationOutcome(ctx context.Context, arg SetRegistrationOutcomeParams) (Registration, error) {
+	return m.SetRegistrationOutcomeFunc(ctx, arg)
+}
+
+func (m *MockQuerier) SetWaitlistEntryInvitee(ctx context.Context, arg SetWaitlistEntryInviteeParams) error {
+	return m.SetWaitlistEntryInviteeFunc(ctx, arg)
+}
+
+func (m *MockQuerier) TransferInvitee(ctx context.Context, arg TransferInviteeParams) (Invitee, error) {
+	return m.TransferInviteeFunc(ctx, arg)
+}
+
 func (m *MockQuerier) UpdateEvent(ctx context.Context, arg UpdateEventParams) (Event, error) {
 	return m.UpdateEventFunc(ctx, arg)
 }
 
+func (m *MockQuerier) UpdateEventRegistration(ctx context.Context, arg UpdateEventRegistrationParams) (Event, error) {
+	return m.UpdateEventRegistrationFunc(ctx, arg)
+}
+
+func (m *MockQuerier) UpdateImportJobProgress(ctx context.Context, arg UpdateImportJobProgressParams) (int64, error) {
+	return m.UpdateImportJobProgressFunc(ctx, arg)
+}
+
 func (m *MockQuerier) UpdateInvitee(ctx context.Context, arg UpdateInviteeParams) (Invitee, error) {
 	return m.UpdateInviteeFunc(ctx, arg)
 }
@@ -119,10 +614,6 @@ func (m *MockQuerier) UpdateInviteeState(ctx context.Context, arg UpdateInviteeS
 	return m.UpdateInviteeStateFunc(ctx, arg)
 }
 
-func (m *MockQuerier) UpdateInviteeStateAndClaimGift(ctx context.Context, arg UpdateInviteeStateAndClaimGiftParams) (Invitee, error) {
-	return m.UpdateInviteeStateAndClaimGiftFunc(ctx, arg)
-}
-
 func (m *MockQuerier) UpdateInviteeStatus(ctx context.Context, arg UpdateInviteeStatusParams) (Invitee, error) {
 	return m.UpdateInviteeStatusFunc(ctx, arg)
 }
@@ -130,3 +621,27 @@ func (m *MockQuerier) UpdateInviteeStatus(ctx context.Context, arg UpdateInvitee
 func (m *MockQuerier) UpdateOrderStatus(ctx context.Context, arg UpdateOrderStatusParams) (Order, error) {
 	return m.UpdateOrderStatusFunc(ctx, arg)
 }
+
+func (m *MockQuerier) UpdatePerk(ctx context.Context, arg UpdatePerkParams) (Perk, error) {
+	return m.UpdatePerkFunc(ctx, arg)
+}
+
+func (m *MockQuerier) UpdateTicketType(ctx context.Context, arg UpdateTicketTypeParams) (TicketType, error) {
+	return m.UpdateTicketTypeFunc(ctx, arg)
+}
+
+func (m *MockQuerier) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	return m.UpdateUserRoleFunc(ctx, arg)
+}
+
+func (m *MockQuerier) UpdateZone(ctx context.Context, arg UpdateZoneParams) (Zone, error) {
+	return m.UpdateZoneFunc(ctx, arg)
+}
+
+func (m *MockQuerier) UpsertPayment(ctx context.Context, arg UpsertPaymentParams) (Payment, error) {
+	return m.UpsertPaymentFunc(ctx, arg)
+}
+
+func (m *MockQuerier) VerifyRegistration(ctx context.Context, arg VerifyRegistrationParams) (Registration, error) {
+	return m.VerifyRegistrationFunc(ctx, arg)
+}
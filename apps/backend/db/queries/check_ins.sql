@@ -0,0 +1,99 @@
+-- name: CreateCheckIn :one
+INSERT INTO check_ins (event_id, invitee_id, checked_in_at, device_id, outcome, conflict_device_id, operator_id, gate, perk, zone_id, reason)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (device_id, invitee_id, checked_in_at) DO NOTHING
+RETURNING *;
+
+-- name: GetCheckInByDeviceScan :one
+SELECT * FROM check_ins
+WHERE device_id = $1 AND invitee_id = $2 AND checked_in_at = $3;
+
+-- name: GetAdmissionCheckIn :one
+SELECT * FROM check_ins
+WHERE invitee_id = $1 AND outcome = 'admitted'
+ORDER BY checked_in_at
+LIMIT 1;
+
+-- name: ListCheckInConflictsByEvent :many
+SELECT * FROM check_ins
+WHERE event_id = $1 AND outcome = 'conflict'
+ORDER BY checked_in_at;
+
+-- name: ListCheckInsByEvent :many
+SELECT * FROM check_ins
+WHERE event_id = $1
+ORDER BY checked_in_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: ListCheckInsByInvitee :many
+SELECT * FROM check_ins
+WHERE invitee_id = $1
+ORDER BY checked_in_at DESC;
+
+-- name: AdmitInvitee :one
+-- Checks the invitee in and records the admission in one statement. Returns
+-- no rows when the event's re-entry policy does not allow another entry or
+-- the invitee is expired, cancelled, refunded, deleted or anonymized.
+WITH admitted AS (
+  UPDATE invitees
+  SET
+    state = 'checked_in',
+    updated_at = now()
+  FROM events
+  WHERE invitees.id = $1
+    AND events.id = invitees.event_id
+    AND invitees.deleted_at IS NULL
+    AND invitees.anonymized_at IS NULL
+    AND invitees.status NOT IN ('expired', 'cancelled', 'refunded')
+    AND (invitees.expires_at IS NULL OR invitees.expires_at > now())
+    AND (
+      events.reentry_policy = 'unlimited'
+      OR invitees.state NOT IN ('checked_in', 'checked_out')
+      OR (events.reentry_policy = 'in_out' AND invitees.state = 'checked_out')
+    )
+  RETURNING invitees.id, invitees.event_id
+)
+INSERT INTO check_ins (event_id, invitee_id, checked_in_at, device_id, outcome, operator_id, gate, zone_id)
+SELECT admitted.event_id, admitted.id, $2, $3, 'admitted', $4, $5, $6
+FROM admitted
+RETURNING *;
+
+-- name: ExitInvitee :one
+-- Records an exit scan for events tracking entries and exits. Returns no rows
+-- when the invitee is not inside.
+WITH exited AS (
+  UPDATE invitees
+  SET
+    state = 'checked_out',
+    updated_at = now()
+  FROM events
+  WHERE invitees.id = $1
+    AND events.id = invitees.event_id
+    AND events.reentry_policy = 'in_out'
+    AND invitees.state = 'checked_in'
+  RETURNING invitees.id, invitees.event_id
+)
+INSERT INTO check_ins (event_id, invitee_id, checked_in_at, device_id, outcome, operator_id, gate, zone_id)
+SELECT exited.event_id, exited.id, $2, $3, 'exited', $4, $5, $6
+FROM exited
+RETURNING *;
+
+-- name: ListEventOccupants :many
+-- Lists the invitees inside the event with the zone they last entered,
+-- rebuilt from the admissions, zone changes and exits in the ledger.
+SELECT latest.invitee_id, latest.zone_id
+FROM (
+  SELECT DISTINCT ON (check_ins.invitee_id) check_ins.invitee_id, check_ins.zone_id, check_ins.outcome
+  FROM check_ins
+  WHERE check_ins.event_id = $1
+    AND check_ins.outcome IN ('admitted', 'zone_access', 'exited')
+  ORDER BY check_ins.invitee_id, check_ins.checked_in_at DESC, check_ins.id DESC
+) latest
+JOIN invitees ON invitees.id = latest.invitee_id
+WHERE latest.outcome <> 'exited'
+  AND invitees.state = 'checked_in';
+
+-- name: ListEventsWithRecentCheckIns :many
+SELECT DISTINCT event_id FROM check_ins
+WHERE event_id IS NOT NULL
+  AND checked_in_at > $1;
@@ -6,12 +6,17 @@ WHERE id = $1 LIMIT 1;
 SELECT * FROM events
 ORDER BY name;
 
+-- name: ListEventsByOwner :many
+SELECT * FROM events
+WHERE owner_id = $1
+ORDER BY name;
+
 -- name: CreateEvent :one
 INSERT INTO events (
-  name, date, location
+  name, date, location, owner_id, reentry_policy, capacity, plus_ones_allowed
 )
 VALUES (
-  $1, $2, $3
+  $1, $2, $3, $4, $5, $6, $7
 )
 RETURNING *;
 
@@ -20,10 +25,35 @@ UPDATE events
 SET
   name = $2,
   date = $3,
-  location = $4
+  location = $4,
+  reentry_policy = $5,
+  capacity = $6,
+  plus_ones_allowed = $7
 WHERE id = $1
 RETURNING *;
 
+-- name: AssignUnownedEvents :execrows
+-- Hands events created before owners were recorded to the earliest admin,
+-- since organizers cannot see them. Leaves them alone while there is no
+-- admin yet.
+UPDATE events
+SET owner_id = (SELECT id FROM users WHERE role = 'admin' ORDER BY created_at, id LIMIT 1)
+WHERE owner_id IS NULL
+  AND EXISTS (SELECT 1 FROM users WHERE role = 'admin');
+
 -- name: DeleteEvent :exec
 DELETE FROM events
 WHERE id = $1;
+
+-- name: UpdateEventRegistration :one
+UPDATE events
+SET
+  registration_open = $2,
+  registration_form = $3
+WHERE id = $1
+RETURNING *;
+
+-- name: LockEvent :one
+-- Locks the event row until the end of the transaction, serializing changes
+-- to its seats.
+SELECT * FROM events WHERE id = $1 FOR UPDATE;
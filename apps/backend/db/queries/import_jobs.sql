@@ -0,0 +1,54 @@
+-- name: CreateImportJob :one
+INSERT INTO import_jobs (id, event_id, created_by, object_name, column_mapping) VALUES ($1, $2, $3, $4, $5) RETURNING *;
+
+-- name: GetImportJob :one
+SELECT * FROM import_jobs WHERE id = $1;
+
+-- name: ClaimImportJob :one
+-- Claims the oldest queued job, or a running job whose lease lapsed, under
+-- a new lease.
+UPDATE import_jobs
+SET
+  status = 'running',
+  lease_id = $1,
+  locked_until = now() + interval '5 minutes',
+  updated_at = now()
+WHERE id = (
+  SELECT id FROM import_jobs
+  WHERE status = 'queued' OR (status = 'running' AND locked_until < now())
+  ORDER BY created_at
+  LIMIT 1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: SetImportJobTotalRows :exec
+UPDATE import_jobs SET total_rows = $2, updated_at = now() WHERE id = $1;
+
+-- name: UpdateImportJobProgress :execrows
+-- Records a checkpoint and renews the lease for the next batch. Affects no
+-- rows when the lease was lost to another worker.
+UPDATE import_jobs
+SET
+  processed_rows = sqlc.arg(processed_rows),
+  succeeded_rows = succeeded_rows + sqlc.arg(succeeded_delta),
+  failed_rows = failed_rows + sqlc.arg(failed_delta),
+  locked_until = now() + interval '5 minutes',
+  updated_at = now()
+WHERE id = sqlc.arg(id) AND status = 'running' AND lease_id = sqlc.arg(lease_id);
+
+-- name: CompleteImportJob :execrows
+UPDATE import_jobs SET status = 'completed', locked_until = NULL, completed_at = now(), updated_at = now() WHERE id = $1 AND status = 'running' AND lease_id = $2;
+
+-- name: FailImportJob :exec
+UPDATE import_jobs SET status = 'failed', error = $2, locked_until = NULL, updated_at = now() WHERE id = $1 AND status = 'running' AND lease_id = $3;
+
+-- name: RetryImportJob :one
+UPDATE import_jobs SET status = 'queued', error = NULL, updated_at = now() WHERE id = $1 AND status = 'failed' RETURNING *;
+
+-- name: CreateImportJobError :exec
+INSERT INTO import_job_errors (job_id, row_number, email, reason) VALUES ($1, $2, $3, $4)
+ON CONFLICT (job_id, row_number) DO NOTHING;
+
+-- name: ListImportJobErrors :many
+SELECT * FROM import_job_errors WHERE job_id = $1 ORDER BY row_number;
@@ -16,26 +16,44 @@ INSERT INTO invitees (
   email,
   expires_at,
   status,
+  import_job_id,
+  first_name,
+  last_name,
+  phone,
+  company,
+  tier,
+  tags,
+  custom_fields,
+  import_row,
   deleted_at,
   anonymized_at
 ) VALUES (
-  $1, $2, $3, $4, NULL, NULL
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULL, NULL
 )
 RETURNING *;
 
+-- name: GetInviteeByEventAndEmail :one
+SELECT *
+FROM invitees
+WHERE event_id = $1 AND email = $2
+LIMIT 1;
+
 -- name: UpdateInvitee :one
 UPDATE invitees
 SET
   qr_code_url = $2,
-  hmac_signature = $3
+  hmac_signature = $3,
+  qr_issued_at = $4,
+  updated_at = now()
 WHERE id = $1
 RETURNING *;
 
--- name: UpdateInviteeStateAndClaimGift :one
+
+-- name: ClaimInviteeGift :one
 UPDATE invitees
 SET
-  state = $2,
-  gift_claimed_at = now()
+  gift_claimed_at = COALESCE(gift_claimed_at, now()),
+  updated_at = now()
 WHERE id = $1
 RETURNING *;
 
@@ -48,7 +66,8 @@ LIMIT 1;
 -- name: UpdateInviteeState :one
 UPDATE invitees
 SET
-  state = $2
+  state = $2,
+  updated_at = now()
 WHERE id = $1
 RETURNING *;
 
@@ -60,9 +79,110 @@ WHERE expires_at < now() AND status = 'pending';
 -- name: UpdateInviteeStatus :one
 UPDATE invitees
 SET
-  status = $2
+  status = $2,
+  updated_at = now()
 WHERE id = $1
 RETURNING *;
 
 -- name: AnonymizeInvitee :exec
-UPDATE invitees SET email = 'anonymized', qr_code_url = NULL, hmac_signature = NULL, deleted_at = NOW(), anonymized_at = NOW() WHERE id = $1;
+UPDATE invitees SET email = 'anonymized', plus_one_names = '{}', qr_code_url = NULL, hmac_signature = NULL, deleted_at = NOW(), anonymized_at = NOW(), updated_at = NOW() WHERE id = $1;
+
+-- name: ListInviteesChangedSince :many
+-- Returns the event's invitees changed after the given time, including those
+-- whose gift perk balance changed.
+SELECT *
+FROM invitees
+WHERE event_id = $1 AND (
+  updated_at > $2
+  OR id IN (
+    SELECT perk_balances.invitee_id
+    FROM perk_balances
+    JOIN perks ON perks.id = perk_balances.perk_id
+    WHERE perks.event_id = $1 AND perks.name = 'gift' AND perk_balances.updated_at > $2
+  )
+)
+ORDER BY updated_at, id;
+
+-- name: CreateOrderInvitee :one
+INSERT INTO invitees (event_id, email, first_name, last_name, status, order_id)
+VALUES ($1, $2, $3, $4, 'pending', $5)
+RETURNING *;
+
+-- name: CreateWaitlistInvitee :one
+-- Creates the invitee of a promoted waitlist entry, expiring at the end of
+-- its claim window. Returns no rows when the email was invited some other
+-- way since joining.
+INSERT INTO invitees (event_id, email, first_name, last_name, status, expires_at)
+VALUES ($1, $2, $3, $4, 'pending', $5)
+ON CONFLICT (event_id, email) DO NOTHING
+RETURNING *;
+
+-- name: ClaimWaitlistInvitee :one
+-- Keeps a promoted invitee for good. Returns no rows when its claim window
+-- has closed.
+UPDATE invitees
+SET
+  expires_at = NULL,
+  updated_at = now()
+WHERE id = $1
+  AND status = 'pending'
+  AND expires_at > now()
+RETURNING *;
+
+-- name: RespondInviteeRSVP :one
+-- Records the invitee's answer to the invitation. Unless it declines, the
+-- answer takes a seat for the invitee and one per plus-one, and is refused
+-- when the event has no room for more seats than the invitee already holds.
+-- Returns no rows when it is refused or the invitee was cancelled, refunded,
+-- expired or removed.
+UPDATE invitees
+SET
+  rsvp_status = $2,
+  plus_ones = $3,
+  plus_one_names = $4,
+  rsvp_at = now(),
+  updated_at = now()
+FROM events
+WHERE invitees.id = $1
+  AND events.id = invitees.event_id
+  AND invitees.deleted_at IS NULL
+  AND invitees.status NOT IN ('cancelled', 'refunded', 'expired')
+  AND (
+    $2 = 'declined'
+    OR events.capacity = 0
+    OR (invitees.rsvp_status <> 'declined' AND $3 <= invitees.plus_ones)
+    OR events.tickets_reserved + (
+      SELECT COALESCE(SUM(1 + others.plus_ones), 0) FROM invitees others
+      WHERE others.event_id = events.id
+        AND others.id <> invitees.id
+        AND others.order_id IS NULL
+        AND others.deleted_at IS NULL
+        AND others.status NOT IN ('cancelled', 'refunded', 'expired')
+        AND others.rsvp_status <> 'declined'
+    ) + 1 + $3 <= events.capacity
+  )
+RETURNING invitees.*;
+
+-- name: CreateRegistrationInvitee :one
+-- Creates the invitee of an approved registration, who accepted by
+-- registering, when the event has a free seat. Returns no rows when the
+-- event is full.
+INSERT INTO invitees (
+  event_id, email, first_name, last_name, phone, company, custom_fields,
+  status, rsvp_status, rsvp_at
+)
+SELECT $1, $2, $3, $4, $5, $6, $7, 'pending', 'accepted', now()
+FROM events
+WHERE events.id = $1
+  AND (
+    events.capacity = 0
+    OR events.tickets_reserved + (
+      SELECT COALESCE(SUM(1 + invitees.plus_ones), 0) FROM invitees
+      WHERE invitees.event_id = $1
+        AND invitees.order_id IS NULL
+        AND invitees.deleted_at IS NULL
+        AND invitees.status NOT IN ('cancelled', 'refunded', 'expired')
+        AND invitees.rsvp_status <> 'declined'
+    ) < events.capacity
+  )
+RETURNING *;
@@ -15,3 +15,110 @@ INSERT INTO orders (user_id, event_id, status, expires_at, deleted_at, anonymize
 
 -- name: AnonymizeOrder :exec
 UPDATE orders SET user_id = NULL, deleted_at = NOW(), anonymized_at = NOW() WHERE id = $1;
+
+-- name: GetOrder :one
+SELECT * FROM orders
+WHERE id = $1 LIMIT 1;
+
+-- name: ListOrdersByUser :many
+SELECT * FROM orders
+WHERE user_id = $1 AND deleted_at IS NULL
+ORDER BY id DESC;
+
+-- name: ReserveOrder :one
+-- Holds the tickets against the event's capacity and creates the pending
+-- order in one statement. Returns no rows when the event does not exist or
+-- has too few tickets left. Invitees added without an order count against
+-- the capacity too with their plus-ones, unless they were cancelled, expired
+-- or declined.
+WITH reserved AS (
+  UPDATE events
+  SET tickets_reserved = events.tickets_reserved + $3
+  WHERE events.id = $2
+    AND (
+      events.capacity = 0
+      OR events.tickets_reserved + $3 + (
+        SELECT COALESCE(SUM(1 + invitees.plus_ones), 0) FROM invitees
+        WHERE invitees.event_id = $2
+          AND invitees.order_id IS NULL
+          AND invitees.deleted_at IS NULL
+          AND invitees.status NOT IN ('cancelled', 'refunded', 'expired')
+          AND invitees.rsvp_status <> 'declined'
+      ) <= events.capacity
+    )
+  RETURNING events.id
+)
+INSERT INTO orders (user_id, event_id, status, quantity, expires_at)
+SELECT $1, reserved.id, 'pending', $3, $4
+FROM reserved
+RETURNING *;
+
+-- name: ConfirmOrder :one
+-- Returns no rows unless the order is pending and its hold has not expired.
+UPDATE orders
+SET
+  status = 'confirmed',
+  updated_at = now()
+WHERE id = $1
+  AND status = 'pending'
+  AND expires_at > now()
+RETURNING *;
+
+-- name: ReleaseOrder :one
+-- Moves a pending order to the given status and returns its tickets to the
+-- event and its ticket types. Returns no rows when the order is not pending.
+WITH released AS (
+  UPDATE orders
+  SET
+    status = $2,
+    updated_at = now()
+  WHERE orders.id = $1
+    AND orders.status = 'pending'
+  RETURNING *
+), restocked AS (
+  UPDATE events
+  SET tickets_reserved = GREATEST(events.tickets_reserved - released.quantity, 0)
+  FROM released
+  WHERE events.id = released.event_id
+), restocked_types AS (
+  UPDATE ticket_types
+  SET reserved = GREATEST(ticket_types.reserved - order_items.quantity, 0)
+  FROM order_items, released
+  WHERE order_items.order_id = released.id
+    AND ticket_types.id = order_items.ticket_type_id
+)
+SELECT * FROM released;
+
+-- name: CreateOrderTicket :one
+INSERT INTO order_tickets (order_id, email, first_name, last_name, ticket_type_id)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: SetOrderTotal :one
+UPDATE orders
+SET
+  amount = $2,
+  currency = $3,
+  updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: ListOrderTickets :many
+SELECT * FROM order_tickets
+WHERE order_id = $1
+ORDER BY id;
+
+-- name: SetOrderTicketInvitee :exec
+UPDATE order_tickets
+SET invitee_id = $2
+WHERE id = $1;
+
+-- name: MarkOrderPaid :one
+-- Returns no rows unless the order is pending.
+UPDATE orders
+SET
+  status = 'paid',
+  updated_at = now()
+WHERE id = $1
+  AND status = 'pending'
+RETURNING *;
@@ -0,0 +1,42 @@
+-- name: UpsertPayment :one
+-- Providers return the same intent for a repeated idempotency key, so paying
+-- an order again returns its existing payment.
+INSERT INTO payments (order_id, provider, intent_id, status, amount, currency)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (provider, intent_id) DO UPDATE
+SET updated_at = now()
+RETURNING *;
+
+-- name: GetPaymentByIntent :one
+SELECT * FROM payments
+WHERE provider = $1 AND intent_id = $2 LIMIT 1;
+
+-- name: ListPaymentsByOrder :many
+SELECT * FROM payments
+WHERE order_id = $1
+ORDER BY id;
+
+-- name: SetPaymentStatus :one
+UPDATE payments
+SET
+  status = $2,
+  updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: ClaimPaymentWebhookEvent :one
+-- Returns no rows when the event was already claimed by an earlier delivery.
+INSERT INTO payment_webhook_events (provider, event_id, event_type)
+VALUES ($1, $2, $3)
+ON CONFLICT (provider, event_id) DO NOTHING
+RETURNING *;
+
+-- name: ReleasePaymentWebhookEvent :exec
+DELETE FROM payment_webhook_events
+WHERE provider = $1 AND event_id = $2;
+
+-- name: GetCapturedPaymentByOrder :one
+SELECT * FROM payments
+WHERE order_id = $1 AND status = 'captured'
+ORDER BY id DESC
+LIMIT 1;
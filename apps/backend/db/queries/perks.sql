@@ -0,0 +1,73 @@
+-- name: CreatePerk :one
+INSERT INTO perks (event_id, name, quantity)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetPerk :one
+SELECT * FROM perks
+WHERE id = $1 LIMIT 1;
+
+-- name: ListPerksByEvent :many
+SELECT * FROM perks
+WHERE event_id = $1
+ORDER BY name;
+
+-- name: UpdatePerk :one
+UPDATE perks
+SET
+  quantity = $2,
+  updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeletePerk :exec
+DELETE FROM perks
+WHERE id = $1;
+
+-- name: RedeemPerk :one
+-- Redeems one unit of the event's named perk for the invitee and records it
+-- in perk_redemptions and the check_ins ledger. The upsert only increments
+-- the balance while it is below the perk's quantity, so concurrent scans
+-- cannot redeem more than allowed. Returns no rows when the perk does not
+-- exist or is used up.
+WITH perk AS (
+  SELECT perks.id FROM perks
+  WHERE perks.event_id = $2 AND perks.name = $3
+), balance AS (
+  INSERT INTO perk_balances (invitee_id, perk_id, redeemed)
+  SELECT $1, perk.id, 1 FROM perk
+  ON CONFLICT (invitee_id, perk_id) DO UPDATE
+  SET
+    redeemed = perk_balances.redeemed + 1,
+    updated_at = now()
+  WHERE perk_balances.redeemed < (SELECT perks.quantity FROM perks WHERE perks.id = perk_balances.perk_id)
+  RETURNING perk_id
+), ledger AS (
+  INSERT INTO check_ins (event_id, invitee_id, checked_in_at, device_id, outcome, operator_id, gate, perk, zone_id)
+  SELECT $2, $1, $4, $5, 'redeemed', $6, $7, $3, $8
+  FROM balance
+)
+INSERT INTO perk_redemptions (perk_id, invitee_id, redeemed_at, device_id, operator_id, gate)
+SELECT balance.perk_id, $1, $4, $5, $6, $7
+FROM balance
+RETURNING *;
+
+-- name: ListInviteePerks :many
+SELECT perks.id, perks.name, perks.quantity, COALESCE(perk_balances.redeemed, 0)::integer AS redeemed
+FROM perks
+LEFT JOIN perk_balances ON perk_balances.perk_id = perks.id AND perk_balances.invitee_id = $1
+WHERE perks.event_id = $2
+ORDER BY perks.name;
+
+-- name: ListPerkRedemptionsByInvitee :many
+SELECT * FROM perk_redemptions
+WHERE invitee_id = $1
+ORDER BY redeemed_at;
+
+-- name: ListGiftBalancesByEvent :many
+-- Returns the gift perk balance of every invitee of the event who redeemed
+-- it: whether the gift is used up and when the balance last changed.
+SELECT perk_balances.invitee_id, (perk_balances.redeemed >= perks.quantity)::boolean AS used_up, perk_balances.updated_at
+FROM perk_balances
+JOIN perks ON perks.id = perk_balances.perk_id
+WHERE perks.event_id = $1 AND perks.name = 'gift';
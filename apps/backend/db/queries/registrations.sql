@@ -0,0 +1,74 @@
+-- name: CreateRegistration :one
+-- Registering again before verifying replaces the details and the
+-- verification token, at most every five minutes so the form cannot be used
+-- to flood someone's inbox. Returns no rows when the email is already
+-- registered or registered again too soon.
+INSERT INTO registrations (
+  event_id, email, first_name, last_name, phone, company, custom_fields,
+  verification_token_hash, verification_expires_at
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT (event_id, email) DO UPDATE
+SET
+  first_name = EXCLUDED.first_name,
+  last_name = EXCLUDED.last_name,
+  phone = EXCLUDED.phone,
+  company = EXCLUDED.company,
+  custom_fields = EXCLUDED.custom_fields,
+  verification_token_hash = EXCLUDED.verification_token_hash,
+  verification_expires_at = EXCLUDED.verification_expires_at,
+  updated_at = now()
+WHERE registrations.status = 'unverified'
+  AND registrations.updated_at < now() - interval '5 minutes'
+RETURNING *;
+
+-- name: GetRegistration :one
+SELECT * FROM registrations
+WHERE id = $1 LIMIT 1;
+
+-- name: GetRegistrationByVerificationToken :one
+SELECT * FROM registrations
+WHERE verification_token_hash = $1 LIMIT 1;
+
+-- name: ListRegistrationsByEvent :many
+SELECT * FROM registrations
+WHERE event_id = $1
+ORDER BY id;
+
+-- name: VerifyRegistration :one
+-- Returns no rows unless the registration is unverified and its
+-- verification token has not expired.
+UPDATE registrations
+SET
+  status = $2,
+  verified_at = now(),
+  updated_at = now()
+WHERE verification_token_hash = $1
+  AND status = 'unverified'
+  AND verification_expires_at > now()
+RETURNING *;
+
+-- name: ReviewRegistration :one
+-- Returns no rows unless the registration is awaiting approval.
+UPDATE registrations
+SET
+  status = $2,
+  reviewed_by = $3,
+  reviewed_at = now(),
+  updated_at = now()
+WHERE id = $1
+  AND status = 'pending_approval'
+RETURNING *;
+
+-- name: SetRegistrationOutcome :one
+UPDATE registrations
+SET
+  status = $2,
+  invitee_id = $3,
+  updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteRegistrationsByInvitee :exec
+DELETE FROM registrations
+WHERE invitee_id = $1;
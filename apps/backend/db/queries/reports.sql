@@ -0,0 +1,6 @@
+-- name: GetEventAttendance :one
+SELECT
+  COUNT(*) AS invited,
+  COUNT(*) FILTER (WHERE state = 'checked_in') AS attended
+FROM invitees
+WHERE event_id = $1 AND deleted_at IS NULL;
@@ -0,0 +1,122 @@
+-- name: CancelInvitee :one
+-- Cancels the ticket and drops its signature so its QR code is rejected.
+-- Returns no rows when it was already cancelled, refunded or deleted.
+UPDATE invitees
+SET
+  status = 'cancelled',
+  qr_code_url = NULL,
+  hmac_signature = NULL,
+  qr_issued_at = NULL,
+  updated_at = now()
+WHERE id = $1
+  AND status NOT IN ('cancelled', 'refunded')
+  AND deleted_at IS NULL
+RETURNING *;
+
+-- name: RefundInvitee :one
+-- Marks an unused ticket of an order refunded, drops its signature and
+-- returns its seat to the event and its ticket type. Returns no rows when the
+-- ticket has no order, was used or is already refunded or deleted.
+WITH refunded AS (
+  UPDATE invitees
+  SET
+    status = 'refunded',
+    qr_code_url = NULL,
+    hmac_signature = NULL,
+    qr_issued_at = NULL,
+    updated_at = now()
+  WHERE invitees.id = $1
+    AND invitees.order_id IS NOT NULL
+    AND invitees.status <> 'refunded'
+    AND invitees.state NOT IN ('checked_in', 'checked_out')
+    AND invitees.deleted_at IS NULL
+  RETURNING *
+), restocked AS (
+  UPDATE events
+  SET tickets_reserved = GREATEST(events.tickets_reserved - 1, 0)
+  FROM refunded
+  WHERE events.id = refunded.event_id
+), restocked_type AS (
+  UPDATE ticket_types
+  SET reserved = GREATEST(ticket_types.reserved - 1, 0)
+  FROM order_tickets, refunded
+  WHERE order_tickets.invitee_id = refunded.id
+    AND ticket_types.id = order_tickets.ticket_type_id
+)
+SELECT * FROM refunded;
+
+-- name: TransferInvitee :one
+-- Hands an unused ticket to a new holder and drops the old signature so the
+-- previous holder's QR code is rejected. Returns no rows when the ticket was
+-- used, cancelled, refunded or deleted.
+UPDATE invitees
+SET
+  email = $2,
+  first_name = $3,
+  last_name = $4,
+  qr_code_url = NULL,
+  hmac_signature = NULL,
+  qr_issued_at = NULL,
+  updated_at = now()
+WHERE id = $1
+  AND status NOT IN ('cancelled', 'refunded', 'expired')
+  AND state NOT IN ('checked_in', 'checked_out')
+  AND deleted_at IS NULL
+RETURNING *;
+
+-- name: GetOrderTicketByInvitee :one
+SELECT * FROM order_tickets
+WHERE invitee_id = $1 LIMIT 1;
+
+-- name: CreateTicketChange :one
+INSERT INTO ticket_changes (
+  invitee_id,
+  event_id,
+  action,
+  previous_email,
+  previous_first_name,
+  previous_last_name,
+  new_email,
+  amount,
+  currency,
+  reason,
+  user_id
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+)
+RETURNING *;
+
+-- name: RecordTicketRefund :one
+-- Records the refund of a ticket and adds its amount to the refunded part of
+-- the payment, which becomes refunded once all of it is returned. A ticket is
+-- refunded at most once, so a concurrent retry inserts no change, leaves the
+-- payment alone and returns no rows.
+WITH change AS (
+  INSERT INTO ticket_changes (invitee_id, event_id, action, amount, currency, reason, user_id)
+  VALUES ($1, $2, 'refunded', $3, $4, $5, $6)
+  ON CONFLICT (invitee_id) WHERE action = 'refunded' DO NOTHING
+  RETURNING *
+), payment AS (
+  UPDATE payments
+  SET
+    refunded_amount = payments.refunded_amount + change.amount,
+    status = CASE WHEN payments.refunded_amount + change.amount >= payments.amount THEN 'refunded' ELSE payments.status END,
+    updated_at = now()
+  FROM change
+  WHERE payments.id = $7
+)
+SELECT * FROM change;
+
+-- name: ListTicketChanges :many
+SELECT * FROM ticket_changes
+WHERE invitee_id = $1
+ORDER BY id;
+
+-- name: AnonymizeTicketChanges :exec
+UPDATE ticket_changes
+SET
+  previous_email = NULL,
+  previous_first_name = NULL,
+  previous_last_name = NULL,
+  new_email = NULL
+WHERE invitee_id = $1;
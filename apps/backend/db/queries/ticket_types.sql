@@ -0,0 +1,58 @@
+-- name: CreateTicketType :one
+INSERT INTO ticket_types (event_id, name, price, currency, quantity, sales_start, sales_end, max_per_order)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: GetTicketType :one
+SELECT * FROM ticket_types
+WHERE id = $1 LIMIT 1;
+
+-- name: ListTicketTypesByEvent :many
+SELECT * FROM ticket_types
+WHERE event_id = $1
+ORDER BY price, name;
+
+-- name: UpdateTicketType :one
+-- Returns no rows when the new quantity is below what is already reserved.
+UPDATE ticket_types
+SET
+  name = $2,
+  price = $3,
+  currency = $4,
+  quantity = $5,
+  sales_start = $6,
+  sales_end = $7,
+  max_per_order = $8,
+  updated_at = now()
+WHERE id = $1
+  AND reserved <= $5
+RETURNING *;
+
+-- name: DeleteTicketType :exec
+DELETE FROM ticket_types
+WHERE id = $1;
+
+-- name: ReserveOrderItem :one
+-- Holds tickets of one type for an order and records the line item at the
+-- current price. Returns no rows when the type belongs to another event, is
+-- not on sale, exceeds its per-order limit or has too few tickets left.
+WITH reserved AS (
+  UPDATE ticket_types
+  SET reserved = ticket_types.reserved + $3
+  WHERE ticket_types.id = $2
+    AND ticket_types.event_id = $4
+    AND ticket_types.reserved + $3 <= ticket_types.quantity
+    AND $3 <= ticket_types.max_per_order
+    AND (ticket_types.sales_start IS NULL OR ticket_types.sales_start <= now())
+    AND (ticket_types.sales_end IS NULL OR ticket_types.sales_end > now())
+  RETURNING ticket_types.id, ticket_types.price, ticket_types.currency
+)
+INSERT INTO order_items (order_id, ticket_type_id, quantity, unit_price, currency)
+SELECT $1, reserved.id, $3, reserved.price, reserved.currency
+FROM reserved
+RETURNING *;
+
+-- name: ListOrderItems :many
+SELECT * FROM order_items
+WHERE order_id = $1
+ORDER BY id;
@@ -1,5 +1,5 @@
 -- name: CreateUser :one
-INSERT INTO users (id, email, password_hash, deleted_at, anonymized_at) VALUES ($1, $2, $3, NULL, NULL) RETURNING *;
+INSERT INTO users (id, email, password_hash, role, deleted_at, anonymized_at) VALUES ($1, $2, $3, $4, NULL, NULL) RETURNING *;
 
 -- name: GetUserByID :one
 SELECT * FROM users WHERE id = $1 AND deleted_at IS NULL;
@@ -9,3 +9,6 @@ SELECT * FROM users WHERE email = $1 AND deleted_at IS NULL;
 
 -- name: AnonymizeUser :exec
 UPDATE users SET email = 'anonymized', password_hash = 'anonymized', deleted_at = NOW(), anonymized_at = NOW() WHERE id = $1;
+
+-- name: UpdateUserRole :one
+UPDATE users SET role = $2, updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL RETURNING *;
@@ -0,0 +1,105 @@
+-- name: JoinWaitlist :one
+-- Someone who left the waitlist rejoins at the back of the queue. Returns no
+-- rows when the email is already on it.
+INSERT INTO waitlist_entries (event_id, email, first_name, last_name, priority, user_id)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (event_id, email) DO UPDATE
+SET
+  first_name = EXCLUDED.first_name,
+  last_name = EXCLUDED.last_name,
+  priority = EXCLUDED.priority,
+  user_id = EXCLUDED.user_id,
+  status = 'waiting',
+  created_at = now()
+WHERE waitlist_entries.status = 'left'
+RETURNING *;
+
+-- name: GetWaitlistEntry :one
+SELECT * FROM waitlist_entries
+WHERE id = $1 LIMIT 1;
+
+-- name: GetWaitlistEntryByClaimToken :one
+SELECT * FROM waitlist_entries
+WHERE claim_token_hash = $1 LIMIT 1;
+
+-- name: ListWaitlistByEvent :many
+SELECT * FROM waitlist_entries
+WHERE event_id = $1
+ORDER BY priority DESC, created_at, id;
+
+-- name: LeaveWaitlist :one
+-- Returns no rows unless the entry is still waiting.
+UPDATE waitlist_entries
+SET status = 'left'
+WHERE id = $1
+  AND status = 'waiting'
+RETURNING *;
+
+-- name: PromoteWaitlistEntry :one
+-- Promotes the first waiting entry by priority and signup time when the event
+-- has a free seat, counting invitees still holding one with their plus-ones,
+-- reserved order tickets and promoted entries whose invitee is not created
+-- yet. Run it after LockEvent in the transaction creating the invitee, so
+-- concurrent promotions see each other's seats. Returns no rows when nobody
+-- is waiting or the event is full.
+WITH next AS (
+  SELECT waitlist_entries.id
+  FROM waitlist_entries
+  JOIN events ON events.id = waitlist_entries.event_id
+  WHERE waitlist_entries.event_id = $1
+    AND waitlist_entries.status = 'waiting'
+    AND (
+      events.capacity = 0
+      OR events.tickets_reserved + (
+        SELECT COALESCE(SUM(1 + invitees.plus_ones), 0) FROM invitees
+        WHERE invitees.event_id = $1
+          AND invitees.order_id IS NULL
+          AND invitees.deleted_at IS NULL
+          AND invitees.status NOT IN ('cancelled', 'refunded', 'expired')
+          AND invitees.rsvp_status <> 'declined'
+      ) + (
+        SELECT COUNT(*) FROM waitlist_entries promoted
+        WHERE promoted.event_id = $1
+          AND promoted.status = 'promoted'
+          AND promoted.invitee_id IS NULL
+      ) < events.capacity
+    )
+  ORDER BY waitlist_entries.priority DESC, waitlist_entries.created_at, waitlist_entries.id
+  LIMIT 1
+  FOR UPDATE OF waitlist_entries
+)
+UPDATE waitlist_entries
+SET
+  status = 'promoted',
+  promoted_at = now(),
+  claim_expires_at = $2,
+  claim_token_hash = $3
+FROM next
+WHERE waitlist_entries.id = next.id
+RETURNING waitlist_entries.*;
+
+-- name: SetWaitlistEntryInvitee :exec
+UPDATE waitlist_entries
+SET invitee_id = $2
+WHERE id = $1;
+
+-- name: LapseWaitlistEntry :exec
+-- Ends a promotion that could not be completed or was not claimed in time.
+UPDATE waitlist_entries
+SET status = 'lapsed'
+WHERE id = $1
+  AND status = 'promoted';
+
+-- name: GetWaitlistEntryByInvitee :one
+SELECT * FROM waitlist_entries
+WHERE invitee_id = $1 LIMIT 1;
+
+-- name: ClaimWaitlistEntry :one
+-- Returns no rows unless the entry is promoted.
+UPDATE waitlist_entries
+SET
+  status = 'claimed',
+  claimed_at = now()
+WHERE id = $1
+  AND status = 'promoted'
+RETURNING *;
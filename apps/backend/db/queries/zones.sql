@@ -0,0 +1,53 @@
+-- name: CreateZone :one
+INSERT INTO zones (event_id, name, tiers, capacity)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetZone :one
+SELECT * FROM zones
+WHERE id = $1 LIMIT 1;
+
+-- name: GetZoneByName :one
+SELECT * FROM zones
+WHERE event_id = $1 AND name = $2 LIMIT 1;
+
+-- name: ListZonesByEvent :many
+SELECT * FROM zones
+WHERE event_id = $1
+ORDER BY name;
+
+-- name: UpdateZone :one
+UPDATE zones
+SET
+  name = $2,
+  tiers = $3,
+  capacity = $4,
+  updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteZone :exec
+DELETE FROM zones
+WHERE id = $1;
+
+-- name: CreateGate :one
+INSERT INTO gates (event_id, zone_id, name)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetGate :one
+SELECT * FROM gates
+WHERE id = $1 LIMIT 1;
+
+-- name: GetGateByName :one
+SELECT * FROM gates
+WHERE event_id = $1 AND name = $2 LIMIT 1;
+
+-- name: ListGatesByEvent :many
+SELECT * FROM gates
+WHERE event_id = $1
+ORDER BY name;
+
+-- name: DeleteGate :exec
+DELETE FROM gates
+WHERE id = $1;
@@ -21,17 +21,23 @@ func (q *Queries) AnonymizeUser(ctx context.Context, id pgtype.UUID) error {
 }
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, email, password_hash, deleted_at, anonymized_at) VALUES ($1, $2, $3, NULL, NULL) RETURNING id, email, password_hash, created_at, updated_at, deleted_at, anonymized_at
+INSERT INTO users (id, email, password_hash, role, deleted_at, anonymized_at) VALUES ($1, $2, $3, $4, NULL, NULL) RETURNING id, email, password_hash, created_at, updated_at, deleted_at, anonymized_at, role
 `
 
 type CreateUserParams struct {
 	ID           pgtype.UUID
 	Email        string
 	PasswordHash string
+	Role         string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRow(ctx, createUser, arg.ID, arg.Email, arg.PasswordHash)
+	row := q.db.QueryRow(ctx, createUser,
+		arg.ID,
+		arg.Email,
+		arg.PasswordHash,
+		arg.Role,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -41,12 +47,13 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.DeletedAt,
 		&i.AnonymizedAt,
+		&i.Role,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, password_hash, created_at, updated_at, deleted_at, anonymized_at FROM users WHERE email = $1 AND deleted_at IS NULL
+SELECT id, email, password_hash, created_at, updated_at, deleted_at, anonymized_at, role FROM users WHERE email = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -60,12 +67,13 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.DeletedAt,
 		&i.AnonymizedAt,
+		&i.Role,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, password_hash, created_at, updated_at, deleted_at, anonymized_at FROM users WHERE id = $1 AND deleted_at IS NULL
+SELECT id, email, password_hash, created_at, updated_at, deleted_at, anonymized_at, role FROM users WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetUserByID(ctx context.Context, id pgtype.UUID) (User, error) {
@@ -79,6 +87,32 @@ func (q *Queries) GetUserByID(ctx context.Context, id pgtype.UUID) (User, error)
 		&i.UpdatedAt,
 		&i.DeletedAt,
 		&i.AnonymizedAt,
+		&i.Role,
+	)
+	return i, err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users SET role = $2, updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL RETURNING id, email, password_hash, created_at, updated_at, deleted_at, anonymized_at, role
+`
+
+type UpdateUserRoleParams struct {
+	ID   pgtype.UUID
+	Role string
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.AnonymizedAt,
+		&i.Role,
 	)
 	return i, err
 }
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"eventpass.pro/apps/backend/db"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/minio/minio-go/v7"
+)
+
+// importBatchSize is the number of CSV rows processed between progress checkpoints
+const importBatchSize = 100
+
+// errImportLeaseLost stops a worker whose lease on an import job lapsed and
+// was claimed by another worker
+var errImportLeaseLost = errors.New("import job lease lost to another worker")
+
+// importRowError is a per-row failure that is reported in the error CSV
+// instead of aborting the whole import
+type importRowError struct {
+	reason string
+}
+
+func (e *importRowError) Error() string {
+	return e.reason
+}
+
+func (api *API) UploadInvitees(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	user, _ := userFromContext(ctx)
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB
+		http.Error(w, "Failed to parse multipart form", http.StatusInternalServerError)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Failed to get file from form", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read CSV data", http.StatusBadRequest)
+		return
+	}
+
+	// The optional mapping form field maps invitee fields to CSV header names
+	var mapping inviteeColumnMapping
+	if raw := r.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			http.Error(w, "Invalid column mapping", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate the header up front so a bad mapping is rejected before queueing
+	header, err := csv.NewReader(bytes.NewReader(data)).Read()
+	if err != nil {
+		http.Error(w, "Failed to read CSV header", http.StatusBadRequest)
+		return
+	}
+	if _, err := newInviteeRowParser(header, mapping); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var columnMapping json.RawMessage
+	if len(mapping) > 0 {
+		if columnMapping, err = json.Marshal(mapping); err != nil {
+			http.Error(w, "Invalid column mapping", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Store the upload so the worker can process and resume it independently of this request
+	jobID := uuid.New()
+	objectName := fmt.Sprintf("imports/%s.csv", jobID)
+	bucketName := os.Getenv("MINIO_BUCKET_NAME")
+
+	_, err = api.minioClient.PutObject(ctx, bucketName, objectName, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "text/csv"})
+	if err != nil {
+		http.Error(w, "Failed to store uploaded file", http.StatusInternalServerError)
+		return
+	}
+
+	job, err := api.db.CreateImportJob(ctx, db.CreateImportJobParams{
+		ID:            pgtype.UUID{Bytes: jobID, Valid: true},
+		EventID:       int32(eventID),
+		CreatedBy:     user.ID,
+		ObjectName:    objectName,
+		ColumnMapping: columnMapping,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(importJobResponse(job))
+}
+
+func (api *API) GetImport(w http.ResponseWriter, r *http.Request) {
+	job, ok := api.loadImportJob(w, r)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(importJobResponse(job))
+}
+
+func (api *API) ExportImportErrors(w http.ResponseWriter, r *http.Request) {
+	job, ok := api.loadImportJob(w, r)
+	if !ok {
+		return
+	}
+
+	importErrors, err := api.db.ListImportJobErrors(r.Context(), job.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jobID := uuid.UUID(job.ID.Bytes).String()
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=import-errors-%s.csv", jobID))
+
+	csvWriter := csv.NewWriter(w)
+	defer csvWriter.Flush()
+
+	if err := csvWriter.Write([]string{"Row", "Email", "Reason"}); err != nil {
+		http.Error(w, "Failed to write CSV header", http.StatusInternalServerError)
+		return
+	}
+
+	for _, importError := range importErrors {
+		record := []string{
+			strconv.Itoa(int(importError.RowNumber)),
+			importError.Email,
+			importError.Reason,
+		}
+		if err := csvWriter.Write(record); err != nil {
+			http.Error(w, "Failed to write CSV record", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (api *API) RetryImport(w http.ResponseWriter, r *http.Request) {
+	job, ok := api.loadImportJob(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := api.db.RetryImportJob(r.Context(), job.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Only failed imports can be retried", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(importJobResponse(job))
+}
+
+// loadImportJob fetches the import job named in the URL and checks event access
+func (api *API) loadImportJob(w http.ResponseWriter, r *http.Request) (db.ImportJob, bool) {
+	jobID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid import ID", http.StatusBadRequest)
+		return db.ImportJob{}, false
+	}
+
+	job, err := api.db.GetImportJob(r.Context(), pgtype.UUID{Bytes: jobID, Valid: true})
+	if err != nil {
+		http.Error(w, "Import not found", http.StatusNotFound)
+		return db.ImportJob{}, false
+	}
+
+	if !api.checkEventAccess(w, r, job.EventID) {
+		return db.ImportJob{}, false
+	}
+
+	return job, true
+}
+
+func importJobResponse(job db.ImportJob) interface{} {
+	return struct {
+		db.ImportJob
+		ErrorsURL string
+	}{
+		ImportJob: job,
+		ErrorsURL: fmt.Sprintf("/imports/%s/errors", uuid.UUID(job.ID.Bytes)),
+	}
+}
+
+func (api *API) StartImportWorker() {
+	ticker := time.NewTicker(5 * time.Second)
+	go func() {
+		for range ticker.C {
+			api.processImportJobs()
+		}
+	}()
+}
+
+// processImportJobs claims and runs queued imports until none are left. Jobs
+// whose lease expired (e.g. the previous worker crashed) are claimed again
+// and resume from their last checkpoint.
+func (api *API) processImportJobs() {
+	ctx := context.Background()
+
+	for {
+		job, err := api.db.ClaimImportJob(ctx, pgtype.UUID{Bytes: uuid.New(), Valid: true})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return
+		}
+		if err != nil {
+			LogError(ctx, "Failed to claim import job", err)
+			return
+		}
+
+		err = api.runImportJob(ctx, job)
+		if errors.Is(err, errImportLeaseLost) {
+			// The worker holding the lease now finishes the job
+			LogInfo(ctx, "Import job lease lost", slog.String("job_id", uuid.UUID(job.ID.Bytes).String()))
+		} else if err != nil {
+			LogError(ctx, "Import job failed", err, slog.String("job_id", uuid.UUID(job.ID.Bytes).String()))
+			api.db.FailImportJob(ctx, db.FailImportJobParams{
+				ID:      job.ID,
+				Error:   pgtype.Text{String: err.Error(), Valid: true},
+				LeaseID: job.LeaseID,
+			})
+		}
+	}
+}
+
+func (api *API) runImportJob(ctx context.Context, job db.ImportJob) error {
+	bucketName := os.Getenv("MINIO_BUCKET_NAME")
+
+	object, err := api.minioClient.GetObject(ctx, bucketName, job.ObjectName, minio.GetObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get import file: %w", err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return fmt.Errorf("failed to read import file: %w", err)
+	}
+
+	return api.importCSV(ctx, job, data)
+}
+
+// importCSV imports the rows of the job's CSV file after its last
+// checkpoint. Each checkpoint renews the job's lease and errImportLeaseLost
+// is returned once another worker holds it.
+func (api *API) importCSV(ctx context.Context, job db.ImportJob, data []byte) error {
+	var mapping inviteeColumnMapping
+	if len(job.ColumnMapping) > 0 {
+		if err := json.Unmarshal(job.ColumnMapping, &mapping); err != nil {
+			return fmt.Errorf("invalid column mapping: %w", err)
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	parser, err := newInviteeRowParser(header, mapping)
+	if err != nil {
+		return err
+	}
+
+	if job.TotalRows == 0 {
+		total, err := countCSVRows(data)
+		if err != nil {
+			return err
+		}
+		if parser.hasHeader {
+			total--
+		}
+		if err := api.db.SetImportJobTotalRows(ctx, db.SetImportJobTotalRowsParams{ID: job.ID, TotalRows: total}); err != nil {
+			return fmt.Errorf("failed to set import total: %w", err)
+		}
+	}
+
+	// rowNumber is the record's position in the file, used in the error
+	// report; dataRows counts records after the header and is the checkpoint
+	var rowNumber, dataRows, succeeded, failed int32
+	checkpoint := func() error {
+		updated, err := api.db.UpdateImportJobProgress(ctx, db.UpdateImportJobProgressParams{
+			ProcessedRows:  dataRows,
+			SucceededDelta: succeeded,
+			FailedDelta:    failed,
+			ID:             job.ID,
+			LeaseID:        job.LeaseID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record import progress: %w", err)
+		}
+		if updated == 0 {
+			return errImportLeaseLost
+		}
+		succeeded, failed = 0, 0
+		api.live.Publish(ctx, liveImportProgress, job.EventID, map[string]interface{}{
+			"job_id":         job.ID,
+			"status":         "processing",
+			"processed_rows": dataRows,
+		})
+		return nil
+	}
+
+	record, readErr := header, error(nil)
+	if parser.hasHeader {
+		rowNumber++
+		record, readErr = reader.Read()
+	}
+	defaultExpiry := time.Now().Add(24 * time.Hour)
+
+	for ; readErr != io.EOF; record, readErr = reader.Read() {
+		rowNumber++
+		dataRows++
+
+		// Rows before the checkpoint were handled by a previous run
+		if dataRows <= job.ProcessedRows {
+			continue
+		}
+
+		var rowErr error
+		var parseErr *csv.ParseError
+		if errors.As(readErr, &parseErr) {
+			rowErr = &importRowError{reason: fmt.Sprintf("malformed CSV row: %v", parseErr.Err)}
+		} else if readErr != nil {
+			return fmt.Errorf("failed to read import file: %w", readErr)
+		} else if row, err := parser.parse(record, defaultExpiry); err != nil {
+			rowErr = err
+		} else {
+			rowErr = api.importInviteeRow(ctx, job, row, rowNumber)
+		}
+
+		var rowFailure *importRowError
+		if errors.As(rowErr, &rowFailure) {
+			err := api.db.CreateImportJobError(ctx, db.CreateImportJobErrorParams{
+				JobID:     job.ID,
+				RowNumber: rowNumber,
+				Email:     parser.value(record, inviteeFieldEmail),
+				Reason:    rowFailure.reason,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to record import error for row %d: %w", rowNumber, err)
+			}
+			failed++
+		} else if rowErr != nil {
+			return fmt.Errorf("row %d: %w", rowNumber, rowErr)
+		} else {
+			succeeded++
+		}
+
+		if dataRows%importBatchSize == 0 {
+			if err := checkpoint(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := checkpoint(); err != nil {
+		return err
+	}
+
+	completed, err := api.db.CompleteImportJob(ctx, db.CompleteImportJobParams{ID: job.ID, LeaseID: job.LeaseID})
+	if err != nil {
+		return fmt.Errorf("failed to complete import job: %w", err)
+	}
+	if completed == 0 {
+		return errImportLeaseLost
+	}
+
+	job, err = api.db.GetImportJob(ctx, job.ID)
+	if err == nil {
+		LogInviteeUpload(ctx, job.EventID, int(job.SucceededRows))
+		api.live.Publish(ctx, liveImportProgress, job.EventID, map[string]interface{}{
+			"job_id":         job.ID,
+			"status":         job.Status,
+			"processed_rows": job.ProcessedRows,
+			"succeeded_rows": job.SucceededRows,
+			"failed_rows":    job.FailedRows,
+		})
+	}
+
+	return nil
+}
+
+// importInviteeRow creates the invitee for one CSV row and issues its QR code.
+// Rows already imported by an earlier run of the same job are completed rather
+// than reported as duplicates, which makes re-running a batch safe. Later rows
+// repeating an email address of the file are reported as duplicates.
+func (api *API) importInviteeRow(ctx context.Context, job db.ImportJob, row inviteeRow, rowNumber int32) error {
+	invitee, err := api.db.CreateInvitee(ctx, db.CreateInviteeParams{
+		EventID:      job.EventID,
+		Email:        row.Email,
+		ExpiresAt:    row.ExpiresAt,
+		Status:       "pending",
+		ImportJobID:  job.ID,
+		FirstName:    row.FirstName,
+		LastName:     row.LastName,
+		Phone:        row.Phone,
+		Company:      row.Company,
+		Tier:         row.Tier,
+		Tags:         row.Tags,
+		CustomFields: row.CustomFields,
+		ImportRow:    pgtype.Int4{Int32: rowNumber, Valid: true},
+	})
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		invitee, err = api.db.GetInviteeByEventAndEmail(ctx, db.GetInviteeByEventAndEmailParams{
+			EventID: job.EventID,
+			Email:   row.Email,
+		})
+		if err != nil {
+			return err
+		}
+		if invitee.ImportJobID != job.ID {
+			return &importRowError{reason: "duplicate email for this event"}
+		}
+		// Invitees imported before rows were tracked cannot be told apart
+		if invitee.ImportRow.Valid && invitee.ImportRow.Int32 != rowNumber {
+			return &importRowError{reason: fmt.Sprintf("duplicate email, already imported from row %d", invitee.ImportRow.Int32)}
+		}
+		if invitee.HmacSignature.Valid {
+			return nil
+		}
+	} else if err != nil {
+		return err
+	}
+
+	_, err = api.issueQRCode(ctx, invitee.ID)
+	return err
+}
+
+// countCSVRows counts the records in a CSV file, including malformed ones
+func countCSVRows(data []byte) (int32, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	var total int32
+	for {
+		_, err := reader.Read()
+		if err == io.EOF {
+			return total, nil
+		}
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return 0, fmt.Errorf("failed to count import rows: %w", err)
+		}
+		total++
+	}
+}
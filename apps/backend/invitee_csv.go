@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Invitee fields a CSV column can be mapped to. Any other column is stored in custom_fields.
+const (
+	inviteeFieldEmail     = "email"
+	inviteeFieldFirstName = "first_name"
+	inviteeFieldLastName  = "last_name"
+	inviteeFieldPhone     = "phone"
+	inviteeFieldCompany   = "company"
+	inviteeFieldTier      = "tier"
+	inviteeFieldTags      = "tags"
+	inviteeFieldExpiresAt = "expires_at"
+)
+
+// inviteeHeaderAliases maps normalized CSV header names to invitee fields
+// when no explicit column mapping is given
+var inviteeHeaderAliases = map[string]string{
+	"email":         inviteeFieldEmail,
+	"e_mail":        inviteeFieldEmail,
+	"email_address": inviteeFieldEmail,
+	"first_name":    inviteeFieldFirstName,
+	"firstname":     inviteeFieldFirstName,
+	"given_name":    inviteeFieldFirstName,
+	"last_name":     inviteeFieldLastName,
+	"lastname":      inviteeFieldLastName,
+	"surname":       inviteeFieldLastName,
+	"family_name":   inviteeFieldLastName,
+	"phone":         inviteeFieldPhone,
+	"phone_number":  inviteeFieldPhone,
+	"mobile":        inviteeFieldPhone,
+	"company":       inviteeFieldCompany,
+	"company_name":  inviteeFieldCompany,
+	"organization":  inviteeFieldCompany,
+	"organisation":  inviteeFieldCompany,
+	"tier":          inviteeFieldTier,
+	"ticket_tier":   inviteeFieldTier,
+	"ticket_type":   inviteeFieldTier,
+	"tags":          inviteeFieldTags,
+	"tag":           inviteeFieldTags,
+	"expires_at":    inviteeFieldExpiresAt,
+	"expiry":        inviteeFieldExpiresAt,
+	"expires":       inviteeFieldExpiresAt,
+}
+
+const maxInviteeTextLength = 255
+
+var (
+	phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ()\-.]{5,19}$`)
+	tierPattern  = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// inviteeColumnMapping maps invitee fields to CSV header names, e.g.
+// {"email": "E-mail Address", "first_name": "Given"}
+type inviteeColumnMapping map[string]string
+
+// inviteeRow holds the validated invitee fields parsed from one CSV row
+type inviteeRow struct {
+	Email        string
+	FirstName    pgtype.Text
+	LastName     pgtype.Text
+	Phone        pgtype.Text
+	Company      pgtype.Text
+	Tier         pgtype.Text
+	Tags         []string
+	ExpiresAt    pgtype.Timestamptz
+	CustomFields json.RawMessage
+}
+
+// inviteeRowParser turns CSV records into invitee rows using the column
+// layout resolved from the header row
+type inviteeRowParser struct {
+	// hasHeader is false for legacy files that only contain an email column
+	hasHeader bool
+	fields    map[string]int
+	custom    map[int]string
+}
+
+func normalizeHeader(header string) string {
+	header = strings.ToLower(strings.TrimSpace(header))
+	return strings.NewReplacer(" ", "_", "-", "_", ".", "_").Replace(header)
+}
+
+// newInviteeRowParser resolves which column holds each invitee field. An
+// explicit mapping takes precedence over the header aliases. Files without a
+// recognizable header whose first cell is an email address are treated as the
+// legacy single-column format.
+func newInviteeRowParser(header []string, mapping inviteeColumnMapping) (*inviteeRowParser, error) {
+	p := &inviteeRowParser{hasHeader: true, fields: map[string]int{}, custom: map[int]string{}}
+
+	if len(mapping) > 0 {
+		byHeader := map[string]int{}
+		for i, h := range header {
+			byHeader[strings.ToLower(strings.TrimSpace(h))] = i
+		}
+		for field, column := range mapping {
+			if !isInviteeField(field) {
+				return nil, fmt.Errorf("unknown invitee field %q in column mapping", field)
+			}
+			i, ok := byHeader[strings.ToLower(strings.TrimSpace(column))]
+			if !ok {
+				return nil, fmt.Errorf("column %q mapped to %s not found in CSV header", column, field)
+			}
+			p.fields[field] = i
+		}
+	} else {
+		for i, h := range header {
+			if field, ok := inviteeHeaderAliases[normalizeHeader(h)]; ok {
+				if _, seen := p.fields[field]; !seen {
+					p.fields[field] = i
+				}
+			}
+		}
+	}
+
+	if _, ok := p.fields[inviteeFieldEmail]; !ok {
+		if len(mapping) == 0 && len(header) > 0 && isValidEmail(strings.TrimSpace(header[0])) {
+			return &inviteeRowParser{fields: map[string]int{inviteeFieldEmail: 0}, custom: map[int]string{}}, nil
+		}
+		return nil, fmt.Errorf("CSV header has no email column")
+	}
+
+	mapped := map[int]bool{}
+	for _, i := range p.fields {
+		mapped[i] = true
+	}
+	for i, h := range header {
+		if !mapped[i] && strings.TrimSpace(h) != "" {
+			p.custom[i] = strings.TrimSpace(h)
+		}
+	}
+
+	return p, nil
+}
+
+func isInviteeField(field string) bool {
+	switch field {
+	case inviteeFieldEmail, inviteeFieldFirstName, inviteeFieldLastName, inviteeFieldPhone,
+		inviteeFieldCompany, inviteeFieldTier, inviteeFieldTags, inviteeFieldExpiresAt:
+		return true
+	}
+	return false
+}
+
+func isValidEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
+func (p *inviteeRowParser) value(record []string, field string) string {
+	i, ok := p.fields[field]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func (p *inviteeRowParser) text(record []string, field string) (pgtype.Text, error) {
+	value := p.value(record, field)
+	if value == "" {
+		return pgtype.Text{}, nil
+	}
+	if len(value) > maxInviteeTextLength {
+		return pgtype.Text{}, &importRowError{reason: fmt.Sprintf("%s is longer than %d characters", field, maxInviteeTextLength)}
+	}
+	return pgtype.Text{String: value, Valid: true}, nil
+}
+
+// parse validates a data record. Validation failures are returned as
+// *importRowError so they end up in the import error report.
+func (p *inviteeRowParser) parse(record []string, defaultExpiry time.Time) (inviteeRow, error) {
+	var row inviteeRow
+	var err error
+
+	row.Email = p.value(record, inviteeFieldEmail)
+	if row.Email == "" {
+		return row, &importRowError{reason: "missing email address"}
+	}
+	if !isValidEmail(row.Email) {
+		return row, &importRowError{reason: "malformed email address"}
+	}
+
+	if row.FirstName, err = p.text(record, inviteeFieldFirstName); err != nil {
+		return row, err
+	}
+	if row.LastName, err = p.text(record, inviteeFieldLastName); err != nil {
+		return row, err
+	}
+	if row.Company, err = p.text(record, inviteeFieldCompany); err != nil {
+		return row, err
+	}
+
+	if phone := p.value(record, inviteeFieldPhone); phone != "" {
+		if !phonePattern.MatchString(phone) {
+			return row, &importRowError{reason: "malformed phone number"}
+		}
+		row.Phone = pgtype.Text{String: phone, Valid: true}
+	}
+
+	if tier := p.value(record, inviteeFieldTier); tier != "" {
+		if !tierPattern.MatchString(tier) {
+			return row, &importRowError{reason: "tier may only contain letters, digits, '-' and '_'"}
+		}
+		row.Tier = pgtype.Text{String: tier, Valid: true}
+	}
+
+	row.Tags = []string{}
+	for _, tag := range strings.Split(p.value(record, inviteeFieldTags), ";") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			row.Tags = append(row.Tags, tag)
+		}
+	}
+
+	row.ExpiresAt = pgtype.Timestamptz{Time: defaultExpiry, Valid: true}
+	if expiresAt := p.value(record, inviteeFieldExpiresAt); expiresAt != "" {
+		t, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", expiresAt)
+		}
+		if err != nil {
+			return row, &importRowError{reason: "expires_at must be RFC 3339 or YYYY-MM-DD"}
+		}
+		row.ExpiresAt = pgtype.Timestamptz{Time: t, Valid: true}
+	}
+
+	custom := map[string]string{}
+	for i, name := range p.custom {
+		if i < len(record) && strings.TrimSpace(record[i]) != "" {
+			custom[name] = strings.TrimSpace(record[i])
+		}
+	}
+	if row.CustomFields, err = json.Marshal(custom); err != nil {
+		return row, err
+	}
+
+	return row, nil
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"eventpass.pro/apps/backend/db"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// liveChannel is the Redis pub/sub channel that fans live updates out to
+// every backend replica
+const liveChannel = "eventpass:live"
+
+// liveReplayLength is roughly how many recent messages are kept per event so
+// SSE clients can resume after a disconnect
+const liveReplayLength = 1000
+
+// Live message types
+const (
+	liveScan           = "scan"
+	liveGiftClaimed    = "gift_claimed"
+	livePerkRedeemed   = "perk_redeemed"
+	liveImportProgress = "import_progress"
+	liveInviteeState   = "invitee_state"
+	liveInviteeExpired = "invitee_expired"
+)
+
+const (
+	liveSendBuffer   = 64
+	liveWriteTimeout = 10 * time.Second
+	livePongTimeout  = 60 * time.Second
+	livePingInterval = 30 * time.Second
+	// liveAuthInterval is how often open WebSocket and SSE connections check
+	// that their session has not been revoked
+	liveAuthInterval = 30 * time.Second
+)
+
+// liveMessage is a typed update about one event pushed to live subscribers
+type liveMessage struct {
+	ID        string      `json:"id,omitempty"`
+	Type      string      `json:"type"`
+	EventID   int32       `json:"event_id"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// liveSubscriber receives the messages of the events it is subscribed to
+type liveSubscriber struct {
+	send   chan []byte
+	events map[int32]bool
+}
+
+// LiveHub delivers live messages to the subscribers connected to this
+// replica. Messages are published through Redis so subscribers on other
+// replicas receive them too.
+type LiveHub struct {
+	rdb *redis.Client
+
+	mu          sync.RWMutex
+	subscribers map[*liveSubscriber]bool
+}
+
+// NewLiveHub creates a hub that fans messages out over the given Redis client
+func NewLiveHub(rdb *redis.Client) *LiveHub {
+	return &LiveHub{rdb: rdb, subscribers: map[*liveSubscriber]bool{}}
+}
+
+// Run relays messages from the Redis channel to local subscribers until ctx is done
+func (h *LiveHub) Run(ctx context.Context) {
+	pubsub := h.rdb.Subscribe(ctx, liveChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		h.deliver([]byte(msg.Payload))
+	}
+}
+
+// Publish sends a message to the event's subscribers on all replicas. A nil
+// hub discards messages.
+func (h *LiveHub) Publish(ctx context.Context, messageType string, eventID int32, data interface{}) {
+	if h == nil {
+		return
+	}
+
+	msg := liveMessage{
+		Type:      messageType,
+		EventID:   eventID,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		LogError(ctx, "Failed to encode live message", err)
+		return
+	}
+
+	// The replay stream entry ID becomes the message ID
+	id, err := h.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: liveStreamKey(eventID),
+		MaxLen: liveReplayLength,
+		Approx: true,
+		Values: map[string]interface{}{"message": payload},
+	}).Result()
+	if err != nil {
+		LogError(ctx, "Failed to store live message for replay", err)
+	} else {
+		msg.ID = id
+		payload, _ = json.Marshal(msg)
+	}
+
+	if err := h.rdb.Publish(ctx, liveChannel, payload).Err(); err != nil {
+		// Still reach the clients connected to this replica
+		LogError(ctx, "Failed to publish live message", err)
+		h.deliver(payload)
+	}
+}
+
+// Replay returns the event's messages published after lastID. ok is false
+// when lastID is no longer in the replay buffer, so messages may have been
+// missed.
+func (h *LiveHub) Replay(ctx context.Context, eventID int32, lastID string) (messages []liveMessage, ok bool, err error) {
+	entries, err := h.rdb.XRange(ctx, liveStreamKey(eventID), lastID, "+").Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(entries) == 0 || entries[0].ID != lastID {
+		return nil, false, nil
+	}
+
+	for _, entry := range entries[1:] {
+		value, _ := entry.Values["message"].(string)
+		var msg liveMessage
+		if err := json.Unmarshal([]byte(value), &msg); err != nil {
+			continue
+		}
+		msg.ID = entry.ID
+		messages = append(messages, msg)
+	}
+	return messages, true, nil
+}
+
+func liveStreamKey(eventID int32) string {
+	return fmt.Sprintf("%s:%d", liveChannel, eventID)
+}
+
+// liveIDAfter reports whether stream entry ID a was added after b
+func liveIDAfter(a, b string) bool {
+	aMillis, aSeq := splitLiveID(a)
+	bMillis, bSeq := splitLiveID(b)
+	if aMillis != bMillis {
+		return aMillis > bMillis
+	}
+	return aSeq > bSeq
+}
+
+func splitLiveID(id string) (millis, seq uint64) {
+	m, s, _ := strings.Cut(id, "-")
+	millis, _ = strconv.ParseUint(m, 10, 64)
+	seq, _ = strconv.ParseUint(s, 10, 64)
+	return millis, seq
+}
+
+// publishInviteeState pushes an invitee's new state to the event's subscribers
+func (api *API) publishInviteeState(ctx context.Context, invitee db.Invitee) {
+	api.live.Publish(ctx, liveInviteeState, invitee.EventID, map[string]interface{}{
+		"invitee_id": invitee.ID,
+		"state":      invitee.State,
+		"status":     invitee.Status,
+	})
+}
+
+// deliver hands a published message to the local subscribers of its event.
+// Subscribers that fall behind miss messages rather than blocking the hub.
+func (h *LiveHub) deliver(payload []byte) {
+	var msg struct {
+		EventID int32 `json:"event_id"`
+	}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subscribers {
+		if !sub.events[msg.EventID] {
+			continue
+		}
+		select {
+		case sub.send <- payload:
+		default:
+		}
+	}
+}
+
+func (h *LiveHub) subscribe() *liveSubscriber {
+	sub := &liveSubscriber{send: make(chan []byte, liveSendBuffer), events: map[int32]bool{}}
+	h.mu.Lock()
+	h.subscribers[sub] = true
+	h.mu.Unlock()
+	return sub
+}
+
+func (h *LiveHub) unsubscribe(sub *liveSubscriber) {
+	h.mu.Lock()
+	delete(h.subscribers, sub)
+	h.mu.Unlock()
+}
+
+// setEvents changes the events a subscriber receives
+func (h *LiveHub) setEvents(sub *liveSubscriber, eventIDs []int32, subscribed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, id := range eventIDs {
+		if subscribed {
+			sub.events[id] = true
+		} else {
+			delete(sub.events, id)
+		}
+	}
+}
+
+// liveEventIDs returns the events a subscriber is subscribed to
+func (h *LiveHub) liveEventIDs(sub *liveSubscriber) []int32 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]int32, 0, len(sub.events))
+	for id := range sub.events {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: checkWebSocketOrigin,
+}
+
+// checkWebSocketOrigin accepts requests without an Origin header (non-browser
+// clients), origins listed in the comma separated CORS_ORIGINS, and
+// otherwise only the server's own host
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if allowed := os.Getenv("CORS_ORIGINS"); allowed != "" {
+		for _, o := range strings.Split(allowed, ",") {
+			if strings.EqualFold(strings.TrimSpace(o), origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// CreateLiveTicket issues a single-use ticket for opening a WebSocket or SSE
+// connection, passed in the ticket query parameter. Unlike an access token,
+// a ticket that ends up in a proxy or access log is useless once it has been
+// used or has expired.
+func (api *API) CreateLiveTicket(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := userFromContext(ctx)
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	ticket, err := api.sessions.IssueLiveTicket(ctx, authIdentity{
+		UserID:    uuid.UUID(user.ID.Bytes).String(),
+		SessionID: sessionIDFromContext(ctx),
+		Role:      user.Role,
+		IssuedAt:  issuedAtFromContext(ctx),
+	})
+	if err != nil {
+		http.Error(w, "Failed to create ticket", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ticket":     ticket,
+		"expires_in": int(liveTicketTTL.Seconds()),
+	})
+}
+
+// liveCommand is sent by WebSocket clients to change their subscriptions
+type liveCommand struct {
+	Action   string  `json:"action"`
+	EventIDs []int32 `json:"event_ids"`
+}
+
+// HandleWebSocket streams live messages for the events the client subscribes
+// to, either with the event_ids query parameter (comma separated) or by
+// sending {"action": "subscribe"|"unsubscribe", "event_ids": [...]}.
+// Browsers authenticate the upgrade with a ticket from CreateLiveTicket.
+func (api *API) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := userFromContext(ctx)
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var initial []int32
+	if value := r.URL.Query().Get("event_ids"); value != "" {
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				http.Error(w, "Invalid event_ids", http.StatusBadRequest)
+				return
+			}
+			initial = append(initial, int32(id))
+		}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sub := api.live.subscribe()
+	defer api.live.unsubscribe(sub)
+
+	// Only the writer goroutine writes to the connection. Replies are dropped
+	// once it has stopped, so the reader never blocks on a dead writer.
+	replies := make(chan interface{}, 8)
+	done := make(chan struct{})
+	defer close(done)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		api.writeLiveMessages(ctx, conn, sub, replies, done)
+	}()
+
+	reply := func(msg interface{}) {
+		select {
+		case replies <- msg:
+		case <-stopped:
+		}
+	}
+
+	handle := func(command liveCommand) {
+		switch command.Action {
+		case "subscribe":
+			var allowed, denied []int32
+			for _, id := range command.EventIDs {
+				if ok, err := api.canAccessEvent(context.Background(), user, id); err == nil && ok {
+					allowed = append(allowed, id)
+				} else {
+					denied = append(denied, id)
+				}
+			}
+			api.live.setEvents(sub, allowed, true)
+			reply(map[string]interface{}{"type": "subscribed", "event_ids": api.live.liveEventIDs(sub), "denied": denied})
+		case "unsubscribe":
+			api.live.setEvents(sub, command.EventIDs, false)
+			reply(map[string]interface{}{"type": "subscribed", "event_ids": api.live.liveEventIDs(sub)})
+		default:
+			reply(map[string]interface{}{"type": "error", "error": "unknown action"})
+		}
+	}
+
+	if len(initial) > 0 {
+		handle(liveCommand{Action: "subscribe", EventIDs: initial})
+	}
+
+	conn.SetReadLimit(4096)
+	conn.SetReadDeadline(time.Now().Add(livePongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(livePongTimeout))
+	})
+
+	for {
+		var command liveCommand
+		if err := conn.ReadJSON(&command); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				reply(map[string]interface{}{"type": "error", "error": "invalid message"})
+				continue
+			}
+			return
+		}
+		handle(command)
+	}
+}
+
+// writeLiveMessages writes subscription replies, live messages and pings to
+// the connection until done is closed or a write fails. It closes the
+// connection once the session that opened it is revoked.
+func (api *API) writeLiveMessages(ctx context.Context, conn *websocket.Conn, sub *liveSubscriber, replies <-chan interface{}, done <-chan struct{}) {
+	ping := time.NewTicker(livePingInterval)
+	defer ping.Stop()
+	auth := time.NewTicker(liveAuthInterval)
+	defer auth.Stop()
+
+	for {
+		var err error
+		conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+		select {
+		case <-done:
+			return
+		case reply := <-replies:
+			err = conn.WriteJSON(reply)
+		case payload := <-sub.send:
+			err = conn.WriteMessage(websocket.TextMessage, payload)
+		case <-ping.C:
+			err = conn.WriteMessage(websocket.PingMessage, nil)
+		case <-auth.C:
+			if !api.stillAuthorized(ctx) {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked"))
+				conn.Close()
+				return
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return
+		}
+	}
+}
@@ -1,29 +1,35 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
-	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
 	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 	"time"
 
 	"eventpass.pro/apps/backend/db"
+	"eventpass.pro/apps/backend/signing"
 	"github.com/go-redis/redis/v8"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/minio/minio-go/v7"
@@ -34,11 +40,25 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// qrTokenGracePeriod is how long after the event date a QR token stays valid
+const qrTokenGracePeriod = 24 * time.Hour
+
+var errQRTokenSuperseded = errors.New("QR code was replaced by a reprint")
+
 type API struct {
 	db          db.Querier
 	minioClient *minio.Client
 	rdb         *redis.Client
 	amqpChannel *amqp.Channel
+	sessions    *SessionStore
+	qrKeys      *signing.Keyring
+	analytics   checkInBucketSource
+	live        *LiveHub
+	scanLimiter *ScanLimiter
+	rateLimiter *RateLimiter
+	occupancy   *Occupancy
+	payments    PaymentProvider
+	pool        *pgxpool.Pool
 }
 
 func main() {
@@ -56,38 +76,20 @@ func main() {
 
 	log.Printf("Database connection established successfully")
 
+	timescale := enableTimescale(pool)
+
 	// Run database migrations
-	if err := applyMigrations(pool); err != nil {
+	if err := applyMigrations(pool, timescale); err != nil {
 		log.Fatal("Failed to run migrations: ", err)
 	}
 	log.Printf("Database migrations completed successfully")
 
 	queries := db.New(pool)
 
-	// Create admin user if not exists
-	adminEmail := "admin@example.com"
-	adminPassword := "password123"
-	_, err = queries.GetUserByEmail(context.Background(), adminEmail)
-	if err != nil {
-		// User doesn't exist, create it
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(adminPassword), bcrypt.DefaultCost)
-		if err != nil {
-			log.Fatal("Failed to hash password: ", err)
-		}
-		_, err = queries.CreateUser(context.Background(), db.CreateUserParams{
-			ID:           pgtype.UUID{Bytes: uuid.New(), Valid: true},
-			Email:        adminEmail,
-			PasswordHash: string(hashedPassword),
-		})
-		if err != nil {
-			log.Fatal("Failed to create admin user: ", err)
-		}
-		log.Printf("Admin user created successfully")
+	if err := bootstrapAdmin(context.Background(), queries); err != nil {
+		log.Fatal(err)
 	}
 
-	// Skip TimescaleDB initialization for now
-	log.Printf("Skipping TimescaleDB initialization for development")
-
 	// MinIO client initialization
 	endpoint := os.Getenv("MINIO_ENDPOINT")
 	accessKeyID := os.Getenv("MINIO_ACCESS_KEY_ID")
@@ -137,12 +139,36 @@ func main() {
 	log.Printf("Skipping RabbitMQ connection for development")
 	amqpChannel = nil
 
+	qrKeys, err := newQRKeyring()
+	if err != nil {
+		log.Fatalf("Unable to load QR signing keys: %v", err)
+	}
+
+	scanLimiter, err := NewScanLimiter(rdb)
+	if err != nil {
+		log.Fatalf("Invalid scan rate limit settings: %v", err)
+	}
+
+	rateLimiter, err := NewRateLimiter(rdb)
+	if err != nil {
+		log.Fatalf("Invalid rate limit settings: %v", err)
+	}
+
+	payments, err := newPaymentProvider()
+	if err != nil {
+		log.Fatalf("Invalid payment provider settings: %v", err)
+	}
+
 	r := mux.NewRouter()
 
-	api := &API{db: queries, minioClient: minioClient, rdb: rdb, amqpChannel: amqpChannel}
+	api := &API{db: queries, minioClient: minioClient, rdb: rdb, amqpChannel: amqpChannel, sessions: NewSessionStore(rdb), qrKeys: qrKeys, analytics: newCheckInAnalytics(pool, timescale), live: NewLiveHub(rdb), scanLimiter: scanLimiter, rateLimiter: rateLimiter, occupancy: NewOccupancy(rdb), payments: payments, pool: pool}
+
+	go api.live.Run(context.Background())
 
 	api.StartInviteeExpirationCron()
 	api.StartOrderExpirationCron()
+	api.StartOccupancyReconcileCron()
+	api.StartImportWorker()
 
 	// Log system startup
 	log.Printf("EventPass Pro backend started successfully")
@@ -158,30 +184,100 @@ func main() {
 	}).Methods("GET")
 
 	// Public routes
-	r.HandleFunc("/test-publish", api.TestPublish).Methods("GET")
-	r.HandleFunc("/validate", api.ValidateInvitee).Methods("GET")
-	r.HandleFunc("/qrcodes/{objectName}", api.ServeQRCode).Methods("GET")
-	r.HandleFunc("/users", api.CreateUser).Methods("POST")
-	r.HandleFunc("/login", api.Login).Methods("POST")
-	r.HandleFunc("/scan/{qr}", api.ScanQRCode).Methods("POST")
-	r.HandleFunc("/ws", api.HandleWebSocket).Methods("GET")
+	publicLimit := rateLimiter.Limit(rateLimiter.DefaultPolicy(), rateLimitByIP)
+	r.Handle("/test-publish", publicLimit(http.HandlerFunc(api.TestPublish))).Methods("GET")
+	r.Handle("/qrcodes/{objectName}", publicLimit(http.HandlerFunc(api.ServeQRCode))).Methods("GET")
+	r.Handle("/users", rateLimiter.Limit(signupRateLimit, rateLimitByIP)(http.HandlerFunc(api.CreateUser))).Methods("POST")
+	r.Handle("/login", rateLimiter.Limit(loginRateLimit, rateLimitByIP)(http.HandlerFunc(api.Login))).Methods("POST")
+	r.Handle("/token/refresh", rateLimiter.Limit(refreshRateLimit, rateLimitByIP)(http.HandlerFunc(api.RefreshToken))).Methods("POST")
+	r.Handle("/webhooks/payments", http.HandlerFunc(api.PaymentWebhook)).Methods("POST")
+	r.Handle("/waitlist/claim", publicLimit(http.HandlerFunc(api.ClaimWaitlistSpot))).Methods("GET", "POST")
+	r.Handle("/rsvp", publicLimit(http.HandlerFunc(api.GetRSVP))).Methods("GET")
+	r.Handle("/rsvp/{response}", publicLimit(http.HandlerFunc(api.GetRSVP))).Methods("GET")
+	r.Handle("/rsvp/{response}", publicLimit(http.HandlerFunc(api.RespondRSVP))).Methods("POST")
+	r.Handle("/events/{id}/registration", publicLimit(http.HandlerFunc(api.GetRegistrationForm))).Methods("GET")
+	r.Handle("/events/{id}/register", rateLimiter.Limit(registerRateLimit, rateLimitByIP)(http.HandlerFunc(api.Register))).Methods("POST")
+	r.Handle("/registrations/verify", publicLimit(http.HandlerFunc(api.VerifyRegistration))).Methods("GET", "POST")
 	r.Handle("/metrics", promhttp.Handler())
 
 	// Authenticated routes
 	authRouter := r.PathPrefix("/").Subrouter()
-	// authRouter.Use(authMiddleware(queries)) // Temporarily disabled for testing
-	authRouter.HandleFunc("/events", api.ListEvents).Methods("GET")
-	authRouter.HandleFunc("/events", api.CreateEvent).Methods("POST")
-	authRouter.HandleFunc("/events/{id}", api.GetEvent).Methods("GET")
-	authRouter.HandleFunc("/events/{id}", api.UpdateEvent).Methods("PUT")
-	authRouter.HandleFunc("/events/{id}", api.DeleteEvent).Methods("DELETE")
-	authRouter.HandleFunc("/events/{id}/invitees", api.ListInvitees).Methods("GET")
-	authRouter.HandleFunc("/events/{id}/invitees", api.UploadInvitees).Methods("POST")
-	authRouter.HandleFunc("/events/{id}/report", api.ExportInvitees).Methods("GET")
-	authRouter.HandleFunc("/invitees/{invitee_id}/reprint", api.ReprintRequest).Methods("POST")
-	authRouter.HandleFunc("/users/{id}/anonymize", api.AnonymizeUser).Methods("POST")
-	authRouter.HandleFunc("/invitees/{id}/anonymize", api.AnonymizeInvitee).Methods("POST")
-	authRouter.HandleFunc("/orders/{id}/anonymize", api.AnonymizeOrder).Methods("POST")
+	authRouter.Use(authMiddleware(queries, api.sessions))
+	authRouter.Use(rateLimiter.Limit(rateLimiter.DefaultPolicy(), rateLimitByUser))
+
+	// Per-route role policies
+	admins := requireRole(RoleAdmin)
+	managers := requireRole(RoleAdmin, RoleOrganizer)
+	readers := requireRole(RoleAdmin, RoleOrganizer, RoleAuditor)
+	scanners := requireRole(RoleAdmin, RoleOrganizer, RoleDoorStaff)
+
+	authRouter.HandleFunc("/logout", api.Logout).Methods("POST")
+	authRouter.HandleFunc("/live/ticket", api.CreateLiveTicket).Methods("POST")
+	authRouter.HandleFunc("/ws", api.HandleWebSocket).Methods("GET")
+	authRouter.HandleFunc("/events/{id}/stream", api.StreamEvent).Methods("GET")
+	authRouter.Handle("/validate", scanners(http.HandlerFunc(api.ValidateInvitee))).Methods("GET")
+	authRouter.Handle("/scan/{qr}", scanners(http.HandlerFunc(api.ScanQRCode))).Methods("POST")
+	authRouter.Handle("/scans/sync", scanners(http.HandlerFunc(api.SyncScans))).Methods("POST")
+	authRouter.Handle("/events", readers(http.HandlerFunc(api.ListEvents))).Methods("GET")
+	authRouter.Handle("/events", managers(http.HandlerFunc(api.CreateEvent))).Methods("POST")
+	authRouter.Handle("/events/{id}", readers(http.HandlerFunc(api.GetEvent))).Methods("GET")
+	authRouter.Handle("/events/{id}", managers(http.HandlerFunc(api.UpdateEvent))).Methods("PUT")
+	authRouter.Handle("/events/{id}", managers(http.HandlerFunc(api.DeleteEvent))).Methods("DELETE")
+	authRouter.Handle("/events/{id}/invitees", readers(http.HandlerFunc(api.ListInvitees))).Methods("GET")
+	authRouter.Handle("/events/{id}/invitees", managers(http.HandlerFunc(api.UploadInvitees))).Methods("POST")
+	authRouter.Handle("/events/{id}/registration", managers(http.HandlerFunc(api.UpdateEventRegistration))).Methods("PUT")
+	authRouter.Handle("/events/{id}/registrations", readers(http.HandlerFunc(api.ListRegistrations))).Methods("GET")
+	authRouter.Handle("/registrations/{id}/approve", managers(http.HandlerFunc(api.ApproveRegistration))).Methods("POST")
+	authRouter.Handle("/registrations/{id}/reject", managers(http.HandlerFunc(api.RejectRegistration))).Methods("POST")
+	authRouter.Handle("/events/{id}/rsvp-requests", managers(http.HandlerFunc(api.SendRSVPRequests))).Methods("POST")
+	authRouter.Handle("/events/{id}/report", readers(http.HandlerFunc(api.ExportInvitees))).Methods("GET")
+	authRouter.Handle("/events/{id}/analytics/checkins", readers(http.HandlerFunc(api.GetCheckInAnalytics))).Methods("GET")
+	authRouter.Handle("/events/{id}/check-ins", readers(http.HandlerFunc(api.ListEventCheckIns))).Methods("GET")
+	authRouter.Handle("/events/{id}/conflicts", readers(http.HandlerFunc(api.ListCheckInConflicts))).Methods("GET")
+	authRouter.Handle("/events/{id}/manifest", scanners(http.HandlerFunc(api.GetEventManifest))).Methods("GET")
+	authRouter.Handle("/events/{id}/manifest/delta", scanners(http.HandlerFunc(api.GetEventManifestDelta))).Methods("GET")
+	authRouter.Handle("/signing/keys", scanners(http.HandlerFunc(api.GetSigningPublicKeys))).Methods("GET")
+	authRouter.HandleFunc("/events/{id}/perks", api.ListPerks).Methods("GET")
+	authRouter.Handle("/events/{id}/perks", managers(http.HandlerFunc(api.CreatePerk))).Methods("POST")
+	authRouter.Handle("/perks/{id}", managers(http.HandlerFunc(api.UpdatePerk))).Methods("PUT")
+	authRouter.Handle("/perks/{id}", managers(http.HandlerFunc(api.DeletePerk))).Methods("DELETE")
+	authRouter.HandleFunc("/invitees/{id}/perks", api.ListInviteePerks).Methods("GET")
+	authRouter.HandleFunc("/events/{id}/zones", api.ListZones).Methods("GET")
+	authRouter.HandleFunc("/events/{id}/occupancy", api.GetEventOccupancy).Methods("GET")
+	authRouter.Handle("/events/{id}/zones", managers(http.HandlerFunc(api.CreateZone))).Methods("POST")
+	authRouter.Handle("/zones/{id}", managers(http.HandlerFunc(api.UpdateZone))).Methods("PUT")
+	authRouter.Handle("/zones/{id}", managers(http.HandlerFunc(api.DeleteZone))).Methods("DELETE")
+	authRouter.Handle("/zones/{id}/gates", managers(http.HandlerFunc(api.CreateGate))).Methods("POST")
+	authRouter.Handle("/gates/{id}", managers(http.HandlerFunc(api.DeleteGate))).Methods("DELETE")
+	authRouter.Handle("/imports/{id}", readers(http.HandlerFunc(api.GetImport))).Methods("GET")
+	authRouter.Handle("/imports/{id}/errors", readers(http.HandlerFunc(api.ExportImportErrors))).Methods("GET")
+	authRouter.Handle("/imports/{id}/retry", managers(http.HandlerFunc(api.RetryImport))).Methods("POST")
+	authRouter.Handle("/invitees/{id}/check-ins", readers(http.HandlerFunc(api.ListInviteeCheckIns))).Methods("GET")
+	authRouter.Handle("/invitees/{invitee_id}/reprint", managers(http.HandlerFunc(api.ReprintRequest))).Methods("POST")
+	authRouter.Handle("/users/{id}/role", admins(http.HandlerFunc(api.UpdateUserRole))).Methods("PUT")
+	authRouter.Handle("/users/{id}/anonymize", admins(http.HandlerFunc(api.AnonymizeUser))).Methods("POST")
+	authRouter.Handle("/invitees/{id}/anonymize", managers(http.HandlerFunc(api.AnonymizeInvitee))).Methods("POST")
+	authRouter.Handle("/invitees/{id}/cancel", managers(http.HandlerFunc(api.CancelTicket))).Methods("POST")
+	authRouter.HandleFunc("/invitees/{id}/transfer", api.TransferTicket).Methods("POST")
+	authRouter.Handle("/invitees/{id}/refund", managers(http.HandlerFunc(api.RefundTicket))).Methods("POST")
+	authRouter.Handle("/invitees/{id}/ticket-changes", readers(http.HandlerFunc(api.ListTicketChanges))).Methods("GET")
+	authRouter.HandleFunc("/events/{id}/waitlist", api.JoinWaitlist).Methods("POST")
+	authRouter.Handle("/events/{id}/waitlist", readers(http.HandlerFunc(api.ListWaitlist))).Methods("GET")
+	authRouter.HandleFunc("/waitlist/{id}", api.LeaveWaitlist).Methods("DELETE")
+	authRouter.HandleFunc("/events/{id}/ticket-types", api.ListTicketTypes).Methods("GET")
+	authRouter.Handle("/events/{id}/ticket-types", managers(http.HandlerFunc(api.CreateTicketType))).Methods("POST")
+	authRouter.Handle("/ticket-types/{id}", managers(http.HandlerFunc(api.UpdateTicketType))).Methods("PUT")
+	authRouter.Handle("/ticket-types/{id}", managers(http.HandlerFunc(api.DeleteTicketType))).Methods("DELETE")
+	authRouter.HandleFunc("/events/{id}/orders", api.ReserveOrder).Methods("POST")
+	authRouter.HandleFunc("/orders", api.ListMyOrders).Methods("GET")
+	authRouter.HandleFunc("/orders/{id}", api.GetOrder).Methods("GET")
+	authRouter.HandleFunc("/orders/{id}/confirm", api.ConfirmOrder).Methods("POST")
+	authRouter.HandleFunc("/orders/{id}/cancel", api.CancelOrder).Methods("POST")
+	authRouter.HandleFunc("/orders/{id}/pay", api.PayOrder).Methods("POST")
+	if _, ok := payments.(*FakePaymentProvider); ok {
+		authRouter.HandleFunc("/payments/fake/{intent}/authorize", api.AuthorizeFakePayment).Methods("POST")
+	}
+	authRouter.Handle("/orders/{id}/anonymize", admins(http.HandlerFunc(api.AnonymizeOrder))).Methods("POST")
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -250,6 +346,21 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Hijack lets WebSocket upgrades take over the connection
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	rw.statusCode = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (api *API) TestPublish(w http.ResponseWriter, r *http.Request) {
 	if api.amqpChannel == nil {
 		http.Error(w, "RabbitMQ not available", http.StatusServiceUnavailable)
@@ -262,41 +373,147 @@ func (api *API) TestPublish(w http.ResponseWriter, r *http.Request) {
 }
 
 func (api *API) ScanQRCode(w http.ResponseWriter, r *http.Request) {
+	api.scanQRToken(w, r, mux.Vars(r)["qr"])
+}
+
+// scanQRToken applies a scan of the QR token with the door rules of the
+// event: re-entry policy, zones, capacity and perks. Every attempt is
+// recorded in check_ins.
+func (api *API) scanQRToken(w http.ResponseWriter, r *http.Request, qr string) {
 	ctx := r.Context()
-	vars := mux.Vars(r)
-	qr := vars["qr"]
+	source := scanSourceFromRequest(r)
+
+	// Entry scans may record an exit instead for events tracking both
+	direction := r.URL.Query().Get("direction")
+	if direction != "" && direction != "in" && direction != "out" {
+		http.Error(w, "direction must be in or out", http.StatusBadRequest)
+		return
+	}
+	if direction == "out" && source.Perk.Valid {
+		http.Error(w, "Only entry scans have a direction", http.StatusBadRequest)
+		return
+	}
 
-	// Skip Redis operations for now
-	set := true
+	// Entry, exit and each perk are separate scans of the same QR
+	scanKey := strings.Join([]string{qr, source.Perk.String, direction}, "|")
+	if reason, retryAfter := api.scanLimiter.Allow(ctx, scanKey, source.DeviceID.String, clientIP(r)); reason != "" {
+		RecordQRCodeScan(reason)
+		message := "Too many scans, slow down"
+		if reason == scanThrottledReplay {
+			message = "QR code was just scanned"
+		}
+		writeRetryAfter(w, message, retryAfter)
+		return
+	}
 
-	if !set {
-		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	invitee, err := api.inviteeForQRToken(ctx, qr, time.Now())
+	if invitee.ID == 0 {
+		api.recordScan(ctx, source, invitee, scanOutcome(err))
+		writeQRTokenError(w, err)
 		return
 	}
 
-	invitee, err := api.db.GetInviteeBySignature(ctx, pgtype.Text{String: qr, Valid: true})
-	if err != nil {
-		http.Error(w, "Invitee not found", http.StatusNotFound)
+	if !api.checkEventAccess(w, r, invitee.EventID) {
 		return
 	}
 
-	if invitee.GiftClaimedAt.Valid {
-		http.Error(w, "Gift already claimed", http.StatusConflict)
+	if err != nil {
+		api.recordScan(ctx, source, invitee, scanOutcome(err))
+		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	updatedInvitee, err := api.db.UpdateInviteeStateAndClaimGift(ctx, db.UpdateInviteeStateAndClaimGiftParams{
-		ID:    invitee.ID,
-		State: "checked_in",
-	})
+	zone, err := api.scanZone(ctx, invitee.EventID, &source)
+	if errors.Is(err, errUnknownZone) {
+		api.recordScanReason(ctx, source, invitee, checkInDenied, fmt.Sprintf("unknown zone %s", source.Zone))
+		http.Error(w, "Unknown zone", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to update invitee state", http.StatusInternalServerError)
+		http.Error(w, "Failed to load zone", http.StatusInternalServerError)
+		return
+	}
+
+	// Leaving a zone is never denied
+	if direction != "out" {
+		if reason := zoneDenial(zone, invitee); reason != "" {
+			api.recordScanReason(ctx, source, invitee, checkInDenied, reason)
+			http.Error(w, "Access denied: "+reason, http.StatusForbidden)
+			return
+		}
+	}
+
+	if source.Perk.Valid {
+		redemption, balance, err := api.redeemPerk(ctx, invitee, source, time.Now())
+		switch {
+		case errors.Is(err, errUnknownPerk):
+			api.recordScanReason(ctx, source, invitee, checkInDenied, fmt.Sprintf("unknown perk %s", source.Perk.String))
+			http.Error(w, "Unknown perk", http.StatusNotFound)
+			return
+		case errors.Is(err, errPerkUsedUp):
+			api.recordScan(ctx, source, invitee, checkInExhausted)
+			http.Error(w, "Perk already redeemed", http.StatusConflict)
+			return
+		case errors.Is(err, errInviteeExpired), errors.Is(err, errInviteeRevoked), errors.Is(err, errInviteeCancelled):
+			api.recordScan(ctx, source, invitee, scanOutcome(err))
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		case err != nil:
+			http.Error(w, "Failed to redeem perk", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(perkRedemptionResponse{
+			Invitee:    invitee,
+			Perk:       source.Perk.String,
+			Redemption: redemption,
+			Redeemed:   balance.Redeemed,
+			Remaining:  max(balance.Quantity-balance.Redeemed, 0),
+		})
 		return
 	}
 
-	// Send gift claim notification if gift was claimed
-	if updatedInvitee.GiftClaimedAt.Valid {
-		// api.SendGiftClaimNotification(ctx, updatedInvitee)
+	var updatedInvitee db.Invitee
+	if direction == "out" {
+		updatedInvitee, _, err = api.exitInvitee(ctx, invitee, source, time.Now())
+	} else {
+		undo, fullErr := api.enterOccupancy(ctx, invitee, zone, true)
+		if fullErr != nil {
+			reason := fullErr.Error()
+			if errors.Is(fullErr, errZoneFull) {
+				reason = fmt.Sprintf("zone %s is at capacity", zone.Name)
+			}
+			api.recordScanReason(ctx, source, invitee, checkInFull, reason)
+			http.Error(w, "Capacity reached: "+reason, http.StatusConflict)
+			return
+		}
+		updatedInvitee, _, err = api.admitInvitee(ctx, invitee, source, time.Now())
+		if err != nil && !(errors.Is(err, errAlreadyAdmitted) && zone.ID != 0) {
+			undo()
+		}
+	}
+	switch {
+	case errors.Is(err, errExitNotTracked):
+		http.Error(w, "Event does not track exits", http.StatusBadRequest)
+		return
+	case errors.Is(err, errNotInside):
+		api.recordScan(ctx, source, invitee, checkInDuplicate)
+		http.Error(w, "Invitee is not checked in", http.StatusConflict)
+		return
+	case errors.Is(err, errAlreadyAdmitted) && zone.ID != 0:
+		// Invitees already inside the venue move between zones freely
+		api.recordScan(ctx, source, updatedInvitee, checkInZoneAccess)
+	case errors.Is(err, errAlreadyAdmitted):
+		api.recordScan(ctx, source, invitee, checkInDuplicate)
+		http.Error(w, "Invitee already checked in", http.StatusConflict)
+		return
+	case errors.Is(err, errInviteeExpired), errors.Is(err, errInviteeRevoked), errors.Is(err, errInviteeCancelled):
+		api.recordScan(ctx, source, invitee, scanOutcome(err))
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	case err != nil:
+		http.Error(w, "Failed to update invitee state", http.StatusInternalServerError)
+		return
 	}
 
 	// Send check-in notification
@@ -305,8 +522,127 @@ func (api *API) ScanQRCode(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(updatedInvitee)
 }
 
+// checkEventAccess reports whether the authenticated user may act on the
+// given event, writing an error response when they may not. Organizers are
+// limited to events they own and attendees reach none; the other roles are
+// gated by route policy.
+func (api *API) checkEventAccess(w http.ResponseWriter, r *http.Request, eventID int32) bool {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return false
+	}
+
+	allowed, err := api.canAccessEvent(r.Context(), user, eventID)
+	if err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return false
+	}
+
+	if !allowed {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// canAccessEvent is the non-HTTP form of checkEventAccess. It returns an
+// error when an organizer's event cannot be loaded.
+func (api *API) canAccessEvent(ctx context.Context, user db.User, eventID int32) (bool, error) {
+	if user.Role == RoleAttendee {
+		return false, nil
+	}
+	if user.Role != RoleOrganizer {
+		return true, nil
+	}
+
+	event, err := api.db.GetEvent(ctx, eventID)
+	if err != nil {
+		return false, err
+	}
+
+	return event.OwnerID == user.ID, nil
+}
+
+// inTx runs fn with queries bound to one transaction, which is committed
+// when fn returns nil. Without a pool, as in tests, fn runs on api.db.
+func (api *API) inTx(ctx context.Context, fn func(q db.Querier) error) error {
+	if api.pool == nil {
+		return fn(api.db)
+	}
+
+	tx, err := api.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(db.New(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// bootstrapAdmin creates the admin@example.com account, or promotes it when
+// it predates roles, and then hands events without an owner to the earliest
+// admin. Owners are assigned here rather than in a migration, since the admin
+// may only exist once this has run.
+func bootstrapAdmin(ctx context.Context, queries db.Querier) error {
+	adminEmail := "admin@example.com"
+	adminPassword := "password123"
+	adminUser, err := queries.GetUserByEmail(ctx, adminEmail)
+	if err != nil {
+		// User doesn't exist, create it
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(adminPassword), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+		_, err = queries.CreateUser(ctx, db.CreateUserParams{
+			ID:           pgtype.UUID{Bytes: uuid.New(), Valid: true},
+			Email:        adminEmail,
+			PasswordHash: string(hashedPassword),
+			Role:         RoleAdmin,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create admin user: %w", err)
+		}
+		log.Printf("Admin user created successfully")
+	} else if adminUser.Role != RoleAdmin {
+		// Users created before roles existed default to organizer
+		if _, err := queries.UpdateUserRole(ctx, db.UpdateUserRoleParams{
+			ID:   adminUser.ID,
+			Role: RoleAdmin,
+		}); err != nil {
+			return fmt.Errorf("failed to promote admin user: %w", err)
+		}
+		log.Printf("Admin user promoted to admin role")
+	}
+
+	assigned, err := queries.AssignUnownedEvents(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to assign unowned events: %w", err)
+	}
+	if assigned > 0 {
+		log.Printf("Assigned %d events without an owner to an admin", assigned)
+	}
+	return nil
+}
+
 func (api *API) ListEvents(w http.ResponseWriter, r *http.Request) {
-	events, err := api.db.ListEvents(context.Background())
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var events []db.Event
+	var err error
+	if user.Role == RoleOrganizer {
+		events, err = api.db.ListEventsByOwner(r.Context(), user.ID)
+	} else {
+		events, err = api.db.ListEvents(r.Context())
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -323,30 +659,78 @@ func (api *API) ListInvitees(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
 	invitees, err := api.db.GetInviteesByEvent(context.Background(), int32(eventID))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Filter by RSVP response when asked, e.g. ?rsvp=accepted
+	if rsvp := r.URL.Query().Get("rsvp"); rsvp != "" {
+		filtered := make([]db.Invitee, 0, len(invitees))
+		for _, invitee := range invitees {
+			if invitee.RsvpStatus == rsvp {
+				filtered = append(filtered, invitee)
+			}
+		}
+		invitees = filtered
+	}
+
 	json.NewEncoder(w).Encode(invitees)
 }
 
 func (api *API) CreateEvent(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	user, ok := userFromContext(ctx)
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
 	var newEvent db.CreateEventParams
 	if err := json.NewDecoder(r.Body).Decode(&newEvent); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// Events are always owned by the user who creates them
+	newEvent.OwnerID = user.ID
+
+	if newEvent.ReentryPolicy == "" {
+		newEvent.ReentryPolicy = reentrySingle
+	}
+	if !isValidReentryPolicy(newEvent.ReentryPolicy) {
+		http.Error(w, "Invalid re-entry policy", http.StatusBadRequest)
+		return
+	}
+	// The capacity limits both how many invitees may be inside at once and
+	// how many seats are handed out as tickets, invitations and
+	// registrations, the same number for both
+	if newEvent.Capacity < 0 {
+		http.Error(w, "Capacity must not be negative", http.StatusBadRequest)
+		return
+	}
+	if newEvent.PlusOnesAllowed < 0 {
+		http.Error(w, "Plus-ones allowed must not be negative", http.StatusBadRequest)
+		return
+	}
+
 	event, err := api.db.CreateEvent(ctx, newEvent)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Every event starts with one gift per invitee
+	if _, err := api.db.CreatePerk(ctx, db.CreatePerkParams{EventID: event.ID, Name: giftPerk, Quantity: 1}); err != nil {
+		LogError(ctx, "Failed to create gift perk", err)
+	}
+
 	json.NewEncoder(w).Encode(event)
 }
 
@@ -358,6 +742,10 @@ func (api *API) GetEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !api.checkEventAccess(w, r, int32(id)) {
+		return
+	}
+
 	event, err := api.db.GetEvent(context.Background(), int32(id))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
@@ -375,170 +763,94 @@ func (api *API) UpdateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var updatedEvent db.UpdateEventParams
-	if err := json.NewDecoder(r.Body).Decode(&updatedEvent); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !api.checkEventAccess(w, r, int32(id)) {
 		return
 	}
 
-	updatedEvent.ID = int32(id)
-
-	event, err := api.db.UpdateEvent(context.Background(), updatedEvent)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	var request struct {
+		db.UpdateEventParams
+		Capacity        *int32
+		PlusOnesAllowed *int32
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	json.NewEncoder(w).Encode(event)
-}
+	updatedEvent := request.UpdateEventParams
+	updatedEvent.ID = int32(id)
 
-func (api *API) DeleteEvent(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid event ID", http.StatusBadRequest)
-		return
+	// Keep the current policy, capacity and plus-one allowance when the
+	// request does not set them
+	if updatedEvent.ReentryPolicy == "" || request.Capacity == nil || request.PlusOnesAllowed == nil {
+		current, err := api.db.GetEvent(r.Context(), int32(id))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if updatedEvent.ReentryPolicy == "" {
+			updatedEvent.ReentryPolicy = current.ReentryPolicy
+		}
+		updatedEvent.Capacity = current.Capacity
+		updatedEvent.PlusOnesAllowed = current.PlusOnesAllowed
 	}
-
-	if err := api.db.DeleteEvent(context.Background(), int32(id)); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if request.Capacity != nil {
+		updatedEvent.Capacity = *request.Capacity
 	}
-
-	w.WriteHeader(http.StatusNoContent)
-}
-
-func (api *API) UploadInvitees(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	eventID, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+	if request.PlusOnesAllowed != nil {
+		updatedEvent.PlusOnesAllowed = *request.PlusOnesAllowed
+	}
+	if !isValidReentryPolicy(updatedEvent.ReentryPolicy) {
+		http.Error(w, "Invalid re-entry policy", http.StatusBadRequest)
 		return
 	}
-
-	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB
-		http.Error(w, "Failed to parse multipart form", http.StatusInternalServerError)
+	if updatedEvent.Capacity < 0 {
+		http.Error(w, "Capacity must not be negative", http.StatusBadRequest)
 		return
 	}
-
-	file, _, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "Failed to get file from form", http.StatusBadRequest)
+	if updatedEvent.PlusOnesAllowed < 0 {
+		http.Error(w, "Plus-ones allowed must not be negative", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	event, err := api.db.UpdateEvent(context.Background(), updatedEvent)
 	if err != nil {
-		http.Error(w, "Failed to read CSV data", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	hmacSecret := os.Getenv("HMAC_SECRET")
-	baseURL := os.Getenv("BASE_URL")
-	bucketName := os.Getenv("MINIO_BUCKET_NAME")
-
-	processedCount := 0
-	for _, record := range records {
-		email := record[0]
-		invitee, err := api.db.CreateInvitee(context.Background(), db.CreateInviteeParams{
-			EventID: int32(eventID),
-			Email:   email,
-			ExpiresAt: pgtype.Timestamptz{
-				Time:  time.Now().Add(24 * time.Hour),
-				Valid: true,
-			},
-			Status: "pending",
-		})
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		mac := hmac.New(sha256.New, []byte(hmacSecret))
-		mac.Write([]byte(strconv.Itoa(int(invitee.ID))))
-		hmacSignature := hex.EncodeToString(mac.Sum(nil))
-
-		validationURL := fmt.Sprintf("%s/validate?invitee_id=%d&signature=%s", baseURL, invitee.ID, hmacSignature)
-
-		png, err := qrcode.Encode(validationURL, qrcode.Medium, 256)
-		if err != nil {
-			http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-			return
-		}
-
-		objectName := fmt.Sprintf("%d.png", invitee.ID)
-		_, err = api.minioClient.PutObject(context.Background(), bucketName, objectName, bytes.NewReader(png), int64(len(png)), minio.PutObjectOptions{ContentType: "image/png"})
-		if err != nil {
-			http.Error(w, "Failed to upload QR code to MinIO", http.StatusInternalServerError)
-			return
-		}
-
-		qrCodeURL := fmt.Sprintf("/qrcodes/%s", objectName)
-
-		_, err = api.db.UpdateInvitee(context.Background(), db.UpdateInviteeParams{
-			ID:            invitee.ID,
-			QrCodeUrl:     pgtype.Text{String: qrCodeURL, Valid: true},
-			HmacSignature: pgtype.Text{String: hmacSignature, Valid: true},
-		})
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		processedCount++
-	}
-
-	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(event)
 }
 
-func (api *API) ValidateInvitee(w http.ResponseWriter, r *http.Request) {
-	inviteeIDStr := r.URL.Query().Get("invitee_id")
-	signature := r.URL.Query().Get("signature")
-
-	inviteeID, err := strconv.Atoi(inviteeIDStr)
+func (api *API) DeleteEvent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid invitee ID", http.StatusBadRequest)
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
 		return
 	}
 
-	invitee, err := api.db.GetInvitee(context.Background(), int32(inviteeID))
-	if err != nil {
-		http.Error(w, "Invitee not found", http.StatusNotFound)
+	if !api.checkEventAccess(w, r, int32(id)) {
 		return
 	}
 
-	hmacSecret := os.Getenv("HMAC_SECRET")
-
-	mac := hmac.New(sha256.New, []byte(hmacSecret))
-	mac.Write([]byte(strconv.Itoa(int(invitee.ID))))
-	expectedSignature := hex.EncodeToString(mac.Sum(nil))
-
-	if !hmac.Equal([]byte(signature), []byte(expectedSignature)) {
-		_, err := api.db.UpdateInviteeState(context.Background(), db.UpdateInviteeStateParams{
-			ID:    invitee.ID,
-			State: "denied",
-		})
-		if err != nil {
-			http.Error(w, "Failed to update invitee state", http.StatusInternalServerError)
-			return
-		}
-
-		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+	if err := api.db.DeleteEvent(context.Background(), int32(id)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	updatedInvitee, err := api.db.UpdateInviteeState(context.Background(), db.UpdateInviteeStateParams{
-		ID:    invitee.ID,
-		State: "checked_in",
-	})
-	if err != nil {
-		http.Error(w, "Failed to update invitee state", http.StatusInternalServerError)
-		return
-	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	json.NewEncoder(w).Encode(updatedInvitee)
+// ValidateInvitee scans the token of the validation URL printed on badges.
+// It is the same scan as ScanQRCode.
+func (api *API) ValidateInvitee(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		// Badges printed before signed tokens link to ?invitee_id=&signature=
+		token = r.URL.Query().Get("signature")
+	}
+	api.scanQRToken(w, r, token)
 }
 
 func (api *API) ServeQRCode(w http.ResponseWriter, r *http.Request) {
@@ -577,6 +889,10 @@ func (api *API) ExportInvitees(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
 	invitees, err := api.db.GetInviteesByEvent(context.Background(), int32(eventID))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -589,25 +905,39 @@ func (api *API) ExportInvitees(w http.ResponseWriter, r *http.Request) {
 	csvWriter := csv.NewWriter(w)
 	defer csvWriter.Flush()
 
-	header := []string{"ID", "Email", "Status", "Created At", "Updated At", "Expires At", "Gift Claimed At"}
+	header := []string{"ID", "Email", "First Name", "Last Name", "Phone", "Company", "Tier", "Tags", "Status", "RSVP", "RSVP At", "Plus Ones", "Plus One Names", "Created At", "Updated At", "Expires At", "Gift Claimed At", "Custom Fields"}
 	if err := csvWriter.Write(header); err != nil {
 		http.Error(w, "Failed to write CSV header", http.StatusInternalServerError)
 		return
 	}
 
 	for _, invitee := range invitees {
-		var giftClaimedAt string
+		var giftClaimedAt, rsvpAt string
 		if invitee.GiftClaimedAt.Valid {
 			giftClaimedAt = invitee.GiftClaimedAt.Time.Format(time.RFC3339)
 		}
+		if invitee.RsvpAt.Valid {
+			rsvpAt = invitee.RsvpAt.Time.Format(time.RFC3339)
+		}
 		record := []string{
 			strconv.Itoa(int(invitee.ID)),
 			invitee.Email,
+			invitee.FirstName.String,
+			invitee.LastName.String,
+			invitee.Phone.String,
+			invitee.Company.String,
+			invitee.Tier.String,
+			strings.Join(invitee.Tags, ";"),
 			invitee.Status,
+			invitee.RsvpStatus,
+			rsvpAt,
+			strconv.Itoa(int(invitee.PlusOnes)),
+			strings.Join(invitee.PlusOneNames, ";"),
 			invitee.CreatedAt.Time.Format(time.RFC3339),
 			invitee.UpdatedAt.Time.Format(time.RFC3339),
 			invitee.ExpiresAt.Time.Format(time.RFC3339),
 			giftClaimedAt,
+			string(invitee.CustomFields),
 		}
 		if err := csvWriter.Write(record); err != nil {
 			http.Error(w, "Failed to write CSV record", http.StatusInternalServerError)
@@ -631,6 +961,11 @@ func (api *API) AnonymizeUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := api.sessions.RevokeUser(ctx, userID.String()); err != nil {
+		http.Error(w, "Failed to revoke user sessions", http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -643,10 +978,28 @@ func (api *API) AnonymizeInvitee(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	invitee, err := api.db.GetInvitee(ctx, int32(inviteeID))
+	if err != nil {
+		http.Error(w, "Invitee not found", http.StatusNotFound)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, invitee.EventID) {
+		return
+	}
+
 	if err := api.db.AnonymizeInvitee(ctx, int32(inviteeID)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if err := api.db.AnonymizeTicketChanges(ctx, int32(inviteeID)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := api.db.DeleteRegistrationsByInvitee(ctx, pgtype.Int4{Int32: int32(inviteeID), Valid: true}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -681,40 +1034,132 @@ func (api *API) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := clientIP(r)
+	if lockout := api.rateLimiter.LoginLockout(ctx, loginRequest.Email, ip); lockout > 0 {
+		writeRetryAfter(w, "Too many failed login attempts, try again later", lockout)
+		return
+	}
+
 	user, err := api.db.GetUserByEmail(ctx, loginRequest.Email)
 	if err != nil {
+		api.rateLimiter.RecordLoginFailure(ctx, loginRequest.Email, ip)
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(loginRequest.Password)); err != nil {
+		api.rateLimiter.RecordLoginFailure(ctx, loginRequest.Email, ip)
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
+	api.rateLimiter.ResetLoginFailures(ctx, loginRequest.Email)
 
 	var userID uuid.UUID
 	if user.ID.Valid {
 		userID = user.ID.Bytes
 	}
 
-	token, err := api.createLogin(userID)
+	api.writeTokens(w, r, userID, user.Role, uuid.New().String())
+}
+
+func (api *API) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var refreshRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&refreshRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, err := api.sessions.ConsumeRefreshToken(ctx, refreshRequest.RefreshToken)
+	if errors.Is(err, errRefreshTokenReused) {
+		LogInfo(ctx, "Rotated refresh token reused, session revoked", slog.String("session_id", session.SessionID))
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, errInvalidRefreshToken) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := uuid.Parse(session.UserID)
+	if err != nil {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// Re-read the user so role changes and deletions take effect on refresh
+	user, err := api.db.GetUserByID(ctx, pgtype.UUID{Bytes: userID, Valid: true})
+	if err != nil {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	api.writeTokens(w, r, userID, user.Role, session.SessionID)
+}
+
+func (api *API) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// The refresh token is optional; revoking the session invalidates it either way
+	var logoutRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&logoutRequest); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := api.sessions.RevokeSession(ctx, sessionIDFromContext(ctx), logoutRequest.RefreshToken); err != nil {
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeTokens issues a new access token and rotated refresh token for a session
+func (api *API) writeTokens(w http.ResponseWriter, r *http.Request, userID uuid.UUID, role, sessionID string) {
+	token, err := api.createLogin(userID, role, sessionID)
 	if err != nil {
 		http.Error(w, "Failed to create token", http.StatusInternalServerError)
 		return
 	}
 
+	refreshToken, err := api.sessions.IssueRefreshToken(r.Context(), userID, sessionID)
+	if err != nil {
+		http.Error(w, "Failed to create refresh token", http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": token,
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(accessTokenTTL.Seconds()),
 	})
 }
 
-func (api *API) createLogin(userID uuid.UUID) (string, error) {
+func (api *API) createLogin(userID uuid.UUID, role, sessionID string) (string, error) {
+	now := time.Now()
+
 	// Create a new token object, specifying signing method and the claims
 	// you would like it to contain.
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": userID.String(),
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"role":    role,
+		"sid":     sessionID,
+		"iat":     now.Unix(),
+		"exp":     now.Add(accessTokenTTL).Unix(),
 	})
 
 	// Sign and get the complete encoded token as a string using the secret
@@ -742,10 +1187,12 @@ func (api *API) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Self-registered users are attendees; other roles are granted by an admin
 	user, err := api.db.CreateUser(ctx, db.CreateUserParams{
 		ID:           pgtype.UUID{Bytes: uuid.New(), Valid: true},
 		Email:        newUser.Email,
 		PasswordHash: string(hashedPassword),
+		Role:         RoleAttendee,
 	})
 
 	if err != nil {
@@ -757,6 +1204,41 @@ func (api *API) CreateUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
+func (api *API) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var roleRequest struct {
+		Role string `json:"role"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&roleRequest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !isValidRole(roleRequest.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	user, err := api.db.UpdateUserRole(ctx, db.UpdateUserRoleParams{
+		ID:   pgtype.UUID{Bytes: userID, Valid: true},
+		Role: roleRequest.Role,
+	})
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(user)
+}
+
 func (api *API) StartInviteeExpirationCron() {
 	ticker := time.NewTicker(1 * time.Minute)
 	go func() {
@@ -775,10 +1257,19 @@ func (api *API) expireOldInvitees() {
 	}
 
 	for _, invitee := range invitees {
-		api.db.UpdateInviteeStatus(ctx, db.UpdateInviteeStatusParams{
+		if _, err := api.db.UpdateInviteeStatus(ctx, db.UpdateInviteeStatusParams{
 			ID:     invitee.ID,
 			Status: "expired",
+		}); err != nil {
+			continue
+		}
+		api.live.Publish(ctx, liveInviteeExpired, invitee.EventID, map[string]interface{}{
+			"invitee_id": invitee.ID,
 		})
+
+		// The seat goes to the next person on the waitlist
+		api.lapseWaitlistInvitee(ctx, invitee)
+		api.promoteWaitlist(ctx, invitee.EventID, 1)
 	}
 }
 
@@ -800,91 +1291,183 @@ func (api *API) expireOldOrders() {
 	}
 
 	for _, order := range orders {
-		api.db.UpdateOrderStatus(ctx, db.UpdateOrderStatusParams{
+		// Returns the held tickets to the event and its ticket types; orders
+		// confirmed meanwhile are skipped
+		if _, err := api.db.ReleaseOrder(ctx, db.ReleaseOrderParams{
 			ID:     order.ID,
-			Status: "expired",
-		})
+			Status: orderExpired,
+		}); err != nil {
+			continue
+		}
+		RecordOrderExpiration()
+		api.promoteWaitlist(ctx, order.EventID, int(order.Quantity))
 	}
 }
 
-func (api *API) ReprintRequest(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+// issueQRCode signs a token for the invitee, renders the validation URL as a
+// PNG QR code, uploads it to MinIO and stores the URL and token on the
+// invitee. Tokens issued before the latest call stop being accepted.
+func (api *API) issueQRCode(ctx context.Context, inviteeID int32) (db.Invitee, error) {
+	baseURL := os.Getenv("BASE_URL")
+	bucketName := os.Getenv("MINIO_BUCKET_NAME")
 
-	user, ok := ctx.Value("user").(db.User)
-	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
-		return
+	invitee, err := api.db.GetInvitee(ctx, inviteeID)
+	if err != nil {
+		return db.Invitee{}, fmt.Errorf("failed to get invitee: %w", err)
 	}
-
-	vars := mux.Vars(r)
-	inviteeID, err := strconv.Atoi(vars["invitee_id"])
+	event, err := api.db.GetEvent(ctx, invitee.EventID)
 	if err != nil {
-		http.Error(w, "Invalid invitee ID", http.StatusBadRequest)
-		return
+		return db.Invitee{}, fmt.Errorf("failed to get event: %w", err)
 	}
 
-	// Create a reprint request record
-	_, err = api.db.CreateReprintRequest(ctx, db.CreateReprintRequestParams{
-		InviteeID: int32(inviteeID),
-		UserID:    user.ID,
-	})
+	// Badges stay valid until the end of the event day
+	issuedAt := time.Now().Truncate(time.Second)
+	expiresAt := event.Date.Time.Add(qrTokenGracePeriod)
+	token, _, err := api.qrKeys.Sign(invitee.EventID, inviteeID, issuedAt, expiresAt)
 	if err != nil {
-		http.Error(w, "Failed to create reprint request", http.StatusInternalServerError)
-		return
+		return db.Invitee{}, fmt.Errorf("failed to sign QR token: %w", err)
 	}
 
-	// Regenerate the QR code
-	hmacSecret := os.Getenv("HMAC_SECRET")
-	baseURL := os.Getenv("BASE_URL")
-	bucketName := os.Getenv("MINIO_BUCKET_NAME")
-
-	mac := hmac.New(sha256.New, []byte(hmacSecret))
-	mac.Write([]byte(strconv.Itoa(inviteeID)))
-	hmacSignature := hex.EncodeToString(mac.Sum(nil))
-
-	validationURL := fmt.Sprintf("%s/validate?invitee_id=%d&signature=%s", baseURL, inviteeID, hmacSignature)
+	validationURL := fmt.Sprintf("%s/validate?token=%s", baseURL, token)
 
 	png, err := qrcode.Encode(validationURL, qrcode.Medium, 256)
 	if err != nil {
-		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
-		return
+		return db.Invitee{}, fmt.Errorf("failed to generate QR code: %w", err)
 	}
 
 	objectName := fmt.Sprintf("%d.png", inviteeID)
-	_, err = api.minioClient.PutObject(context.Background(), bucketName, objectName, bytes.NewReader(png), int64(len(png)), minio.PutObjectOptions{ContentType: "image/png"})
+	_, err = api.minioClient.PutObject(ctx, bucketName, objectName, bytes.NewReader(png), int64(len(png)), minio.PutObjectOptions{ContentType: "image/png"})
 	if err != nil {
-		http.Error(w, "Failed to upload QR code to MinIO", http.StatusInternalServerError)
-		return
+		return db.Invitee{}, fmt.Errorf("failed to upload QR code to MinIO: %w", err)
 	}
 
 	qrCodeURL := fmt.Sprintf("/qrcodes/%s", objectName)
 
-	updatedInvitee, err := api.db.UpdateInvitee(context.Background(), db.UpdateInviteeParams{
-		ID:            int32(inviteeID),
+	return api.db.UpdateInvitee(ctx, db.UpdateInviteeParams{
+		ID:            inviteeID,
 		QrCodeUrl:     pgtype.Text{String: qrCodeURL, Valid: true},
-		HmacSignature: pgtype.Text{String: hmacSignature, Valid: true},
+		HmacSignature: pgtype.Text{String: token, Valid: true},
+		QrIssuedAt:    pgtype.Timestamptz{Time: issuedAt, Valid: true},
 	})
+}
+
+// inviteeForQRToken verifies a QR token as of the scan time and loads the
+// invitee it was issued for. Only the token stored on the invitee is
+// current, so a reprint or transfer supersedes the previous badge at once.
+// When the token is authentic but expired, superseded or its ticket was
+// cancelled the invitee is returned together with the error so the denial
+// can be recorded; otherwise a failed lookup returns a zero invitee.
+func (api *API) inviteeForQRToken(ctx context.Context, token string, scannedAt time.Time) (db.Invitee, error) {
+	claims, err := api.qrKeys.Verify(token, scannedAt)
+	if errors.Is(err, signing.ErrMalformedToken) && isLegacySignature(token) {
+		return api.inviteeForLegacySignature(ctx, token, scannedAt)
+	}
+	if err != nil && !errors.Is(err, signing.ErrTokenExpired) {
+		return db.Invitee{}, err
+	}
+
+	invitee, lookupErr := api.db.GetInvitee(ctx, claims.InviteeID)
+	if lookupErr != nil {
+		return db.Invitee{}, lookupErr
+	}
+	if invitee.EventID != claims.EventID {
+		return db.Invitee{}, signing.ErrInvalidSignature
+	}
+
 	if err != nil {
-		http.Error(w, "Failed to update invitee with new QR code", http.StatusInternalServerError)
-		return
+		return invitee, err
+	}
+	if isTicketCancelled(invitee) {
+		return invitee, errInviteeCancelled
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(invitee.HmacSignature.String)) != 1 {
+		return invitee, errQRTokenSuperseded
 	}
 
-	json.NewEncoder(w).Encode(updatedInvitee)
+	return invitee, nil
 }
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+// isLegacySignature reports whether the scanned value has the form of the
+// hex HMAC printed on badges before signed tokens were introduced
+func isLegacySignature(value string) bool {
+	_, err := hex.DecodeString(value)
+	return err == nil && len(value) == hex.EncodedLen(sha256.Size)
 }
 
-func (api *API) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// inviteeForLegacySignature loads the invitee of a badge printed before
+// signed tokens. Such a badge is current until the invitee's QR code is
+// issued again, and expires with the event like a token would.
+func (api *API) inviteeForLegacySignature(ctx context.Context, signature string, scannedAt time.Time) (db.Invitee, error) {
+	invitee, err := api.db.GetInviteeBySignature(ctx, pgtype.Text{String: signature, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return db.Invitee{}, signing.ErrInvalidSignature
+	}
+	if err != nil {
+		return db.Invitee{}, err
+	}
+
+	event, err := api.db.GetEvent(ctx, invitee.EventID)
 	if err != nil {
+		return db.Invitee{}, err
+	}
+	if !scannedAt.Before(event.Date.Time.Add(qrTokenGracePeriod)) {
+		return invitee, signing.ErrTokenExpired
+	}
+
+	return invitee, nil
+}
+
+// writeQRTokenError reports a token that could not be matched to an invitee
+func writeQRTokenError(w http.ResponseWriter, err error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Invitee not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Invalid QR token", http.StatusUnauthorized)
+}
+
+func (api *API) ReprintRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := userFromContext(ctx)
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
 		return
 	}
-	defer conn.Close()
 
-	// WebSocket connection established but not fully implemented
-	conn.Close()
-}
\ No newline at end of file
+	vars := mux.Vars(r)
+	inviteeID, err := strconv.Atoi(vars["invitee_id"])
+	if err != nil {
+		http.Error(w, "Invalid invitee ID", http.StatusBadRequest)
+		return
+	}
+
+	invitee, err := api.db.GetInvitee(ctx, int32(inviteeID))
+	if err != nil {
+		http.Error(w, "Invitee not found", http.StatusNotFound)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, invitee.EventID) {
+		return
+	}
+
+	// Create a reprint request record
+	_, err = api.db.CreateReprintRequest(ctx, db.CreateReprintRequestParams{
+		InviteeID: int32(inviteeID),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		http.Error(w, "Failed to create reprint request", http.StatusInternalServerError)
+		return
+	}
+
+	// Regenerate the QR code
+	updatedInvitee, err := api.issueQRCode(ctx, int32(inviteeID))
+	if err != nil {
+		http.Error(w, "Failed to regenerate QR code", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updatedInvitee)
+}
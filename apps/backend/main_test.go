@@ -1,13 +1,32 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"eventpass.pro/apps/backend/db"
+	"eventpass.pro/apps/backend/signing"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func TestListInvitees(t *testing.T) {
@@ -24,6 +43,7 @@ func TestListInvitees(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	req = withTestUser(req, RoleAdmin)
 
 	vars := map[string]string{
 		"id": "1",
@@ -41,3 +61,2052 @@ func TestListInvitees(t *testing.T) {
 
 	// TODO: Add more assertions, like checking the response body
 }
+
+func TestListInviteesForbiddenForOtherOrganizer(t *testing.T) {
+	owner := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	organizer := db.User{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Role: RoleOrganizer}
+
+	api := &API{
+		db: &db.MockQuerier{
+			GetEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return db.Event{ID: id, OwnerID: owner}, nil
+			},
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/events/1/invitees", nil)
+	req = req.WithContext(context.WithValue(req.Context(), userContextKey, organizer))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/events/{id}/invitees", api.ListInvitees)
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusForbidden)
+	}
+}
+
+func TestCreateUserIsAttendee(t *testing.T) {
+	var created db.CreateUserParams
+	api := &API{
+		db: &db.MockQuerier{
+			CreateUserFunc: func(ctx context.Context, arg db.CreateUserParams) (db.User, error) {
+				created = arg
+				return db.User{ID: arg.ID, Email: arg.Email, Role: arg.Role}, nil
+			},
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"email":"new@example.com","password":"secret"}`))
+	api.CreateUser(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	if created.Role != RoleAttendee {
+		t.Errorf("self-registered user got role %q want %q", created.Role, RoleAttendee)
+	}
+}
+
+func TestAttendeeCannotAccessEvents(t *testing.T) {
+	api := &API{db: &db.MockQuerier{}}
+	attendee := db.User{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Role: RoleAttendee}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/events/1/zones", nil)
+	req = req.WithContext(context.WithValue(req.Context(), userContextKey, attendee))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/events/{id}/zones", api.ListZones)
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	handler := requireRole(RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		role string
+		want int
+	}{
+		{RoleAdmin, http.StatusNoContent},
+		{RoleOrganizer, http.StatusForbidden},
+		{RoleDoorStaff, http.StatusForbidden},
+		{RoleAuditor, http.StatusForbidden},
+		{RoleAttendee, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/users/1/anonymize", nil)
+		req = withTestUser(req, tt.role)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("role %s: got status %v want %v", tt.role, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestInviteeRowParser(t *testing.T) {
+	header := []string{"E-mail Address", "Given", "Tier", "Tags", "Dietary"}
+	parser, err := newInviteeRowParser(header, inviteeColumnMapping{"email": "E-mail Address", "first_name": "Given", "tier": "Tier", "tags": "Tags"})
+	if err != nil {
+		t.Fatalf("newInviteeRowParser: %v", err)
+	}
+
+	row, err := parser.parse([]string{"ada@example.com", "Ada", "vip", "speaker; press", "vegan"}, time.Now())
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if row.Email != "ada@example.com" || row.FirstName.String != "Ada" || row.Tier.String != "vip" {
+		t.Errorf("unexpected row: %+v", row)
+	}
+	if len(row.Tags) != 2 || row.Tags[1] != "press" {
+		t.Errorf("unexpected tags: %v", row.Tags)
+	}
+	if string(row.CustomFields) != `{"Dietary":"vegan"}` {
+		t.Errorf("unexpected custom fields: %s", row.CustomFields)
+	}
+
+	if _, err := parser.parse([]string{"not-an-email", "Ada", "vip"}, time.Now()); err == nil {
+		t.Error("expected malformed email to be rejected")
+	}
+
+	if _, err := newInviteeRowParser(header, inviteeColumnMapping{"email": "Missing"}); err == nil {
+		t.Error("expected mapping to an unknown column to be rejected")
+	}
+}
+
+func TestImportReportsDuplicateEmails(t *testing.T) {
+	job := db.ImportJob{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, EventID: 1}
+	otherJob := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	existing := map[string]db.Invitee{
+		"ada@example.com":   {ID: 1, EventID: 1, ImportJobID: job.ID, ImportRow: pgtype.Int4{Int32: 2, Valid: true}, HmacSignature: pgtype.Text{String: "token", Valid: true}},
+		"grace@example.com": {ID: 2, EventID: 1, ImportJobID: otherJob, ImportRow: pgtype.Int4{Int32: 2, Valid: true}},
+	}
+
+	api := &API{
+		db: &db.MockQuerier{
+			CreateInviteeFunc: func(ctx context.Context, arg db.CreateInviteeParams) (db.Invitee, error) {
+				return db.Invitee{}, &pgconn.PgError{Code: "23505"}
+			},
+			GetInviteeByEventAndEmailFunc: func(ctx context.Context, arg db.GetInviteeByEventAndEmailParams) (db.Invitee, error) {
+				return existing[arg.Email], nil
+			},
+		},
+	}
+
+	tests := []struct {
+		email  string
+		row    int32
+		reason string
+	}{
+		// The row that created the invitee is re-run after a resume
+		{"ada@example.com", 2, ""},
+		{"ada@example.com", 5, "duplicate email, already imported from row 2"},
+		{"grace@example.com", 2, "duplicate email for this event"},
+	}
+
+	for _, tt := range tests {
+		err := api.importInviteeRow(context.Background(), job, inviteeRow{Email: tt.email}, tt.row)
+		var rowErr *importRowError
+		switch {
+		case tt.reason == "" && err != nil:
+			t.Errorf("%s row %d: got %v want no error", tt.email, tt.row, err)
+		case tt.reason != "" && (!errors.As(err, &rowErr) || rowErr.reason != tt.reason):
+			t.Errorf("%s row %d: got %v want %q", tt.email, tt.row, err, tt.reason)
+		}
+	}
+}
+
+func TestImportStopsWhenLeaseLost(t *testing.T) {
+	job := db.ImportJob{
+		ID:        pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		EventID:   1,
+		TotalRows: importBatchSize + 1,
+		LeaseID:   pgtype.UUID{Bytes: uuid.New(), Valid: true},
+	}
+
+	var rows strings.Builder
+	rows.WriteString("email\n")
+	for i := 0; i <= importBatchSize; i++ {
+		rows.WriteString("not-an-email\n")
+	}
+
+	var checkpoints int
+	api := &API{
+		db: &db.MockQuerier{
+			CreateImportJobErrorFunc: func(ctx context.Context, arg db.CreateImportJobErrorParams) error {
+				return nil
+			},
+			UpdateImportJobProgressFunc: func(ctx context.Context, arg db.UpdateImportJobProgressParams) (int64, error) {
+				checkpoints++
+				if arg.LeaseID != job.LeaseID {
+					t.Errorf("checkpoint under lease %v want %v", arg.LeaseID, job.LeaseID)
+				}
+				// Another worker claimed the job after the first batch
+				if checkpoints > 1 {
+					return 0, nil
+				}
+				return 1, nil
+			},
+			CompleteImportJobFunc: func(ctx context.Context, arg db.CompleteImportJobParams) (int64, error) {
+				t.Error("import completed after its lease was lost")
+				return 0, nil
+			},
+		},
+	}
+
+	err := api.importCSV(context.Background(), job, []byte(rows.String()))
+	if !errors.Is(err, errImportLeaseLost) {
+		t.Errorf("got %v want %v", err, errImportLeaseLost)
+	}
+	if checkpoints != 2 {
+		t.Errorf("got %d checkpoints want 2", checkpoints)
+	}
+}
+
+// testKeys returns the QR signing keyring the handler tests sign with
+func testKeys(t *testing.T) *signing.Keyring {
+	t.Helper()
+	keys, err := signing.NewKeyring("k1", map[string][]byte{"k1": []byte("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// signedTestToken signs the QR token of an invitee issued at issuedAt, which
+// stays valid for an hour
+func signedTestToken(t *testing.T, keys *signing.Keyring, eventID, inviteeID int32, issuedAt time.Time) string {
+	t.Helper()
+	token, _, err := keys.Sign(eventID, inviteeID, issuedAt, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// withTestUser returns the request authenticated as a user with the role
+func withTestUser(req *http.Request, role string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), userContextKey, db.User{Role: role}))
+}
+
+func TestReprintedQRTokenIsSuperseded(t *testing.T) {
+	keys := testKeys(t)
+	// The reprint happens within the same second as the original print
+	issuedAt := time.Now().Truncate(time.Second)
+	printed := signedTestToken(t, keys, 1, 42, issuedAt)
+	reprinted := signedTestToken(t, keys, 1, 42, issuedAt)
+
+	var recorded db.CreateCheckInParams
+	api := &API{
+		qrKeys: keys,
+		db: &db.MockQuerier{
+			GetInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+				return db.Invitee{ID: id, EventID: 1, State: "pending", HmacSignature: pgtype.Text{String: reprinted, Valid: true}}, nil
+			},
+			// Without AdmitInvitee or UpdateInviteeState mocks any change to
+			// the holder of the reprint panics
+			CreateCheckInFunc: func(ctx context.Context, arg db.CreateCheckInParams) (db.CheckIn, error) {
+				recorded = arg
+				return db.CheckIn{Outcome: arg.Outcome}, nil
+			},
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/validate?token="+printed, nil)
+	req = withTestUser(req, RoleDoorStaff)
+	api.ValidateInvitee(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusUnauthorized)
+	}
+	if recorded.Outcome != checkInSuperseded || recorded.InviteeID.Int32 != 42 {
+		t.Errorf("unexpected scan recorded: %+v", recorded)
+	}
+}
+
+func TestLegacyBadgeIsAccepted(t *testing.T) {
+	keys := testKeys(t)
+	signature := strings.Repeat("ab", 32)
+
+	var admitted bool
+	api := &API{
+		qrKeys: keys,
+		db: &db.MockQuerier{
+			GetInviteeBySignatureFunc: func(ctx context.Context, hmacSignature pgtype.Text) (db.Invitee, error) {
+				if hmacSignature.String != signature {
+					return db.Invitee{}, pgx.ErrNoRows
+				}
+				return db.Invitee{ID: 42, EventID: 1, HmacSignature: hmacSignature}, nil
+			},
+			GetEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return db.Event{ID: id, Date: pgtype.Timestamp{Time: time.Now().Add(time.Hour), Valid: true}}, nil
+			},
+			GetInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+				return db.Invitee{ID: id, EventID: 1, State: "checked_in"}, nil
+			},
+			AdmitInviteeFunc: func(ctx context.Context, arg db.AdmitInviteeParams) (db.CheckIn, error) {
+				admitted = arg.ID == 42
+				return db.CheckIn{ID: 1, Outcome: checkInAdmitted}, nil
+			},
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/validate?invitee_id=42&signature="+signature, nil)
+	req = withTestUser(req, RoleDoorStaff)
+	api.ValidateInvitee(rr, req)
+
+	if rr.Code != http.StatusOK || !admitted {
+		t.Errorf("got status %d and admitted %v want %d and true: %s", rr.Code, admitted, http.StatusOK, rr.Body)
+	}
+}
+
+func TestSyncScansRecordsConflict(t *testing.T) {
+	keys := testKeys(t)
+	issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	token := signedTestToken(t, keys, 1, 42, issuedAt)
+
+	var recorded db.CreateCheckInParams
+	api := &API{
+		qrKeys: keys,
+		db: &db.MockQuerier{
+			GetInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+				return db.Invitee{
+					ID:            id,
+					EventID:       1,
+					HmacSignature: pgtype.Text{String: token, Valid: true},
+					GiftClaimedAt: pgtype.Timestamp{Time: issuedAt, Valid: true},
+				}, nil
+			},
+			GetCheckInByDeviceScanFunc: func(ctx context.Context, arg db.GetCheckInByDeviceScanParams) (db.CheckIn, error) {
+				return db.CheckIn{}, pgx.ErrNoRows
+			},
+			AdmitInviteeFunc: func(ctx context.Context, arg db.AdmitInviteeParams) (db.CheckIn, error) {
+				return db.CheckIn{}, pgx.ErrNoRows
+			},
+			GetAdmissionCheckInFunc: func(ctx context.Context, inviteeID pgtype.Int4) (db.CheckIn, error) {
+				return db.CheckIn{Outcome: checkInAdmitted, DeviceID: pgtype.Text{String: "door-a", Valid: true}}, nil
+			},
+			CreateCheckInFunc: func(ctx context.Context, arg db.CreateCheckInParams) (db.CheckIn, error) {
+				recorded = arg
+				return db.CheckIn{ID: 7, InviteeID: arg.InviteeID, Outcome: arg.Outcome, ConflictDeviceID: arg.ConflictDeviceID}, nil
+			},
+		},
+	}
+
+	body := fmt.Sprintf(`{"scans":[{"token":%q,"device_id":"door-b","scanned_at":%q}]}`, token, time.Now().Format(time.RFC3339))
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/scans/sync", strings.NewReader(body))
+	req = withTestUser(req, RoleDoorStaff)
+	api.SyncScans(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	if recorded.Outcome != checkInConflict || recorded.ConflictDeviceID.String != "door-a" {
+		t.Errorf("unexpected check-in recorded: %+v", recorded)
+	}
+
+	var response struct {
+		Results []offlineScanResult `json:"results"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Results) != 1 || response.Results[0].Status != checkInConflict {
+		t.Errorf("unexpected results: %+v", response.Results)
+	}
+}
+
+func TestScanLedgerRecordsEveryAttempt(t *testing.T) {
+	keys := testKeys(t)
+	forger, err := signing.NewKeyring("k1", map[string][]byte{"k1": []byte("guess")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuedAt := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	sign := func(keys *signing.Keyring, inviteeID int32, expiresAt time.Time) string {
+		token, _, err := keys.Sign(1, inviteeID, issuedAt, expiresAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	operator := db.User{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Role: RoleDoorStaff}
+
+	tests := []struct {
+		name      string
+		token     string
+		want      int
+		outcome   string
+		inviteeID int32
+	}{
+		{"forged", sign(forger, 42, time.Now().Add(time.Hour)), http.StatusUnauthorized, checkInInvalidSignature, 0},
+		{"unknown invitee", sign(keys, 404, time.Now().Add(time.Hour)), http.StatusNotFound, checkInNotFound, 0},
+		{"expired", sign(keys, 42, time.Now().Add(-time.Hour)), http.StatusUnauthorized, checkInExpired, 42},
+	}
+
+	for _, tt := range tests {
+		var recorded []db.CreateCheckInParams
+		api := &API{
+			qrKeys: keys,
+			db: &db.MockQuerier{
+				GetInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+					if id != 42 {
+						return db.Invitee{}, pgx.ErrNoRows
+					}
+					return db.Invitee{ID: id, EventID: 1, QrIssuedAt: pgtype.Timestamptz{Time: issuedAt, Valid: true}}, nil
+				},
+				CreateCheckInFunc: func(ctx context.Context, arg db.CreateCheckInParams) (db.CheckIn, error) {
+					recorded = append(recorded, arg)
+					return db.CheckIn{Outcome: arg.Outcome}, nil
+				},
+			},
+		}
+
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/scan/"+tt.token+"?device_id=door-a&gate=north", nil)
+		req = mux.SetURLVars(req, map[string]string{"qr": tt.token})
+		req = req.WithContext(context.WithValue(req.Context(), userContextKey, operator))
+		api.ScanQRCode(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("%s: got status %d want %d", tt.name, rr.Code, tt.want)
+		}
+		if len(recorded) != 1 {
+			t.Fatalf("%s: got %d scans recorded want 1", tt.name, len(recorded))
+		}
+		scan := recorded[0]
+		if scan.Outcome != tt.outcome || scan.InviteeID.Int32 != tt.inviteeID || scan.EventID.Valid != (tt.inviteeID != 0) {
+			t.Errorf("%s: unexpected scan recorded: %+v", tt.name, scan)
+		}
+		if scan.DeviceID.String != "door-a" || scan.Gate.String != "north" || scan.OperatorID != operator.ID || !scan.CheckedInAt.Valid {
+			t.Errorf("%s: scan source not recorded: %+v", tt.name, scan)
+		}
+	}
+}
+
+func TestScanLedgerRecordsAdmission(t *testing.T) {
+	keys := testKeys(t)
+	issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	token := signedTestToken(t, keys, 1, 42, issuedAt)
+	operator := db.User{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Role: RoleDoorStaff}
+
+	var admitted db.AdmitInviteeParams
+	api := &API{
+		qrKeys: keys,
+		db: &db.MockQuerier{
+			GetInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+				return db.Invitee{ID: id, EventID: 1, HmacSignature: pgtype.Text{String: token, Valid: true}}, nil
+			},
+			GetGateByNameFunc: func(ctx context.Context, arg db.GetGateByNameParams) (db.Gate, error) {
+				return db.Gate{}, pgx.ErrNoRows
+			},
+			AdmitInviteeFunc: func(ctx context.Context, arg db.AdmitInviteeParams) (db.CheckIn, error) {
+				admitted = arg
+				return db.CheckIn{ID: 1, InviteeID: pgtype.Int4{Int32: arg.ID, Valid: true}, Outcome: checkInAdmitted}, nil
+			},
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/scan/"+token+"?device_id=door-a&gate=north", nil)
+	req = mux.SetURLVars(req, map[string]string{"qr": token})
+	req = req.WithContext(context.WithValue(req.Context(), userContextKey, operator))
+	api.ScanQRCode(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	// The admission is written to check_ins by AdmitInvitee itself
+	if admitted.ID != 42 || admitted.DeviceID.String != "door-a" || admitted.Gate.String != "north" || admitted.OperatorID != operator.ID || !admitted.CheckedInAt.Valid {
+		t.Errorf("unexpected admission recorded: %+v", admitted)
+	}
+}
+
+// fetchManifest calls a manifest handler and decodes the signed manifest
+func fetchManifest(t *testing.T, api *API, path string, handler http.HandlerFunc) scanManifest {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", path, nil)
+	req = withTestUser(req, RoleAdmin)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/events/{id}/manifest", handler)
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var body struct {
+		Manifest string `json:"manifest"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body.Manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest scanManifest
+	if err := json.Unmarshal(payload, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+func TestManifestSkipsExpiredBadgesAndReadsGifts(t *testing.T) {
+	keys := testKeys(t)
+	now := time.Now()
+	signature := pgtype.Text{String: "token", Valid: true}
+
+	api := &API{
+		qrKeys: keys,
+		db: &db.MockQuerier{
+			GetInviteesByEventFunc: func(ctx context.Context, eventID int32) ([]db.Invitee, error) {
+				return []db.Invitee{
+					{ID: 1, EventID: eventID, HmacSignature: signature, Status: "confirmed", ExpiresAt: pgtype.Timestamptz{Time: now.Add(time.Hour), Valid: true}},
+					{ID: 2, EventID: eventID, HmacSignature: signature, Status: "confirmed", ExpiresAt: pgtype.Timestamptz{Time: now.Add(-time.Minute), Valid: true}},
+					// Only the legacy column says the gift was claimed
+					{ID: 3, EventID: eventID, HmacSignature: signature, Status: "confirmed", GiftClaimedAt: pgtype.Timestamp{Time: now, Valid: true}},
+				}, nil
+			},
+			ListGiftBalancesByEventFunc: func(ctx context.Context, eventID int32) ([]db.ListGiftBalancesByEventRow, error) {
+				return []db.ListGiftBalancesByEventRow{{InviteeID: 1, UsedUp: true, UpdatedAt: pgtype.Timestamptz{Time: now, Valid: true}}}, nil
+			},
+		},
+	}
+
+	manifest := fetchManifest(t, api, "/events/1/manifest", api.GetEventManifest)
+
+	gifts := map[int32]bool{}
+	for _, entry := range manifest.Invitees {
+		gifts[entry.ID] = entry.GiftClaimed
+	}
+	if len(gifts) != 2 {
+		t.Fatalf("got invitees %v, want 1 and 3 without the expired badge", gifts)
+	}
+	if !gifts[1] {
+		t.Error("gift redeemed through the gift perk is not marked claimed")
+	}
+	if gifts[3] {
+		t.Error("gift without a perk redemption is marked claimed")
+	}
+	if manifest.Version != now.UnixMicro() {
+		t.Errorf("version %d want the gift balance change %d", manifest.Version, now.UnixMicro())
+	}
+}
+
+func TestManifestDeltaOverlapsSince(t *testing.T) {
+	keys := testKeys(t)
+	since := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	// Stamped before since but committed after the previous manifest was generated
+	late := since.Add(-time.Second)
+
+	var changedSince time.Time
+	api := &API{
+		qrKeys: keys,
+		db: &db.MockQuerier{
+			ListInviteesChangedSinceFunc: func(ctx context.Context, arg db.ListInviteesChangedSinceParams) ([]db.Invitee, error) {
+				changedSince = arg.UpdatedAt.Time
+				return []db.Invitee{
+					{ID: 4, EventID: arg.EventID, HmacSignature: pgtype.Text{String: "token", Valid: true}, Status: "confirmed", UpdatedAt: pgtype.Timestamptz{Time: late, Valid: true}},
+				}, nil
+			},
+			ListGiftBalancesByEventFunc: func(ctx context.Context, eventID int32) ([]db.ListGiftBalancesByEventRow, error) {
+				return nil, nil
+			},
+		},
+	}
+
+	manifest := fetchManifest(t, api, fmt.Sprintf("/events/1/manifest?since=%d", since.UnixMicro()), api.GetEventManifestDelta)
+
+	if want := since.Add(-manifestDeltaOverlap); !changedSince.Equal(want) {
+		t.Errorf("delta read changes since %v want %v", changedSince, want)
+	}
+	if len(manifest.Invitees) != 1 || manifest.Invitees[0].ID != 4 {
+		t.Errorf("late commit missing from delta: %+v", manifest.Invitees)
+	}
+	if manifest.Version != since.UnixMicro() {
+		t.Errorf("version moved back to %d from %d", manifest.Version, since.UnixMicro())
+	}
+}
+
+// testDatabase connects to the Postgres database in TEST_DATABASE_URL and
+// applies the migrations, skipping the test when it is not set. Tests only
+// touch rows they create, so the database may be shared.
+func testDatabase(t *testing.T) *pgxpool.Pool {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	// Migrations are read relative to the repository root
+	t.Chdir("../..")
+	if err := applyMigrations(pool, false); err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestBootstrapAdminAssignsUnownedEvents(t *testing.T) {
+	pool := testDatabase(t)
+	ctx := context.Background()
+	queries := db.New(pool)
+
+	// Databases from before roles existed have the admin as an organizer
+	if admin, err := queries.GetUserByEmail(ctx, "admin@example.com"); err == nil {
+		if _, err := queries.UpdateUserRole(ctx, db.UpdateUserRoleParams{ID: admin.ID, Role: RoleOrganizer}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	event, err := queries.CreateEvent(ctx, db.CreateEventParams{
+		Name:          "Ownerless",
+		Location:      "Hall",
+		ReentryPolicy: reentrySingle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bootstrapAdmin(ctx, queries); err != nil {
+		t.Fatal(err)
+	}
+
+	event, err = queries.GetEvent(ctx, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !event.OwnerID.Valid {
+		t.Fatal("event still has no owner")
+	}
+	owner, err := queries.GetUserByID(ctx, event.OwnerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.Role != RoleAdmin {
+		t.Errorf("event owned by a user with role %q", owner.Role)
+	}
+}
+
+func TestConcurrentScansAdmitOnce(t *testing.T) {
+	pool := testDatabase(t)
+	ctx := context.Background()
+	queries := db.New(pool)
+
+	keys := testKeys(t)
+
+	event, err := queries.CreateEvent(ctx, db.CreateEventParams{
+		Name:          "Concurrent scans",
+		Date:          pgtype.Timestamp{Time: time.Now().Add(time.Hour), Valid: true},
+		Location:      "Hall",
+		ReentryPolicy: reentrySingle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invitee, err := queries.CreateInvitee(ctx, db.CreateInviteeParams{
+		EventID:      event.ID,
+		Email:        fmt.Sprintf("scan-%d@example.com", event.ID),
+		Status:       "pending",
+		Tags:         []string{},
+		CustomFields: json.RawMessage("{}"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(ctx, "DELETE FROM check_ins WHERE event_id = $1", event.ID)
+		pool.Exec(ctx, "DELETE FROM invitees WHERE event_id = $1", event.ID)
+		pool.Exec(ctx, "DELETE FROM events WHERE id = $1", event.ID)
+	})
+
+	issuedAt := time.Now().Truncate(time.Second)
+	token := signedTestToken(t, keys, event.ID, invitee.ID, issuedAt)
+	if _, err := queries.UpdateInvitee(ctx, db.UpdateInviteeParams{
+		ID:            invitee.ID,
+		HmacSignature: pgtype.Text{String: token, Valid: true},
+		QrIssuedAt:    pgtype.Timestamptz{Time: issuedAt, Valid: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	api := &API{qrKeys: keys, db: queries}
+
+	const scanners = 20
+	codes := make(chan int, scanners)
+	var wg sync.WaitGroup
+	for i := 0; i < scanners; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/scan/"+token, nil)
+			req = mux.SetURLVars(req, map[string]string{"qr": token})
+			req = withTestUser(req, RoleDoorStaff)
+			api.ScanQRCode(rr, req)
+			codes <- rr.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusConflict] != scanners-1 {
+		t.Errorf("got status counts %v want one %d and %d %d", counts, http.StatusOK, scanners-1, http.StatusConflict)
+	}
+
+	outcomes := map[string]int{}
+	rows, err := pool.Query(ctx, "SELECT outcome, count(*) FROM check_ins WHERE invitee_id = $1 GROUP BY outcome", invitee.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var outcome string
+		var count int
+		if err := rows.Scan(&outcome, &count); err != nil {
+			t.Fatal(err)
+		}
+		outcomes[outcome] = count
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if outcomes[checkInAdmitted] != 1 || outcomes[checkInDuplicate] != scanners-1 {
+		t.Errorf("got check-in outcomes %v want one admission and %d duplicates", outcomes, scanners-1)
+	}
+}
+
+func TestBuildCheckInAnalytics(t *testing.T) {
+	start := time.Date(2025, 6, 1, 18, 0, 0, 0, time.UTC)
+	minutes := []checkInBucket{
+		{Bucket: start, Gate: "north", Admitted: 3, Scans: 4},
+		{Bucket: start.Add(2 * time.Minute), Gate: "north", Admitted: 2, Scans: 2},
+		{Bucket: start.Add(2 * time.Minute), Gate: "south", Admitted: 1, Scans: 1},
+		{Bucket: start.Add(6 * time.Minute), Gate: "north", Admitted: 1, Scans: 1},
+	}
+
+	response := buildCheckInAnalytics(mergeCheckInBuckets(minutes, 5*time.Minute), 5*time.Minute)
+
+	if len(response.Arrivals) != 2 {
+		t.Fatalf("got %d arrival buckets want 2", len(response.Arrivals))
+	}
+	if first := response.Arrivals[0]; first.Admitted != 6 || first.Scans != 7 || first.Cumulative != 6 {
+		t.Errorf("unexpected first bucket: %+v", first)
+	}
+	if last := response.Arrivals[1]; last.Cumulative != 7 {
+		t.Errorf("got cumulative %d want 7", last.Cumulative)
+	}
+
+	north := response.Gates[0]
+	if north.Gate != "north" || north.PeakAdmitted != 5 || !north.PeakBucket.Equal(start) || north.PeakPerMinute != 1 {
+		t.Errorf("unexpected north gate throughput: %+v", north)
+	}
+}
+
+func TestLiveHubDeliversToEventSubscribers(t *testing.T) {
+	hub := NewLiveHub(nil)
+	subscribed := hub.subscribe()
+	other := hub.subscribe()
+	hub.setEvents(subscribed, []int32{1}, true)
+	hub.setEvents(other, []int32{2}, true)
+
+	payload, _ := json.Marshal(liveMessage{Type: liveScan, EventID: 1})
+	hub.deliver(payload)
+
+	select {
+	case got := <-subscribed.send:
+		if string(got) != string(payload) {
+			t.Errorf("got %s want %s", got, payload)
+		}
+	default:
+		t.Error("subscriber of event 1 received nothing")
+	}
+	select {
+	case got := <-other.send:
+		t.Errorf("subscriber of event 2 received %s", got)
+	default:
+	}
+
+	hub.unsubscribe(subscribed)
+	hub.deliver(payload)
+	if len(subscribed.send) != 0 {
+		t.Error("unsubscribed client received a message")
+	}
+}
+
+func TestCheckWebSocketOrigin(t *testing.T) {
+	tests := []struct {
+		origin  string
+		allowed string
+		want    bool
+	}{
+		{origin: "", want: true},
+		{origin: "https://api.example.com", want: true},
+		{origin: "https://evil.example.com", want: false},
+		{origin: "http://localhost:3000", allowed: "http://localhost:3000, https://app.example.com", want: true},
+		{origin: "https://api.example.com", allowed: "http://localhost:3000", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("CORS_ORIGINS", tt.allowed)
+		req := httptest.NewRequest("GET", "https://api.example.com/ws", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if got := checkWebSocketOrigin(req); got != tt.want {
+			t.Errorf("origin %q with CORS_ORIGINS %q: got %v want %v", tt.origin, tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestLiveIDAfter(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1700000000000-1", "1700000000000-0", true},
+		{"1700000000001-0", "1700000000000-9", true},
+		{"1700000000000-0", "1700000000000-0", false},
+		{"999-5", "1000-0", false},
+	}
+
+	for _, tt := range tests {
+		if got := liveIDAfter(tt.a, tt.b); got != tt.want {
+			t.Errorf("liveIDAfter(%q, %q) = %v want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestWriteSSE(t *testing.T) {
+	var buf bytes.Buffer
+	writeSSE(&buf, "1700000000000-0", liveScan, []byte(`{"type":"scan"}`))
+	writeSSE(&buf, "", "reset", []byte(`{}`))
+
+	want := "id: 1700000000000-0\nevent: scan\ndata: {\"type\":\"scan\"}\n\nevent: reset\ndata: {}\n\n"
+	if buf.String() != want {
+		t.Errorf("got %q want %q", buf.String(), want)
+	}
+}
+
+func TestWriteRetryAfter(t *testing.T) {
+	rr := httptest.NewRecorder()
+	writeRetryAfter(rr, "QR code was just scanned", 2300*time.Millisecond)
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "3" {
+		t.Errorf("got Retry-After %q want 3", got)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest("POST", "/scan/token", nil)
+	req.RemoteAddr = "10.0.0.5:51234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+
+	if got := clientIP(req); got != "10.0.0.5" {
+		t.Errorf("got %q want the remote address when the proxy is not trusted", got)
+	}
+
+	t.Setenv("TRUST_PROXY", "true")
+	if got := clientIP(req); got != "203.0.113.7" {
+		t.Errorf("got %q want the first forwarded address", got)
+	}
+}
+
+func TestLoginLockoutDuration(t *testing.T) {
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{failures: 4, want: 0},
+		{failures: 5, want: time.Minute},
+		{failures: 6, want: 2 * time.Minute},
+		{failures: 8, want: 8 * time.Minute},
+		{failures: 40, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := loginLockoutDuration(tt.failures, accountLockoutFailures); got != tt.want {
+			t.Errorf("%d failures: got %v want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// testRedis connects to the Redis server in TEST_REDIS_URL and skips the
+// test when it is not set
+func testRedis(t *testing.T) *redis.Client {
+	url := os.Getenv("TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("TEST_REDIS_URL is not set")
+	}
+
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdb := redis.NewClient(opts)
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+// sessionTestAPI returns an API with Redis-backed sessions for a single organizer
+func sessionTestAPI(t *testing.T) (*API, db.User) {
+	t.Setenv("JWT_SECRET", "secret")
+	user := db.User{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Role: RoleOrganizer}
+	api := &API{
+		sessions: NewSessionStore(testRedis(t)),
+		db: &db.MockQuerier{
+			GetUserByIDFunc: func(ctx context.Context, id pgtype.UUID) (db.User, error) {
+				return user, nil
+			},
+		},
+	}
+	return api, user
+}
+
+// refreshTokens posts a refresh token and returns the status and the rotated token
+func refreshTokens(t *testing.T, api *API, refreshToken string) (int, string) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	rr := httptest.NewRecorder()
+	api.RefreshToken(rr, httptest.NewRequest("POST", "/token/refresh", bytes.NewReader(body)))
+
+	var tokens struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(rr.Body).Decode(&tokens)
+	return rr.Code, tokens.RefreshToken
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	api, user := sessionTestAPI(t)
+	ctx := context.Background()
+
+	first, err := api.sessions.IssueRefreshToken(ctx, user.ID.Bytes, uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, second := refreshTokens(t, api, first)
+	if status != http.StatusOK || second == "" || second == first {
+		t.Fatalf("first refresh: got status %d and token %q", status, second)
+	}
+	status, third := refreshTokens(t, api, second)
+	if status != http.StatusOK || third == "" || third == second {
+		t.Fatalf("second refresh: got status %d and token %q", status, third)
+	}
+
+	if status, _ := refreshTokens(t, api, "unknown"); status != http.StatusUnauthorized {
+		t.Errorf("unknown token: got status %d want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	api, user := sessionTestAPI(t)
+	ctx := context.Background()
+	sessionID := uuid.NewString()
+
+	first, err := api.sessions.IssueRefreshToken(ctx, user.ID.Bytes, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, second := refreshTokens(t, api, first)
+	if status != http.StatusOK {
+		t.Fatalf("refresh: got status %d want %d", status, http.StatusOK)
+	}
+
+	// Replaying the rotated token ends the session for both holders
+	if status, _ := refreshTokens(t, api, first); status != http.StatusUnauthorized {
+		t.Errorf("reused token: got status %d want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ := refreshTokens(t, api, second); status != http.StatusUnauthorized {
+		t.Errorf("token rotated before reuse: got status %d want %d", status, http.StatusUnauthorized)
+	}
+	revoked, err := api.sessions.IsSessionRevoked(ctx, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Error("session was not revoked after refresh token reuse")
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	api, user := sessionTestAPI(t)
+	ctx := context.Background()
+	sessionID := uuid.NewString()
+
+	accessToken, err := api.createLogin(user.ID.Bytes, user.Role, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, err := api.sessions.IssueRefreshToken(ctx, user.ID.Bytes, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	protected := authMiddleware(api.db, api.sessions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	authorized := func() int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/events", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		protected.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if status := authorized(); status != http.StatusOK {
+		t.Fatalf("before logout: got status %d want %d", status, http.StatusOK)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/logout", nil)
+	req = req.WithContext(context.WithValue(req.Context(), sessionContextKey, sessionID))
+	api.Logout(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("logout: got status %d want %d", rr.Code, http.StatusNoContent)
+	}
+
+	if status := authorized(); status != http.StatusUnauthorized {
+		t.Errorf("access token after logout: got status %d want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ := refreshTokens(t, api, refreshToken); status != http.StatusUnauthorized {
+		t.Errorf("refresh token after logout: got status %d want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestLiveConnectionsRecheckRevocation(t *testing.T) {
+	api, user := sessionTestAPI(t)
+
+	ctx := context.WithValue(context.Background(), userContextKey, user)
+	ctx = context.WithValue(ctx, sessionContextKey, uuid.NewString())
+	ctx = context.WithValue(ctx, issuedAtContextKey, time.Now().Add(-time.Minute).Unix())
+
+	if !api.stillAuthorized(ctx) {
+		t.Fatal("connection of a valid session is not authorized")
+	}
+
+	if err := api.sessions.RevokeUser(ctx, uuid.UUID(user.ID.Bytes).String()); err != nil {
+		t.Fatal(err)
+	}
+	if api.stillAuthorized(ctx) {
+		t.Error("connection is still authorized after its user was revoked")
+	}
+}
+
+func TestLiveConnectionsRecheckRole(t *testing.T) {
+	api, user := sessionTestAPI(t)
+	api.db = &db.MockQuerier{
+		GetUserByIDFunc: func(ctx context.Context, id pgtype.UUID) (db.User, error) {
+			return db.User{ID: id, Role: RoleAuditor}, nil
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), userContextKey, user)
+	ctx = context.WithValue(ctx, sessionContextKey, uuid.NewString())
+	ctx = context.WithValue(ctx, issuedAtContextKey, time.Now().Unix())
+
+	if api.stillAuthorized(ctx) {
+		t.Error("connection is still authorized after the user's role changed")
+	}
+}
+
+func TestLiveTicketIsSingleUse(t *testing.T) {
+	api, user := sessionTestAPI(t)
+
+	ctx := context.WithValue(context.Background(), userContextKey, user)
+	ctx = context.WithValue(ctx, sessionContextKey, uuid.NewString())
+	ctx = context.WithValue(ctx, issuedAtContextKey, time.Now().Unix())
+
+	rr := httptest.NewRecorder()
+	api.CreateLiveTicket(rr, httptest.NewRequest("POST", "/live/ticket", nil).WithContext(ctx))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	var body struct {
+		Ticket string `json:"ticket"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	protected := authMiddleware(api.db, api.sessions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	stream := func() int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/events/1/stream?ticket="+body.Ticket, nil)
+		req.Header.Set("Accept", "text/event-stream")
+		protected.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if status := stream(); status != http.StatusOK {
+		t.Errorf("first use: got status %d want %d", status, http.StatusOK)
+	}
+	if status := stream(); status != http.StatusUnauthorized {
+		t.Errorf("second use: got status %d want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestLiveAccessTokenQueryParamRejected(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	api := &API{}
+	token, err := api.createLogin(uuid.New(), RoleAdmin, uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	protected := authMiddleware(&db.MockQuerier{}, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/events/1/stream?access_token="+token, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	protected.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestScanPerkUsedUp(t *testing.T) {
+	keys := testKeys(t)
+	issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	token := signedTestToken(t, keys, 1, 42, issuedAt)
+
+	var recorded db.CreateCheckInParams
+	api := &API{
+		qrKeys: keys,
+		db: &db.MockQuerier{
+			GetInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+				return db.Invitee{ID: id, EventID: 1, State: "checked_in", HmacSignature: pgtype.Text{String: token, Valid: true}}, nil
+			},
+			RedeemPerkFunc: func(ctx context.Context, arg db.RedeemPerkParams) (db.PerkRedemption, error) {
+				if arg.Name != "drinks" {
+					t.Errorf("got perk %q want drinks", arg.Name)
+				}
+				return db.PerkRedemption{}, pgx.ErrNoRows
+			},
+			ListInviteePerksFunc: func(ctx context.Context, arg db.ListInviteePerksParams) ([]db.ListInviteePerksRow, error) {
+				return []db.ListInviteePerksRow{
+					{ID: 1, Name: "drinks", Quantity: 2, Redeemed: 2},
+					{ID: 2, Name: "gift", Quantity: 1},
+				}, nil
+			},
+			CreateCheckInFunc: func(ctx context.Context, arg db.CreateCheckInParams) (db.CheckIn, error) {
+				recorded = arg
+				return db.CheckIn{Outcome: arg.Outcome}, nil
+			},
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/scan/"+token+"?perk=drinks", nil)
+	req = mux.SetURLVars(req, map[string]string{"qr": token})
+	req = withTestUser(req, RoleDoorStaff)
+	api.ScanQRCode(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusConflict)
+	}
+	if recorded.Outcome != checkInExhausted || recorded.Perk.String != "drinks" {
+		t.Errorf("unexpected scan recorded: %+v", recorded)
+	}
+}
+
+func TestScanDeniedForZone(t *testing.T) {
+	keys := testKeys(t)
+	issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	token := signedTestToken(t, keys, 1, 42, issuedAt)
+
+	var recorded db.CreateCheckInParams
+	api := &API{
+		qrKeys: keys,
+		db: &db.MockQuerier{
+			GetInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+				return db.Invitee{ID: id, EventID: 1, Tier: pgtype.Text{String: "general", Valid: true}, HmacSignature: pgtype.Text{String: token, Valid: true}}, nil
+			},
+			GetGateByNameFunc: func(ctx context.Context, arg db.GetGateByNameParams) (db.Gate, error) {
+				return db.Gate{ID: 3, EventID: arg.EventID, ZoneID: 7, Name: arg.Name}, nil
+			},
+			GetZoneFunc: func(ctx context.Context, id int32) (db.Zone, error) {
+				return db.Zone{ID: id, EventID: 1, Name: "vip", Tiers: []string{"VIP"}}, nil
+			},
+			CreateCheckInFunc: func(ctx context.Context, arg db.CreateCheckInParams) (db.CheckIn, error) {
+				recorded = arg
+				return db.CheckIn{Outcome: arg.Outcome}, nil
+			},
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/scan/"+token+"?gate=lounge", nil)
+	req = mux.SetURLVars(req, map[string]string{"qr": token})
+	req = withTestUser(req, RoleDoorStaff)
+	api.ScanQRCode(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusForbidden)
+	}
+	if recorded.Outcome != checkInDenied || recorded.ZoneID.Int32 != 7 || recorded.Reason.String != "tier general has no access to zone vip" {
+		t.Errorf("unexpected scan recorded: %+v", recorded)
+	}
+
+	if reason := zoneDenial(db.Zone{ID: 7, Name: "vip", Tiers: []string{"VIP"}}, db.Invitee{Tier: pgtype.Text{String: "vip", Valid: true}}); reason != "" {
+		t.Errorf("vip invitee denied: %s", reason)
+	}
+	if reason := zoneDenial(db.Zone{ID: 8, Name: "hall"}, db.Invitee{}); reason != "" {
+		t.Errorf("open zone denied: %s", reason)
+	}
+}
+
+func TestScanLedgerRecordsUnknownZoneAndPerk(t *testing.T) {
+	keys := testKeys(t)
+	issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	token := signedTestToken(t, keys, 1, 42, issuedAt)
+
+	tests := []struct {
+		query  string
+		reason string
+	}{
+		{query: "?zone=annex", reason: "unknown zone annex"},
+		{query: "?perk=spa", reason: "unknown perk spa"},
+	}
+
+	for _, tt := range tests {
+		var recorded []db.CreateCheckInParams
+		api := &API{
+			qrKeys: keys,
+			db: &db.MockQuerier{
+				GetInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+					return db.Invitee{ID: id, EventID: 1, State: "checked_in", HmacSignature: pgtype.Text{String: token, Valid: true}}, nil
+				},
+				GetZoneByNameFunc: func(ctx context.Context, arg db.GetZoneByNameParams) (db.Zone, error) {
+					return db.Zone{}, pgx.ErrNoRows
+				},
+				RedeemPerkFunc: func(ctx context.Context, arg db.RedeemPerkParams) (db.PerkRedemption, error) {
+					return db.PerkRedemption{}, pgx.ErrNoRows
+				},
+				ListInviteePerksFunc: func(ctx context.Context, arg db.ListInviteePerksParams) ([]db.ListInviteePerksRow, error) {
+					return []db.ListInviteePerksRow{{ID: 2, Name: "gift", Quantity: 1}}, nil
+				},
+				CreateCheckInFunc: func(ctx context.Context, arg db.CreateCheckInParams) (db.CheckIn, error) {
+					recorded = append(recorded, arg)
+					return db.CheckIn{Outcome: arg.Outcome}, nil
+				},
+			},
+		}
+
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/scan/"+token+tt.query, nil)
+		req = mux.SetURLVars(req, map[string]string{"qr": token})
+		req = withTestUser(req, RoleDoorStaff)
+		api.ScanQRCode(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d want %d", tt.query, rr.Code, http.StatusNotFound)
+		}
+		if len(recorded) != 1 || recorded[0].Outcome != checkInDenied || recorded[0].Reason.String != tt.reason || recorded[0].InviteeID.Int32 != 42 {
+			t.Errorf("%s: unexpected scans recorded: %+v", tt.query, recorded)
+		}
+	}
+}
+
+func TestSyncScansRecordsUnknownZone(t *testing.T) {
+	keys := testKeys(t)
+	issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	token := signedTestToken(t, keys, 1, 42, issuedAt)
+
+	var recorded db.CreateCheckInParams
+	api := &API{
+		qrKeys: keys,
+		db: &db.MockQuerier{
+			GetInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+				return db.Invitee{ID: id, EventID: 1, HmacSignature: pgtype.Text{String: token, Valid: true}}, nil
+			},
+			GetCheckInByDeviceScanFunc: func(ctx context.Context, arg db.GetCheckInByDeviceScanParams) (db.CheckIn, error) {
+				return db.CheckIn{}, pgx.ErrNoRows
+			},
+			GetZoneByNameFunc: func(ctx context.Context, arg db.GetZoneByNameParams) (db.Zone, error) {
+				return db.Zone{}, pgx.ErrNoRows
+			},
+			CreateCheckInFunc: func(ctx context.Context, arg db.CreateCheckInParams) (db.CheckIn, error) {
+				recorded = arg
+				return db.CheckIn{ID: 8, InviteeID: arg.InviteeID, Outcome: arg.Outcome, Reason: arg.Reason}, nil
+			},
+		},
+	}
+
+	body := fmt.Sprintf(`{"scans":[{"token":%q,"device_id":"door-b","zone":"annex","scanned_at":%q}]}`, token, time.Now().Format(time.RFC3339))
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/scans/sync", strings.NewReader(body))
+	req = withTestUser(req, RoleDoorStaff)
+	api.SyncScans(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	if recorded.Outcome != checkInDenied || recorded.Reason.String != "unknown zone annex" {
+		t.Errorf("unexpected check-in recorded: %+v", recorded)
+	}
+
+	var response struct {
+		Results []offlineScanResult `json:"results"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Results) != 1 || response.Results[0].Status != checkInDenied || response.Results[0].Error != "unknown zone annex" {
+		t.Errorf("unexpected results: %+v", response.Results)
+	}
+}
+
+func TestGetEventOccupancyFromLedger(t *testing.T) {
+	api := &API{
+		db: &db.MockQuerier{
+			GetEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return db.Event{ID: id, Capacity: 500}, nil
+			},
+			ListZonesByEventFunc: func(ctx context.Context, eventID int32) ([]db.Zone, error) {
+				return []db.Zone{{ID: 7, EventID: eventID, Name: "vip", Capacity: 2}, {ID: 8, EventID: eventID, Name: "backstage"}}, nil
+			},
+			ListEventOccupantsFunc: func(ctx context.Context, eventID pgtype.Int4) ([]db.ListEventOccupantsRow, error) {
+				return []db.ListEventOccupantsRow{
+					{InviteeID: pgtype.Int4{Int32: 1, Valid: true}},
+					{InviteeID: pgtype.Int4{Int32: 2, Valid: true}, ZoneID: pgtype.Int4{Int32: 7, Valid: true}},
+					{InviteeID: pgtype.Int4{Int32: 3, Valid: true}, ZoneID: pgtype.Int4{Int32: 7, Valid: true}},
+				}, nil
+			},
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/events/1/occupancy", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	req = withTestUser(req, RoleDoorStaff)
+	api.GetEventOccupancy(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d", rr.Code, http.StatusOK)
+	}
+	var response struct {
+		Occupancy int64 `json:"occupancy"`
+		Capacity  int32 `json:"capacity"`
+		Zones     []struct {
+			ZoneID    int32 `json:"zone_id"`
+			Occupancy int64 `json:"occupancy"`
+			Capacity  int32 `json:"capacity"`
+		} `json:"zones"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Occupancy != 3 || response.Capacity != 500 {
+		t.Errorf("got occupancy %d/%d want 3/500", response.Occupancy, response.Capacity)
+	}
+	if len(response.Zones) != 2 || response.Zones[0].Occupancy != 2 || response.Zones[0].Capacity != 2 || response.Zones[1].Occupancy != 0 {
+		t.Errorf("unexpected zones: %+v", response.Zones)
+	}
+}
+
+func TestReserveOrderSoldOut(t *testing.T) {
+	api := &API{
+		db: &db.MockQuerier{
+			GetEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return db.Event{ID: id, Capacity: 100}, nil
+			},
+			ListTicketTypesByEventFunc: func(ctx context.Context, eventID int32) ([]db.TicketType, error) {
+				return nil, nil
+			},
+			GetInviteeByEventAndEmailFunc: func(ctx context.Context, arg db.GetInviteeByEventAndEmailParams) (db.Invitee, error) {
+				return db.Invitee{}, pgx.ErrNoRows
+			},
+			ReserveOrderFunc: func(ctx context.Context, arg db.ReserveOrderParams) (db.Order, error) {
+				if arg.Quantity != 2 || !arg.ExpiresAt.Time.After(time.Now()) {
+					t.Errorf("unexpected reservation: %+v", arg)
+				}
+				return db.Order{}, pgx.ErrNoRows
+			},
+		},
+	}
+
+	body := `{"tickets": [{"email": "a@example.com"}, {"email": "b@example.com"}]}`
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/events/1/orders", strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	req = withTestUser(req, RoleOrganizer)
+	api.ReserveOrder(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusConflict)
+	}
+
+	// Ticket holders must be distinct
+	body = `{"tickets": [{"email": "a@example.com"}, {"email": "A@example.com"}]}`
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/events/1/orders", strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	req = withTestUser(req, RoleOrganizer)
+	api.ReserveOrder(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOrderItemsForTickets(t *testing.T) {
+	now := time.Now()
+	ticketTypes := []db.TicketType{
+		{ID: 2, Name: "VIP", Price: 15000, Currency: "EUR", Quantity: 10, MaxPerOrder: 2},
+		{ID: 1, Name: "General", Price: 5000, Currency: "EUR", Quantity: 100, MaxPerOrder: 10},
+		{ID: 3, Name: "Early bird", Price: 3000, Currency: "EUR", Quantity: 50, MaxPerOrder: 10, SalesEnd: pgtype.Timestamptz{Time: now.Add(-time.Hour), Valid: true}},
+	}
+
+	items, message, _ := orderItemsForTickets(ticketTypes, []orderTicketRequest{
+		{Email: "a@example.com", TicketTypeID: 2},
+		{Email: "b@example.com", TicketTypeID: 1},
+		{Email: "c@example.com", TicketTypeID: 2},
+	}, now)
+	if message != "" {
+		t.Fatal(message)
+	}
+	if len(items) != 2 || items[0].ticketType.ID != 1 || items[0].quantity != 1 || items[1].ticketType.ID != 2 || items[1].quantity != 2 {
+		t.Errorf("unexpected items: %+v", items)
+	}
+
+	tests := []struct {
+		name    string
+		tickets []orderTicketRequest
+		status  int
+	}{
+		{"missing type", []orderTicketRequest{{TicketTypeID: 0}}, http.StatusBadRequest},
+		{"sales ended", []orderTicketRequest{{TicketTypeID: 3}}, http.StatusConflict},
+		{"over limit", []orderTicketRequest{{TicketTypeID: 2}, {TicketTypeID: 2}, {TicketTypeID: 2}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if _, message, status := orderItemsForTickets(ticketTypes, tt.tickets, now); message == "" || status != tt.status {
+			t.Errorf("%s: got %q (%d) want status %d", tt.name, message, status, tt.status)
+		}
+	}
+}
+
+func TestPaymentWebhookIsIdempotent(t *testing.T) {
+	fake := NewFakePaymentProvider("test-secret")
+	intent, _ := fake.CreateIntent(context.Background(), PaymentIntentRequest{OrderID: 7, Amount: 5000, Currency: "EUR", IdempotencyKey: "order-7"})
+
+	claimed := map[string]bool{}
+	payment := db.Payment{ID: 1, OrderID: 7, Provider: fakeProviderName, IntentID: intent.ID, Status: paymentRequiresPayment}
+	order := db.Order{ID: 7, Status: orderPending, Amount: 5000}
+	paid := 0
+	api := &API{
+		payments: fake,
+		db: &db.MockQuerier{
+			ClaimPaymentWebhookEventFunc: func(ctx context.Context, arg db.ClaimPaymentWebhookEventParams) (db.PaymentWebhookEvent, error) {
+				if claimed[arg.EventID] {
+					return db.PaymentWebhookEvent{}, pgx.ErrNoRows
+				}
+				claimed[arg.EventID] = true
+				return db.PaymentWebhookEvent{}, nil
+			},
+			GetPaymentByIntentFunc: func(ctx context.Context, arg db.GetPaymentByIntentParams) (db.Payment, error) {
+				return payment, nil
+			},
+			GetOrderFunc: func(ctx context.Context, id int32) (db.Order, error) {
+				return order, nil
+			},
+			SetPaymentStatusFunc: func(ctx context.Context, arg db.SetPaymentStatusParams) (db.Payment, error) {
+				payment.Status = arg.Status
+				return payment, nil
+			},
+			MarkOrderPaidFunc: func(ctx context.Context, id int32) (db.Order, error) {
+				paid++
+				order.Status = orderPaid
+				return order, nil
+			},
+			ListOrderTicketsFunc: func(ctx context.Context, orderID int32) ([]db.OrderTicket, error) {
+				return nil, nil
+			},
+		},
+	}
+
+	event, err := fake.Authorize(intent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, signature := fake.SignWebhook(event)
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/webhooks/payments", bytes.NewReader(body))
+		req.Header.Set(fakeSignatureHeader, signature)
+		api.PaymentWebhook(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("delivery %d: got status %d want %d", i+1, rr.Code, http.StatusOK)
+		}
+	}
+
+	if paid != 1 || order.Status != orderPaid {
+		t.Errorf("order marked paid %d times, status %s", paid, order.Status)
+	}
+	if status := fake.Status(intent.ID); status != fakeIntentSucceeded {
+		t.Errorf("intent is %s, want captured", status)
+	}
+
+	// Forged deliveries are rejected
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/webhooks/payments", bytes.NewReader(body))
+	req.Header.Set(fakeSignatureHeader, strings.Repeat("0", 64))
+	api.PaymentWebhook(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestStripeWebhookSignature(t *testing.T) {
+	provider := NewStripeProvider("sk_test", "whsec_test")
+	body := []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount_received":5000}}}`)
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	header := "t=" + timestamp + ",v1=" + hex.EncodeToString(stripeSignature([]byte("whsec_test"), timestamp, body))
+
+	if err := provider.verifySignature(header, body, now); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	if err := provider.verifySignature(header, body, now.Add(time.Hour)); err == nil {
+		t.Error("stale signature accepted")
+	}
+	if err := provider.verifySignature(header, append(body, ' '), now); err == nil {
+		t.Error("signature accepted for a modified body")
+	}
+}
+
+func TestRefundTicketRevokesAndRefunds(t *testing.T) {
+	fake := NewFakePaymentProvider("test-secret")
+	intent, _ := fake.CreateIntent(context.Background(), PaymentIntentRequest{OrderID: 7, Amount: 20000, Currency: "EUR", IdempotencyKey: "order-7"})
+	fake.Authorize(intent.ID)
+	fake.Capture(context.Background(), intent.ID)
+
+	invitee := db.Invitee{ID: 42, EventID: 1, Status: "pending", OrderID: pgtype.Int4{Int32: 7, Valid: true}}
+	var change db.RecordTicketRefundParams
+	refunds := 0
+	api := &API{
+		payments: fake,
+		db: &db.MockQuerier{
+			GetInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+				return invitee, nil
+			},
+			GetOrderFunc: func(ctx context.Context, id int32) (db.Order, error) {
+				return db.Order{ID: id, EventID: 1, Status: orderPaid, Amount: 20000}, nil
+			},
+			ListTicketChangesFunc: func(ctx context.Context, inviteeID int32) ([]db.TicketChange, error) {
+				return nil, nil
+			},
+			GetOrderTicketByInviteeFunc: func(ctx context.Context, inviteeID pgtype.Int4) (db.OrderTicket, error) {
+				return db.OrderTicket{OrderID: 7, InviteeID: inviteeID, TicketTypeID: pgtype.Int4{Int32: 3, Valid: true}}, nil
+			},
+			ListOrderItemsFunc: func(ctx context.Context, orderID int32) ([]db.OrderItem, error) {
+				return []db.OrderItem{
+					{OrderID: orderID, TicketTypeID: 2, Quantity: 1, UnitPrice: 15000, Currency: "EUR"},
+					{OrderID: orderID, TicketTypeID: 3, Quantity: 1, UnitPrice: 5000, Currency: "EUR"},
+				}, nil
+			},
+			GetCapturedPaymentByOrderFunc: func(ctx context.Context, orderID int32) (db.Payment, error) {
+				return db.Payment{ID: 1, OrderID: orderID, Provider: fakeProviderName, IntentID: intent.ID, Status: paymentCaptured, Amount: 20000}, nil
+			},
+			RefundInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+				refunds++
+				refunded := invitee
+				refunded.Status = inviteeRefunded
+				return refunded, nil
+			},
+			RecordTicketRefundFunc: func(ctx context.Context, arg db.RecordTicketRefundParams) (db.TicketChange, error) {
+				change = arg
+				return db.TicketChange{Action: ticketRefunded, Amount: arg.Amount}, nil
+			},
+			GetEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return db.Event{ID: id}, nil
+			},
+			LockEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return db.Event{ID: id}, nil
+			},
+			PromoteWaitlistEntryFunc: func(ctx context.Context, arg db.PromoteWaitlistEntryParams) (db.WaitlistEntry, error) {
+				return db.WaitlistEntry{}, pgx.ErrNoRows
+			},
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/invitees/42/refund", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "42"})
+	req = withTestUser(req, RoleAdmin)
+	api.RefundTicket(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if refunds != 1 || change.PaymentID.Int32 != 1 || change.Amount != 5000 {
+		t.Errorf("unexpected refund: %d refunds, change %+v", refunds, change)
+	}
+	if refunded := fake.Refunded(intent.ID); refunded != 5000 {
+		t.Errorf("refunded %d of the payment, want 5000", refunded)
+	}
+
+	// The refunded ticket's QR code no longer admits
+	if err := inviteeAvailability(db.Invitee{Status: inviteeRefunded}, time.Now()); !errors.Is(err, errInviteeCancelled) {
+		t.Errorf("refunded ticket available: %v", err)
+	}
+}
+
+func TestConcurrentRefundRetriesRecordOnce(t *testing.T) {
+	pool := testDatabase(t)
+	ctx := context.Background()
+	queries := db.New(pool)
+
+	event, err := queries.CreateEvent(ctx, db.CreateEventParams{
+		Name:          "Concurrent refunds",
+		Date:          pgtype.Timestamp{Time: time.Now().Add(48 * time.Hour), Valid: true},
+		Location:      "Hall",
+		ReentryPolicy: reentrySingle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := queries.CreateOrder(ctx, db.CreateOrderParams{
+		UserID:    pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		EventID:   event.ID,
+		Status:    orderPaid,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(time.Hour), Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(ctx, "DELETE FROM invitees WHERE event_id = $1", event.ID)
+		pool.Exec(ctx, "DELETE FROM orders WHERE id = $1", order.ID)
+		pool.Exec(ctx, "DELETE FROM events WHERE id = $1", event.ID)
+	})
+	payment, err := queries.UpsertPayment(ctx, db.UpsertPaymentParams{
+		OrderID:  order.ID,
+		Provider: fakeProviderName,
+		IntentID: fmt.Sprintf("refund-test-%d", order.ID),
+		Status:   paymentCaptured,
+		Amount:   20000,
+		Currency: "EUR",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invitee, err := queries.CreateOrderInvitee(ctx, db.CreateOrderInviteeParams{
+		EventID: event.ID,
+		Email:   fmt.Sprintf("refund-%d@example.com", event.ID),
+		OrderID: pgtype.Int4{Int32: order.ID, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Retries of the same refund that all got past the provider call
+	const retries = 10
+	var recorded atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < retries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := queries.RecordTicketRefund(ctx, db.RecordTicketRefundParams{
+				InviteeID: invitee.ID,
+				EventID:   event.ID,
+				Amount:    5000,
+				Currency:  pgtype.Text{String: "EUR", Valid: true},
+				PaymentID: pgtype.Int4{Int32: payment.ID, Valid: true},
+			})
+			if err == nil {
+				recorded.Add(1)
+			} else if !errors.Is(err, pgx.ErrNoRows) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	payment, err = queries.GetPaymentByIntent(ctx, db.GetPaymentByIntentParams{Provider: payment.Provider, IntentID: payment.IntentID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.Load() != 1 || payment.RefundedAmount != 5000 {
+		t.Errorf("got %d recorded refunds and %d refunded, want 1 and 5000", recorded.Load(), payment.RefundedAmount)
+	}
+}
+
+func TestExpiredWaitlistInviteePromotesNext(t *testing.T) {
+	eventDate := time.Now().Add(6 * time.Hour)
+	expired := db.Invitee{ID: 5, EventID: 1, Status: "pending"}
+	var lapsed []int32
+	var promoted []db.PromoteWaitlistEntryParams
+	var created db.CreateWaitlistInviteeParams
+	var linked db.SetWaitlistEntryInviteeParams
+	api := &API{
+		db: &db.MockQuerier{
+			GetExpiredInviteesFunc: func(ctx context.Context) ([]db.Invitee, error) {
+				return []db.Invitee{expired}, nil
+			},
+			UpdateInviteeStatusFunc: func(ctx context.Context, arg db.UpdateInviteeStatusParams) (db.Invitee, error) {
+				return db.Invitee{ID: arg.ID, Status: arg.Status}, nil
+			},
+			GetWaitlistEntryByInviteeFunc: func(ctx context.Context, inviteeID pgtype.Int4) (db.WaitlistEntry, error) {
+				return db.WaitlistEntry{ID: 10, EventID: 1, Status: waitlistPromoted, InviteeID: inviteeID}, nil
+			},
+			LapseWaitlistEntryFunc: func(ctx context.Context, id int32) error {
+				lapsed = append(lapsed, id)
+				return nil
+			},
+			GetEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return db.Event{ID: id, Name: "Launch", Date: pgtype.Timestamp{Time: eventDate, Valid: true}}, nil
+			},
+			LockEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return db.Event{ID: id}, nil
+			},
+			PromoteWaitlistEntryFunc: func(ctx context.Context, arg db.PromoteWaitlistEntryParams) (db.WaitlistEntry, error) {
+				promoted = append(promoted, arg)
+				return db.WaitlistEntry{ID: 11, EventID: arg.EventID, Email: "next@example.com", Status: waitlistPromoted, ClaimExpiresAt: arg.ClaimExpiresAt, ClaimTokenHash: arg.ClaimTokenHash}, nil
+			},
+			CreateWaitlistInviteeFunc: func(ctx context.Context, arg db.CreateWaitlistInviteeParams) (db.Invitee, error) {
+				created = arg
+				return db.Invitee{ID: 6, EventID: arg.EventID, Email: arg.Email, Status: "pending", ExpiresAt: arg.ExpiresAt}, nil
+			},
+			SetWaitlistEntryInviteeFunc: func(ctx context.Context, arg db.SetWaitlistEntryInviteeParams) error {
+				linked = arg
+				return nil
+			},
+		},
+	}
+
+	api.expireOldInvitees()
+
+	if len(lapsed) != 1 || lapsed[0] != 10 {
+		t.Errorf("lapsed entries %v, want [10]", lapsed)
+	}
+	// One seat freed, so only one entry is promoted
+	if len(promoted) != 1 {
+		t.Fatalf("got %d promotions want 1", len(promoted))
+	}
+	if !promoted[0].ClaimTokenHash.Valid || len(promoted[0].ClaimTokenHash.String) != 64 {
+		t.Errorf("unexpected claim token hash %q", promoted[0].ClaimTokenHash.String)
+	}
+	// The claim window ends with the event when it starts sooner
+	if !promoted[0].ClaimExpiresAt.Time.Equal(eventDate) {
+		t.Errorf("claim window ends %v want %v", promoted[0].ClaimExpiresAt.Time, eventDate)
+	}
+	if created.Email != "next@example.com" || !created.ExpiresAt.Time.Equal(eventDate) {
+		t.Errorf("unexpected waitlist invitee %+v", created)
+	}
+	if linked.ID != 11 || linked.InviteeID.Int32 != 6 {
+		t.Errorf("unexpected waitlist link %+v", linked)
+	}
+}
+
+func TestConcurrentPromotionsRespectCapacity(t *testing.T) {
+	pool := testDatabase(t)
+	ctx := context.Background()
+	queries := db.New(pool)
+
+	event, err := queries.CreateEvent(ctx, db.CreateEventParams{
+		Name:          "Concurrent promotions",
+		Date:          pgtype.Timestamp{Time: time.Now().Add(48 * time.Hour), Valid: true},
+		Location:      "Hall",
+		ReentryPolicy: reentrySingle,
+		Capacity:      2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(ctx, "DELETE FROM waitlist_entries WHERE event_id = $1", event.ID)
+		pool.Exec(ctx, "DELETE FROM invitees WHERE event_id = $1", event.ID)
+		pool.Exec(ctx, "DELETE FROM events WHERE id = $1", event.ID)
+	})
+
+	const waiting = 10
+	for i := 0; i < waiting; i++ {
+		if _, err := queries.JoinWaitlist(ctx, db.JoinWaitlistParams{
+			EventID: event.ID,
+			Email:   fmt.Sprintf("waiting-%d-%d@example.com", event.ID, i),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	api := &API{db: queries, pool: pool}
+
+	// Each call believes one seat was freed
+	var wg sync.WaitGroup
+	for i := 0; i < waiting; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			api.promoteWaitlist(ctx, event.ID, 1)
+		}()
+	}
+	wg.Wait()
+
+	var promoted, invited int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM waitlist_entries WHERE event_id = $1 AND status = 'promoted'", event.ID).Scan(&promoted); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM invitees WHERE event_id = $1", event.ID).Scan(&invited); err != nil {
+		t.Fatal(err)
+	}
+	if promoted != int(event.Capacity) || invited != int(event.Capacity) {
+		t.Errorf("got %d promoted and %d invitees for %d seats", promoted, invited, event.Capacity)
+	}
+}
+
+func TestRespondRSVPDeclineFreesSeats(t *testing.T) {
+	keys := testKeys(t)
+	now := time.Now()
+	event := db.Event{ID: 1, Name: "Launch", Date: pgtype.Timestamp{Time: now.Add(48 * time.Hour), Valid: true}, Capacity: 10, PlusOnesAllowed: 2}
+	invitee := db.Invitee{ID: 42, EventID: 1, Status: "pending", RsvpStatus: rsvpAccepted, PlusOnes: 2, PlusOneNames: []string{"Ann", "Bob"}}
+	var answered []db.RespondInviteeRSVPParams
+	var promoted []db.PromoteWaitlistEntryParams
+	api := &API{
+		qrKeys: keys,
+		db: &db.MockQuerier{
+			GetInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+				return invitee, nil
+			},
+			GetEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return event, nil
+			},
+			RespondInviteeRSVPFunc: func(ctx context.Context, arg db.RespondInviteeRSVPParams) (db.Invitee, error) {
+				answered = append(answered, arg)
+				updated := invitee
+				updated.RsvpStatus, updated.PlusOnes, updated.PlusOneNames = arg.RsvpStatus, arg.PlusOnes, arg.PlusOneNames
+				return updated, nil
+			},
+			LockEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return db.Event{ID: id}, nil
+			},
+			PromoteWaitlistEntryFunc: func(ctx context.Context, arg db.PromoteWaitlistEntryParams) (db.WaitlistEntry, error) {
+				promoted = append(promoted, arg)
+				return db.WaitlistEntry{}, pgx.ErrNoRows
+			},
+		},
+	}
+
+	respond := func(response, token, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/rsvp/"+response+"?token="+token, strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"response": response})
+		api.RespondRSVP(rr, req)
+		return rr
+	}
+
+	token, _, err := keys.SignFor(signing.PurposeRSVP, 1, 42, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The allowance is enforced
+	if rr := respond("accept", token, `{"plus_ones": 3}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("got status %d want %d: %s", rr.Code, http.StatusBadRequest, rr.Body.String())
+	}
+
+	// The QR token of the invitee is no RSVP link
+	qrToken := signedTestToken(t, keys, 1, 42, now)
+	if rr := respond("decline", qrToken, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d want %d: %s", rr.Code, http.StatusUnauthorized, rr.Body.String())
+	}
+
+	// Opening the emailed link only shows the invitation
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/rsvp/decline?token="+token, nil)
+	req = mux.SetURLVars(req, map[string]string{"response": "decline"})
+	api.GetRSVP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if len(answered) != 0 || len(promoted) != 0 {
+		t.Fatalf("opening the link recorded %+v and promoted %d", answered, len(promoted))
+	}
+
+	rr = respond("decline", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if len(answered) != 1 || answered[0].RsvpStatus != rsvpDeclined || answered[0].PlusOnes != 0 || len(answered[0].PlusOneNames) != 0 {
+		t.Errorf("unexpected answer %+v", answered)
+	}
+	// The freed seats are offered to the waitlist
+	if len(promoted) != 1 {
+		t.Errorf("got %d promotion attempts want 1", len(promoted))
+	}
+}
+
+func TestRegisterAndVerifyAwaitsApproval(t *testing.T) {
+	event := db.Event{
+		ID:               1,
+		Name:             "Open Day",
+		Date:             pgtype.Timestamp{Time: time.Now().Add(72 * time.Hour), Valid: true},
+		RegistrationOpen: true,
+		RegistrationForm: json.RawMessage(`{"required_fields": ["first_name"], "custom_fields": [{"name": "diet", "label": "Dietary needs"}], "approval_required": true}`),
+	}
+	var created []db.CreateRegistrationParams
+	var verified db.VerifyRegistrationParams
+	api := &API{
+		db: &db.MockQuerier{
+			GetEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return event, nil
+			},
+			CreateRegistrationFunc: func(ctx context.Context, arg db.CreateRegistrationParams) (db.Registration, error) {
+				created = append(created, arg)
+				return db.Registration{ID: 9, EventID: arg.EventID, Email: arg.Email, Status: registrationUnverified, VerificationTokenHash: arg.VerificationTokenHash, VerificationExpiresAt: arg.VerificationExpiresAt}, nil
+			},
+			GetRegistrationByVerificationTokenFunc: func(ctx context.Context, hash string) (db.Registration, error) {
+				if len(created) == 0 || hash != created[0].VerificationTokenHash {
+					return db.Registration{}, pgx.ErrNoRows
+				}
+				return db.Registration{ID: 9, EventID: 1, Email: created[0].Email, Status: registrationUnverified, VerificationExpiresAt: created[0].VerificationExpiresAt}, nil
+			},
+			VerifyRegistrationFunc: func(ctx context.Context, arg db.VerifyRegistrationParams) (db.Registration, error) {
+				verified = arg
+				return db.Registration{ID: 9, EventID: 1, Email: created[0].Email, Status: arg.Status}, nil
+			},
+		},
+	}
+
+	register := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/events/1/register", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		api.Register(rr, req)
+		return rr
+	}
+
+	// Bots filling in the honeypot are told nothing but not registered
+	if rr := register(`{"email": "bot@example.com", "first_name": "Bot", "website": "http://spam.example"}`); rr.Code != http.StatusAccepted || len(created) != 0 {
+		t.Errorf("honeypot: got status %d and %d registrations", rr.Code, len(created))
+	}
+	if rr := register(`{"email": "guest@example.com"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("got status %d want %d without a required field", rr.Code, http.StatusBadRequest)
+	}
+	if rr := register(`{"email": "guest@example.com", "first_name": "Ann", "custom_fields": {"diet": "vegan", "extra": "dropped"}}`); rr.Code != http.StatusAccepted {
+		t.Fatalf("got status %d want %d: %s", rr.Code, http.StatusAccepted, rr.Body.String())
+	}
+	if len(created) != 1 || created[0].FirstName.String != "Ann" || string(created[0].CustomFields) != `{"diet":"vegan"}` {
+		t.Fatalf("unexpected registration %+v", created)
+	}
+
+	// A forged token matches no registration
+	rr := httptest.NewRecorder()
+	api.VerifyRegistration(rr, httptest.NewRequest("GET", "/registrations/verify?token=forged", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("got status %d want %d for a forged token", rr.Code, http.StatusNotFound)
+	}
+
+	// Verifying moves it to the approval queue. The emailed token is not
+	// exposed, so a known one stands in for it.
+	token := "known-token"
+	created[0].VerificationTokenHash = linkTokenHash(token)
+	rr = httptest.NewRecorder()
+	api.VerifyRegistration(rr, httptest.NewRequest("GET", "/registrations/verify?token="+token, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if verified.Status != registrationPendingApproval {
+		t.Errorf("verified into %q want %q", verified.Status, registrationPendingApproval)
+	}
+}
+
+func TestCancelTicket(t *testing.T) {
+	now := time.Now()
+	event := db.Event{ID: 1, Date: pgtype.Timestamp{Time: now.Add(48 * time.Hour), Valid: true}, Capacity: 10}
+	invitee := db.Invitee{ID: 42, EventID: 1, Status: "pending", RsvpStatus: rsvpAccepted, PlusOnes: 2}
+	auditErr := errors.New("audit insert failed")
+	var promoted int
+	api := &API{
+		db: &db.MockQuerier{
+			GetInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+				return invitee, nil
+			},
+			GetEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return event, nil
+			},
+			CancelInviteeFunc: func(ctx context.Context, id int32) (db.Invitee, error) {
+				cancelled := invitee
+				cancelled.Status = inviteeCancelled
+				return cancelled, nil
+			},
+			CreateTicketChangeFunc: func(ctx context.Context, arg db.CreateTicketChangeParams) (db.TicketChange, error) {
+				if auditErr != nil {
+					return db.TicketChange{}, auditErr
+				}
+				return db.TicketChange{ID: 7, InviteeID: arg.InviteeID, Action: arg.Action}, nil
+			},
+			LockEventFunc: func(ctx context.Context, id int32) (db.Event, error) {
+				return event, nil
+			},
+			PromoteWaitlistEntryFunc: func(ctx context.Context, arg db.PromoteWaitlistEntryParams) (db.WaitlistEntry, error) {
+				promoted++
+				return db.WaitlistEntry{}, pgx.ErrNoRows
+			},
+		},
+	}
+
+	cancel := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/invitees/42/cancel", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "42"})
+		req = withTestUser(req, RoleAdmin)
+		api.CancelTicket(rr, req)
+		return rr
+	}
+
+	// A cancellation that cannot be recorded fails as a whole
+	if rr := cancel(); rr.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d want %d: %s", rr.Code, http.StatusInternalServerError, rr.Body.String())
+	}
+	if promoted != 0 {
+		t.Errorf("failed cancellation promoted %d waitlist entries", promoted)
+	}
+
+	auditErr = nil
+	rr := cancel()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var response ticketChangeResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Change.ID != 7 || response.Change.Action != ticketCancelled {
+		t.Errorf("unexpected change %+v", response.Change)
+	}
+	// The freed seats are offered to the waitlist
+	if promoted != 1 {
+		t.Errorf("got %d promotion attempts want 1", promoted)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"eventpass.pro/apps/backend/db"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// manifestDeltaOverlap is how far before since a delta starts looking for
+// changes. Rows are stamped with the start time of their transaction, so a
+// row that commits after a manifest was generated can be older than that
+// manifest's version. Devices apply entries idempotently, so re-sending the
+// recent changes is harmless.
+const manifestDeltaOverlap = 5 * time.Minute
+
+// manifestEntry is what an offline device needs to check a badge: the hash of
+// the invitee's current QR token, whether they are already in, whether their
+// gift is used up and when the badge stops being valid
+type manifestEntry struct {
+	ID          int32      `json:"id"`
+	SigHash     string     `json:"sig_hash"`
+	State       string     `json:"state"`
+	GiftClaimed bool       `json:"gift_claimed"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// scanManifest lists the valid invitees of an event. Version is the latest
+// invitee or gift balance change in microseconds and is passed back as since
+// to fetch a delta. Deltas list changed invitees and the IDs that are no
+// longer valid.
+type scanManifest struct {
+	EventID     int32           `json:"event_id"`
+	Version     int64           `json:"version"`
+	Since       int64           `json:"since,omitempty"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Invitees    []manifestEntry `json:"invitees"`
+	Removed     []int32         `json:"removed,omitempty"`
+}
+
+// GetEventManifest returns a signed snapshot of every valid invitee of the event
+func (api *API) GetEventManifest(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := api.manifestEventID(w, r)
+	if !ok {
+		return
+	}
+
+	invitees, err := api.db.GetInviteesByEvent(r.Context(), eventID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	gifts, err := api.db.ListGiftBalancesByEvent(r.Context(), eventID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	api.writeManifest(w, r, eventID, 0, invitees, gifts)
+}
+
+// GetEventManifestDelta returns the invitees changed since the given manifest version
+func (api *API) GetEventManifestDelta(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := api.manifestEventID(w, r)
+	if !ok {
+		return
+	}
+
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		http.Error(w, "Invalid since version", http.StatusBadRequest)
+		return
+	}
+
+	invitees, err := api.db.ListInviteesChangedSince(r.Context(), db.ListInviteesChangedSinceParams{
+		EventID:   eventID,
+		UpdatedAt: pgtype.Timestamptz{Time: time.UnixMicro(since).Add(-manifestDeltaOverlap), Valid: true},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	gifts, err := api.db.ListGiftBalancesByEvent(r.Context(), eventID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	api.writeManifest(w, r, eventID, since, invitees, gifts)
+}
+
+func (api *API) manifestEventID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return 0, false
+	}
+
+	return int32(eventID), true
+}
+
+// writeManifest signs and writes the manifest for the invitees. The body is
+// the base64url encoded manifest JSON plus a signature over those exact bytes,
+// which the device verifies with the keys from /signing/keys. Gift state
+// comes from the gift perk balances.
+func (api *API) writeManifest(w http.ResponseWriter, r *http.Request, eventID int32, since int64, invitees []db.Invitee, gifts []db.ListGiftBalancesByEventRow) {
+	now := time.Now().UTC()
+	manifest := scanManifest{
+		EventID:     eventID,
+		Version:     since,
+		Since:       since,
+		GeneratedAt: now,
+		Invitees:    []manifestEntry{},
+	}
+
+	giftBalances := make(map[int32]db.ListGiftBalancesByEventRow, len(gifts))
+	for _, gift := range gifts {
+		giftBalances[gift.InviteeID] = gift
+	}
+
+	for _, invitee := range invitees {
+		gift := giftBalances[invitee.ID]
+		if version := invitee.UpdatedAt.Time.UnixMicro(); version > manifest.Version {
+			manifest.Version = version
+		}
+		if version := gift.UpdatedAt.Time.UnixMicro(); gift.UpdatedAt.Valid && version > manifest.Version {
+			manifest.Version = version
+		}
+
+		if !isManifestValid(invitee, now) {
+			if since > 0 {
+				manifest.Removed = append(manifest.Removed, invitee.ID)
+			}
+			continue
+		}
+
+		sum := sha256.Sum256([]byte(invitee.HmacSignature.String))
+		entry := manifestEntry{
+			ID:          invitee.ID,
+			SigHash:     hex.EncodeToString(sum[:]),
+			State:       invitee.State,
+			GiftClaimed: gift.UsedUp,
+		}
+		if invitee.ExpiresAt.Valid {
+			entry.ExpiresAt = &invitee.ExpiresAt.Time
+		}
+		manifest.Invitees = append(manifest.Invitees, entry)
+	}
+
+	// Late commits picked up by the overlap window and badges that expired
+	// change the content without moving the version, so the ETag hashes it
+	content, _ := json.Marshal([]interface{}{manifest.Version, manifest.Invitees, manifest.Removed})
+	contentSum := sha256.Sum256(content)
+	etag := fmt.Sprintf(`"%d-%d-%s"`, eventID, since, hex.EncodeToString(contentSum[:8]))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	payload, err := json.Marshal(manifest)
+	if err != nil {
+		http.Error(w, "Failed to encode manifest", http.StatusInternalServerError)
+		return
+	}
+
+	keyID, algorithm, signature := api.qrKeys.SignDocument(payload)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	json.NewEncoder(w).Encode(struct {
+		Version   int64  `json:"version"`
+		KeyID     string `json:"kid"`
+		Algorithm string `json:"alg"`
+		Manifest  string `json:"manifest"`
+		Signature string `json:"signature"`
+	}{
+		Version:   manifest.Version,
+		KeyID:     keyID,
+		Algorithm: algorithm,
+		Manifest:  base64.RawURLEncoding.EncodeToString(payload),
+		Signature: base64.RawURLEncoding.EncodeToString(signature),
+	})
+}
+
+// isManifestValid reports whether the invitee holds a badge that can still be admitted at now
+func isManifestValid(invitee db.Invitee, now time.Time) bool {
+	if invitee.ExpiresAt.Valid && !invitee.ExpiresAt.Time.After(now) {
+		return false
+	}
+	return invitee.HmacSignature.Valid && !invitee.DeletedAt.Valid && invitee.Status != "expired"
+}
@@ -78,7 +78,7 @@ var (
 			Name: "eventpass_qr_scans_total",
 			Help: "Total number of QR code scans",
 		},
-		[]string{"status"}, // success, already_claimed, invalid
+		[]string{"status"}, // check-in outcome, or replay, device_rate_limited, ip_rate_limited
 	)
 
 	CheckInsTotal = promauto.NewCounterVec(
@@ -89,6 +89,14 @@ var (
 		[]string{"event_id"},
 	)
 
+	EventOccupancy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "eventpass_event_occupancy",
+			Help: "Number of invitees currently inside an event or zone",
+		},
+		[]string{"event_id", "zone_id"}, // zone_id is empty for the whole event
+	)
+
 	UsersRegisteredTotal = promauto.NewCounter(
 		prometheus.CounterOpts{
 			Name: "eventpass_users_registered_total",
@@ -118,6 +126,14 @@ var (
 		},
 	)
 
+	PaymentWebhooksTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "eventpass_payment_webhooks_total",
+			Help: "Total number of payment webhook deliveries",
+		},
+		[]string{"provider", "type", "status"}, // status: processed, duplicate, ignored, failed
+	)
+
 	AnonymizationRequestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "eventpass_anonymization_requests_total",
@@ -214,6 +230,16 @@ func RecordCheckIn(eventID int32) {
 	CheckInsTotal.WithLabelValues(strconv.Itoa(int(eventID))).Inc()
 }
 
+// RecordOccupancy records the number of invitees inside an event, or inside
+// one of its zones for a non-zero zoneID
+func RecordOccupancy(eventID, zoneID int32, occupancy int64) {
+	zone := ""
+	if zoneID != 0 {
+		zone = strconv.Itoa(int(zoneID))
+	}
+	EventOccupancy.WithLabelValues(strconv.Itoa(int(eventID)), zone).Set(float64(occupancy))
+}
+
 // RecordUserRegistration records user registration metrics
 func RecordUserRegistration() {
 	UsersRegisteredTotal.Inc()
@@ -234,6 +260,11 @@ func RecordOrderExpiration() {
 	OrdersExpiredTotal.Inc()
 }
 
+// RecordPaymentWebhook records payment webhook metrics
+func RecordPaymentWebhook(provider, eventType, status string) {
+	PaymentWebhooksTotal.WithLabelValues(provider, eventType, status).Inc()
+}
+
 // RecordAnonymization records GDPR anonymization metrics
 func RecordAnonymization(anonymizationType string) {
 	AnonymizationRequestsTotal.WithLabelValues(anonymizationType).Inc()
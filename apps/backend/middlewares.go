@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"os"
 	"strings"
@@ -9,49 +10,178 @@ import (
 	"eventpass.pro/apps/backend/db"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 // Use the existing contextKey type from logging.go
-const userContextKey contextKey = "user"
+const (
+	userContextKey     contextKey = "user"
+	sessionContextKey  contextKey = "session_id"
+	issuedAtContextKey contextKey = "issued_at"
+)
+
+// User roles stored on users.role and carried in the JWT "role" claim
+const (
+	RoleAdmin     = "admin"
+	RoleOrganizer = "organizer"
+	RoleDoorStaff = "door_staff"
+	RoleAuditor   = "auditor"
+	// RoleAttendee is given to self-registered accounts, which can buy
+	// tickets and join waitlists but not reach any event's data
+	RoleAttendee = "attendee"
+)
+
+func isValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleOrganizer, RoleDoorStaff, RoleAuditor, RoleAttendee:
+		return true
+	}
+	return false
+}
+
+// userFromContext returns the authenticated user set by authMiddleware
+func userFromContext(ctx context.Context) (db.User, bool) {
+	user, ok := ctx.Value(userContextKey).(db.User)
+	return user, ok
+}
+
+// sessionIDFromContext returns the session ID of the access token used for the request
+func sessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionContextKey).(string)
+	return sessionID
+}
+
+// issuedAtFromContext returns when the access token used for the request was issued, in Unix seconds
+func issuedAtFromContext(ctx context.Context) int64 {
+	issuedAt, _ := ctx.Value(issuedAtContextKey).(int64)
+	return issuedAt
+}
+
+// stillAuthorized repeats the revocation and role checks of authMiddleware.
+// WebSocket and SSE connections outlive the request that authenticated them,
+// so they call it periodically and close once it fails.
+func (api *API) stillAuthorized(ctx context.Context) bool {
+	user, ok := userFromContext(ctx)
+	if !ok {
+		return false
+	}
 
-func authMiddleware(queries *db.Queries) func(http.Handler) http.Handler {
+	revoked, err := api.sessions.IsTokenRevoked(ctx, uuid.UUID(user.ID.Bytes).String(), sessionIDFromContext(ctx), issuedAtFromContext(ctx))
+	if err != nil {
+		LogError(ctx, "Failed to check token revocation", err)
+		return false
+	}
+	if revoked {
+		return false
+	}
+
+	current, err := api.db.GetUserByID(ctx, user.ID)
+	if err != nil {
+		return false
+	}
+	return current.Role == user.Role
+}
+
+// bearerToken returns the access token from the Authorization header
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// liveTicketParam returns the ticket of a WebSocket upgrade or EventSource
+// request. Browsers cannot set headers on those, so they authenticate with a
+// single-use ticket from POST /live/ticket in the ticket query parameter.
+func liveTicketParam(r *http.Request) string {
+	if websocket.IsWebSocketUpgrade(r) || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return r.URL.Query().Get("ticket")
+	}
+	return ""
+}
+
+// accessTokenIdentity verifies an access token and returns its claims,
+// writing an error response when it is invalid
+func accessTokenIdentity(w http.ResponseWriter, tokenString string) (authIdentity, bool) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, http.ErrAbortHandler
+		}
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+
+	if err != nil || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return authIdentity{}, false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		return authIdentity{}, false
+	}
+
+	userIDStr, ok := claims["user_id"].(string)
+	if !ok {
+		http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+		return authIdentity{}, false
+	}
+
+	sessionID, ok := claims["sid"].(string)
+	if !ok {
+		http.Error(w, "Invalid session in token", http.StatusUnauthorized)
+		return authIdentity{}, false
+	}
+
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		http.Error(w, "Invalid iat in token", http.StatusUnauthorized)
+		return authIdentity{}, false
+	}
+
+	role, _ := claims["role"].(string)
+	return authIdentity{UserID: userIDStr, SessionID: sessionID, Role: role, IssuedAt: issuedAt.Unix()}, true
+}
+
+func authMiddleware(queries db.Querier, sessions *SessionStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Authorization header required", http.StatusUnauthorized)
-				return
-			}
-
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, http.ErrAbortHandler
+			var identity authIdentity
+			if ticket := liveTicketParam(r); ticket != "" {
+				var err error
+				identity, err = sessions.ConsumeLiveTicket(r.Context(), ticket)
+				if errors.Is(err, errInvalidLiveTicket) {
+					http.Error(w, "Invalid or expired ticket", http.StatusUnauthorized)
+					return
+				}
+				if err != nil {
+					http.Error(w, "Failed to check ticket", http.StatusServiceUnavailable)
+					return
+				}
+			} else {
+				tokenString := bearerToken(r)
+				if tokenString == "" {
+					http.Error(w, "Authorization header required", http.StatusUnauthorized)
+					return
 				}
-				return []byte(os.Getenv("JWT_SECRET")), nil
-			})
 
-			if err != nil || !token.Valid {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
-				return
+				var ok bool
+				if identity, ok = accessTokenIdentity(w, tokenString); !ok {
+					return
+				}
 			}
 
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+			userID, err := uuid.Parse(identity.UserID)
+			if err != nil {
+				http.Error(w, "Invalid user_id format in token", http.StatusUnauthorized)
 				return
 			}
 
-			userIDStr, ok := claims["user_id"].(string)
-			if !ok {
-				http.Error(w, "Invalid user_id in token", http.StatusUnauthorized)
+			revoked, err := sessions.IsTokenRevoked(r.Context(), identity.UserID, identity.SessionID, identity.IssuedAt)
+			if err != nil {
+				http.Error(w, "Failed to check token revocation", http.StatusServiceUnavailable)
 				return
 			}
-
-			userID, err := uuid.Parse(userIDStr)
-			if err != nil {
-				http.Error(w, "Invalid user_id format in token", http.StatusUnauthorized)
+			if revoked {
+				http.Error(w, "Token has been revoked", http.StatusUnauthorized)
 				return
 			}
 
@@ -65,8 +195,39 @@ func authMiddleware(queries *db.Queries) func(http.Handler) http.Handler {
 				return
 			}
 
+			// Tokens issued before a role change are no longer valid
+			if identity.Role != user.Role {
+				http.Error(w, "Token role is out of date", http.StatusUnauthorized)
+				return
+			}
+
 			ctx := context.WithValue(r.Context(), userContextKey, user)
+			ctx = context.WithValue(ctx, sessionContextKey, identity.SessionID)
+			ctx = context.WithValue(ctx, issuedAtContextKey, identity.IssuedAt)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// requireRole wraps a handler so that only users with one of the given roles
+// can reach it. It must run after authMiddleware.
+func requireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := userFromContext(r.Context())
+			if !ok {
+				http.Error(w, "User not authenticated", http.StatusUnauthorized)
+				return
+			}
+
+			for _, role := range roles {
+				if user.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+	}
+}
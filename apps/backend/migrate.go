@@ -16,9 +16,41 @@ func runMigrations() error {
 	return nil
 }
 
-func applyMigrations(pool *pgxpool.Pool) error {
+// timescaleMigrationMarker is the first line of migrations that need the
+// TimescaleDB extension. They are skipped, and retried on a later start, when
+// the extension is not available.
+const timescaleMigrationMarker = "-- requires: timescaledb"
+
+func applyMigrations(pool *pgxpool.Pool, timescale bool) error {
 	migrationsDir := "apps/backend/db/migrations"
 
+	// Track applied migrations so non-idempotent statements only ever run once
+	_, err := pool.Exec(context.Background(), `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	applied := map[string]bool{}
+	rows, err := pool.Query(context.Background(), "SELECT version FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("failed to read applied migrations: %v", err)
+	}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read applied migrations: %v", err)
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read applied migrations: %v", err)
+	}
+
 	// Get all migration files
 	files, err := filepath.Glob(filepath.Join(migrationsDir, "*.up.sql"))
 	if err != nil {
@@ -29,13 +61,23 @@ func applyMigrations(pool *pgxpool.Pool) error {
 	sort.Strings(files)
 
 	for _, file := range files {
-		fmt.Printf("Applying migration: %s\n", filepath.Base(file))
+		version := filepath.Base(file)
+		if applied[version] {
+			continue
+		}
 
 		content, err := os.ReadFile(file)
 		if err != nil {
 			return fmt.Errorf("failed to read migration file %s: %v", file, err)
 		}
 
+		if strings.HasPrefix(string(content), timescaleMigrationMarker) && !timescale {
+			fmt.Printf("Skipping migration %s: TimescaleDB is not available\n", version)
+			continue
+		}
+
+		fmt.Printf("Applying migration: %s\n", version)
+
 		// Split by semicolon and execute each statement
 		statements := strings.Split(string(content), ";")
 
@@ -45,6 +87,14 @@ func applyMigrations(pool *pgxpool.Pool) error {
 				continue
 			}
 
+			// Migrations from before the marker create hypertables inline.
+			// Without TimescaleDB the tables stay plain and a marked migration
+			// converts them once the extension is available.
+			if !timescale && strings.Contains(stmt, "create_hypertable(") {
+				fmt.Printf("Skipping TimescaleDB statement in %s\n", file)
+				continue
+			}
+
 			if _, err := pool.Exec(context.Background(), stmt); err != nil {
 				// Ignore "relation already exists" errors for idempotent migrations
 				if strings.Contains(err.Error(), "already exists") || strings.Contains(err.Error(), "relation") && strings.Contains(err.Error(), "exists") ||
@@ -56,6 +106,10 @@ func applyMigrations(pool *pgxpool.Pool) error {
 				return fmt.Errorf("failed to execute statement in %s: %v\nStatement: %s", file, err, stmt)
 			}
 		}
+
+		if _, err := pool.Exec(context.Background(), "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+			return fmt.Errorf("failed to record migration %s: %v", version, err)
+		}
 	}
 
 	return nil
@@ -247,7 +247,7 @@ func (api *API) SendEventReminder(ctx context.Context, eventID int32, hoursBefor
 	}
 
 	subject := fmt.Sprintf("Reminder: %s starts in %d hours", event.Name, hoursBefore)
-	message := fmt.Sprintf(`
+	template := `
 Reminder: %s
 
 Event: %s
@@ -255,23 +255,45 @@ Start Time: %s
 Location: %s
 
 This is a reminder that the event starts in %d hours.
-
+%s
 Please make sure to arrive on time and bring your QR code for check-in.
 
 Best regards,
 EventPass Pro Team
-`, event.Name, event.Name, event.Date.Time.Format("2006-01-02 15:04"), event.Location, hoursBefore)
+`
 
+	// Invitees who declined are not reminded; those who have not answered or
+	// answered maybe are asked to confirm
+	now := time.Now()
+	recipients := 0
 	for _, invitee := range invitees {
-		if invitee.Status == "pending" {
-			api.SendEventNotification(ctx, eventID, "email", invitee.Email, subject, message)
+		if invitee.Status != "pending" || invitee.RsvpStatus == rsvpDeclined {
+			continue
+		}
+
+		var rsvp string
+		if invitee.RsvpStatus == rsvpAwaiting || invitee.RsvpStatus == rsvpMaybe {
+			accept, err := api.rsvpLink(event, invitee, "accept", now)
+			var decline string
+			if err == nil {
+				decline, err = api.rsvpLink(event, invitee, "decline", now)
+			}
+			if err != nil {
+				LogError(ctx, "Failed to sign RSVP links for reminder", err)
+			} else {
+				rsvp = fmt.Sprintf("\nPlease confirm you are coming: %s\nCannot make it? Let us know: %s\n", accept, decline)
+			}
 		}
+
+		message := fmt.Sprintf(template, event.Name, event.Name, event.Date.Time.Format("2006-01-02 15:04"), event.Location, hoursBefore, rsvp)
+		api.SendEventNotification(ctx, eventID, "email", invitee.Email, subject, message)
+		recipients++
 	}
 
 	LogInfo(ctx, "Event reminders sent",
 		slog.Int("event_id", int(eventID)),
 		slog.Int("hours_before", hoursBefore),
-		slog.Int("recipients", len(invitees)))
+		slog.Int("recipients", recipients))
 
 	return nil
 }
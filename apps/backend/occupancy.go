@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"eventpass.pro/apps/backend/db"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// occupancyTTL drops the counters of events that stopped scanning
+	occupancyTTL = 48 * time.Hour
+	// occupancyReconcileInterval is how often counters are rebuilt from check_ins
+	occupancyReconcileInterval = 5 * time.Minute
+	// occupancyReconcileWindow limits reconciliation to events scanned recently
+	occupancyReconcileWindow = 24 * time.Hour
+)
+
+var (
+	errEventFull = errors.New("event is at capacity")
+	errZoneFull  = errors.New("zone is at capacity")
+)
+
+// Field of the inside hash for invitees in the event but in no zone
+const occupancyNoZone = "0"
+
+// occupancyEnterScript moves an invitee into a zone unless the event or zone
+// is full. Invitees moving between zones only count against the zone. It
+// returns the status, the previous zone ("" when outside), and the event,
+// new zone and previous zone counts.
+var occupancyEnterScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[3]) == 0 then
+  return {'stale', '', 0, 0, 0}
+end
+local prev = redis.call('HGET', KEYS[1], ARGV[1]) or ''
+local zone = ARGV[2]
+if prev ~= zone then
+  local total = redis.call('HLEN', KEYS[1])
+  local eventCapacity = tonumber(ARGV[3])
+  if prev == '' and eventCapacity > 0 and total >= eventCapacity then
+    return {'event_full', prev, total, 0, 0}
+  end
+  local zoneCapacity = tonumber(ARGV[4])
+  local inZone = tonumber(redis.call('HGET', KEYS[2], zone) or '0')
+  if zone ~= '0' and zoneCapacity > 0 and inZone >= zoneCapacity then
+    return {'zone_full', prev, total, inZone, 0}
+  end
+  if prev ~= '' then
+    redis.call('HINCRBY', KEYS[2], prev, -1)
+  end
+  redis.call('HSET', KEYS[1], ARGV[1], zone)
+  redis.call('HINCRBY', KEYS[2], zone, 1)
+end
+for i = 1, 3 do
+  redis.call('EXPIRE', KEYS[i], ARGV[5])
+end
+local prevCount = 0
+if prev ~= '' then
+  prevCount = tonumber(redis.call('HGET', KEYS[2], prev) or '0')
+end
+return {'ok', prev, redis.call('HLEN', KEYS[1]), tonumber(redis.call('HGET', KEYS[2], zone) or '0'), prevCount}
+`)
+
+// occupancyMoveScript moves an invitee into a zone, or out of the event when
+// the zone is "", without checking capacity. It returns the same values as
+// occupancyEnterScript.
+var occupancyMoveScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[3]) == 0 then
+  return {'stale', '', 0, 0, 0}
+end
+local prev = redis.call('HGET', KEYS[1], ARGV[1]) or ''
+local zone = ARGV[2]
+if prev ~= zone then
+  if prev ~= '' then
+    redis.call('HINCRBY', KEYS[2], prev, -1)
+  end
+  if zone == '' then
+    redis.call('HDEL', KEYS[1], ARGV[1])
+  else
+    redis.call('HSET', KEYS[1], ARGV[1], zone)
+    redis.call('HINCRBY', KEYS[2], zone, 1)
+  end
+end
+for i = 1, 3 do
+  redis.call('EXPIRE', KEYS[i], ARGV[3])
+end
+local zoneCount, prevCount = 0, 0
+if zone ~= '' then
+  zoneCount = tonumber(redis.call('HGET', KEYS[2], zone) or '0')
+end
+if prev ~= '' then
+  prevCount = tonumber(redis.call('HGET', KEYS[2], prev) or '0')
+end
+return {'ok', prev, redis.call('HLEN', KEYS[1]), zoneCount, prevCount}
+`)
+
+// Occupancy counts the invitees inside each event and zone in Redis. The
+// counters are a fast copy of what the check_ins ledger says and are rebuilt
+// from it whenever they are missing and periodically by the reconcile cron.
+type Occupancy struct {
+	rdb *redis.Client
+}
+
+// NewOccupancy creates occupancy counters stored in the given Redis client
+func NewOccupancy(rdb *redis.Client) *Occupancy {
+	return &Occupancy{rdb: rdb}
+}
+
+// occupancyResult is what the occupancy scripts return
+type occupancyResult struct {
+	Status    string
+	Previous  string
+	Total     int64
+	ZoneCount int64
+	PrevCount int64
+}
+
+func occupancyKeys(eventID int32) []string {
+	prefix := fmt.Sprintf("occupancy:%d", eventID)
+	return []string{prefix + ":inside", prefix + ":zones", prefix + ":synced"}
+}
+
+func occupancyZoneField(zoneID int32) string {
+	if zoneID == 0 {
+		return occupancyNoZone
+	}
+	return strconv.Itoa(int(zoneID))
+}
+
+func (o *Occupancy) run(ctx context.Context, script *redis.Script, eventID int32, args ...interface{}) (occupancyResult, error) {
+	values, err := script.Run(ctx, o.rdb, occupancyKeys(eventID), args...).Slice()
+	if err != nil {
+		return occupancyResult{}, err
+	}
+	if len(values) != 5 {
+		return occupancyResult{}, fmt.Errorf("unexpected occupancy script result %v", values)
+	}
+
+	var result occupancyResult
+	result.Status, _ = values[0].(string)
+	result.Previous, _ = values[1].(string)
+	result.Total, _ = values[2].(int64)
+	result.ZoneCount, _ = values[3].(int64)
+	result.PrevCount, _ = values[4].(int64)
+	return result, nil
+}
+
+// enter moves the invitee into the zone (0 for none) within the capacities
+func (o *Occupancy) enter(ctx context.Context, eventID, inviteeID, zoneID, eventCapacity, zoneCapacity int32) (occupancyResult, error) {
+	return o.run(ctx, occupancyEnterScript, eventID, inviteeID, occupancyZoneField(zoneID), eventCapacity, zoneCapacity, int(occupancyTTL.Seconds()))
+}
+
+// move puts the invitee in the zone field given, or outside for ""
+func (o *Occupancy) move(ctx context.Context, eventID, inviteeID int32, zone string) (occupancyResult, error) {
+	return o.run(ctx, occupancyMoveScript, eventID, inviteeID, zone, int(occupancyTTL.Seconds()))
+}
+
+// Counts returns how many invitees are inside the event and in each zone.
+// ok is false when the counters need to be rebuilt first.
+func (o *Occupancy) Counts(ctx context.Context, eventID int32) (total int64, zones map[int32]int64, ok bool, err error) {
+	keys := occupancyKeys(eventID)
+	pipe := o.rdb.Pipeline()
+	synced := pipe.Exists(ctx, keys[2])
+	inside := pipe.HLen(ctx, keys[0])
+	counts := pipe.HGetAll(ctx, keys[1])
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, nil, false, err
+	}
+	if synced.Val() == 0 {
+		return 0, nil, false, nil
+	}
+
+	zones = map[int32]int64{}
+	for field, value := range counts.Val() {
+		zoneID, _ := strconv.Atoi(field)
+		count, _ := strconv.ParseInt(value, 10, 64)
+		if zoneID != 0 {
+			zones[int32(zoneID)] = count
+		}
+	}
+	return inside.Val(), zones, true, nil
+}
+
+// Reset replaces the event's counters with the given occupants. Scans
+// counted between loading the occupants and the reset are corrected by the
+// next reconciliation.
+func (o *Occupancy) Reset(ctx context.Context, eventID int32, occupants []db.ListEventOccupantsRow) error {
+	keys := occupancyKeys(eventID)
+	inside := map[string]interface{}{}
+	zones := map[string]int64{}
+	for _, occupant := range occupants {
+		zone := occupancyZoneField(occupant.ZoneID.Int32)
+		inside[strconv.Itoa(int(occupant.InviteeID.Int32))] = zone
+		zones[zone]++
+	}
+
+	pipe := o.rdb.TxPipeline()
+	pipe.Del(ctx, keys[0], keys[1])
+	if len(inside) > 0 {
+		pipe.HSet(ctx, keys[0], inside)
+	}
+	for zone, count := range zones {
+		pipe.HSet(ctx, keys[1], zone, count)
+	}
+	pipe.Set(ctx, keys[2], time.Now().Unix(), 0)
+	for _, key := range keys {
+		pipe.Expire(ctx, key, occupancyTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// eventOccupants loads who is inside the event from the check_ins ledger
+func (api *API) eventOccupants(ctx context.Context, eventID int32) ([]db.ListEventOccupantsRow, error) {
+	return api.db.ListEventOccupants(ctx, pgtype.Int4{Int32: eventID, Valid: true})
+}
+
+// reconcileOccupancy rebuilds the event's counters from check_ins
+func (api *API) reconcileOccupancy(ctx context.Context, eventID int32) error {
+	occupants, err := api.eventOccupants(ctx, eventID)
+	if err != nil {
+		return err
+	}
+	if err := api.occupancy.Reset(ctx, eventID, occupants); err != nil {
+		return err
+	}
+
+	total, zones := occupancyCounts(occupants)
+	RecordOccupancy(eventID, 0, total)
+	for zoneID, count := range zones {
+		RecordOccupancy(eventID, zoneID, count)
+	}
+	return nil
+}
+
+// occupancyCounts counts the occupants of the event and of each zone
+func occupancyCounts(occupants []db.ListEventOccupantsRow) (int64, map[int32]int64) {
+	zones := map[int32]int64{}
+	for _, occupant := range occupants {
+		if occupant.ZoneID.Valid {
+			zones[occupant.ZoneID.Int32]++
+		}
+	}
+	return int64(len(occupants)), zones
+}
+
+// runOccupancy runs an occupancy script, rebuilding stale counters and
+// retrying once, and records the new counts
+func (api *API) runOccupancy(ctx context.Context, eventID int32, zone string, run func() (occupancyResult, error)) (occupancyResult, error) {
+	result, err := run()
+	if err == nil && result.Status == "stale" {
+		if err := api.reconcileOccupancy(ctx, eventID); err != nil {
+			return result, err
+		}
+		result, err = run()
+	}
+	if err != nil || result.Status != "ok" {
+		return result, err
+	}
+
+	RecordOccupancy(eventID, 0, result.Total)
+	if zoneID, _ := strconv.Atoi(zone); zoneID != 0 {
+		RecordOccupancy(eventID, int32(zoneID), result.ZoneCount)
+	}
+	if zoneID, _ := strconv.Atoi(result.Previous); zoneID != 0 && result.Previous != zone {
+		RecordOccupancy(eventID, int32(zoneID), result.PrevCount)
+	}
+	return result, nil
+}
+
+// enterOccupancy counts the invitee as inside the event and zone (the zero
+// zone for none). With enforce set it returns errEventFull or errZoneFull
+// instead when that would exceed a capacity. The returned func undoes the
+// move for scans rejected afterwards. Redis failures are only logged so an
+// outage never blocks the door.
+func (api *API) enterOccupancy(ctx context.Context, invitee db.Invitee, zone db.Zone, enforce bool) (undo func(), err error) {
+	undo = func() {}
+	if api.occupancy == nil {
+		return undo, nil
+	}
+
+	var eventCapacity, zoneCapacity int32
+	if enforce {
+		event, err := api.db.GetEvent(ctx, invitee.EventID)
+		if err != nil {
+			LogError(ctx, "Failed to load event capacity", err)
+			return undo, nil
+		}
+		eventCapacity, zoneCapacity = event.Capacity, zone.Capacity
+	}
+
+	field := occupancyZoneField(zone.ID)
+	result, err := api.runOccupancy(ctx, invitee.EventID, field, func() (occupancyResult, error) {
+		return api.occupancy.enter(ctx, invitee.EventID, invitee.ID, zone.ID, eventCapacity, zoneCapacity)
+	})
+	switch {
+	case err != nil:
+		LogError(ctx, "Failed to count occupancy", err)
+		return undo, nil
+	case result.Status == "event_full":
+		return undo, errEventFull
+	case result.Status == "zone_full":
+		return undo, errZoneFull
+	}
+
+	if result.Previous == field {
+		return undo, nil
+	}
+	return func() { api.moveOccupancy(ctx, invitee, result.Previous) }, nil
+}
+
+// leaveOccupancy stops counting the invitee as inside the event
+func (api *API) leaveOccupancy(ctx context.Context, invitee db.Invitee) {
+	if api.occupancy == nil {
+		return
+	}
+	api.moveOccupancy(ctx, invitee, "")
+}
+
+func (api *API) moveOccupancy(ctx context.Context, invitee db.Invitee, zone string) {
+	_, err := api.runOccupancy(ctx, invitee.EventID, zone, func() (occupancyResult, error) {
+		return api.occupancy.move(ctx, invitee.EventID, invitee.ID, zone)
+	})
+	if err != nil {
+		LogError(ctx, "Failed to count occupancy", err)
+	}
+}
+
+// StartOccupancyReconcileCron periodically rebuilds the occupancy counters
+// of recently scanned events from check_ins, correcting drift from scans
+// that were counted but not committed or the other way round
+func (api *API) StartOccupancyReconcileCron() {
+	ticker := time.NewTicker(occupancyReconcileInterval)
+	go func() {
+		for range ticker.C {
+			api.reconcileRecentOccupancy()
+		}
+	}()
+}
+
+func (api *API) reconcileRecentOccupancy() {
+	ctx := context.Background()
+
+	since := pgtype.Timestamptz{Time: time.Now().Add(-occupancyReconcileWindow), Valid: true}
+	eventIDs, err := api.db.ListEventsWithRecentCheckIns(ctx, since)
+	if err != nil {
+		LogError(ctx, "Failed to list events to reconcile", err)
+		return
+	}
+
+	for _, eventID := range eventIDs {
+		if err := api.reconcileOccupancy(ctx, eventID.Int32); err != nil {
+			LogError(ctx, "Failed to reconcile occupancy", err)
+		}
+	}
+}
+
+type zoneOccupancy struct {
+	ZoneID    int32  `json:"zone_id"`
+	Name      string `json:"name"`
+	Occupancy int64  `json:"occupancy"`
+	Capacity  int32  `json:"capacity"`
+}
+
+// GetEventOccupancy returns how many invitees are inside the event and each
+// of its zones, next to their capacities (0 for no limit). Events without
+// exit scans only ever fill up, since nobody is seen leaving.
+func (api *API) GetEventOccupancy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	event, err := api.db.GetEvent(ctx, int32(eventID))
+	if err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	zones, err := api.db.ListZonesByEvent(ctx, event.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	total, counts, ok := int64(0), map[int32]int64(nil), false
+	if api.occupancy != nil {
+		total, counts, ok, err = api.occupancy.Counts(ctx, event.ID)
+		if err != nil {
+			LogError(ctx, "Failed to read occupancy", err)
+		} else if !ok {
+			if err := api.reconcileOccupancy(ctx, event.ID); err != nil {
+				LogError(ctx, "Failed to reconcile occupancy", err)
+			}
+		}
+	}
+	if !ok {
+		// Count from the ledger when Redis has no counters
+		occupants, err := api.eventOccupants(ctx, event.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		total, counts = occupancyCounts(occupants)
+	}
+
+	response := struct {
+		EventID   int32           `json:"event_id"`
+		Occupancy int64           `json:"occupancy"`
+		Capacity  int32           `json:"capacity"`
+		Zones     []zoneOccupancy `json:"zones"`
+	}{
+		EventID:   event.ID,
+		Occupancy: total,
+		Capacity:  event.Capacity,
+		Zones:     make([]zoneOccupancy, 0, len(zones)),
+	}
+	for _, zone := range zones {
+		response.Zones = append(response.Zones, zoneOccupancy{
+			ZoneID:    zone.ID,
+			Name:      zone.Name,
+			Occupancy: counts[zone.ID],
+			Capacity:  zone.Capacity,
+		})
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
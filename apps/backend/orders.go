@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"eventpass.pro/apps/backend/db"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Order statuses stored on orders.status
+const (
+	orderPending   = "pending"
+	orderPaid      = "paid"
+	orderConfirmed = "confirmed"
+	orderCancelled = "cancelled"
+	orderExpired   = "expired"
+)
+
+const (
+	// orderHoldDuration is how long a pending order holds its tickets
+	orderHoldDuration = 15 * time.Minute
+	// maxTicketsPerOrder bounds the tickets reserved in one order
+	maxTicketsPerOrder = 10
+)
+
+// orderTicketRequest names the holder of one ticket and, for events selling
+// ticket types, its type
+type orderTicketRequest struct {
+	Email        string `json:"email"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	TicketTypeID int32  `json:"ticket_type_id"`
+}
+
+// orderResponse is an order with its line items and tickets
+type orderResponse struct {
+	Order   db.Order         `json:"order"`
+	Items   []db.OrderItem   `json:"items"`
+	Tickets []db.OrderTicket `json:"tickets"`
+}
+
+// ReserveOrder holds tickets for an event in a pending order that expires
+// after orderHoldDuration unless confirmed. Each ticket names its holder, who
+// becomes an invitee on confirmation. Events with ticket types require a type
+// for every ticket; the order is priced from the types' current prices.
+func (api *API) ReserveOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := userFromContext(ctx)
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Tickets []orderTicketRequest `json:"tickets"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(request.Tickets) == 0 || len(request.Tickets) > maxTicketsPerOrder {
+		http.Error(w, fmt.Sprintf("An order must have between 1 and %d tickets", maxTicketsPerOrder), http.StatusBadRequest)
+		return
+	}
+	seen := map[string]bool{}
+	for i := range request.Tickets {
+		ticket := &request.Tickets[i]
+		ticket.Email = strings.TrimSpace(ticket.Email)
+		ticket.FirstName = strings.TrimSpace(ticket.FirstName)
+		ticket.LastName = strings.TrimSpace(ticket.LastName)
+		if !isValidEmail(ticket.Email) {
+			http.Error(w, fmt.Sprintf("Invalid email address %q", ticket.Email), http.StatusBadRequest)
+			return
+		}
+		if len(ticket.FirstName) > maxInviteeTextLength || len(ticket.LastName) > maxInviteeTextLength {
+			http.Error(w, fmt.Sprintf("Names are limited to %d characters", maxInviteeTextLength), http.StatusBadRequest)
+			return
+		}
+		if seen[strings.ToLower(ticket.Email)] {
+			http.Error(w, fmt.Sprintf("%s has more than one ticket", ticket.Email), http.StatusBadRequest)
+			return
+		}
+		seen[strings.ToLower(ticket.Email)] = true
+	}
+
+	event, err := api.db.GetEvent(ctx, int32(eventID))
+	if err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if event.Date.Valid && event.Date.Time.Before(time.Now()) {
+		http.Error(w, "Event has already taken place", http.StatusConflict)
+		return
+	}
+
+	ticketTypes, err := api.db.ListTicketTypesByEvent(ctx, event.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items, message, status := orderItemsForTickets(ticketTypes, request.Tickets, time.Now())
+	if message != "" {
+		http.Error(w, message, status)
+		return
+	}
+
+	for _, ticket := range request.Tickets {
+		_, err := api.db.GetInviteeByEventAndEmail(ctx, db.GetInviteeByEventAndEmailParams{EventID: event.ID, Email: ticket.Email})
+		if err == nil {
+			http.Error(w, fmt.Sprintf("%s is already invited", ticket.Email), http.StatusConflict)
+			return
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// The order, its items and tickets are reserved together, so a failure
+	// leaves no partial order holding tickets
+	var order db.Order
+	var reservedItems []db.OrderItem
+	var tickets []db.OrderTicket
+	var soldOut string
+	err = api.inTx(ctx, func(q db.Querier) error {
+		var err error
+		order, err = q.ReserveOrder(ctx, db.ReserveOrderParams{
+			UserID:    user.ID,
+			EventID:   event.ID,
+			Quantity:  int32(len(request.Tickets)),
+			ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(orderHoldDuration), Valid: true},
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			soldOut = "Not enough tickets left"
+		}
+		if err != nil {
+			return err
+		}
+
+		reservedItems = make([]db.OrderItem, 0, len(items))
+		var amount int64
+		for _, item := range items {
+			reserved, err := q.ReserveOrderItem(ctx, db.ReserveOrderItemParams{
+				OrderID:      order.ID,
+				TicketTypeID: item.ticketType.ID,
+				Quantity:     item.quantity,
+				EventID:      event.ID,
+			})
+			if errors.Is(err, pgx.ErrNoRows) {
+				soldOut = fmt.Sprintf("Not enough %s tickets left", item.ticketType.Name)
+			}
+			if err != nil {
+				return err
+			}
+			reservedItems = append(reservedItems, reserved)
+			amount += reserved.UnitPrice * int64(reserved.Quantity)
+		}
+		if len(reservedItems) > 0 {
+			order, err = q.SetOrderTotal(ctx, db.SetOrderTotalParams{
+				ID:       order.ID,
+				Amount:   amount,
+				Currency: pgtype.Text{String: reservedItems[0].Currency, Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		tickets = make([]db.OrderTicket, 0, len(request.Tickets))
+		for _, ticket := range request.Tickets {
+			created, err := q.CreateOrderTicket(ctx, db.CreateOrderTicketParams{
+				OrderID:      order.ID,
+				Email:        ticket.Email,
+				FirstName:    optionalText(ticket.FirstName),
+				LastName:     optionalText(ticket.LastName),
+				TicketTypeID: pgtype.Int4{Int32: ticket.TicketTypeID, Valid: ticket.TicketTypeID != 0},
+			})
+			if err != nil {
+				return err
+			}
+			tickets = append(tickets, created)
+		}
+		return nil
+	})
+	if soldOut != "" {
+		http.Error(w, soldOut, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		LogError(ctx, "Failed to reserve order", err)
+		http.Error(w, "Failed to reserve tickets", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(orderResponse{Order: order, Items: reservedItems, Tickets: tickets})
+}
+
+// orderItem is the number of tickets of one type in an order request
+type orderItem struct {
+	ticketType db.TicketType
+	quantity   int32
+}
+
+// orderItemsForTickets groups the requested tickets by ticket type, ordered
+// by type ID so concurrent orders lock the types in the same order. It
+// returns an error message and status when the tickets do not match the
+// event's types, a type is not on sale, over its per-order limit or the
+// types are priced in different currencies.
+func orderItemsForTickets(ticketTypes []db.TicketType, tickets []orderTicketRequest, now time.Time) ([]orderItem, string, int) {
+	if len(ticketTypes) == 0 {
+		for _, ticket := range tickets {
+			if ticket.TicketTypeID != 0 {
+				return nil, "Event has no ticket types", http.StatusBadRequest
+			}
+		}
+		return nil, "", 0
+	}
+
+	byID := map[int32]db.TicketType{}
+	for _, ticketType := range ticketTypes {
+		byID[ticketType.ID] = ticketType
+	}
+	counts := map[int32]int32{}
+	for _, ticket := range tickets {
+		if _, ok := byID[ticket.TicketTypeID]; !ok {
+			return nil, "Every ticket needs a ticket_type_id of this event", http.StatusBadRequest
+		}
+		counts[ticket.TicketTypeID]++
+	}
+
+	items := make([]orderItem, 0, len(counts))
+	for _, ticketType := range ticketTypes {
+		if count := counts[ticketType.ID]; count > 0 {
+			items = append(items, orderItem{ticketType: ticketType, quantity: count})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ticketType.ID < items[j].ticketType.ID })
+
+	for _, item := range items {
+		ticketType := item.ticketType
+		if !ticketTypeOnSale(ticketType, now) {
+			return nil, fmt.Sprintf("%s tickets are not on sale", ticketType.Name), http.StatusConflict
+		}
+		if item.quantity > ticketType.MaxPerOrder {
+			return nil, fmt.Sprintf("At most %d %s tickets per order", ticketType.MaxPerOrder, ticketType.Name), http.StatusBadRequest
+		}
+		if ticketType.Currency != items[0].ticketType.Currency {
+			return nil, "All tickets of an order must be priced in one currency", http.StatusBadRequest
+		}
+	}
+	return items, "", 0
+}
+
+// ListMyOrders returns the authenticated user's orders, newest first
+func (api *API) ListMyOrders(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	orders, err := api.db.ListOrdersByUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(orders)
+}
+
+// GetOrder returns one of the user's orders with its line items and tickets
+func (api *API) GetOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := api.orderForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := api.db.ListOrderItems(r.Context(), order.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tickets, err := api.db.ListOrderTickets(r.Context(), order.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(orderResponse{Order: order, Items: items, Tickets: tickets})
+}
+
+// ConfirmOrder confirms a pending free order before its hold expires and
+// issues each ticket as an invitee with a signed QR code. Orders with a price
+// are confirmed by paying them instead. Confirming a confirmed or paid order
+// again issues the tickets a failed attempt left out.
+func (api *API) ConfirmOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	order, ok := api.orderForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if order.Status == orderPending && order.Amount > 0 {
+		http.Error(w, "Order must be paid", http.StatusPaymentRequired)
+		return
+	}
+	if order.Status == orderPending {
+		confirmed, err := api.db.ConfirmOrder(ctx, order.ID)
+		if err == nil {
+			order = confirmed
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if order, err = api.db.GetOrder(ctx, order.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if order.Status == orderPending {
+		http.Error(w, "Order hold has expired", http.StatusGone)
+		return
+	}
+	if order.Status != orderConfirmed && order.Status != orderPaid {
+		http.Error(w, fmt.Sprintf("Order is %s", order.Status), http.StatusConflict)
+		return
+	}
+
+	tickets, err := api.fulfilOrder(ctx, order)
+	if err != nil {
+		LogError(ctx, "Failed to issue order tickets", err)
+		http.Error(w, "Failed to issue tickets, confirm again to retry", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(orderResponse{Order: order, Tickets: tickets})
+}
+
+// fulfilOrder creates an invitee with a signed QR code for each ticket of a
+// confirmed or paid order that does not have one yet
+func (api *API) fulfilOrder(ctx context.Context, order db.Order) ([]db.OrderTicket, error) {
+	tickets, err := api.db.ListOrderTickets(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, ticket := range tickets {
+		if ticket.InviteeID.Valid {
+			continue
+		}
+
+		invitee, err := api.db.CreateOrderInvitee(ctx, db.CreateOrderInviteeParams{
+			EventID:   order.EventID,
+			Email:     ticket.Email,
+			FirstName: ticket.FirstName,
+			LastName:  ticket.LastName,
+			OrderID:   pgtype.Int4{Int32: order.ID, Valid: true},
+		})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			// Created by an earlier attempt, or invited since reserving
+			invitee, err = api.db.GetInviteeByEventAndEmail(ctx, db.GetInviteeByEventAndEmailParams{EventID: order.EventID, Email: ticket.Email})
+			if err == nil && invitee.OrderID.Int32 != order.ID {
+				return tickets, fmt.Errorf("%s was invited outside order %d", ticket.Email, order.ID)
+			}
+		}
+		if err != nil {
+			return tickets, err
+		}
+
+		if !invitee.QrIssuedAt.Valid {
+			if _, err := api.issueQRCode(ctx, invitee.ID); err != nil {
+				return tickets, err
+			}
+		}
+		if err := api.db.SetOrderTicketInvitee(ctx, db.SetOrderTicketInviteeParams{
+			ID:        ticket.ID,
+			InviteeID: pgtype.Int4{Int32: invitee.ID, Valid: true},
+		}); err != nil {
+			return tickets, err
+		}
+		tickets[i].InviteeID = pgtype.Int4{Int32: invitee.ID, Valid: true}
+	}
+
+	return tickets, nil
+}
+
+// CancelOrder cancels a pending order and returns its tickets to the event
+func (api *API) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := api.orderForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	cancelled, err := api.db.ReleaseOrder(r.Context(), db.ReleaseOrderParams{ID: order.ID, Status: orderCancelled})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Only pending orders can be cancelled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	api.promoteWaitlist(r.Context(), cancelled.EventID, int(cancelled.Quantity))
+
+	json.NewEncoder(w).Encode(cancelled)
+}
+
+// orderForRequest loads the order named by the id route variable, writing
+// the error response itself. Users only see their own orders; admins see all.
+func (api *API) orderForRequest(w http.ResponseWriter, r *http.Request) (db.Order, bool) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return db.Order{}, false
+	}
+
+	vars := mux.Vars(r)
+	orderID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return db.Order{}, false
+	}
+
+	order, err := api.db.GetOrder(r.Context(), int32(orderID))
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && order.UserID != user.ID && user.Role != RoleAdmin) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return db.Order{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.Order{}, false
+	}
+
+	return order, true
+}
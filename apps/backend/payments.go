@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"eventpass.pro/apps/backend/db"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Payment statuses stored on payments.status
+const (
+	paymentRequiresPayment = "requires_payment"
+	paymentAuthorized      = "authorized"
+	paymentCaptured        = "captured"
+	paymentFailed          = "failed"
+	paymentRefunded        = "refunded"
+)
+
+// Provider independent webhook event types. Providers map their own event
+// types onto these and leave Type empty for events we do not handle.
+const (
+	paymentEventAuthorized = "payment.authorized"
+	paymentEventSucceeded  = "payment.succeeded"
+	paymentEventFailed     = "payment.failed"
+	paymentEventRefunded   = "payment.refunded"
+)
+
+// maxWebhookBodySize bounds the payment webhook payloads read
+const maxWebhookBodySize = 64 << 10
+
+var errInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+// PaymentProvider is a payment gateway charging for orders. Intents are
+// created for manual capture: the gateway authorizes the buyer's payment and
+// reports it by webhook, and the payment is captured once the order is still
+// held.
+type PaymentProvider interface {
+	// Name identifies the provider in payments.provider
+	Name() string
+	// CreateIntent starts a payment. Repeating the idempotency key returns
+	// the intent created first.
+	CreateIntent(ctx context.Context, request PaymentIntentRequest) (PaymentIntent, error)
+	// Capture collects an authorized payment
+	Capture(ctx context.Context, intentID string) error
+	// Refund returns a captured payment or part of it, or releases an
+	// authorization that was not captured
+	Refund(ctx context.Context, request PaymentRefundRequest) error
+	// VerifyWebhook checks a webhook delivery's signature and parses its
+	// event, returning errInvalidWebhookSignature for forged deliveries
+	VerifyWebhook(header http.Header, body []byte) (PaymentEvent, error)
+}
+
+// PaymentIntentRequest is a payment to create for an order
+type PaymentIntentRequest struct {
+	OrderID        int32
+	Amount         int64
+	Currency       string
+	IdempotencyKey string
+}
+
+// PaymentIntent is a payment created with a provider. The client secret lets
+// the buyer's browser complete the payment with the provider.
+type PaymentIntent struct {
+	ID           string
+	ClientSecret string
+	Status       string
+}
+
+// PaymentRefundRequest is a refund of a payment. An Amount of 0 refunds all
+// that was not refunded yet; repeating the idempotency key refunds once.
+type PaymentRefundRequest struct {
+	IntentID       string
+	Amount         int64
+	IdempotencyKey string
+}
+
+// PaymentEvent is a verified webhook event
+type PaymentEvent struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	IntentID string `json:"intent_id"`
+	Amount   int64  `json:"amount"`
+}
+
+// newPaymentProvider configures the payment provider from the environment.
+// PAYMENT_PROVIDER selects "stripe", which needs STRIPE_SECRET_KEY and
+// STRIPE_WEBHOOK_SECRET, or "fake" for local development. Without it paid
+// orders cannot be placed.
+func newPaymentProvider() (PaymentProvider, error) {
+	switch provider := os.Getenv("PAYMENT_PROVIDER"); provider {
+	case "":
+		slog.Info("Payment provider not configured, paid orders disabled")
+		return nil, nil
+	case stripeProviderName:
+		secretKey, webhookSecret := os.Getenv("STRIPE_SECRET_KEY"), os.Getenv("STRIPE_WEBHOOK_SECRET")
+		if secretKey == "" || webhookSecret == "" {
+			return nil, fmt.Errorf("STRIPE_SECRET_KEY and STRIPE_WEBHOOK_SECRET must be set")
+		}
+		return NewStripeProvider(secretKey, webhookSecret), nil
+	case fakeProviderName:
+		slog.Warn("Using the fake payment provider, payments are not charged")
+		return NewFakePaymentProvider(os.Getenv("FAKE_PAYMENT_WEBHOOK_SECRET")), nil
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_PROVIDER %q", provider)
+	}
+}
+
+// PayOrder creates a payment for a pending order priced above zero and
+// returns the client secret to complete it with the provider. Paying again
+// returns the same payment. The order becomes paid when the provider's
+// webhook reports the payment; free orders are confirmed directly.
+func (api *API) PayOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	order, ok := api.orderForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if api.payments == nil {
+		http.Error(w, "Payments are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if order.Status != orderPending {
+		http.Error(w, fmt.Sprintf("Order is %s", order.Status), http.StatusConflict)
+		return
+	}
+	if order.Amount == 0 {
+		http.Error(w, "Order is free, confirm it instead", http.StatusBadRequest)
+		return
+	}
+	if !order.ExpiresAt.Time.After(time.Now()) {
+		http.Error(w, "Order hold has expired", http.StatusGone)
+		return
+	}
+
+	intent, err := api.payments.CreateIntent(ctx, PaymentIntentRequest{
+		OrderID:        order.ID,
+		Amount:         order.Amount,
+		Currency:       order.Currency.String,
+		IdempotencyKey: fmt.Sprintf("order-%d", order.ID),
+	})
+	if err != nil {
+		LogError(ctx, "Failed to create payment intent", err)
+		http.Error(w, "Failed to create payment", http.StatusBadGateway)
+		return
+	}
+
+	payment, err := api.db.UpsertPayment(ctx, db.UpsertPaymentParams{
+		OrderID:  order.ID,
+		Provider: api.payments.Name(),
+		IntentID: intent.ID,
+		Status:   paymentRequiresPayment,
+		Amount:   order.Amount,
+		Currency: order.Currency.String,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Payment      db.Payment `json:"payment"`
+		Provider     string     `json:"provider"`
+		ClientSecret string     `json:"client_secret"`
+	}{Payment: payment, Provider: payment.Provider, ClientSecret: intent.ClientSecret})
+}
+
+// PaymentWebhook receives the provider's payment events. Each event is
+// handled once: redeliveries of a handled event are acknowledged without
+// effect, and events that fail are answered with an error so the provider
+// delivers them again.
+func (api *API) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if api.payments == nil {
+		http.Error(w, "Payments are not configured", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	event, err := api.payments.VerifyWebhook(r.Header, body)
+	if errors.Is(err, errInvalidWebhookSignature) {
+		http.Error(w, "Invalid signature", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid webhook payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := api.processPaymentEvent(r.Context(), event); err != nil {
+		http.Error(w, "Failed to process event", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// processPaymentEvent claims a verified event and handles it, releasing the
+// claim again when handling fails so a redelivery is retried
+func (api *API) processPaymentEvent(ctx context.Context, event PaymentEvent) error {
+	provider := api.payments.Name()
+	if event.Type == "" {
+		RecordPaymentWebhook(provider, "other", "ignored")
+		return nil
+	}
+
+	_, err := api.db.ClaimPaymentWebhookEvent(ctx, db.ClaimPaymentWebhookEventParams{
+		Provider:  provider,
+		EventID:   event.ID,
+		EventType: event.Type,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		RecordPaymentWebhook(provider, event.Type, "duplicate")
+		return nil
+	}
+	if err != nil {
+		LogError(ctx, "Failed to claim payment webhook event", err)
+		return err
+	}
+
+	if err := api.handlePaymentEvent(ctx, event); err != nil {
+		LogError(ctx, "Failed to handle payment webhook event", err)
+		RecordPaymentWebhook(provider, event.Type, "failed")
+		if err := api.db.ReleasePaymentWebhookEvent(ctx, db.ReleasePaymentWebhookEventParams{Provider: provider, EventID: event.ID}); err != nil {
+			LogError(ctx, "Failed to release payment webhook event", err)
+		}
+		return err
+	}
+	RecordPaymentWebhook(provider, event.Type, "processed")
+	return nil
+}
+
+// handlePaymentEvent applies an event to its payment and order. Authorized
+// payments are captured while the order is pending and the order becomes
+// paid; payments arriving for orders that expired or were cancelled in the
+// meantime are refunded.
+func (api *API) handlePaymentEvent(ctx context.Context, event PaymentEvent) error {
+	payment, err := api.db.GetPaymentByIntent(ctx, db.GetPaymentByIntentParams{
+		Provider: api.payments.Name(),
+		IntentID: event.IntentID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Not created by us, e.g. another integration on the same account
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case paymentEventAuthorized:
+		if payment.Status != paymentRequiresPayment && payment.Status != paymentFailed {
+			return nil
+		}
+		order, err := api.db.GetOrder(ctx, payment.OrderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != orderPending {
+			return api.refundPayment(ctx, payment)
+		}
+		if err := api.payments.Capture(ctx, payment.IntentID); err != nil {
+			return err
+		}
+		if payment, err = api.setPaymentStatus(ctx, payment, paymentCaptured); err != nil {
+			return err
+		}
+		return api.markOrderPaid(ctx, payment)
+
+	case paymentEventSucceeded:
+		if payment.Status == paymentRefunded {
+			return nil
+		}
+		if payment, err = api.setPaymentStatus(ctx, payment, paymentCaptured); err != nil {
+			return err
+		}
+		return api.markOrderPaid(ctx, payment)
+
+	case paymentEventFailed:
+		if payment.Status != paymentRequiresPayment && payment.Status != paymentAuthorized {
+			return nil
+		}
+		_, err := api.setPaymentStatus(ctx, payment, paymentFailed)
+		return err
+
+	case paymentEventRefunded:
+		_, err := api.setPaymentStatus(ctx, payment, paymentRefunded)
+		return err
+	}
+	return nil
+}
+
+// markOrderPaid moves the payment's order from pending to paid and issues its
+// tickets. A payment for an order that is no longer pending and not already
+// paid by it is refunded.
+func (api *API) markOrderPaid(ctx context.Context, payment db.Payment) error {
+	order, err := api.db.MarkOrderPaid(ctx, payment.OrderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		order, err = api.db.GetOrder(ctx, payment.OrderID)
+		if err != nil {
+			return err
+		}
+		if order.Status == orderPaid || order.Status == orderConfirmed {
+			return nil
+		}
+		return api.refundPayment(ctx, payment)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The payment is taken, so failing to issue tickets must not fail the
+	// event; the buyer confirms the order again to retry
+	if _, err := api.fulfilOrder(ctx, order); err != nil {
+		LogError(ctx, "Failed to issue order tickets", err)
+	}
+	return nil
+}
+
+func (api *API) refundPayment(ctx context.Context, payment db.Payment) error {
+	if err := api.payments.Refund(ctx, PaymentRefundRequest{IntentID: payment.IntentID, IdempotencyKey: "refund-" + payment.IntentID}); err != nil {
+		return err
+	}
+	_, err := api.setPaymentStatus(ctx, payment, paymentRefunded)
+	return err
+}
+
+func (api *API) setPaymentStatus(ctx context.Context, payment db.Payment, status string) (db.Payment, error) {
+	if payment.Status == status {
+		return payment, nil
+	}
+	return api.db.SetPaymentStatus(ctx, db.SetPaymentStatusParams{ID: payment.ID, Status: status})
+}
+
+// AuthorizeFakePayment stands in for the buyer completing a payment with the
+// fake provider: it authorizes the intent and processes the resulting
+// webhook event. It is only routed when the fake provider is configured.
+func (api *API) AuthorizeFakePayment(w http.ResponseWriter, r *http.Request) {
+	fake, ok := api.payments.(*FakePaymentProvider)
+	if !ok {
+		http.Error(w, "Fake payments are not enabled", http.StatusNotFound)
+		return
+	}
+
+	event, err := fake.Authorize(mux.Vars(r)["intent"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err := api.processPaymentEvent(r.Context(), event); err != nil {
+		http.Error(w, "Failed to process event", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(event)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const fakeProviderName = "fake"
+
+// fakeSignatureHeader carries the hex HMAC-SHA256 of a fake webhook body
+const fakeSignatureHeader = "Fake-Signature"
+
+// Statuses of fake intents, named after the Stripe ones
+const (
+	fakeIntentRequiresPayment = "requires_payment_method"
+	fakeIntentRequiresCapture = "requires_capture"
+	fakeIntentSucceeded       = "succeeded"
+	fakeIntentCanceled        = "canceled"
+	fakeIntentRefunded        = "refunded"
+)
+
+// FakePaymentProvider is an in-memory payment provider for tests and local
+// development. Nothing is charged: Authorize plays the buyer paying and
+// returns the webhook event the provider would deliver.
+type FakePaymentProvider struct {
+	secret []byte
+
+	mu      sync.Mutex
+	intents map[string]*fakeIntent
+	byKey   map[string]string
+	events  int
+}
+
+type fakeIntent struct {
+	amount   int64
+	refunded int64
+	currency string
+	status   string
+	refunds  map[string]bool
+}
+
+// NewFakePaymentProvider creates a fake provider signing webhooks with the
+// secret, or with a random one when it is empty
+func NewFakePaymentProvider(secret string) *FakePaymentProvider {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &FakePaymentProvider{
+		secret:  key,
+		intents: map[string]*fakeIntent{},
+		byKey:   map[string]string{},
+	}
+}
+
+func (p *FakePaymentProvider) Name() string {
+	return fakeProviderName
+}
+
+func (p *FakePaymentProvider) CreateIntent(ctx context.Context, request PaymentIntentRequest) (PaymentIntent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id, ok := p.byKey[request.IdempotencyKey]
+	if !ok {
+		id = fmt.Sprintf("fake_pi_%d", len(p.intents)+1)
+		p.intents[id] = &fakeIntent{amount: request.Amount, currency: request.Currency, status: fakeIntentRequiresPayment, refunds: map[string]bool{}}
+		if request.IdempotencyKey != "" {
+			p.byKey[request.IdempotencyKey] = id
+		}
+	}
+	return PaymentIntent{ID: id, ClientSecret: id + "_secret", Status: p.intents[id].status}, nil
+}
+
+func (p *FakePaymentProvider) Capture(ctx context.Context, intentID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return fmt.Errorf("fake: no intent %s", intentID)
+	}
+	if intent.status != fakeIntentRequiresCapture {
+		return fmt.Errorf("fake: intent %s is %s", intentID, intent.status)
+	}
+	intent.status = fakeIntentSucceeded
+	return nil
+}
+
+func (p *FakePaymentProvider) Refund(ctx context.Context, request PaymentRefundRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[request.IntentID]
+	if !ok {
+		return fmt.Errorf("fake: no intent %s", request.IntentID)
+	}
+	if intent.refunds[request.IdempotencyKey] {
+		return nil
+	}
+	switch intent.status {
+	case fakeIntentRequiresCapture:
+		intent.status = fakeIntentCanceled
+	case fakeIntentSucceeded:
+		amount := request.Amount
+		if amount == 0 {
+			amount = intent.amount - intent.refunded
+		}
+		if amount > intent.amount-intent.refunded {
+			return fmt.Errorf("fake: refund of %d exceeds intent %s", amount, request.IntentID)
+		}
+		intent.refunded += amount
+		if intent.refunded == intent.amount {
+			intent.status = fakeIntentRefunded
+		}
+	default:
+		return fmt.Errorf("fake: intent %s is %s", request.IntentID, intent.status)
+	}
+	if request.IdempotencyKey != "" {
+		intent.refunds[request.IdempotencyKey] = true
+	}
+	return nil
+}
+
+// Refunded returns the amount refunded of the intent
+func (p *FakePaymentProvider) Refunded(intentID string) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if intent, ok := p.intents[intentID]; ok {
+		return intent.refunded
+	}
+	return 0
+}
+
+func (p *FakePaymentProvider) VerifyWebhook(header http.Header, body []byte) (PaymentEvent, error) {
+	signature, err := hex.DecodeString(header.Get(fakeSignatureHeader))
+	if err != nil || !hmac.Equal(signature, p.sign(body)) {
+		return PaymentEvent{}, errInvalidWebhookSignature
+	}
+
+	var event PaymentEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return PaymentEvent{}, err
+	}
+	return event, nil
+}
+
+// Authorize authorizes an intent as if the buyer paid it and returns the
+// authorization event
+func (p *FakePaymentProvider) Authorize(intentID string) (PaymentEvent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return PaymentEvent{}, fmt.Errorf("fake: no intent %s", intentID)
+	}
+	if intent.status != fakeIntentRequiresPayment {
+		return PaymentEvent{}, fmt.Errorf("fake: intent %s is %s", intentID, intent.status)
+	}
+	intent.status = fakeIntentRequiresCapture
+
+	p.events++
+	return PaymentEvent{
+		ID:       fmt.Sprintf("fake_evt_%d", p.events),
+		Type:     paymentEventAuthorized,
+		IntentID: intentID,
+		Amount:   intent.amount,
+	}, nil
+}
+
+// Status returns the intent's status, or "" for unknown intents
+func (p *FakePaymentProvider) Status(intentID string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if intent, ok := p.intents[intentID]; ok {
+		return intent.status
+	}
+	return ""
+}
+
+// SignWebhook encodes an event as a webhook delivery, returning its body and
+// signature header value
+func (p *FakePaymentProvider) SignWebhook(event PaymentEvent) ([]byte, string) {
+	body, _ := json.Marshal(event)
+	return body, hex.EncodeToString(p.sign(body))
+}
+
+func (p *FakePaymentProvider) sign(body []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const stripeProviderName = "stripe"
+
+const (
+	stripeAPIURL = "https://api.stripe.com/v1"
+	// stripeSignatureTolerance is how old a webhook signature may be, which
+	// bounds replays of captured deliveries
+	stripeSignatureTolerance = 5 * time.Minute
+)
+
+// StripeProvider takes payments with Stripe payment intents over its REST API
+type StripeProvider struct {
+	secretKey     string
+	webhookSecret []byte
+	baseURL       string
+	client        *http.Client
+}
+
+// NewStripeProvider creates a Stripe provider with the account's secret API
+// key and the webhook endpoint's signing secret
+func NewStripeProvider(secretKey, webhookSecret string) *StripeProvider {
+	return &StripeProvider{
+		secretKey:     secretKey,
+		webhookSecret: []byte(webhookSecret),
+		baseURL:       stripeAPIURL,
+		client:        &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// stripeObject holds the fields we read from payment intents, charges and
+// refunds
+type stripeObject struct {
+	ID               string `json:"id"`
+	Status           string `json:"status"`
+	ClientSecret     string `json:"client_secret"`
+	Amount           int64  `json:"amount"`
+	AmountCapturable int64  `json:"amount_capturable"`
+	AmountReceived   int64  `json:"amount_received"`
+	AmountRefunded   int64  `json:"amount_refunded"`
+	PaymentIntent    string `json:"payment_intent"`
+	Refunded         bool   `json:"refunded"`
+}
+
+func (p *StripeProvider) Name() string {
+	return stripeProviderName
+}
+
+func (p *StripeProvider) CreateIntent(ctx context.Context, request PaymentIntentRequest) (PaymentIntent, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(request.Amount, 10))
+	form.Set("currency", strings.ToLower(request.Currency))
+	form.Set("capture_method", "manual")
+	form.Set("metadata[order_id]", strconv.Itoa(int(request.OrderID)))
+
+	var intent stripeObject
+	if err := p.call(ctx, http.MethodPost, "/payment_intents", form, request.IdempotencyKey, &intent); err != nil {
+		return PaymentIntent{}, err
+	}
+	return PaymentIntent{ID: intent.ID, ClientSecret: intent.ClientSecret, Status: intent.Status}, nil
+}
+
+func (p *StripeProvider) Capture(ctx context.Context, intentID string) error {
+	return p.call(ctx, http.MethodPost, "/payment_intents/"+url.PathEscape(intentID)+"/capture", url.Values{}, "capture-"+intentID, nil)
+}
+
+// Refund cancels an intent that is still waiting for capture, since Stripe
+// only refunds captured payments
+func (p *StripeProvider) Refund(ctx context.Context, request PaymentRefundRequest) error {
+	intentID := request.IntentID
+	var intent stripeObject
+	if err := p.call(ctx, http.MethodGet, "/payment_intents/"+url.PathEscape(intentID), nil, "", &intent); err != nil {
+		return err
+	}
+	if intent.Status == "requires_capture" {
+		return p.call(ctx, http.MethodPost, "/payment_intents/"+url.PathEscape(intentID)+"/cancel", url.Values{}, "cancel-"+intentID, nil)
+	}
+
+	form := url.Values{}
+	form.Set("payment_intent", intentID)
+	if request.Amount > 0 {
+		form.Set("amount", strconv.FormatInt(request.Amount, 10))
+	}
+	return p.call(ctx, http.MethodPost, "/refunds", form, request.IdempotencyKey, nil)
+}
+
+// call sends a request to the Stripe API and decodes the response into out
+// when it is not nil
+func (p *StripeProvider) call(ctx context.Context, method, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.secretKey)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("stripe: %s %s: %d %s", method, path, resp.StatusCode, failure.Error.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// VerifyWebhook checks the Stripe-Signature header, which holds the signing
+// timestamp t and one or more v1 HMAC-SHA256 signatures of "t.body", and maps
+// the payment intent and charge events onto PaymentEvent
+func (p *StripeProvider) VerifyWebhook(header http.Header, body []byte) (PaymentEvent, error) {
+	if err := p.verifySignature(header.Get("Stripe-Signature"), body, time.Now()); err != nil {
+		return PaymentEvent{}, err
+	}
+
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object stripeObject `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return PaymentEvent{}, err
+	}
+
+	object := event.Data.Object
+	parsed := PaymentEvent{ID: event.ID, IntentID: object.ID}
+	switch event.Type {
+	case "payment_intent.amount_capturable_updated":
+		parsed.Type, parsed.Amount = paymentEventAuthorized, object.AmountCapturable
+	case "payment_intent.succeeded":
+		parsed.Type, parsed.Amount = paymentEventSucceeded, object.AmountReceived
+	case "payment_intent.payment_failed", "payment_intent.canceled":
+		parsed.Type, parsed.Amount = paymentEventFailed, object.Amount
+	case "charge.refunded":
+		// Partial refunds are tracked when we make them
+		if object.Refunded {
+			parsed.Type, parsed.IntentID, parsed.Amount = paymentEventRefunded, object.PaymentIntent, object.AmountRefunded
+		}
+	}
+	return parsed, nil
+}
+
+func (p *StripeProvider) verifySignature(header string, body []byte, now time.Time) error {
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			if signature, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errInvalidWebhookSignature
+	}
+	if age := now.Sub(time.Unix(signedAt, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return errInvalidWebhookSignature
+	}
+
+	expected := stripeSignature(p.webhookSecret, timestamp, body)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return errInvalidWebhookSignature
+}
+
+func stripeSignature(secret []byte, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"eventpass.pro/apps/backend/db"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Re-entry policies stored on events.reentry_policy
+const (
+	// reentrySingle admits each invitee once
+	reentrySingle = "single"
+	// reentryUnlimited admits invitees on every entry scan
+	reentryUnlimited = "unlimited"
+	// reentryInOut tracks exits and admits invitees who are not inside
+	reentryInOut = "in_out"
+)
+
+func isValidReentryPolicy(policy string) bool {
+	switch policy {
+	case reentrySingle, reentryUnlimited, reentryInOut:
+		return true
+	}
+	return false
+}
+
+const (
+	// entryPerk names the entry itself in scans; it is governed by the
+	// event's re-entry policy rather than a perks row
+	entryPerk = "entry"
+	// giftPerk is the perk created for every event, whose redemption also
+	// stamps invitees.gift_claimed_at
+	giftPerk = "gift"
+)
+
+var (
+	errUnknownPerk    = errors.New("unknown perk")
+	errPerkUsedUp     = errors.New("perk already fully redeemed")
+	errNotInside      = errors.New("invitee is not checked in")
+	errExitNotTracked = errors.New("event does not track exits")
+)
+
+// exitInvitee records an exit scan for events with the in_out re-entry
+// policy. It returns errNotInside when the invitee is not checked in and
+// errExitNotTracked for events with another policy.
+func (api *API) exitInvitee(ctx context.Context, invitee db.Invitee, source scanSource, scannedAt time.Time) (db.Invitee, db.CheckIn, error) {
+	checkIn, err := api.db.ExitInvitee(ctx, db.ExitInviteeParams{
+		ID:          invitee.ID,
+		CheckedInAt: pgtype.Timestamptz{Time: scannedAt, Valid: true},
+		DeviceID:    source.DeviceID,
+		OperatorID:  source.OperatorID,
+		Gate:        source.Gate,
+		ZoneID:      source.ZoneID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		event, err := api.db.GetEvent(ctx, invitee.EventID)
+		if err != nil {
+			return invitee, db.CheckIn{}, err
+		}
+		if event.ReentryPolicy != reentryInOut {
+			return invitee, db.CheckIn{}, errExitNotTracked
+		}
+		return invitee, db.CheckIn{}, errNotInside
+	}
+	if err != nil {
+		return invitee, db.CheckIn{}, err
+	}
+
+	RecordQRCodeScan(checkInExited)
+	api.leaveOccupancy(ctx, invitee)
+	api.publishScan(ctx, checkIn)
+
+	exited, err := api.db.GetInvitee(ctx, invitee.ID)
+	if err != nil {
+		LogError(ctx, "Failed to reload exited invitee", err)
+		return invitee, checkIn, nil
+	}
+	api.publishInviteeState(ctx, exited)
+	return exited, checkIn, nil
+}
+
+// redeemPerk redeems one unit of the event's named perk for the invitee. It
+// returns errUnknownPerk when the event has no such perk and errPerkUsedUp
+// once the perk's quantity is redeemed. The balance returned is the
+// invitee's balance after the redemption.
+func (api *API) redeemPerk(ctx context.Context, invitee db.Invitee, source scanSource, scannedAt time.Time) (db.PerkRedemption, db.ListInviteePerksRow, error) {
+	perk := source.Perk.String
+	if err := inviteeAvailability(invitee, time.Now()); err != nil {
+		return db.PerkRedemption{}, db.ListInviteePerksRow{}, err
+	}
+
+	redemption, redeemErr := api.db.RedeemPerk(ctx, db.RedeemPerkParams{
+		InviteeID:  invitee.ID,
+		EventID:    invitee.EventID,
+		Name:       perk,
+		RedeemedAt: pgtype.Timestamptz{Time: scannedAt, Valid: true},
+		DeviceID:   source.DeviceID,
+		OperatorID: source.OperatorID,
+		Gate:       source.Gate,
+		ZoneID:     source.ZoneID,
+	})
+	if redeemErr != nil && !errors.Is(redeemErr, pgx.ErrNoRows) {
+		return db.PerkRedemption{}, db.ListInviteePerksRow{}, redeemErr
+	}
+
+	balances, err := api.db.ListInviteePerks(ctx, db.ListInviteePerksParams{InviteeID: invitee.ID, EventID: invitee.EventID})
+	if err != nil {
+		return redemption, db.ListInviteePerksRow{}, err
+	}
+	var balance db.ListInviteePerksRow
+	for _, b := range balances {
+		if b.Name == perk {
+			balance = b
+		}
+	}
+
+	if redeemErr != nil {
+		if balance.ID == 0 {
+			return db.PerkRedemption{}, balance, errUnknownPerk
+		}
+		return db.PerkRedemption{}, balance, errPerkUsedUp
+	}
+
+	RecordQRCodeScan(checkInRedeemed)
+	api.live.Publish(ctx, livePerkRedeemed, invitee.EventID, map[string]interface{}{
+		"invitee_id":  invitee.ID,
+		"perk":        perk,
+		"redeemed":    balance.Redeemed,
+		"quantity":    balance.Quantity,
+		"redeemed_at": redemption.RedeemedAt.Time,
+	})
+
+	if perk == giftPerk {
+		claimed, err := api.db.ClaimInviteeGift(ctx, invitee.ID)
+		if err != nil {
+			// The redemption is committed, only the legacy timestamp is missing
+			LogError(ctx, "Failed to stamp gift claim", err)
+		} else {
+			api.live.Publish(ctx, liveGiftClaimed, claimed.EventID, map[string]interface{}{
+				"invitee_id":      claimed.ID,
+				"gift_claimed_at": claimed.GiftClaimedAt,
+			})
+		}
+	}
+
+	return redemption, balance, nil
+}
+
+// perkRedemptionResponse is returned for successful perk scans
+type perkRedemptionResponse struct {
+	Invitee    db.Invitee        `json:"invitee"`
+	Perk       string            `json:"perk"`
+	Redemption db.PerkRedemption `json:"redemption"`
+	Redeemed   int32             `json:"redeemed"`
+	Remaining  int32             `json:"remaining"`
+}
+
+type perkRequest struct {
+	Name     string `json:"name"`
+	Quantity int32  `json:"quantity"`
+}
+
+// ListPerks returns the perks defined for an event
+func (api *API) ListPerks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	perks, err := api.db.ListPerksByEvent(r.Context(), int32(eventID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(perks)
+}
+
+// CreatePerk defines a perk invitees can redeem a number of times, e.g. a
+// meal voucher or drink tokens
+func (api *API) CreatePerk(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	var request perkRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.ToLower(strings.TrimSpace(request.Name))
+	if request.Quantity == 0 {
+		request.Quantity = 1
+	}
+	if request.Name == "" || request.Name == entryPerk || len(request.Name) > 64 {
+		http.Error(w, "Invalid perk name", http.StatusBadRequest)
+		return
+	}
+	if request.Quantity < 0 {
+		http.Error(w, "Quantity must be positive", http.StatusBadRequest)
+		return
+	}
+
+	perk, err := api.db.CreatePerk(r.Context(), db.CreatePerkParams{
+		EventID:  int32(eventID),
+		Name:     request.Name,
+		Quantity: request.Quantity,
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		http.Error(w, "Perk already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(perk)
+}
+
+// UpdatePerk changes how many times each invitee may redeem a perk
+func (api *API) UpdatePerk(w http.ResponseWriter, r *http.Request) {
+	perk, ok := api.perkForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var request perkRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if request.Quantity <= 0 {
+		http.Error(w, "Quantity must be positive", http.StatusBadRequest)
+		return
+	}
+
+	perk, err := api.db.UpdatePerk(r.Context(), db.UpdatePerkParams{ID: perk.ID, Quantity: request.Quantity})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(perk)
+}
+
+// DeletePerk removes a perk together with its redemptions
+func (api *API) DeletePerk(w http.ResponseWriter, r *http.Request) {
+	perk, ok := api.perkForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := api.db.DeletePerk(r.Context(), perk.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// perkForRequest loads the perk named by the id route variable and checks
+// access to its event, writing the error response itself
+func (api *API) perkForRequest(w http.ResponseWriter, r *http.Request) (db.Perk, bool) {
+	vars := mux.Vars(r)
+	perkID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid perk ID", http.StatusBadRequest)
+		return db.Perk{}, false
+	}
+
+	perk, err := api.db.GetPerk(r.Context(), int32(perkID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Perk not found", http.StatusNotFound)
+		return db.Perk{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.Perk{}, false
+	}
+
+	if !api.checkEventAccess(w, r, perk.EventID) {
+		return db.Perk{}, false
+	}
+	return perk, true
+}
+
+type inviteePerkBalance struct {
+	ID        int32  `json:"id"`
+	Name      string `json:"name"`
+	Quantity  int32  `json:"quantity"`
+	Redeemed  int32  `json:"redeemed"`
+	Remaining int32  `json:"remaining"`
+}
+
+// ListInviteePerks returns what an invitee has redeemed of each of the
+// event's perks, and the individual redemptions
+func (api *API) ListInviteePerks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	inviteeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invitee ID", http.StatusBadRequest)
+		return
+	}
+
+	invitee, err := api.db.GetInvitee(ctx, int32(inviteeID))
+	if err != nil {
+		http.Error(w, "Invitee not found", http.StatusNotFound)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, invitee.EventID) {
+		return
+	}
+
+	rows, err := api.db.ListInviteePerks(ctx, db.ListInviteePerksParams{InviteeID: invitee.ID, EventID: invitee.EventID})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	redemptions, err := api.db.ListPerkRedemptionsByInvitee(ctx, invitee.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	balances := make([]inviteePerkBalance, 0, len(rows))
+	for _, row := range rows {
+		balances = append(balances, inviteePerkBalance{
+			ID:        row.ID,
+			Name:      row.Name,
+			Quantity:  row.Quantity,
+			Redeemed:  row.Redeemed,
+			Remaining: max(row.Quantity-row.Redeemed, 0),
+		})
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		InviteeID   int32                `json:"invitee_id"`
+		State       string               `json:"state"`
+		Perks       []inviteePerkBalance `json:"perks"`
+		Redemptions []db.PerkRedemption  `json:"redemptions"`
+	}{
+		InviteeID:   invitee.ID,
+		State:       invitee.State,
+		Perks:       balances,
+		Redemptions: redemptions,
+	})
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultScanDedupWindow    = 10 * time.Second
+	defaultScanLimitPerDevice = 120
+	defaultScanLimitPerIP     = 300
+	// scanLimitWindow is the fixed window the per device and per IP limits count over
+	scanLimitWindow = time.Minute
+)
+
+// Reasons a scan is throttled, also used as eventpass_qr_scans_total statuses
+const (
+	scanThrottledReplay = "replay"
+	scanThrottledDevice = "device_rate_limited"
+	scanThrottledIP     = "ip_rate_limited"
+)
+
+// ScanLimiter throttles QR scans in Redis. A QR presented again within the
+// dedup window is rejected as a replay, and each device and client IP may
+// only scan a limited number of times per minute.
+type ScanLimiter struct {
+	rdb            *redis.Client
+	dedupWindow    time.Duration
+	limitPerDevice int64
+	limitPerIP     int64
+}
+
+// NewScanLimiter creates a scan limiter configured by SCAN_DEDUP_WINDOW (a
+// duration), SCAN_RATE_LIMIT_PER_DEVICE and SCAN_RATE_LIMIT_PER_IP (scans per
+// minute, 0 disables the limit)
+func NewScanLimiter(rdb *redis.Client) (*ScanLimiter, error) {
+	limiter := &ScanLimiter{
+		rdb:            rdb,
+		dedupWindow:    defaultScanDedupWindow,
+		limitPerDevice: defaultScanLimitPerDevice,
+		limitPerIP:     defaultScanLimitPerIP,
+	}
+
+	if value := os.Getenv("SCAN_DEDUP_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil || window < 0 {
+			return nil, fmt.Errorf("invalid SCAN_DEDUP_WINDOW %q", value)
+		}
+		limiter.dedupWindow = window
+	}
+	for name, limit := range map[string]*int64{
+		"SCAN_RATE_LIMIT_PER_DEVICE": &limiter.limitPerDevice,
+		"SCAN_RATE_LIMIT_PER_IP":     &limiter.limitPerIP,
+	} {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*limit = n
+		}
+	}
+
+	return limiter, nil
+}
+
+// Allow reports whether a scan from the device and IP may proceed, where
+// scanKey identifies what was scanned for replay detection. When it may not,
+// it returns the throttling reason and how long to wait. Redis failures let
+// the scan through so an outage never blocks the door. A nil limiter allows
+// everything.
+func (l *ScanLimiter) Allow(ctx context.Context, scanKey, deviceID, ip string) (reason string, retryAfter time.Duration) {
+	if l == nil {
+		return "", 0
+	}
+
+	now := time.Now()
+	if deviceID != "" {
+		if retryAfter := l.overLimit(ctx, "device:"+deviceID, l.limitPerDevice, now); retryAfter > 0 {
+			return scanThrottledDevice, retryAfter
+		}
+	}
+	if ip != "" {
+		if retryAfter := l.overLimit(ctx, "ip:"+ip, l.limitPerIP, now); retryAfter > 0 {
+			return scanThrottledIP, retryAfter
+		}
+	}
+
+	if l.dedupWindow > 0 {
+		sum := sha256.Sum256([]byte(scanKey))
+		key := "scan_dedup:" + hex.EncodeToString(sum[:])
+
+		set, err := l.rdb.SetNX(ctx, key, now.Unix(), l.dedupWindow).Result()
+		if err != nil {
+			LogError(ctx, "Failed to check scan replay", err)
+			return "", 0
+		}
+		if !set {
+			ttl, err := l.rdb.PTTL(ctx, key).Result()
+			if err != nil || ttl <= 0 {
+				ttl = l.dedupWindow
+			}
+			return scanThrottledReplay, ttl
+		}
+	}
+
+	return "", 0
+}
+
+// overLimit counts a scan in the subject's current window and returns the
+// time until the window ends once the limit is exceeded
+func (l *ScanLimiter) overLimit(ctx context.Context, subject string, limit int64, now time.Time) time.Duration {
+	if limit == 0 {
+		return 0
+	}
+
+	windowStart := now.Truncate(scanLimitWindow)
+	key := fmt.Sprintf("scan_rate:%s:%d", subject, windowStart.Unix())
+
+	pipe := l.rdb.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, scanLimitWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		LogError(ctx, "Failed to count scan rate", err)
+		return 0
+	}
+
+	if count.Val() <= limit {
+		return 0
+	}
+	return windowStart.Add(scanLimitWindow).Sub(now)
+}
+
+// writeRetryAfter responds 429 with the wait rounded up to whole seconds
+func writeRetryAfter(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, message, http.StatusTooManyRequests)
+}
+
+// clientIP returns the address of the client. X-Forwarded-For is only
+// trusted when TRUST_PROXY is set, since clients can send it themselves.
+func clientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimitPolicy is a token bucket refilled at PerMinute tokens a minute and
+// holding at most Burst tokens
+type rateLimitPolicy struct {
+	Name      string
+	PerMinute int64
+	Burst     int64
+}
+
+// Stricter policies for the unauthenticated routes open to brute force and spam
+var (
+	loginRateLimit    = rateLimitPolicy{Name: "login", PerMinute: 10, Burst: 5}
+	signupRateLimit   = rateLimitPolicy{Name: "signup", PerMinute: 5, Burst: 5}
+	refreshRateLimit  = rateLimitPolicy{Name: "refresh", PerMinute: 30, Burst: 10}
+	registerRateLimit = rateLimitPolicy{Name: "register", PerMinute: 5, Burst: 5}
+)
+
+const defaultRequestsPerMinute = 100
+
+// Failed logins lock an account, or a client IP, out for loginLockoutBase
+// once the threshold is reached, doubling with every further failure
+const (
+	loginFailureWindow     = time.Hour
+	loginLockoutBase       = time.Minute
+	loginLockoutMax        = time.Hour
+	accountLockoutFailures = 5
+	ipLockoutFailures      = 20
+)
+
+// tokenBucketScript takes one token from the bucket at KEYS[1] and returns
+// whether it was available and the tokens left. ARGV holds the refill rate in
+// tokens per millisecond, the bucket size and the current time in milliseconds.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// RateLimiter enforces request rate limits and login lockouts shared by all
+// backend instances through Redis. Redis failures let requests through.
+type RateLimiter struct {
+	rdb           *redis.Client
+	defaultPolicy rateLimitPolicy
+}
+
+// NewRateLimiter creates a rate limiter whose default policy allows
+// RATE_LIMIT_REQUESTS_PER_MINUTE requests a minute
+func NewRateLimiter(rdb *redis.Client) (*RateLimiter, error) {
+	perMinute := int64(defaultRequestsPerMinute)
+	if value := os.Getenv("RATE_LIMIT_REQUESTS_PER_MINUTE"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_REQUESTS_PER_MINUTE %q", value)
+		}
+		perMinute = n
+	}
+
+	return &RateLimiter{
+		rdb:           rdb,
+		defaultPolicy: rateLimitPolicy{Name: "default", PerMinute: perMinute, Burst: perMinute},
+	}, nil
+}
+
+// DefaultPolicy returns the policy configured by RATE_LIMIT_REQUESTS_PER_MINUTE
+func (l *RateLimiter) DefaultPolicy() rateLimitPolicy {
+	return l.defaultPolicy
+}
+
+// rateLimitByIP keys buckets by client IP, for unauthenticated routes
+func rateLimitByIP(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// rateLimitByUser keys buckets by the authenticated user so door staff
+// sharing a venue's IP do not use up each other's quota
+func rateLimitByUser(r *http.Request) string {
+	if user, ok := userFromContext(r.Context()); ok && user.ID.Valid {
+		return "user:" + uuid.UUID(user.ID.Bytes).String()
+	}
+	return rateLimitByIP(r)
+}
+
+// Limit returns middleware applying the policy to each key's own bucket. It
+// advertises the quota in the X-RateLimit-* headers and rejects requests with
+// an empty bucket with 429 and Retry-After.
+func (l *RateLimiter) Limit(policy rateLimitPolicy, key func(*http.Request) string) func(http.Handler) http.Handler {
+	rate := float64(policy.PerMinute) / float64(time.Minute/time.Millisecond)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			bucketKey := fmt.Sprintf("rate_limit:%s:%s", policy.Name, key(r))
+
+			result, err := tokenBucketScript.Run(ctx, l.rdb, []string{bucketKey},
+				rate, policy.Burst, time.Now().UnixMilli()).Slice()
+			if err != nil || len(result) != 2 {
+				LogError(ctx, "Failed to apply rate limit", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, _ := result[0].(int64)
+			tokensValue, _ := result[1].(string)
+			tokens, _ := strconv.ParseFloat(tokensValue, 64)
+
+			resetMillis := (float64(policy.Burst) - tokens) / rate
+			w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(policy.PerMinute, 10))
+			w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(int64(tokens), 10))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(resetMillis/1000)), 10))
+
+			if allowed != 1 {
+				retryAfter := time.Duration((1-tokens)/rate) * time.Millisecond
+				writeRetryAfter(w, "Too many requests", retryAfter)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func loginFailureSubjects(email, ip string) []string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return []string{"account:" + hex.EncodeToString(sum[:]), "ip:" + ip}
+}
+
+// LoginLockout returns how long logins for the account or from the IP stay
+// locked after repeated failures, or zero when they are allowed
+func (l *RateLimiter) LoginLockout(ctx context.Context, email, ip string) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	var lockout time.Duration
+	for _, subject := range loginFailureSubjects(email, ip) {
+		ttl, err := l.rdb.PTTL(ctx, "login_lockout:"+subject).Result()
+		if err != nil {
+			LogError(ctx, "Failed to check login lockout", err)
+			continue
+		}
+		if ttl > lockout {
+			lockout = ttl
+		}
+	}
+	return lockout
+}
+
+// RecordLoginFailure counts a failed login against the account and the IP
+// and locks out whichever reached its threshold
+func (l *RateLimiter) RecordLoginFailure(ctx context.Context, email, ip string) {
+	if l == nil {
+		return
+	}
+
+	subjects := loginFailureSubjects(email, ip)
+	thresholds := []int64{accountLockoutFailures, ipLockoutFailures}
+	for i, subject := range subjects {
+		key := "login_failures:" + subject
+		pipe := l.rdb.TxPipeline()
+		failures := pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, loginFailureWindow)
+		if _, err := pipe.Exec(ctx); err != nil {
+			LogError(ctx, "Failed to record login failure", err)
+			continue
+		}
+
+		if lockout := loginLockoutDuration(failures.Val(), thresholds[i]); lockout > 0 {
+			if err := l.rdb.Set(ctx, "login_lockout:"+subject, failures.Val(), lockout).Err(); err != nil {
+				LogError(ctx, "Failed to lock out login", err)
+			}
+		}
+	}
+}
+
+// ResetLoginFailures clears the account's failures after a successful login.
+// The IP's failures are kept so one valid account cannot reset them.
+func (l *RateLimiter) ResetLoginFailures(ctx context.Context, email string) {
+	if l == nil {
+		return
+	}
+
+	subject := loginFailureSubjects(email, "")[0]
+	if err := l.rdb.Del(ctx, "login_failures:"+subject, "login_lockout:"+subject).Err(); err != nil {
+		LogError(ctx, "Failed to reset login failures", err)
+	}
+}
+
+// loginLockoutDuration doubles the lockout for every failure past the threshold
+func loginLockoutDuration(failures, threshold int64) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+
+	lockout := loginLockoutBase
+	for i := threshold; i < failures && lockout < loginLockoutMax; i++ {
+		lockout *= 2
+	}
+	if lockout > loginLockoutMax {
+		lockout = loginLockoutMax
+	}
+	return lockout
+}
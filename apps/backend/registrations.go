@@ -0,0 +1,706 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"eventpass.pro/apps/backend/db"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Registration statuses stored on registrations.status
+const (
+	registrationUnverified      = "unverified"
+	registrationPendingApproval = "pending_approval"
+	registrationApproved        = "approved"
+	registrationWaitlisted      = "waitlisted"
+	registrationRejected        = "rejected"
+)
+
+// registrationVerificationWindow is how long email verification links stay
+// valid
+const registrationVerificationWindow = 24 * time.Hour
+
+// maxRegistrationBodySize bounds public registration requests
+const maxRegistrationBodySize = 64 << 10
+
+// maxRegistrationCustomFields bounds the custom fields of a registration form
+const maxRegistrationCustomFields = 20
+
+// registrationForm configures what registrants fill in for an open event.
+// RequiredFields names the invitee fields that must be given, out of
+// first_name, last_name, phone and company; the email is always required.
+// CustomFields are stored in the invitee's custom fields.
+type registrationForm struct {
+	RequiredFields   []string            `json:"required_fields"`
+	CustomFields     []registrationField `json:"custom_fields"`
+	ApprovalRequired bool                `json:"approval_required"`
+}
+
+// registrationField is a custom question of a registration form
+type registrationField struct {
+	Name     string `json:"name"`
+	Label    string `json:"label"`
+	Required bool   `json:"required"`
+}
+
+// parseRegistrationForm decodes the form stored on an event, which is empty
+// until one is configured
+func parseRegistrationForm(raw json.RawMessage) (registrationForm, error) {
+	var form registrationForm
+	if len(raw) == 0 {
+		return form, nil
+	}
+	err := json.Unmarshal(raw, &form)
+	return form, err
+}
+
+func (f registrationForm) validate() error {
+	for _, field := range f.RequiredFields {
+		switch field {
+		case inviteeFieldFirstName, inviteeFieldLastName, inviteeFieldPhone, inviteeFieldCompany:
+		default:
+			return fmt.Errorf("%q cannot be a required field", field)
+		}
+	}
+
+	if len(f.CustomFields) > maxRegistrationCustomFields {
+		return fmt.Errorf("registration forms are limited to %d custom fields", maxRegistrationCustomFields)
+	}
+	names := map[string]bool{}
+	for _, field := range f.CustomFields {
+		if field.Name == "" || len(field.Name) > maxInviteeTextLength || len(field.Label) > maxInviteeTextLength {
+			return fmt.Errorf("custom fields need a name and names and labels are limited to %d characters", maxInviteeTextLength)
+		}
+		if isInviteeField(field.Name) {
+			return fmt.Errorf("custom field %q clashes with an invitee field", field.Name)
+		}
+		if names[field.Name] {
+			return fmt.Errorf("custom field %q is defined twice", field.Name)
+		}
+		names[field.Name] = true
+	}
+	return nil
+}
+
+func (f registrationForm) requires(field string) bool {
+	for _, required := range f.RequiredFields {
+		if required == field {
+			return true
+		}
+	}
+	return false
+}
+
+// publicRegistration is what the public registration endpoints show. It
+// leaves out the verification token and the reviewer.
+type publicRegistration struct {
+	EventName string `json:"event_name"`
+	Email     string `json:"email"`
+	Status    string `json:"status"`
+}
+
+// withoutVerificationToken hides the verification token hash from API
+// responses
+func withoutVerificationToken(registration db.Registration) db.Registration {
+	registration.VerificationTokenHash = ""
+	return registration
+}
+
+// UpdateEventRegistration opens or closes an event to self-registration and
+// sets its registration form. Fields the request leaves out are kept.
+func (api *API) UpdateEventRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	var request struct {
+		Open *bool             `json:"open"`
+		Form *registrationForm `json:"form"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	event, err := api.db.GetEvent(ctx, int32(eventID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	params := db.UpdateEventRegistrationParams{
+		ID:               event.ID,
+		RegistrationOpen: event.RegistrationOpen,
+		RegistrationForm: event.RegistrationForm,
+	}
+	if request.Open != nil {
+		params.RegistrationOpen = *request.Open
+	}
+	if request.Form != nil {
+		if err := request.Form.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if params.RegistrationForm, err = json.Marshal(request.Form); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	updated, err := api.db.UpdateEventRegistration(ctx, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updated)
+}
+
+// GetRegistrationForm shows the public what an open event is and what its
+// registration form asks for
+func (api *API) GetRegistrationForm(w http.ResponseWriter, r *http.Request) {
+	event, form, ok := api.openEventForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	response := struct {
+		EventName string           `json:"event_name"`
+		EventDate *time.Time       `json:"event_date,omitempty"`
+		Location  string           `json:"location"`
+		Form      registrationForm `json:"form"`
+	}{EventName: event.Name, Location: event.Location, Form: form}
+	if event.Date.Valid {
+		response.EventDate = &event.Date.Time
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// Register signs someone up for an open event and emails them a link to
+// verify their address. The answer is the same whether or not the address
+// was registered before, so the endpoint does not reveal who registered.
+// Requests filling in the hidden website field are taken for bots and
+// dropped.
+func (api *API) Register(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, form, ok := api.openEventForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Email        string            `json:"email"`
+		FirstName    string            `json:"first_name"`
+		LastName     string            `json:"last_name"`
+		Phone        string            `json:"phone"`
+		Company      string            `json:"company"`
+		CustomFields map[string]string `json:"custom_fields"`
+		Website      string            `json:"website"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRegistrationBodySize)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	accepted := func() {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Check your email to confirm your registration"})
+	}
+	if request.Website != "" {
+		LogInfo(ctx, "Dropped registration filling in the honeypot field", slog.Int("event_id", int(event.ID)))
+		accepted()
+		return
+	}
+
+	params := db.CreateRegistrationParams{
+		EventID:               event.ID,
+		Email:                 strings.TrimSpace(request.Email),
+		VerificationExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(registrationVerificationWindow), Valid: true},
+	}
+	if !isValidEmail(params.Email) {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	fields := []struct {
+		name  string
+		value string
+		dest  *pgtype.Text
+	}{
+		{inviteeFieldFirstName, request.FirstName, &params.FirstName},
+		{inviteeFieldLastName, request.LastName, &params.LastName},
+		{inviteeFieldPhone, request.Phone, &params.Phone},
+		{inviteeFieldCompany, request.Company, &params.Company},
+	}
+	for _, field := range fields {
+		value := strings.TrimSpace(field.value)
+		if value == "" && form.requires(field.name) {
+			http.Error(w, fmt.Sprintf("%s is required", field.name), http.StatusBadRequest)
+			return
+		}
+		if len(value) > maxInviteeTextLength {
+			http.Error(w, fmt.Sprintf("%s is longer than %d characters", field.name, maxInviteeTextLength), http.StatusBadRequest)
+			return
+		}
+		*field.dest = optionalText(value)
+	}
+	if params.Phone.Valid && !phonePattern.MatchString(params.Phone.String) {
+		http.Error(w, "Invalid phone number", http.StatusBadRequest)
+		return
+	}
+
+	// Only the form's custom fields are kept
+	custom := map[string]string{}
+	for _, field := range form.CustomFields {
+		value := strings.TrimSpace(request.CustomFields[field.Name])
+		if value == "" && field.Required {
+			http.Error(w, fmt.Sprintf("%s is required", field.Name), http.StatusBadRequest)
+			return
+		}
+		if len(value) > maxInviteeTextLength {
+			http.Error(w, fmt.Sprintf("%s is longer than %d characters", field.Name, maxInviteeTextLength), http.StatusBadRequest)
+			return
+		}
+		if value != "" {
+			custom[field.Name] = value
+		}
+	}
+	var err error
+	if params.CustomFields, err = json.Marshal(custom); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token, err := newLinkToken()
+	if err != nil {
+		http.Error(w, "Failed to create verification link", http.StatusInternalServerError)
+		return
+	}
+	params.VerificationTokenHash = linkTokenHash(token)
+
+	registration, err := api.db.CreateRegistration(ctx, params)
+	if errors.Is(err, pgx.ErrNoRows) {
+		accepted()
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	api.sendRegistrationVerification(ctx, event, registration, token)
+	accepted()
+}
+
+// VerifyRegistration confirms a registrant's email address with the token
+// from the verification email. The registration then awaits an organizer's
+// approval or, when the event does not require it, becomes an invitee right
+// away. Verifying again returns the registration's current status.
+func (api *API) VerifyRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Missing verification token", http.StatusBadRequest)
+		return
+	}
+	hash := linkTokenHash(token)
+
+	registration, err := api.db.GetRegistrationByVerificationToken(ctx, hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Invalid verification token", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	event, err := api.db.GetEvent(ctx, registration.EventID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if registration.Status == registrationUnverified {
+		form, err := parseRegistrationForm(event.RegistrationForm)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		next := registrationApproved
+		if form.ApprovalRequired {
+			next = registrationPendingApproval
+		}
+
+		verified, err := api.db.VerifyRegistration(ctx, db.VerifyRegistrationParams{VerificationTokenHash: hash, Status: next})
+		if errors.Is(err, pgx.ErrNoRows) {
+			if registration.VerificationExpiresAt.Time.Before(time.Now()) {
+				http.Error(w, "Verification link has expired, register again", http.StatusGone)
+				return
+			}
+			// Verified concurrently
+			verified, err = api.db.GetRegistrationByVerificationToken(ctx, hash)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		registration = verified
+	}
+
+	if registration.Status == registrationApproved && !registration.InviteeID.Valid {
+		if registration, err = api.admitRegistration(ctx, event, registration); err != nil {
+			LogError(ctx, "Failed to admit registration", err)
+			http.Error(w, "Failed to issue your ticket, open the link again to retry", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(publicRegistration{EventName: event.Name, Email: registration.Email, Status: registration.Status})
+}
+
+// ListRegistrations returns the event's registrations, optionally only those
+// with a status, e.g. ?status=pending_approval for the approval queue
+func (api *API) ListRegistrations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	registrations, err := api.db.ListRegistrationsByEvent(r.Context(), int32(eventID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	filtered := make([]db.Registration, 0, len(registrations))
+	for _, registration := range registrations {
+		if status == "" || registration.Status == status {
+			filtered = append(filtered, withoutVerificationToken(registration))
+		}
+	}
+
+	json.NewEncoder(w).Encode(filtered)
+}
+
+// ApproveRegistration approves a verified registration awaiting approval and
+// makes the registrant an invitee, or puts them on the waitlist when the
+// event is full. Approving again retries issuing a ticket that failed.
+func (api *API) ApproveRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	registration, user, ok := api.registrationForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if registration.Status != registrationApproved || registration.InviteeID.Valid {
+		reviewed, err := api.db.ReviewRegistration(ctx, db.ReviewRegistrationParams{
+			ID:         registration.ID,
+			Status:     registrationApproved,
+			ReviewedBy: user.ID,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, fmt.Sprintf("Registration is %s", registration.Status), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		registration = reviewed
+	}
+
+	event, err := api.db.GetEvent(ctx, registration.EventID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	admitted, err := api.admitRegistration(ctx, event, registration)
+	if err != nil {
+		LogError(ctx, "Failed to admit registration", err)
+		http.Error(w, "Registration approved but its ticket could not be issued, approve again to retry", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(withoutVerificationToken(admitted))
+}
+
+// RejectRegistration turns down a verified registration awaiting approval
+// and lets the registrant know
+func (api *API) RejectRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	registration, user, ok := api.registrationForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	rejected, err := api.db.ReviewRegistration(ctx, db.ReviewRegistrationParams{
+		ID:         registration.ID,
+		Status:     registrationRejected,
+		ReviewedBy: user.ID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("Registration is %s", registration.Status), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if event, err := api.db.GetEvent(ctx, rejected.EventID); err == nil {
+		subject := fmt.Sprintf("Your registration for %s", event.Name)
+		message := fmt.Sprintf(`
+Hello!
+
+Thank you for registering for %s. Unfortunately we cannot offer you a place at this event.
+
+Best regards,
+EventPass Pro Team
+`, event.Name)
+		api.SendEventNotification(ctx, event.ID, "email", rejected.Email, subject, message)
+	} else {
+		LogError(ctx, "Failed to get event for rejection notification", err)
+	}
+
+	json.NewEncoder(w).Encode(withoutVerificationToken(rejected))
+}
+
+// admitRegistration makes an approved registration an invitee with a signed
+// QR code and emails it, or puts the registrant on the waitlist when the
+// event is full. A registrant who was invited some other way meanwhile keeps
+// that invitation.
+func (api *API) admitRegistration(ctx context.Context, event db.Event, registration db.Registration) (db.Registration, error) {
+	var invitee db.Invitee
+	err := api.inTx(ctx, func(q db.Querier) error {
+		// Admissions of the event wait for each other on the event row, so
+		// each one counts the seat taken by the one before
+		_, err := q.LockEvent(ctx, registration.EventID)
+		if err != nil {
+			return err
+		}
+		invitee, err = q.CreateRegistrationInvitee(ctx, db.CreateRegistrationInviteeParams{
+			EventID:      registration.EventID,
+			Email:        registration.Email,
+			FirstName:    registration.FirstName,
+			LastName:     registration.LastName,
+			Phone:        registration.Phone,
+			Company:      registration.Company,
+			CustomFields: registration.CustomFields,
+		})
+		return err
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		existing, err := api.db.GetInviteeByEventAndEmail(ctx, db.GetInviteeByEventAndEmailParams{EventID: registration.EventID, Email: registration.Email})
+		if err != nil {
+			return registration, fmt.Errorf("failed to get existing invitee: %w", err)
+		}
+		return api.db.SetRegistrationOutcome(ctx, db.SetRegistrationOutcomeParams{
+			ID:        registration.ID,
+			Status:    registrationApproved,
+			InviteeID: pgtype.Int4{Int32: existing.ID, Valid: true},
+		})
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return api.waitlistRegistration(ctx, event, registration)
+	}
+	if err != nil {
+		return registration, fmt.Errorf("failed to create invitee: %w", err)
+	}
+
+	registration, err = api.db.SetRegistrationOutcome(ctx, db.SetRegistrationOutcomeParams{
+		ID:        registration.ID,
+		Status:    registrationApproved,
+		InviteeID: pgtype.Int4{Int32: invitee.ID, Valid: true},
+	})
+	if err != nil {
+		return registration, fmt.Errorf("failed to link invitee: %w", err)
+	}
+
+	issued, err := api.issueQRCode(ctx, invitee.ID)
+	if err != nil {
+		// The invitee exists, reprinting issues the QR code
+		api.publishInviteeState(ctx, invitee)
+		return registration, fmt.Errorf("failed to issue QR code: %w", err)
+	}
+	api.publishInviteeState(ctx, issued)
+
+	subject := fmt.Sprintf("You are registered for %s", event.Name)
+	message := fmt.Sprintf(`
+Hello!
+
+Your registration for %s is confirmed.
+
+Event: %s
+Start Time: %s
+Location: %s
+
+Your QR code for check-in: %s
+
+Best regards,
+EventPass Pro Team
+`, event.Name, event.Name, event.Date.Time.Format("2006-01-02 15:04"), event.Location, issued.QrCodeUrl.String)
+	api.SendEventNotification(ctx, event.ID, "email", issued.Email, subject, message)
+
+	return registration, nil
+}
+
+// waitlistRegistration puts an approved registrant of a full event on its
+// waitlist, from where they are promoted like anyone waiting
+func (api *API) waitlistRegistration(ctx context.Context, event db.Event, registration db.Registration) (db.Registration, error) {
+	_, err := api.db.JoinWaitlist(ctx, db.JoinWaitlistParams{
+		EventID:   registration.EventID,
+		Email:     registration.Email,
+		FirstName: registration.FirstName,
+		LastName:  registration.LastName,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return registration, fmt.Errorf("failed to join waitlist: %w", err)
+	}
+
+	registration, err = api.db.SetRegistrationOutcome(ctx, db.SetRegistrationOutcomeParams{
+		ID:     registration.ID,
+		Status: registrationWaitlisted,
+	})
+	if err != nil {
+		return registration, err
+	}
+
+	subject := fmt.Sprintf("You are on the waitlist for %s", event.Name)
+	message := fmt.Sprintf(`
+Hello!
+
+Thank you for registering for %s. The event is currently full, so we have put you on the waitlist.
+
+We will email you a link to claim your seat as soon as one opens up.
+
+Best regards,
+EventPass Pro Team
+`, event.Name)
+	api.SendEventNotification(ctx, event.ID, "email", registration.Email, subject, message)
+
+	return registration, nil
+}
+
+// sendRegistrationVerification emails a registrant the link verifying their
+// address
+func (api *API) sendRegistrationVerification(ctx context.Context, event db.Event, registration db.Registration, token string) {
+	verifyURL := fmt.Sprintf("%s/registrations/verify?token=%s", os.Getenv("BASE_URL"), token)
+
+	subject := fmt.Sprintf("Confirm your registration for %s", event.Name)
+	message := fmt.Sprintf(`
+Hello!
+
+Please confirm your email address to complete your registration for %s.
+
+Event: %s
+Start Time: %s
+Location: %s
+
+Confirm your registration before %s: %s
+
+If you did not register, you can ignore this email.
+
+Best regards,
+EventPass Pro Team
+`, event.Name, event.Name, event.Date.Time.Format("2006-01-02 15:04"), event.Location, registration.VerificationExpiresAt.Time.Format("2006-01-02 15:04"), verifyURL)
+
+	api.SendEventNotification(ctx, event.ID, "email", registration.Email, subject, message)
+}
+
+// openEventForRequest loads the event named by the id route variable when it
+// is open for registration and has not taken place, writing the error
+// response itself
+func (api *API) openEventForRequest(w http.ResponseWriter, r *http.Request) (db.Event, registrationForm, bool) {
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return db.Event{}, registrationForm{}, false
+	}
+
+	event, err := api.db.GetEvent(r.Context(), int32(eventID))
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !event.RegistrationOpen) {
+		http.Error(w, "Event is not open for registration", http.StatusNotFound)
+		return db.Event{}, registrationForm{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.Event{}, registrationForm{}, false
+	}
+	if event.Date.Valid && !event.Date.Time.After(time.Now()) {
+		http.Error(w, "Event has already taken place", http.StatusGone)
+		return db.Event{}, registrationForm{}, false
+	}
+
+	form, err := parseRegistrationForm(event.RegistrationForm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.Event{}, registrationForm{}, false
+	}
+
+	return event, form, true
+}
+
+// registrationForRequest loads the registration named by the id route
+// variable for a user with access to its event, writing the error response
+// itself
+func (api *API) registrationForRequest(w http.ResponseWriter, r *http.Request) (db.Registration, db.User, bool) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return db.Registration{}, db.User{}, false
+	}
+
+	vars := mux.Vars(r)
+	registrationID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid registration ID", http.StatusBadRequest)
+		return db.Registration{}, db.User{}, false
+	}
+
+	registration, err := api.db.GetRegistration(r.Context(), int32(registrationID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Registration not found", http.StatusNotFound)
+		return db.Registration{}, db.User{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.Registration{}, db.User{}, false
+	}
+
+	if !api.checkEventAccess(w, r, registration.EventID) {
+		return db.Registration{}, db.User{}, false
+	}
+
+	return registration, user, true
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"eventpass.pro/apps/backend/db"
+	"eventpass.pro/apps/backend/signing"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// RSVP responses stored on invitees.rsvp_status
+const (
+	rsvpAwaiting = "awaiting"
+	rsvpAccepted = "accepted"
+	rsvpDeclined = "declined"
+	rsvpMaybe    = "maybe"
+)
+
+// rsvpResponses maps the response in RSVP link paths to the stored status
+var rsvpResponses = map[string]string{
+	"accept":  rsvpAccepted,
+	"decline": rsvpDeclined,
+	"maybe":   rsvpMaybe,
+}
+
+// rsvpLinkLifetime is how long RSVP links of events without a date stay
+// valid; links of dated events expire when the event starts
+const rsvpLinkLifetime = 90 * 24 * time.Hour
+
+// rsvpResponse is what the public RSVP endpoints show a guest. It leaves out
+// the invitee's QR code and other details only organizers see.
+type rsvpResponse struct {
+	EventName       string     `json:"event_name"`
+	EventDate       *time.Time `json:"event_date,omitempty"`
+	Location        string     `json:"location"`
+	Email           string     `json:"email"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	RsvpStatus      string     `json:"rsvp_status"`
+	PlusOnes        int32      `json:"plus_ones"`
+	PlusOneNames    []string   `json:"plus_one_names"`
+	PlusOnesAllowed int32      `json:"plus_ones_allowed"`
+}
+
+func newRSVPResponse(event db.Event, invitee db.Invitee) rsvpResponse {
+	response := rsvpResponse{
+		EventName:       event.Name,
+		Location:        event.Location,
+		Email:           invitee.Email,
+		FirstName:       invitee.FirstName.String,
+		LastName:        invitee.LastName.String,
+		RsvpStatus:      invitee.RsvpStatus,
+		PlusOnes:        invitee.PlusOnes,
+		PlusOneNames:    invitee.PlusOneNames,
+		PlusOnesAllowed: event.PlusOnesAllowed,
+	}
+	if event.Date.Valid {
+		response.EventDate = &event.Date.Time
+	}
+	if invitee.OrderID.Valid {
+		response.PlusOnesAllowed = 0
+	}
+	return response
+}
+
+// rsvpSeats returns the seats an invitee's answer holds against the event's
+// capacity. Bought tickets hold theirs through the order whatever the answer.
+func rsvpSeats(invitee db.Invitee) int {
+	if invitee.OrderID.Valid || invitee.RsvpStatus == rsvpDeclined {
+		return 0
+	}
+	return 1 + int(invitee.PlusOnes)
+}
+
+// GetRSVP shows the guest holding an RSVP link the invitation and their
+// current answer. The emailed links open it, so following one records
+// nothing; the answer is only given with a POST.
+func (api *API) GetRSVP(w http.ResponseWriter, r *http.Request) {
+	if response, ok := mux.Vars(r)["response"]; ok {
+		if _, ok := rsvpResponses[response]; !ok {
+			http.Error(w, "Unknown RSVP response", http.StatusNotFound)
+			return
+		}
+	}
+
+	invitee, event, ok := api.rsvpInviteeForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(newRSVPResponse(event, invitee))
+}
+
+// RespondRSVP records the guest's answer from an RSVP link: accept, decline
+// or maybe. Accepting or answering maybe may bring plus-ones, up to the
+// event's allowance, who take seats like the guest; answering again replaces
+// the previous answer and a decline gives the seats to the waitlist. Without
+// a body the plus-ones already recorded are kept.
+func (api *API) RespondRSVP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	status, ok := rsvpResponses[mux.Vars(r)["response"]]
+	if !ok {
+		http.Error(w, "Unknown RSVP response", http.StatusNotFound)
+		return
+	}
+
+	invitee, event, ok := api.rsvpInviteeForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		PlusOnes     *int32   `json:"plus_ones"`
+		PlusOneNames []string `json:"plus_one_names"`
+	}
+	if err := decodeOptionalBody(r, &request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	plusOnes, plusOneNames := invitee.PlusOnes, invitee.PlusOneNames
+	changed := request.PlusOnes != nil || request.PlusOneNames != nil
+	if changed {
+		plusOneNames = nil
+		for _, name := range request.PlusOneNames {
+			name = strings.TrimSpace(name)
+			if len(name) > maxInviteeTextLength {
+				http.Error(w, fmt.Sprintf("Names are limited to %d characters", maxInviteeTextLength), http.StatusBadRequest)
+				return
+			}
+			if name != "" {
+				plusOneNames = append(plusOneNames, name)
+			}
+		}
+		plusOnes = int32(len(plusOneNames))
+		if request.PlusOnes != nil {
+			plusOnes = *request.PlusOnes
+		}
+	}
+
+	allowed := event.PlusOnesAllowed
+	if invitee.OrderID.Valid {
+		allowed = 0
+	}
+	switch {
+	case status == rsvpDeclined:
+		plusOnes, plusOneNames = 0, nil
+	case !changed && plusOnes > allowed:
+		// The allowance was lowered since the plus-ones were recorded
+		plusOnes = allowed
+		if len(plusOneNames) > int(allowed) {
+			plusOneNames = plusOneNames[:allowed]
+		}
+	case plusOnes < 0:
+		http.Error(w, "Plus-ones must not be negative", http.StatusBadRequest)
+		return
+	case int(plusOnes) < len(plusOneNames):
+		http.Error(w, "More plus-one names than plus-ones", http.StatusBadRequest)
+		return
+	case plusOnes > allowed:
+		http.Error(w, fmt.Sprintf("At most %d plus-ones are allowed", allowed), http.StatusBadRequest)
+		return
+	}
+	if plusOneNames == nil {
+		plusOneNames = []string{}
+	}
+
+	var answered db.Invitee
+	err := api.inTx(ctx, func(q db.Querier) error {
+		// Answers taking seats wait for each other on the event row, so each
+		// one counts the seats taken by the one before
+		_, err := q.LockEvent(ctx, invitee.EventID)
+		if err != nil {
+			return err
+		}
+		answered, err = q.RespondInviteeRSVP(ctx, db.RespondInviteeRSVPParams{
+			ID:           invitee.ID,
+			RsvpStatus:   status,
+			PlusOnes:     plusOnes,
+			PlusOneNames: plusOneNames,
+		})
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "The event has no room for more guests", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	api.publishInviteeState(ctx, answered)
+
+	if freed := rsvpSeats(invitee) - rsvpSeats(answered); freed > 0 {
+		api.promoteWaitlist(ctx, answered.EventID, freed)
+	}
+
+	json.NewEncoder(w).Encode(newRSVPResponse(event, answered))
+}
+
+// rsvpInviteeForRequest loads the invitee and event of the RSVP link token
+// in the token query parameter, writing the error response itself. Links of
+// invitees that can no longer attend and of past events are refused.
+func (api *API) rsvpInviteeForRequest(w http.ResponseWriter, r *http.Request) (db.Invitee, db.Event, bool) {
+	ctx := r.Context()
+	now := time.Now()
+
+	claims, err := api.qrKeys.VerifyFor(r.URL.Query().Get("token"), signing.PurposeRSVP, now)
+	if errors.Is(err, signing.ErrTokenExpired) {
+		http.Error(w, "RSVP link has expired", http.StatusGone)
+		return db.Invitee{}, db.Event{}, false
+	}
+	if err != nil {
+		http.Error(w, "Invalid RSVP link", http.StatusUnauthorized)
+		return db.Invitee{}, db.Event{}, false
+	}
+
+	invitee, err := api.db.GetInvitee(ctx, claims.InviteeID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && invitee.EventID != claims.EventID) {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return db.Invitee{}, db.Event{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.Invitee{}, db.Event{}, false
+	}
+	if err := inviteeAvailability(invitee, now); err != nil {
+		http.Error(w, "Invitation is no longer valid", http.StatusGone)
+		return db.Invitee{}, db.Event{}, false
+	}
+
+	event, err := api.db.GetEvent(ctx, invitee.EventID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.Invitee{}, db.Event{}, false
+	}
+	if event.Date.Valid && !event.Date.Time.After(now) {
+		http.Error(w, "Event has already taken place", http.StatusGone)
+		return db.Invitee{}, db.Event{}, false
+	}
+
+	return invitee, event, true
+}
+
+// SendRSVPRequests emails an RSVP link to every invitee of the event who has
+// not answered yet or answered maybe. Invitees who accepted or declined can
+// still change their answer with the link they were sent.
+func (api *API) SendRSVPRequests(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	event, err := api.db.GetEvent(ctx, int32(eventID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	if event.Date.Valid && !event.Date.Time.After(now) {
+		http.Error(w, "Event has already taken place", http.StatusConflict)
+		return
+	}
+
+	invitees, err := api.db.GetInviteesByEvent(ctx, event.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sent := 0
+	for _, invitee := range invitees {
+		if invitee.RsvpStatus != rsvpAwaiting && invitee.RsvpStatus != rsvpMaybe {
+			continue
+		}
+		if inviteeAvailability(invitee, now) != nil {
+			continue
+		}
+		if err := api.sendRSVPRequest(ctx, event, invitee, now); err != nil {
+			LogError(ctx, "Failed to send RSVP request", err)
+			continue
+		}
+		sent++
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"sent": sent})
+}
+
+// rsvpLink returns the link answering the invitation with the response,
+// signed for the invitee
+func (api *API) rsvpLink(event db.Event, invitee db.Invitee, response string, now time.Time) (string, error) {
+	expiresAt := now.Add(rsvpLinkLifetime)
+	if event.Date.Valid {
+		expiresAt = event.Date.Time
+	}
+
+	token, _, err := api.qrKeys.SignFor(signing.PurposeRSVP, invitee.EventID, invitee.ID, now, expiresAt)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign RSVP link: %w", err)
+	}
+	return fmt.Sprintf("%s/rsvp/%s?token=%s", os.Getenv("BASE_URL"), response, token), nil
+}
+
+// sendRSVPRequest emails the invitee the links to answer the invitation
+func (api *API) sendRSVPRequest(ctx context.Context, event db.Event, invitee db.Invitee, now time.Time) error {
+	links := map[string]string{}
+	for response := range rsvpResponses {
+		link, err := api.rsvpLink(event, invitee, response, now)
+		if err != nil {
+			return err
+		}
+		links[response] = link
+	}
+
+	var plusOnes string
+	if event.PlusOnesAllowed > 0 && !invitee.OrderID.Valid {
+		plusOnes = fmt.Sprintf("\nYou may bring up to %d guests, let us know when you accept.\n", event.PlusOnesAllowed)
+	}
+
+	subject := fmt.Sprintf("Will you attend %s?", event.Name)
+	message := fmt.Sprintf(`
+Hello!
+
+You are invited to %s. Please let us know if you can make it.
+
+Event: %s
+Start Time: %s
+Location: %s
+%s
+Accept: %s
+Maybe: %s
+Decline: %s
+
+You can change your answer with these links until the event starts.
+
+Best regards,
+EventPass Pro Team
+`, event.Name, event.Name, event.Date.Time.Format("2006-01-02 15:04"), event.Location, plusOnes, links["accept"], links["maybe"], links["decline"])
+
+	api.SendEventNotification(ctx, invitee.EventID, "email", invitee.Email, subject, message)
+	return nil
+}
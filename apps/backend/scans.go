@@ -0,0 +1,525 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"eventpass.pro/apps/backend/db"
+	"eventpass.pro/apps/backend/signing"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Outcomes recorded in check_ins
+const (
+	checkInAdmitted         = "admitted"
+	checkInDuplicate        = "duplicate"
+	checkInConflict         = "conflict"
+	checkInInvalidSignature = "invalid_signature"
+	checkInExpired          = "expired"
+	checkInSuperseded       = "superseded"
+	checkInNotFound         = "not_found"
+	checkInRevoked          = "revoked"
+	checkInExited           = "exited"
+	checkInRedeemed         = "redeemed"
+	checkInExhausted        = "exhausted"
+	checkInDenied           = "denied"
+	checkInFull             = "full"
+)
+
+// Status of an offline scan that could not be applied; it is not recorded
+const scanRejected = "rejected"
+
+const (
+	// maxSyncBatchSize bounds the number of scans accepted in one sync request
+	maxSyncBatchSize = 500
+	// maxScanClockSkew is how far a device clock may run ahead of the server
+	maxScanClockSkew = 5 * time.Minute
+)
+
+var (
+	errAlreadyAdmitted = errors.New("invitee already admitted")
+	errInviteeExpired  = errors.New("invitee has expired")
+	errInviteeRevoked  = errors.New("invitee was deleted or anonymized")
+)
+
+// admitInvitee checks the invitee in and records the admission in check_ins
+// with a single conditional statement, so the event's re-entry policy holds
+// even for concurrent scans of one badge. Rejected scans get
+// errAlreadyAdmitted, or errInviteeExpired, errInviteeRevoked or
+// errInviteeCancelled when the invitee can no longer be admitted at all, and
+// are left for the caller to record.
+func (api *API) admitInvitee(ctx context.Context, invitee db.Invitee, source scanSource, scannedAt time.Time) (db.Invitee, db.CheckIn, error) {
+	checkIn, err := api.db.AdmitInvitee(ctx, db.AdmitInviteeParams{
+		ID:          invitee.ID,
+		CheckedInAt: pgtype.Timestamptz{Time: scannedAt, Valid: true},
+		DeviceID:    source.DeviceID,
+		OperatorID:  source.OperatorID,
+		Gate:        source.Gate,
+		ZoneID:      source.ZoneID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		current, err := api.db.GetInvitee(ctx, invitee.ID)
+		if err != nil {
+			return invitee, db.CheckIn{}, err
+		}
+		return current, db.CheckIn{}, admissionError(current, time.Now())
+	}
+	if err != nil {
+		return invitee, db.CheckIn{}, err
+	}
+
+	RecordQRCodeScan(checkInAdmitted)
+	RecordCheckIn(invitee.EventID)
+	api.publishScan(ctx, checkIn)
+
+	admitted, err := api.db.GetInvitee(ctx, invitee.ID)
+	if err != nil {
+		// The admission is committed, only the refreshed row is missing
+		LogError(ctx, "Failed to reload admitted invitee", err)
+		return invitee, checkIn, nil
+	}
+
+	api.publishInviteeState(ctx, admitted)
+	return admitted, checkIn, nil
+}
+
+// admissionError explains why AdmitInvitee did not admit the invitee
+func admissionError(invitee db.Invitee, now time.Time) error {
+	if err := inviteeAvailability(invitee, now); err != nil {
+		return err
+	}
+	return errAlreadyAdmitted
+}
+
+// inviteeAvailability returns errInviteeRevoked, errInviteeCancelled or
+// errInviteeExpired for invitees that can no longer be admitted or redeem
+// perks
+func inviteeAvailability(invitee db.Invitee, now time.Time) error {
+	switch {
+	case invitee.DeletedAt.Valid || invitee.AnonymizedAt.Valid:
+		return errInviteeRevoked
+	case isTicketCancelled(invitee):
+		return errInviteeCancelled
+	case invitee.Status == "expired" || (invitee.ExpiresAt.Valid && !invitee.ExpiresAt.Time.After(now)):
+		return errInviteeExpired
+	}
+	return nil
+}
+
+// scanOutcome maps an error from inviteeForQRToken or admitInvitee to the
+// recorded outcome
+func scanOutcome(err error) string {
+	switch {
+	case err == nil:
+		return checkInAdmitted
+	case errors.Is(err, errAlreadyAdmitted):
+		return checkInDuplicate
+	case errors.Is(err, signing.ErrTokenExpired), errors.Is(err, errInviteeExpired):
+		return checkInExpired
+	case errors.Is(err, errInviteeRevoked), errors.Is(err, errInviteeCancelled):
+		return checkInRevoked
+	case errors.Is(err, errQRTokenSuperseded):
+		return checkInSuperseded
+	case errors.Is(err, pgx.ErrNoRows):
+		return checkInNotFound
+	default:
+		return checkInInvalidSignature
+	}
+}
+
+// scanSource identifies the device, gate and operator behind a scan, and the
+// perk it redeems; entry scans have no perk. Zone names the zone requested
+// by the device and ZoneID is the zone resolved by scanZone.
+type scanSource struct {
+	DeviceID   pgtype.Text
+	Gate       pgtype.Text
+	OperatorID pgtype.UUID
+	Perk       pgtype.Text
+	Zone       string
+	ZoneID     pgtype.Int4
+}
+
+// scanSourceFromRequest reads the optional device_id, gate, zone and perk
+// query parameters of an online scan; the operator is the authenticated user
+func scanSourceFromRequest(r *http.Request) scanSource {
+	query := r.URL.Query()
+	user, _ := userFromContext(r.Context())
+	source := scanSource{
+		DeviceID:   optionalText(query.Get("device_id")),
+		Gate:       optionalText(query.Get("gate")),
+		OperatorID: user.ID,
+		Zone:       query.Get("zone"),
+	}
+	if perk := query.Get("perk"); perk != entryPerk {
+		source.Perk = optionalText(perk)
+	}
+	return source
+}
+
+func optionalText(value string) pgtype.Text {
+	return pgtype.Text{String: value, Valid: value != ""}
+}
+
+// recordScan adds an online scan attempt to the check_ins ledger. A zero
+// invitee records a scan whose token could not be matched. Failures are only
+// logged so the ledger never blocks the door.
+func (api *API) recordScan(ctx context.Context, source scanSource, invitee db.Invitee, outcome string) {
+	api.recordScanReason(ctx, source, invitee, outcome, "")
+}
+
+// recordScanReason records a scan attempt together with why it was rejected
+func (api *API) recordScanReason(ctx context.Context, source scanSource, invitee db.Invitee, outcome, reason string) {
+	params := db.CreateCheckInParams{
+		CheckedInAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		DeviceID:    source.DeviceID,
+		Outcome:     outcome,
+		OperatorID:  source.OperatorID,
+		Gate:        source.Gate,
+		Perk:        source.Perk,
+		ZoneID:      source.ZoneID,
+		Reason:      optionalText(reason),
+	}
+	if invitee.ID != 0 {
+		params.EventID = pgtype.Int4{Int32: invitee.EventID, Valid: true}
+		params.InviteeID = pgtype.Int4{Int32: invitee.ID, Valid: true}
+	}
+
+	RecordQRCodeScan(outcome)
+
+	checkIn, err := api.db.CreateCheckIn(ctx, params)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			LogError(ctx, "Failed to record scan", err)
+		}
+		return
+	}
+	api.publishScan(ctx, checkIn)
+}
+
+// publishScan pushes a recorded scan to the event's live subscribers. Scans
+// that could not be matched to an event are not published.
+func (api *API) publishScan(ctx context.Context, checkIn db.CheckIn) {
+	if !checkIn.EventID.Valid {
+		return
+	}
+
+	api.live.Publish(ctx, liveScan, checkIn.EventID.Int32, map[string]interface{}{
+		"check_in_id":   checkIn.ID,
+		"invitee_id":    checkIn.InviteeID.Int32,
+		"outcome":       checkIn.Outcome,
+		"device_id":     checkIn.DeviceID.String,
+		"gate":          checkIn.Gate.String,
+		"perk":          checkIn.Perk.String,
+		"zone_id":       checkIn.ZoneID.Int32,
+		"reason":        checkIn.Reason.String,
+		"checked_in_at": checkIn.CheckedInAt.Time,
+	})
+}
+
+// offlineScan is a scan captured by a door device while it had no connection
+type offlineScan struct {
+	Token     string    `json:"token"`
+	DeviceID  string    `json:"device_id"`
+	Gate      string    `json:"gate"`
+	Zone      string    `json:"zone"`
+	ScannedAt time.Time `json:"scanned_at"`
+}
+
+type offlineScanResult struct {
+	Index               int    `json:"index"`
+	Status              string `json:"status"`
+	InviteeID           int32  `json:"invitee_id,omitempty"`
+	CheckInID           int32  `json:"check_in_id,omitempty"`
+	ConflictingDeviceID string `json:"conflicting_device_id,omitempty"`
+	Error               string `json:"error,omitempty"`
+}
+
+// SyncScans applies a batch of offline scans. Each scan is identified by its
+// device, invitee and local timestamp, so resending a batch returns the
+// original results instead of admitting anyone twice. A badge admitted on a
+// different device first is recorded as a conflict for the organizer.
+//
+// The status of each result is the outcome recorded in check_ins, or
+// "rejected" for scans that could not be matched to an invitee.
+func (api *API) SyncScans(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, ok := userFromContext(ctx)
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		Scans []offlineScan `json:"scans"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(request.Scans) > maxSyncBatchSize {
+		http.Error(w, fmt.Sprintf("At most %d scans can be synced at once", maxSyncBatchSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results := make([]offlineScanResult, 0, len(request.Scans))
+	for i, scan := range request.Scans {
+		result, err := api.applyOfflineScan(ctx, user, scan)
+		if err != nil {
+			LogError(ctx, "Failed to apply offline scan", err)
+			http.Error(w, "Failed to apply offline scans", http.StatusInternalServerError)
+			return
+		}
+		result.Index = i
+		results = append(results, result)
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Results []offlineScanResult `json:"results"`
+	}{Results: results})
+}
+
+// applyOfflineScan runs one offline scan through the same checks as
+// ScanQRCode and records it. Scans without a matching invitee are not
+// recorded since they have no key to deduplicate resends by. Problems with
+// the scan itself are reported in the result; the error is only set for
+// storage failures.
+func (api *API) applyOfflineScan(ctx context.Context, user db.User, scan offlineScan) (offlineScanResult, error) {
+	rejected := func(reason string) (offlineScanResult, error) {
+		return offlineScanResult{Status: scanRejected, Error: reason}, nil
+	}
+
+	if scan.Token == "" || scan.DeviceID == "" || scan.ScannedAt.IsZero() {
+		return rejected("token, device_id and scanned_at are required")
+	}
+	if scan.ScannedAt.After(time.Now().Add(maxScanClockSkew)) {
+		return rejected("scanned_at is in the future")
+	}
+	scannedAt := scan.ScannedAt.Truncate(time.Microsecond)
+
+	invitee, tokenErr := api.inviteeForQRToken(ctx, scan.Token, scannedAt)
+	if invitee.ID == 0 {
+		if errors.Is(tokenErr, pgx.ErrNoRows) {
+			return rejected("invitee not found")
+		}
+		return rejected("invalid QR token")
+	}
+
+	allowed, err := api.canAccessEvent(ctx, user, invitee.EventID)
+	if err != nil || !allowed {
+		return rejected("forbidden")
+	}
+
+	inviteeID := pgtype.Int4{Int32: invitee.ID, Valid: true}
+	deviceID := pgtype.Text{String: scan.DeviceID, Valid: true}
+	checkedInAt := pgtype.Timestamptz{Time: scannedAt, Valid: true}
+
+	// A resent scan returns what was recorded the first time
+	existing, err := api.db.GetCheckInByDeviceScan(ctx, db.GetCheckInByDeviceScanParams{
+		DeviceID:    deviceID,
+		InviteeID:   inviteeID,
+		CheckedInAt: checkedInAt,
+	})
+	if err == nil {
+		return checkInResult(existing), nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return offlineScanResult{}, err
+	}
+
+	source := scanSource{DeviceID: deviceID, Gate: optionalText(scan.Gate), OperatorID: user.ID, Zone: scan.Zone}
+	zone, err := api.scanZone(ctx, invitee.EventID, &source)
+	reason := zoneDenial(zone, invitee)
+	if errors.Is(err, errUnknownZone) {
+		reason = fmt.Sprintf("unknown zone %s", source.Zone)
+	} else if err != nil {
+		return offlineScanResult{}, err
+	}
+
+	outcome := scanOutcome(tokenErr)
+	var conflictDeviceID pgtype.Text
+
+	if tokenErr == nil && reason != "" {
+		outcome = checkInDenied
+	} else if tokenErr == nil {
+		_, admission, err := api.admitInvitee(ctx, invitee, source, scannedAt)
+		switch {
+		case err == nil:
+			// Offline scans already let the invitee in, so capacity is not enforced
+			api.enterOccupancy(ctx, invitee, zone, false)
+			return checkInResult(admission), nil
+		case errors.Is(err, errAlreadyAdmitted) && zone.ID != 0:
+			api.enterOccupancy(ctx, invitee, zone, false)
+			outcome = checkInZoneAccess
+		case errors.Is(err, errAlreadyAdmitted):
+			admission, err := api.db.GetAdmissionCheckIn(ctx, inviteeID)
+			switch {
+			case err == nil && admission.DeviceID == deviceID && admission.CheckedInAt.Time.Equal(scannedAt):
+				// The same scan was synced concurrently and admitted first
+				return checkInResult(admission), nil
+			case err == nil && admission.DeviceID == deviceID:
+				outcome = checkInDuplicate
+			case err == nil || errors.Is(err, pgx.ErrNoRows):
+				// Admitted elsewhere, possibly by an online scan without a device ID
+				outcome = checkInConflict
+				conflictDeviceID = admission.DeviceID
+			default:
+				return offlineScanResult{}, err
+			}
+		case errors.Is(err, errInviteeExpired), errors.Is(err, errInviteeRevoked), errors.Is(err, errInviteeCancelled):
+			outcome = scanOutcome(err)
+		default:
+			return offlineScanResult{}, err
+		}
+	}
+
+	checkIn, err := api.db.CreateCheckIn(ctx, db.CreateCheckInParams{
+		EventID:          pgtype.Int4{Int32: invitee.EventID, Valid: true},
+		InviteeID:        inviteeID,
+		CheckedInAt:      checkedInAt,
+		DeviceID:         deviceID,
+		Outcome:          outcome,
+		ConflictDeviceID: conflictDeviceID,
+		OperatorID:       user.ID,
+		Gate:             source.Gate,
+		ZoneID:           source.ZoneID,
+		Reason:           optionalText(reason),
+	})
+	if err == nil {
+		RecordQRCodeScan(outcome)
+		api.publishScan(ctx, checkIn)
+	} else if errors.Is(err, pgx.ErrNoRows) {
+		// The same scan was synced concurrently and recorded first
+		checkIn, err = api.db.GetCheckInByDeviceScan(ctx, db.GetCheckInByDeviceScanParams{
+			DeviceID:    deviceID,
+			InviteeID:   inviteeID,
+			CheckedInAt: checkedInAt,
+		})
+	}
+	if err != nil {
+		return offlineScanResult{}, err
+	}
+
+	return checkInResult(checkIn), nil
+}
+
+func checkInResult(checkIn db.CheckIn) offlineScanResult {
+	return offlineScanResult{
+		Status:              checkIn.Outcome,
+		InviteeID:           checkIn.InviteeID.Int32,
+		CheckInID:           checkIn.ID,
+		ConflictingDeviceID: checkIn.ConflictDeviceID.String,
+		Error:               checkIn.Reason.String,
+	}
+}
+
+// ListCheckInConflicts returns the offline scans of badges that had already
+// been admitted on another device
+func (api *API) ListCheckInConflicts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	conflicts, err := api.db.ListCheckInConflictsByEvent(r.Context(), pgtype.Int4{Int32: int32(eventID), Valid: true})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(conflicts)
+}
+
+// ListEventCheckIns returns the event's scan ledger, newest first
+func (api *API) ListEventCheckIns(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	checkIns, err := api.db.ListCheckInsByEvent(r.Context(), db.ListCheckInsByEventParams{
+		EventID: pgtype.Int4{Int32: int32(eventID), Valid: true},
+		Limit:   limit,
+		Offset:  offset,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(checkIns)
+}
+
+// ListInviteeCheckIns returns every scan of the invitee's badge, newest first
+func (api *API) ListInviteeCheckIns(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	inviteeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invitee ID", http.StatusBadRequest)
+		return
+	}
+
+	invitee, err := api.db.GetInvitee(r.Context(), int32(inviteeID))
+	if err != nil {
+		http.Error(w, "Invitee not found", http.StatusNotFound)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, invitee.EventID) {
+		return
+	}
+
+	checkIns, err := api.db.ListCheckInsByInvitee(r.Context(), pgtype.Int4{Int32: invitee.ID, Valid: true})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(checkIns)
+}
+
+// pageParams reads the optional limit and offset query parameters
+func pageParams(w http.ResponseWriter, r *http.Request) (int32, int32, bool) {
+	const defaultLimit, maxLimit = 100, 1000
+
+	limit, offset := defaultLimit, 0
+	var err error
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxLimit), http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			http.Error(w, "offset must not be negative", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+
+	return int32(limit), int32(offset), true
+}
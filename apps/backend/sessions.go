@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	// accessTokenTTL is kept short so a lost device loses access quickly
+	accessTokenTTL = 15 * time.Minute
+	// refreshTokenTTL bounds how long a session can be kept alive by rotation
+	refreshTokenTTL = 30 * 24 * time.Hour
+	// liveTicketTTL bounds how long a WebSocket or SSE ticket can wait to be used
+	liveTicketTTL = 30 * time.Second
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	// errRefreshTokenReused means an already rotated refresh token was presented
+	// again, so it leaked and its session has been revoked
+	errRefreshTokenReused = errors.New("refresh token reused")
+	errInvalidLiveTicket  = errors.New("invalid live ticket")
+)
+
+// refreshSession is the server-side record stored for each refresh token
+type refreshSession struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+}
+
+// authIdentity is who an access token authenticates: its user, session, role
+// and issue time. Live tickets store the identity of the token they were
+// issued with.
+type authIdentity struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	Role      string `json:"role"`
+	IssuedAt  int64  `json:"issued_at"`
+}
+
+// SessionStore persists refresh tokens and the access token revocation list in Redis
+type SessionStore struct {
+	rdb *redis.Client
+}
+
+// NewSessionStore creates a new session store backed by the given Redis client
+func NewSessionStore(rdb *redis.Client) *SessionStore {
+	return &SessionStore{rdb: rdb}
+}
+
+func refreshTokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "refresh_token:" + hex.EncodeToString(sum[:])
+}
+
+// usedRefreshTokenKey marks a refresh token that was already rotated, so a
+// second use can be told apart from an unknown token
+func usedRefreshTokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "used_refresh_token:" + hex.EncodeToString(sum[:])
+}
+
+func liveTicketKey(ticket string) string {
+	sum := sha256.Sum256([]byte(ticket))
+	return "live_ticket:" + hex.EncodeToString(sum[:])
+}
+
+func userRefreshTokensKey(userID string) string {
+	return "user_refresh_tokens:" + userID
+}
+
+func revokedSessionKey(sessionID string) string {
+	return "revoked_session:" + sessionID
+}
+
+func revokedUserKey(userID string) string {
+	return "revoked_user:" + userID
+}
+
+// IssueRefreshToken creates a new refresh token for the given session
+func (s *SessionStore) IssueRefreshToken(ctx context.Context, userID uuid.UUID, sessionID string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	record, err := json.Marshal(refreshSession{UserID: userID.String(), SessionID: sessionID})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal refresh session: %w", err)
+	}
+
+	key := refreshTokenKey(token)
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, key, record, refreshTokenTTL)
+	pipe.SAdd(ctx, userRefreshTokensKey(userID.String()), key)
+	pipe.Expire(ctx, userRefreshTokensKey(userID.String()), refreshTokenTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// consumeRefreshTokenScript swaps the refresh token at KEYS[1] for a used
+// marker at KEYS[2] that lives for ARGV[1] milliseconds. It returns the
+// session record and 1 when the token had already been used, or nil when the
+// token is unknown.
+var consumeRefreshTokenScript = redis.NewScript(`
+local record = redis.call('GET', KEYS[1])
+if record then
+  redis.call('DEL', KEYS[1])
+  redis.call('SET', KEYS[2], record, 'PX', ARGV[1])
+  return {record, 0}
+end
+record = redis.call('GET', KEYS[2])
+if record then
+  return {record, 1}
+end
+return false
+`)
+
+// ConsumeRefreshToken atomically removes a refresh token and returns its session.
+// Each refresh token can only be used once; callers issue a new one on success.
+// Presenting a token that was already rotated revokes the whole session, since
+// either the client or whoever copied the token is replaying it.
+func (s *SessionStore) ConsumeRefreshToken(ctx context.Context, token string) (refreshSession, error) {
+	var session refreshSession
+
+	key := refreshTokenKey(token)
+	result, err := consumeRefreshTokenScript.Run(ctx, s.rdb, []string{key, usedRefreshTokenKey(token)}, refreshTokenTTL.Milliseconds()).Slice()
+	if err == redis.Nil {
+		return session, errInvalidRefreshToken
+	}
+	if err != nil {
+		return session, fmt.Errorf("failed to read refresh token: %w", err)
+	}
+	if len(result) != 2 {
+		return session, fmt.Errorf("unexpected refresh token result: %v", result)
+	}
+
+	record, _ := result[0].(string)
+	if err := json.Unmarshal([]byte(record), &session); err != nil {
+		return session, fmt.Errorf("failed to unmarshal refresh session: %w", err)
+	}
+
+	if reused, _ := result[1].(int64); reused == 1 {
+		if err := s.RevokeSession(ctx, session.SessionID, ""); err != nil {
+			return session, err
+		}
+		return session, errRefreshTokenReused
+	}
+	s.rdb.SRem(ctx, userRefreshTokensKey(session.UserID), key)
+
+	revoked, err := s.IsSessionRevoked(ctx, session.SessionID)
+	if err != nil {
+		return session, err
+	}
+	if revoked {
+		return session, errInvalidRefreshToken
+	}
+
+	return session, nil
+}
+
+// IssueLiveTicket creates a single-use ticket standing for the given
+// identity, which expires after liveTicketTTL
+func (s *SessionStore) IssueLiveTicket(ctx context.Context, identity authIdentity) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate live ticket: %w", err)
+	}
+	ticket := hex.EncodeToString(buf)
+
+	record, err := json.Marshal(identity)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal live ticket: %w", err)
+	}
+	if err := s.rdb.Set(ctx, liveTicketKey(ticket), record, liveTicketTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store live ticket: %w", err)
+	}
+	return ticket, nil
+}
+
+// ConsumeLiveTicket atomically removes a live ticket and returns its identity
+func (s *SessionStore) ConsumeLiveTicket(ctx context.Context, ticket string) (authIdentity, error) {
+	var identity authIdentity
+
+	record, err := s.rdb.GetDel(ctx, liveTicketKey(ticket)).Result()
+	if err == redis.Nil {
+		return identity, errInvalidLiveTicket
+	}
+	if err != nil {
+		return identity, fmt.Errorf("failed to read live ticket: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(record), &identity); err != nil {
+		return identity, fmt.Errorf("failed to unmarshal live ticket: %w", err)
+	}
+	return identity, nil
+}
+
+// RevokeSession adds a session to the revocation list and drops the given refresh token
+func (s *SessionStore) RevokeSession(ctx context.Context, sessionID, refreshToken string) error {
+	pipe := s.rdb.TxPipeline()
+	// Keep the entry for as long as any refresh token of the session could still exist
+	pipe.Set(ctx, revokedSessionKey(sessionID), 1, refreshTokenTTL)
+	if refreshToken != "" {
+		pipe.Del(ctx, refreshTokenKey(refreshToken))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeUser revokes every access token issued to a user so far and deletes
+// all of their refresh tokens
+func (s *SessionStore) RevokeUser(ctx context.Context, userID string) error {
+	keys, err := s.rdb.SMembers(ctx, userRefreshTokensKey(userID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list refresh tokens: %w", err)
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, revokedUserKey(userID), time.Now().Unix(), accessTokenTTL)
+	if len(keys) > 0 {
+		pipe.Del(ctx, keys...)
+	}
+	pipe.Del(ctx, userRefreshTokensKey(userID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke user sessions: %w", err)
+	}
+	return nil
+}
+
+// IsSessionRevoked reports whether a session has been logged out
+func (s *SessionStore) IsSessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	n, err := s.rdb.Exists(ctx, revokedSessionKey(sessionID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check session revocation: %w", err)
+	}
+	return n > 0, nil
+}
+
+// IsTokenRevoked reports whether an access token was revoked, either through
+// its session or because all of the user's tokens were revoked after issuedAt
+func (s *SessionStore) IsTokenRevoked(ctx context.Context, userID, sessionID string, issuedAt int64) (bool, error) {
+	revoked, err := s.IsSessionRevoked(ctx, sessionID)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	value, err := s.rdb.Get(ctx, revokedUserKey(userID)).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check user revocation: %w", err)
+	}
+
+	revokedAt, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid user revocation timestamp: %w", err)
+	}
+	return issuedAt <= revokedAt, nil
+}
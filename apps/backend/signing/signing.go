@@ -0,0 +1,308 @@
+// Package signing issues and verifies the tokens encoded in invitee QR codes.
+//
+// A token has the form "<version>.<payload>.<signature>", where payload is the
+// base64url encoded JSON claims and signature is made over
+// "<version>.<payload>" with the key named by the claims' kid:
+//
+//   - v1 tokens carry an HMAC-SHA256 signature and need the shared secret to verify
+//   - v2 tokens carry an Ed25519 signature and can be verified offline with the
+//     public key alone
+//
+// Several keys can be configured at once so a new key can be rolled out while
+// badges signed with the previous one stay valid.
+//
+// Tokens for other purposes, such as RSVP links, name it in their "pur"
+// claim and are always HMAC signed, so they never pass an offline scanner
+// and Verify rejects them as QR tokens.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Token format versions
+const (
+	VersionHMAC    = "v1"
+	VersionEd25519 = "v2"
+)
+
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrWrongPurpose     = errors.New("token issued for another purpose")
+)
+
+// PurposeRSVP marks tokens of the links invitees answer invitations with
+const PurposeRSVP = "rsvp"
+
+// Claims are the values embedded in a QR token
+type Claims struct {
+	KeyID     string `json:"kid"`
+	EventID   int32  `json:"eid"`
+	InviteeID int32  `json:"iid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	Purpose   string `json:"pur,omitempty"`
+	// Nonce makes every token unique, so a token reissued within the same
+	// second differs from the one it replaces
+	Nonce string `json:"jti,omitempty"`
+}
+
+// Keyring holds the keys tokens can be verified with and the active key new
+// tokens are signed with. Once Ed25519 keys are added new tokens are signed
+// with the active Ed25519 key; HMAC tokens are still accepted.
+type Keyring struct {
+	activeKeyID string
+	keys        map[string][]byte
+
+	activeEd25519KeyID string
+	ed25519Keys        map[string]ed25519.PrivateKey
+}
+
+// PublicKey is an Ed25519 key scanners can verify v2 tokens with
+type PublicKey struct {
+	KeyID string
+	Key   ed25519.PublicKey
+}
+
+// NewKeyring creates a keyring that signs with activeKeyID and verifies with any of keys
+func NewKeyring(activeKeyID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("active signing key %q is not configured", activeKeyID)
+	}
+	for id, key := range keys {
+		if !validKeyID(id) {
+			return nil, fmt.Errorf("invalid signing key ID %q", id)
+		}
+		if len(key) == 0 {
+			return nil, fmt.Errorf("signing key %q is empty", id)
+		}
+	}
+	return &Keyring{activeKeyID: activeKeyID, keys: keys}, nil
+}
+
+// SetEd25519Keys switches signing to Ed25519 with activeKeyID. Key IDs must
+// not clash with the HMAC key IDs.
+func (k *Keyring) SetEd25519Keys(activeKeyID string, keys map[string]ed25519.PrivateKey) error {
+	if _, ok := keys[activeKeyID]; !ok {
+		return fmt.Errorf("active Ed25519 key %q is not configured", activeKeyID)
+	}
+	for id, key := range keys {
+		if !validKeyID(id) {
+			return fmt.Errorf("invalid signing key ID %q", id)
+		}
+		if _, clash := k.keys[id]; clash {
+			return fmt.Errorf("signing key ID %q is used by both an HMAC and an Ed25519 key", id)
+		}
+		if len(key) != ed25519.PrivateKeySize {
+			return fmt.Errorf("Ed25519 key %q has invalid length", id)
+		}
+	}
+	k.activeEd25519KeyID = activeKeyID
+	k.ed25519Keys = keys
+	return nil
+}
+
+func validKeyID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, ".,:")
+}
+
+// ParseKeys parses a comma separated list of "kid:secret" pairs
+func ParseKeys(spec string) (map[string][]byte, error) {
+	keys := map[string][]byte{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("signing key entry %q is not in kid:secret form", entry)
+		}
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("duplicate signing key ID %q", id)
+		}
+		keys[id] = []byte(secret)
+	}
+	return keys, nil
+}
+
+// ParseEd25519Keys parses a comma separated list of "kid:seed" pairs where
+// seed is a base64 encoded 32 byte Ed25519 private key seed
+func ParseEd25519Keys(spec string) (map[string]ed25519.PrivateKey, error) {
+	seeds, err := ParseKeys(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]ed25519.PrivateKey, len(seeds))
+	for id, encoded := range seeds {
+		seed, err := base64.StdEncoding.DecodeString(string(encoded))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("Ed25519 key %q must be a base64 encoded %d byte seed", id, ed25519.SeedSize)
+		}
+		keys[id] = ed25519.NewKeyFromSeed(seed)
+	}
+	return keys, nil
+}
+
+// ActiveKeyID returns the ID of the key new tokens are signed with
+func (k *Keyring) ActiveKeyID() string {
+	if k.activeEd25519KeyID != "" {
+		return k.activeEd25519KeyID
+	}
+	return k.activeKeyID
+}
+
+// PublicKeys returns the Ed25519 public keys, sorted by key ID
+func (k *Keyring) PublicKeys() []PublicKey {
+	publicKeys := make([]PublicKey, 0, len(k.ed25519Keys))
+	for id, key := range k.ed25519Keys {
+		publicKeys = append(publicKeys, PublicKey{KeyID: id, Key: key.Public().(ed25519.PublicKey)})
+	}
+	sort.Slice(publicKeys, func(i, j int) bool { return publicKeys[i].KeyID < publicKeys[j].KeyID })
+	return publicKeys
+}
+
+// Sign issues a token for the invitee using the active key
+func (k *Keyring) Sign(eventID, inviteeID int32, issuedAt, expiresAt time.Time) (string, Claims, error) {
+	return k.sign("", eventID, inviteeID, issuedAt, expiresAt)
+}
+
+// SignFor issues a token for the invitee for another purpose than a QR code,
+// signed with the active HMAC key
+func (k *Keyring) SignFor(purpose string, eventID, inviteeID int32, issuedAt, expiresAt time.Time) (string, Claims, error) {
+	if purpose == "" {
+		return "", Claims{}, fmt.Errorf("token purpose is empty")
+	}
+	return k.sign(purpose, eventID, inviteeID, issuedAt, expiresAt)
+}
+
+func (k *Keyring) sign(purpose string, eventID, inviteeID int32, issuedAt, expiresAt time.Time) (string, Claims, error) {
+	useEd25519 := k.activeEd25519KeyID != "" && purpose == ""
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", Claims{}, fmt.Errorf("failed to generate token nonce: %w", err)
+	}
+	claims := Claims{
+		KeyID:     k.activeKeyID,
+		EventID:   eventID,
+		InviteeID: inviteeID,
+		IssuedAt:  issuedAt.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+		Purpose:   purpose,
+		Nonce:     base64.RawURLEncoding.EncodeToString(nonce),
+	}
+	if useEd25519 {
+		claims.KeyID = k.activeEd25519KeyID
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", Claims{}, fmt.Errorf("failed to marshal token claims: %w", err)
+	}
+
+	var signed string
+	var signature []byte
+	if useEd25519 {
+		signed = VersionEd25519 + "." + base64.RawURLEncoding.EncodeToString(payload)
+		signature = ed25519.Sign(k.ed25519Keys[k.activeEd25519KeyID], []byte(signed))
+	} else {
+		signed = VersionHMAC + "." + base64.RawURLEncoding.EncodeToString(payload)
+		signature = k.mac(k.keys[k.activeKeyID], signed)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), claims, nil
+}
+
+// Verify checks the QR token's signature and expiry and returns its claims
+func (k *Keyring) Verify(token string, now time.Time) (Claims, error) {
+	return k.verify(token, "", now)
+}
+
+// VerifyFor checks a token issued with SignFor for the purpose
+func (k *Keyring) VerifyFor(token, purpose string, now time.Time) (Claims, error) {
+	if purpose == "" {
+		return Claims{}, ErrWrongPurpose
+	}
+	return k.verify(token, purpose, now)
+}
+
+func (k *Keyring) verify(token, purpose string, now time.Time) (Claims, error) {
+	var claims Claims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || (parts[0] != VersionHMAC && parts[0] != VersionEd25519) {
+		return claims, ErrMalformedToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, ErrMalformedToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrMalformedToken
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Claims{}, ErrMalformedToken
+	}
+
+	signed := parts[0] + "." + parts[1]
+	if claims.Purpose != purpose || (purpose != "" && parts[0] != VersionHMAC) {
+		return Claims{}, ErrWrongPurpose
+	}
+
+	if parts[0] == VersionEd25519 {
+		key, ok := k.ed25519Keys[claims.KeyID]
+		if !ok {
+			return Claims{}, ErrUnknownKey
+		}
+		if !ed25519.Verify(key.Public().(ed25519.PublicKey), []byte(signed), signature) {
+			return Claims{}, ErrInvalidSignature
+		}
+	} else {
+		key, ok := k.keys[claims.KeyID]
+		if !ok {
+			return Claims{}, ErrUnknownKey
+		}
+		if !hmac.Equal(signature, k.mac(key, signed)) {
+			return Claims{}, ErrInvalidSignature
+		}
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, ErrTokenExpired
+	}
+
+	return claims, nil
+}
+
+// SignDocument signs arbitrary data, such as an offline scan manifest, with
+// the active key. The returned algorithm is "Ed25519" when Ed25519 keys are
+// configured, so devices can check it with a published public key, and
+// "HS256" otherwise.
+func (k *Keyring) SignDocument(data []byte) (keyID, algorithm string, signature []byte) {
+	if k.activeEd25519KeyID != "" {
+		return k.activeEd25519KeyID, "Ed25519", ed25519.Sign(k.ed25519Keys[k.activeEd25519KeyID], data)
+	}
+	return k.activeKeyID, "HS256", k.mac(k.keys[k.activeKeyID], string(data))
+}
+
+func (k *Keyring) mac(key []byte, signed string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
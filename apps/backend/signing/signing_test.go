@@ -0,0 +1,167 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyRotation(t *testing.T) {
+	now := time.Now()
+
+	old, err := NewKeyring("k1", map[string][]byte{"k1": []byte("first")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := old.Sign(7, 42, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := NewKeyring("k2", map[string][]byte{"k1": []byte("first"), "k2": []byte("second")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := rotated.Verify(token, now)
+	if err != nil {
+		t.Fatalf("token signed with the previous key should verify: %v", err)
+	}
+	if claims.KeyID != "k1" || claims.EventID != 7 || claims.InviteeID != 42 {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	retired, err := NewKeyring("k2", map[string][]byte{"k2": []byte("second")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retired.Verify(token, now); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("got %v want %v", err, ErrUnknownKey)
+	}
+	if _, err := rotated.Verify(token, now.Add(2*time.Hour)); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got %v want %v", err, ErrTokenExpired)
+	}
+
+	forger, err := NewKeyring("k2", map[string][]byte{"k2": []byte("guessed")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, _, err := forger.Sign(7, 42, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotated.Verify(forged, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("got %v want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestEd25519Token(t *testing.T) {
+	now := time.Now()
+
+	keyring, err := NewKeyring("h1", map[string][]byte{"h1": []byte("shared")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacToken, _, err := keyring.Sign(7, 42, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ParseEd25519Keys("e1:" + base64.StdEncoding.EncodeToString(make([]byte, ed25519.SeedSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetEd25519Keys("e1", keys); err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := keyring.Sign(7, 43, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, VersionEd25519+".") {
+		t.Fatalf("expected a %s token, got %s", VersionEd25519, token)
+	}
+
+	// A scanner only holding the published public key can check the signature
+	parts := strings.Split(token, ".")
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeys := keyring.PublicKeys()
+	if len(publicKeys) != 1 || !ed25519.Verify(publicKeys[0].Key, []byte(parts[0]+"."+parts[1]), signature) {
+		t.Error("token does not verify with the published public key")
+	}
+
+	for _, tt := range []string{hmacToken, token} {
+		if _, err := keyring.Verify(tt, now); err != nil {
+			t.Errorf("verify %s: %v", tt, err)
+		}
+	}
+}
+
+func TestPurposeToken(t *testing.T) {
+	now := time.Now()
+
+	keyring, err := NewKeyring("h1", map[string][]byte{"h1": []byte("shared")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ParseEd25519Keys("e1:" + base64.StdEncoding.EncodeToString(make([]byte, ed25519.SeedSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetEd25519Keys("e1", keys); err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := keyring.SignFor(PurposeRSVP, 7, 42, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the server can check it, even with Ed25519 keys configured
+	if !strings.HasPrefix(token, VersionHMAC+".") {
+		t.Fatalf("expected a %s token, got %s", VersionHMAC, token)
+	}
+	claims, err := keyring.VerifyFor(token, PurposeRSVP, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.KeyID != "h1" || claims.EventID != 7 || claims.InviteeID != 42 {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	// It is not a QR token and a QR token is not an RSVP token
+	if _, err := keyring.Verify(token, now); !errors.Is(err, ErrWrongPurpose) {
+		t.Errorf("got %v want %v", err, ErrWrongPurpose)
+	}
+	qrToken, _, err := keyring.Sign(7, 42, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyring.VerifyFor(qrToken, PurposeRSVP, now); !errors.Is(err, ErrWrongPurpose) {
+		t.Errorf("got %v want %v", err, ErrWrongPurpose)
+	}
+}
+
+func TestReissuedTokensDiffer(t *testing.T) {
+	now := time.Now()
+	keys, err := NewKeyring("k1", map[string][]byte{"k1": []byte("first")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _, err := keys.Sign(7, 42, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := keys.Sign(7, 42, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Error("tokens issued in the same second are identical")
+	}
+}
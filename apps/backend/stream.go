@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// sseHeartbeatInterval keeps idle proxies from closing the stream
+	sseHeartbeatInterval = 15 * time.Second
+	// sseRetry is the reconnect delay suggested to clients, in milliseconds
+	sseRetry = 3000
+)
+
+// StreamEvent streams the event's live messages as Server-Sent Events for
+// networks that block WebSocket upgrades. Browsers authenticate with a ticket
+// from CreateLiveTicket. Each message is sent with its
+// type as the SSE event name and its ID, so a reconnecting client resumes
+// from the Last-Event-ID header (or the last_event_id query parameter). A
+// "reset" event tells the client the ID has left the replay buffer and it
+// should reload the current state. A "revoked" event is sent before the
+// stream closes because the session was revoked.
+func (api *API) StreamEvent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+
+	// Subscribe before replaying so nothing published in between is lost
+	sub := api.live.subscribe()
+	defer api.live.unsubscribe(sub)
+	api.live.setEvents(sub, []int32{int32(eventID)}, true)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry)
+
+	if lastID != "" {
+		messages, ok, err := api.live.Replay(ctx, int32(eventID), lastID)
+		switch {
+		case err != nil:
+			LogError(ctx, "Failed to replay live messages", err)
+			writeSSE(w, "", "reset", []byte(`{}`))
+		case !ok:
+			writeSSE(w, "", "reset", []byte(`{}`))
+		default:
+			for _, msg := range messages {
+				payload, _ := json.Marshal(msg)
+				writeSSE(w, msg.ID, msg.Type, payload)
+				lastID = msg.ID
+			}
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	auth := time.NewTicker(liveAuthInterval)
+	defer auth.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload := <-sub.send:
+			var msg liveMessage
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				continue
+			}
+			if msg.ID != "" {
+				// Already sent during replay
+				if lastID != "" && !liveIDAfter(msg.ID, lastID) {
+					continue
+				}
+				lastID = msg.ID
+			}
+			writeSSE(w, msg.ID, msg.Type, payload)
+		case <-heartbeat.C:
+			io.WriteString(w, ": heartbeat\n\n")
+		case <-auth.C:
+			if !api.stillAuthorized(ctx) {
+				writeSSE(w, "", "revoked", []byte(`{}`))
+				rc.Flush()
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeSSE writes one Server-Sent Event. data must not contain newlines,
+// which holds for encoded JSON.
+func writeSSE(w io.Writer, id, event string, data []byte) {
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
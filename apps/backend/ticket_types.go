@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"eventpass.pro/apps/backend/db"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// currencyPattern matches ISO 4217 currency codes
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+type ticketTypeRequest struct {
+	Name        string     `json:"name"`
+	Price       int64      `json:"price"`
+	Currency    string     `json:"currency"`
+	Quantity    int32      `json:"quantity"`
+	SalesStart  *time.Time `json:"sales_start"`
+	SalesEnd    *time.Time `json:"sales_end"`
+	MaxPerOrder int32      `json:"max_per_order"`
+}
+
+// validate normalizes the request and returns why it is invalid, or ""
+func (request *ticketTypeRequest) validate() string {
+	request.Name = strings.TrimSpace(request.Name)
+	request.Currency = strings.ToUpper(strings.TrimSpace(request.Currency))
+	if request.MaxPerOrder == 0 {
+		request.MaxPerOrder = maxTicketsPerOrder
+	}
+
+	switch {
+	case request.Name == "" || len(request.Name) > 64:
+		return "Invalid ticket type name"
+	case request.Price < 0:
+		return "Price must not be negative"
+	case !currencyPattern.MatchString(request.Currency):
+		return "Currency must be a three letter ISO 4217 code"
+	case request.Quantity < 0:
+		return "Quantity must not be negative"
+	case request.MaxPerOrder < 0 || request.MaxPerOrder > maxTicketsPerOrder:
+		return "max_per_order must be between 1 and " + strconv.Itoa(maxTicketsPerOrder)
+	case request.SalesStart != nil && request.SalesEnd != nil && !request.SalesEnd.After(*request.SalesStart):
+		return "sales_end must be after sales_start"
+	}
+	return ""
+}
+
+func optionalTime(t *time.Time) pgtype.Timestamptz {
+	if t == nil {
+		return pgtype.Timestamptz{}
+	}
+	return pgtype.Timestamptz{Time: *t, Valid: true}
+}
+
+// ticketTypeOnSale reports whether the type's sales window includes now
+func ticketTypeOnSale(ticketType db.TicketType, now time.Time) bool {
+	if ticketType.SalesStart.Valid && ticketType.SalesStart.Time.After(now) {
+		return false
+	}
+	if ticketType.SalesEnd.Valid && !ticketType.SalesEnd.Time.After(now) {
+		return false
+	}
+	return true
+}
+
+// ticketTypeResponse is a ticket type with the tickets still available
+type ticketTypeResponse struct {
+	db.TicketType
+	Available int32 `json:"available"`
+	OnSale    bool  `json:"on_sale"`
+}
+
+func newTicketTypeResponse(ticketType db.TicketType) ticketTypeResponse {
+	return ticketTypeResponse{
+		TicketType: ticketType,
+		Available:  max(ticketType.Quantity-ticketType.Reserved, 0),
+		OnSale:     ticketTypeOnSale(ticketType, time.Now()),
+	}
+}
+
+// ListTicketTypes returns the ticket types sold for an event. Buyers need
+// them to place orders, so any authenticated user may list them.
+func (api *API) ListTicketTypes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	ticketTypes, err := api.db.ListTicketTypesByEvent(r.Context(), int32(eventID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]ticketTypeResponse, 0, len(ticketTypes))
+	for _, ticketType := range ticketTypes {
+		response = append(response, newTicketTypeResponse(ticketType))
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreateTicketType adds a kind of ticket to an event, with its price in
+// minor units, the number for sale, an optional sales window and a limit
+// per order
+func (api *API) CreateTicketType(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	var request ticketTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if message := request.validate(); message != "" {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	ticketType, err := api.db.CreateTicketType(r.Context(), db.CreateTicketTypeParams{
+		EventID:     int32(eventID),
+		Name:        request.Name,
+		Price:       request.Price,
+		Currency:    request.Currency,
+		Quantity:    request.Quantity,
+		SalesStart:  optionalTime(request.SalesStart),
+		SalesEnd:    optionalTime(request.SalesEnd),
+		MaxPerOrder: request.MaxPerOrder,
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		http.Error(w, "Ticket type already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newTicketTypeResponse(ticketType))
+}
+
+// UpdateTicketType replaces a ticket type's settings. Orders already placed
+// keep the price they were placed at, and the quantity cannot drop below the
+// tickets already reserved.
+func (api *API) UpdateTicketType(w http.ResponseWriter, r *http.Request) {
+	ticketType, ok := api.ticketTypeForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var request ticketTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if message := request.validate(); message != "" {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	updated, err := api.db.UpdateTicketType(r.Context(), db.UpdateTicketTypeParams{
+		ID:          ticketType.ID,
+		Name:        request.Name,
+		Price:       request.Price,
+		Currency:    request.Currency,
+		Quantity:    request.Quantity,
+		SalesStart:  optionalTime(request.SalesStart),
+		SalesEnd:    optionalTime(request.SalesEnd),
+		MaxPerOrder: request.MaxPerOrder,
+	})
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Quantity is below the tickets already reserved", http.StatusConflict)
+		return
+	}
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		http.Error(w, "Ticket type already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newTicketTypeResponse(updated))
+}
+
+// DeleteTicketType removes a ticket type that has never been ordered
+func (api *API) DeleteTicketType(w http.ResponseWriter, r *http.Request) {
+	ticketType, ok := api.ticketTypeForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := api.db.DeleteTicketType(r.Context(), ticketType.ID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		http.Error(w, "Ticket type has orders, set its quantity to stop sales instead", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ticketTypeForRequest loads the ticket type named by the id route variable
+// and checks access to its event, writing the error response itself
+func (api *API) ticketTypeForRequest(w http.ResponseWriter, r *http.Request) (db.TicketType, bool) {
+	vars := mux.Vars(r)
+	ticketTypeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid ticket type ID", http.StatusBadRequest)
+		return db.TicketType{}, false
+	}
+
+	ticketType, err := api.db.GetTicketType(r.Context(), int32(ticketTypeID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Ticket type not found", http.StatusNotFound)
+		return db.TicketType{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.TicketType{}, false
+	}
+
+	if !api.checkEventAccess(w, r, ticketType.EventID) {
+		return db.TicketType{}, false
+	}
+	return ticketType, true
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"eventpass.pro/apps/backend/db"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Invitee statuses of tickets taken back from their holder
+const (
+	inviteeCancelled = "cancelled"
+	inviteeRefunded  = "refunded"
+)
+
+// Actions recorded in ticket_changes
+const (
+	ticketCancelled   = "cancelled"
+	ticketTransferred = "transferred"
+	ticketRefunded    = "refunded"
+)
+
+var errInviteeCancelled = errors.New("ticket was cancelled")
+
+// isTicketCancelled reports whether the invitee's ticket was cancelled or
+// refunded, which revokes its QR code
+func isTicketCancelled(invitee db.Invitee) bool {
+	return invitee.Status == inviteeCancelled || invitee.Status == inviteeRefunded
+}
+
+type ticketChangeResponse struct {
+	Invitee db.Invitee      `json:"invitee"`
+	Change  db.TicketChange `json:"change"`
+}
+
+// CancelTicket revokes an invitee's ticket: its signature is dropped so the
+// QR code is rejected at the door and by offline scanners. The seats an
+// invited guest held with their plus-ones go to the event's waitlist. A sold
+// ticket keeps its seat reserved for the order, refund the ticket to return
+// it to sale.
+func (api *API) CancelTicket(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	invitee, user, ok := api.ticketForRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := decodeOptionalBody(r, &request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var cancelled db.Invitee
+	var change db.TicketChange
+	err := api.inTx(ctx, func(q db.Querier) error {
+		var err error
+		cancelled, err = q.CancelInvitee(ctx, invitee.ID)
+		if err != nil {
+			return err
+		}
+		change, err = q.CreateTicketChange(ctx, db.CreateTicketChangeParams{
+			InviteeID: cancelled.ID,
+			EventID:   cancelled.EventID,
+			Action:    ticketCancelled,
+			Reason:    optionalText(strings.TrimSpace(request.Reason)),
+			UserID:    user.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record ticket cancellation: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Ticket is already cancelled or refunded", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	api.publishInviteeState(ctx, cancelled)
+	if seats := rsvpSeats(invitee); seats > 0 {
+		api.promoteWaitlist(ctx, cancelled.EventID, seats)
+	}
+
+	json.NewEncoder(w).Encode(ticketChangeResponse{Invitee: cancelled, Change: change})
+}
+
+// TransferTicket hands an unused ticket to a new holder. The invitee keeps
+// its ID, order and perks but gets the new email and names and a freshly
+// signed QR code; the previous holder's QR code stops working and they are
+// kept in the ticket's history. The buyer of the ticket's order may transfer
+// it too.
+func (api *API) TransferTicket(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	invitee, user, ok := api.ticketForRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Email     string `json:"email"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	request.Email = strings.TrimSpace(request.Email)
+	request.FirstName = strings.TrimSpace(request.FirstName)
+	request.LastName = strings.TrimSpace(request.LastName)
+	if !isValidEmail(request.Email) {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if len(request.FirstName) > maxInviteeTextLength || len(request.LastName) > maxInviteeTextLength {
+		http.Error(w, fmt.Sprintf("Names are limited to %d characters", maxInviteeTextLength), http.StatusBadRequest)
+		return
+	}
+	if strings.EqualFold(request.Email, invitee.Email) {
+		http.Error(w, "Ticket already belongs to this email", http.StatusBadRequest)
+		return
+	}
+
+	var transferred db.Invitee
+	var change db.TicketChange
+	err := api.inTx(ctx, func(q db.Querier) error {
+		var err error
+		transferred, err = q.TransferInvitee(ctx, db.TransferInviteeParams{
+			ID:        invitee.ID,
+			Email:     request.Email,
+			FirstName: optionalText(request.FirstName),
+			LastName:  optionalText(request.LastName),
+		})
+		if err != nil {
+			return err
+		}
+		change, err = q.CreateTicketChange(ctx, db.CreateTicketChangeParams{
+			InviteeID:         transferred.ID,
+			EventID:           transferred.EventID,
+			Action:            ticketTransferred,
+			PreviousEmail:     pgtype.Text{String: invitee.Email, Valid: true},
+			PreviousFirstName: invitee.FirstName,
+			PreviousLastName:  invitee.LastName,
+			NewEmail:          pgtype.Text{String: transferred.Email, Valid: true},
+			Reason:            optionalText(strings.TrimSpace(request.Reason)),
+			UserID:            user.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record ticket transfer: %w", err)
+		}
+		return nil
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		http.Error(w, fmt.Sprintf("%s is already invited", request.Email), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Only unused, active tickets can be transferred", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	reissued, err := api.issueQRCode(ctx, transferred.ID)
+	if err != nil {
+		LogError(ctx, "Failed to issue transferred ticket", err)
+		http.Error(w, "Ticket transferred but its QR code could not be issued, reprint it", http.StatusInternalServerError)
+		return
+	}
+	api.publishInviteeState(ctx, reissued)
+	api.sendTicketTransferred(ctx, reissued)
+
+	json.NewEncoder(w).Encode(ticketChangeResponse{Invitee: reissued, Change: change})
+}
+
+// sendTicketTransferred tells the new holder that a ticket is theirs
+func (api *API) sendTicketTransferred(ctx context.Context, invitee db.Invitee) {
+	event, err := api.db.GetEvent(ctx, invitee.EventID)
+	if err != nil {
+		LogError(ctx, "Failed to get event for transfer notification", err)
+		return
+	}
+
+	subject := fmt.Sprintf("Your ticket for %s", event.Name)
+	message := fmt.Sprintf(`
+Hello!
+
+A ticket for %s has been transferred to you.
+
+Event: %s
+Start Time: %s
+Location: %s
+
+Your QR code for check-in: %s
+
+Best regards,
+EventPass Pro Team
+`, event.Name, event.Name, event.Date.Time.Format("2006-01-02 15:04"), event.Location, invitee.QrCodeUrl.String)
+
+	api.SendEventNotification(ctx, invitee.EventID, "email", invitee.Email, subject, message)
+}
+
+// RefundTicket takes back an unused ticket bought in an order: its QR code
+// is revoked, its seat returns to the event and its ticket type, and the
+// price paid for it is refunded to the buyer's payment. When the payment
+// refund fails the ticket stays refunded and refunding again retries it.
+func (api *API) RefundTicket(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	invitee, user, ok := api.ticketForRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := decodeOptionalBody(r, &request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !invitee.OrderID.Valid {
+		http.Error(w, "Only tickets bought in an order can be refunded", http.StatusBadRequest)
+		return
+	}
+	order, err := api.db.GetOrder(ctx, invitee.OrderID.Int32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if order.Status != orderPaid && order.Status != orderConfirmed {
+		http.Error(w, fmt.Sprintf("Order is %s", order.Status), http.StatusConflict)
+		return
+	}
+
+	changes, err := api.db.ListTicketChanges(ctx, invitee.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, change := range changes {
+		if change.Action == ticketRefunded {
+			http.Error(w, "Ticket is already refunded", http.StatusConflict)
+			return
+		}
+	}
+
+	amount, currency, err := api.ticketPrice(ctx, invitee, order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var payment db.Payment
+	if amount > 0 {
+		if api.payments == nil {
+			http.Error(w, "Payments are not configured", http.StatusServiceUnavailable)
+			return
+		}
+		payment, err = api.db.GetCapturedPaymentByOrder(ctx, order.ID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Order has no captured payment to refund", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// A ticket already marked refunded is a retry of a failed payment refund
+	if invitee.Status != inviteeRefunded {
+		refunded, err := api.db.RefundInvitee(ctx, invitee.ID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Only unused tickets can be refunded", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		invitee = refunded
+		api.publishInviteeState(ctx, invitee)
+		api.promoteWaitlist(ctx, invitee.EventID, 1)
+	}
+
+	if amount > 0 {
+		err := api.payments.Refund(ctx, PaymentRefundRequest{
+			IntentID:       payment.IntentID,
+			Amount:         amount,
+			IdempotencyKey: fmt.Sprintf("refund-invitee-%d", invitee.ID),
+		})
+		if err != nil {
+			LogError(ctx, "Failed to refund ticket payment", err)
+			http.Error(w, "Ticket refunded but the payment refund failed, refund again to retry", http.StatusBadGateway)
+			return
+		}
+	}
+
+	// The provider deduplicates the refund by its idempotency key; recording
+	// it is conditional so a concurrent retry does not count it twice
+	var paymentID pgtype.Int4
+	if amount > 0 {
+		paymentID = pgtype.Int4{Int32: payment.ID, Valid: true}
+	}
+	change, err := api.db.RecordTicketRefund(ctx, db.RecordTicketRefundParams{
+		InviteeID: invitee.ID,
+		EventID:   invitee.EventID,
+		Amount:    amount,
+		Currency:  currency,
+		Reason:    optionalText(strings.TrimSpace(request.Reason)),
+		UserID:    user.ID,
+		PaymentID: paymentID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Ticket is already refunded", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		LogError(ctx, "Failed to record ticket refund", err)
+	}
+
+	json.NewEncoder(w).Encode(ticketChangeResponse{Invitee: invitee, Change: change})
+}
+
+// ticketPrice returns what the buyer paid for the invitee's ticket: the unit
+// price of its ticket type in the order, or nothing for events without types
+func (api *API) ticketPrice(ctx context.Context, invitee db.Invitee, order db.Order) (int64, pgtype.Text, error) {
+	ticket, err := api.db.GetOrderTicketByInvitee(ctx, pgtype.Int4{Int32: invitee.ID, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, pgtype.Text{}, nil
+	}
+	if err != nil || !ticket.TicketTypeID.Valid {
+		return 0, pgtype.Text{}, err
+	}
+
+	items, err := api.db.ListOrderItems(ctx, order.ID)
+	if err != nil {
+		return 0, pgtype.Text{}, err
+	}
+	for _, item := range items {
+		if item.TicketTypeID == ticket.TicketTypeID.Int32 {
+			return item.UnitPrice, pgtype.Text{String: item.Currency, Valid: true}, nil
+		}
+	}
+	return 0, pgtype.Text{}, nil
+}
+
+// ListTicketChanges returns the cancellations, transfers and refunds of an
+// invitee's ticket, oldest first
+func (api *API) ListTicketChanges(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	inviteeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invitee ID", http.StatusBadRequest)
+		return
+	}
+
+	invitee, err := api.db.GetInvitee(r.Context(), int32(inviteeID))
+	if err != nil {
+		http.Error(w, "Invitee not found", http.StatusNotFound)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, invitee.EventID) {
+		return
+	}
+
+	changes, err := api.db.ListTicketChanges(r.Context(), invitee.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(changes)
+}
+
+// ticketForRequest loads the invitee named by the id route variable for a
+// change to its ticket, writing the error response itself. Admins and the
+// event's organizers may change tickets; with buyerAllowed so may the user
+// who bought the ticket in an order.
+func (api *API) ticketForRequest(w http.ResponseWriter, r *http.Request, buyerAllowed bool) (db.Invitee, db.User, bool) {
+	ctx := r.Context()
+	user, ok := userFromContext(ctx)
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return db.Invitee{}, db.User{}, false
+	}
+
+	vars := mux.Vars(r)
+	inviteeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invitee ID", http.StatusBadRequest)
+		return db.Invitee{}, db.User{}, false
+	}
+
+	invitee, err := api.db.GetInvitee(ctx, int32(inviteeID))
+	if err != nil {
+		http.Error(w, "Invitee not found", http.StatusNotFound)
+		return db.Invitee{}, db.User{}, false
+	}
+
+	if buyerAllowed && invitee.OrderID.Valid {
+		order, err := api.db.GetOrder(ctx, invitee.OrderID.Int32)
+		if err == nil && order.UserID == user.ID {
+			return invitee, user, true
+		}
+	}
+
+	if user.Role != RoleAdmin && user.Role != RoleOrganizer {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return db.Invitee{}, db.User{}, false
+	}
+	if !api.checkEventAccess(w, r, invitee.EventID) {
+		return db.Invitee{}, db.User{}, false
+	}
+	return invitee, user, true
+}
+
+// decodeOptionalBody decodes a JSON body into v, accepting an empty body
+func decodeOptionalBody(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
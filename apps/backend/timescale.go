@@ -1,27 +1,153 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// createContinuousAggregates sets up TimescaleDB continuous aggregates for analytics
-// This function can be called during system initialization to set up materialized views
-// for efficient querying of time-series check-in data
-//
-// Usage: createContinuousAggregates(pool)
-// createContinuousAggregates sets up TimescaleDB continuous aggregates for analytics
-// This function can be called during system initialization to set up materialized views
-// for efficient querying of time-series check-in data
-//
-// To use this function, call it after database connection is established:
-//   createContinuousAggregates(pool)
-//
-// The function creates:
-// - hourly_check_ins: Materialized view for hourly check-in aggregation
-// - daily_check_ins: Materialized view for daily check-in aggregation
-// - Associated refresh policies for automatic updates
-func createContinuousAggregates() {
-	// For now, skip TimescaleDB initialization to avoid connection issues
-	// This can be re-enabled once the database schema is properly set up
-	log.Printf("Info: Skipping TimescaleDB initialization for now")
+// enableTimescale installs the TimescaleDB extension if the server provides it
+// and reports whether it is available. Without it the check-in aggregates are
+// not created and analytics fall back to plain Postgres queries.
+func enableTimescale(pool *pgxpool.Pool) bool {
+	if _, err := pool.Exec(context.Background(), "CREATE EXTENSION IF NOT EXISTS timescaledb"); err != nil {
+		log.Printf("TimescaleDB is not available, using plain Postgres analytics: %v", err)
+		return false
+	}
+
+	log.Printf("TimescaleDB extension enabled")
+	return true
+}
+
+// checkInBucket is the number of scans at one gate in one time bucket
+type checkInBucket struct {
+	Bucket   time.Time
+	Gate     string
+	Admitted int64
+	Scans    int64
+}
+
+// checkInBucketSource loads per-gate check-in counts for an event
+type checkInBucketSource interface {
+	CheckInBuckets(ctx context.Context, eventID int32, bucket time.Duration) ([]checkInBucket, error)
+	Source() string
+}
+
+// checkInAnalytics reads check-in counts from the continuous aggregates
+// created by migration 000022 when TimescaleDB is available, and buckets the
+// raw check_ins rows with date_trunc otherwise
+type checkInAnalytics struct {
+	pool      *pgxpool.Pool
+	timescale bool
+}
+
+func newCheckInAnalytics(pool *pgxpool.Pool, timescale bool) *checkInAnalytics {
+	return &checkInAnalytics{pool: pool, timescale: timescale}
+}
+
+// Source names the backend the counts come from
+func (a *checkInAnalytics) Source() string {
+	if a.timescale {
+		return "timescaledb"
+	}
+	return "postgres"
+}
+
+// CheckInBuckets returns the event's scan counts per gate, ordered by bucket
+func (a *checkInAnalytics) CheckInBuckets(ctx context.Context, eventID int32, bucket time.Duration) ([]checkInBucket, error) {
+	if !a.timescale {
+		return a.fallbackBuckets(ctx, eventID, bucket)
+	}
+
+	var query string
+	args := []interface{}{eventID}
+	switch bucket {
+	case time.Hour:
+		query = `SELECT bucket, COALESCE(gate, ''), admitted, scans
+			FROM check_ins_hourly WHERE event_id = $1 ORDER BY bucket`
+	case 24 * time.Hour:
+		query = `SELECT bucket, COALESCE(gate, ''), admitted, scans
+			FROM check_ins_daily WHERE event_id = $1 ORDER BY bucket`
+	default:
+		query = `SELECT time_bucket($2 * INTERVAL '1 second', checked_in_at) AS bucket, COALESCE(gate, ''),
+				COUNT(*) FILTER (WHERE outcome = 'admitted'), COUNT(*)
+			FROM check_ins WHERE event_id = $1
+			GROUP BY 1, 2 ORDER BY 1`
+		args = append(args, int64(bucket/time.Second))
+	}
+
+	return a.queryBuckets(ctx, query, args...)
+}
+
+// fallbackBuckets groups by the coarsest date_trunc unit that divides the
+// bucket size and merges the rows into buckets in Go
+func (a *checkInAnalytics) fallbackBuckets(ctx context.Context, eventID int32, bucket time.Duration) ([]checkInBucket, error) {
+	unit := "minute"
+	switch {
+	case bucket%(24*time.Hour) == 0:
+		unit = "day"
+	case bucket%time.Hour == 0:
+		unit = "hour"
+	}
+
+	rows, err := a.queryBuckets(ctx, `SELECT date_trunc($2, checked_in_at AT TIME ZONE 'UTC') AS bucket, COALESCE(gate, ''),
+			COUNT(*) FILTER (WHERE outcome = 'admitted'), COUNT(*)
+		FROM check_ins WHERE event_id = $1
+		GROUP BY 1, 2 ORDER BY 1`, eventID, unit)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeCheckInBuckets(rows, bucket), nil
+}
+
+func (a *checkInAnalytics) queryBuckets(ctx context.Context, query string, args ...interface{}) ([]checkInBucket, error) {
+	rows, err := a.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query check-in buckets: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []checkInBucket
+	for rows.Next() {
+		var b checkInBucket
+		if err := rows.Scan(&b.Bucket, &b.Gate, &b.Admitted, &b.Scans); err != nil {
+			return nil, fmt.Errorf("failed to scan check-in bucket: %w", err)
+		}
+		b.Bucket = b.Bucket.UTC()
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
+
+// mergeCheckInBuckets sums finer grained rows into buckets of the given size
+func mergeCheckInBuckets(rows []checkInBucket, bucket time.Duration) []checkInBucket {
+	type key struct {
+		bucket time.Time
+		gate   string
+	}
+
+	merged := map[key]*checkInBucket{}
+	var order []key
+	for _, row := range rows {
+		k := key{bucket: row.Bucket.Truncate(bucket), gate: row.Gate}
+		if b, ok := merged[k]; ok {
+			b.Admitted += row.Admitted
+			b.Scans += row.Scans
+			continue
+		}
+		merged[k] = &checkInBucket{Bucket: k.bucket, Gate: row.Gate, Admitted: row.Admitted, Scans: row.Scans}
+		order = append(order, k)
+	}
+
+	buckets := make([]checkInBucket, 0, len(order))
+	for _, k := range order {
+		buckets = append(buckets, *merged[k])
+	}
+	sort.SliceStable(buckets, func(i, j int) bool { return buckets[i].Bucket.Before(buckets[j].Bucket) })
+	return buckets
 }
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"eventpass.pro/apps/backend/db"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Waitlist entry statuses stored on waitlist_entries.status
+const (
+	waitlistWaiting  = "waiting"
+	waitlistPromoted = "promoted"
+	waitlistClaimed  = "claimed"
+	waitlistLapsed   = "lapsed"
+	waitlistLeft     = "left"
+)
+
+// waitlistClaimWindow is how long a promoted entry has to claim its seat
+// before it goes to the next person waiting
+const waitlistClaimWindow = 24 * time.Hour
+
+// newLinkToken returns a random token for a link emailed to someone without
+// an account, such as a waitlist claim or an email verification link
+func newLinkToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// linkTokenHash is what is stored of a link token, so the database alone
+// does not give the links away
+func linkTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func waitlistTokenHash(token string) pgtype.Text {
+	return pgtype.Text{String: linkTokenHash(token), Valid: true}
+}
+
+// withoutClaimToken hides the claim token hash from API responses
+func withoutClaimToken(entry db.WaitlistEntry) db.WaitlistEntry {
+	entry.ClaimTokenHash = pgtype.Text{}
+	return entry
+}
+
+// JoinWaitlist puts someone on the event's waitlist. Anyone signed in may
+// join; admins and the event's organizers may set a priority, which moves
+// the entry ahead of those with a lower one. Equal priorities are served in
+// signup order.
+func (api *API) JoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := userFromContext(ctx)
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Email     string `json:"email"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Priority  int32  `json:"priority"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	request.Email = strings.TrimSpace(request.Email)
+	request.FirstName = strings.TrimSpace(request.FirstName)
+	request.LastName = strings.TrimSpace(request.LastName)
+	if !isValidEmail(request.Email) {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if len(request.FirstName) > maxInviteeTextLength || len(request.LastName) > maxInviteeTextLength {
+		http.Error(w, fmt.Sprintf("Names are limited to %d characters", maxInviteeTextLength), http.StatusBadRequest)
+		return
+	}
+
+	event, err := api.db.GetEvent(ctx, int32(eventID))
+	if err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if event.Date.Valid && event.Date.Time.Before(time.Now()) {
+		http.Error(w, "Event has already taken place", http.StatusConflict)
+		return
+	}
+
+	if request.Priority != 0 {
+		allowed := user.Role == RoleAdmin || user.Role == RoleOrganizer
+		if allowed {
+			allowed, err = api.canAccessEvent(ctx, user, event.ID)
+		}
+		if err != nil || !allowed {
+			http.Error(w, "Only organizers may set a priority", http.StatusForbidden)
+			return
+		}
+	}
+
+	_, err = api.db.GetInviteeByEventAndEmail(ctx, db.GetInviteeByEventAndEmailParams{EventID: event.ID, Email: request.Email})
+	if err == nil {
+		http.Error(w, fmt.Sprintf("%s is already invited", request.Email), http.StatusConflict)
+		return
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entry, err := api.db.JoinWaitlist(ctx, db.JoinWaitlistParams{
+		EventID:   event.ID,
+		Email:     request.Email,
+		FirstName: optionalText(request.FirstName),
+		LastName:  optionalText(request.LastName),
+		Priority:  request.Priority,
+		UserID:    user.ID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("%s is already on the waitlist", request.Email), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Seats may already be free, e.g. when the event is not full
+	api.promoteWaitlist(ctx, event.ID, 1)
+
+	if current, err := api.db.GetWaitlistEntry(ctx, entry.ID); err == nil {
+		entry = current
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(withoutClaimToken(entry))
+}
+
+// ListWaitlist returns the event's waitlist in the order it is served
+func (api *API) ListWaitlist(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	entries, err := api.db.ListWaitlistByEvent(r.Context(), int32(eventID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range entries {
+		entries[i] = withoutClaimToken(entries[i])
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+// LeaveWaitlist takes a waiting entry off the waitlist. The user who added
+// it, admins and the event's organizers may remove it.
+func (api *API) LeaveWaitlist(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := userFromContext(ctx)
+	if !ok {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	entryID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid waitlist entry ID", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := api.db.GetWaitlistEntry(ctx, int32(entryID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Waitlist entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if entry.UserID != user.ID {
+		if user.Role != RoleAdmin && user.Role != RoleOrganizer {
+			http.Error(w, "Waitlist entry not found", http.StatusNotFound)
+			return
+		}
+		if !api.checkEventAccess(w, r, entry.EventID) {
+			return
+		}
+	}
+
+	left, err := api.db.LeaveWaitlist(ctx, entry.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("Waitlist entry is %s", entry.Status), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(withoutClaimToken(left))
+}
+
+// ClaimWaitlistSpot claims the seat offered to a promoted waitlist entry
+// with the token from its notification. The invitee stops expiring and gets
+// a signed QR code. It is public, since waitlisted people need no account,
+// and claiming twice returns the same invitee.
+func (api *API) ClaimWaitlistSpot(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Missing claim token", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := api.db.GetWaitlistEntryByClaimToken(ctx, waitlistTokenHash(token))
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !entry.InviteeID.Valid) {
+		http.Error(w, "Invalid claim token", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch entry.Status {
+	case waitlistPromoted:
+		if _, err := api.db.ClaimWaitlistInvitee(ctx, entry.InviteeID.Int32); errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Claim window has closed", http.StatusGone)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, err := api.db.ClaimWaitlistEntry(ctx, entry.ID); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case waitlistClaimed:
+	default:
+		http.Error(w, "Claim window has closed", http.StatusGone)
+		return
+	}
+
+	invitee, err := api.db.GetInvitee(ctx, entry.InviteeID.Int32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !invitee.QrIssuedAt.Valid {
+		if invitee, err = api.issueQRCode(ctx, invitee.ID); err != nil {
+			LogError(ctx, "Failed to issue waitlist ticket", err)
+			http.Error(w, "Failed to issue QR code, claim again to retry", http.StatusInternalServerError)
+			return
+		}
+		api.publishInviteeState(ctx, invitee)
+	}
+
+	json.NewEncoder(w).Encode(invitee)
+}
+
+// promoteWaitlist offers up to seats freed seats of the event to the next
+// people waiting, as long as the event has room. Each becomes a pending
+// invitee expiring at the end of the claim window and is sent a claim link;
+// unclaimed seats are passed on when expireOldInvitees expires them.
+// Failures are only logged, since the seat stays free for the next run.
+func (api *API) promoteWaitlist(ctx context.Context, eventID int32, seats int) {
+	event, err := api.db.GetEvent(ctx, eventID)
+	if err != nil {
+		LogError(ctx, "Failed to load event for waitlist promotion", err)
+		return
+	}
+	now := time.Now()
+	if event.Date.Valid && !event.Date.Time.After(now) {
+		return
+	}
+	claimExpiresAt := now.Add(waitlistClaimWindow)
+	if event.Date.Valid && event.Date.Time.Before(claimExpiresAt) {
+		claimExpiresAt = event.Date.Time
+	}
+
+	for promoted := 0; promoted < seats; {
+		token, err := newLinkToken()
+		if err != nil {
+			LogError(ctx, "Failed to generate waitlist claim token", err)
+			return
+		}
+
+		var entry db.WaitlistEntry
+		var invitee db.Invitee
+		err = api.inTx(ctx, func(q db.Querier) error {
+			// Promotions of the event wait for each other on the event row,
+			// so each one counts the seats taken by the one before
+			_, err := q.LockEvent(ctx, eventID)
+			if err != nil {
+				return err
+			}
+			entry, err = q.PromoteWaitlistEntry(ctx, db.PromoteWaitlistEntryParams{
+				EventID:        eventID,
+				ClaimExpiresAt: pgtype.Timestamptz{Time: claimExpiresAt, Valid: true},
+				ClaimTokenHash: waitlistTokenHash(token),
+			})
+			if err != nil {
+				return err
+			}
+
+			invitee, err = q.CreateWaitlistInvitee(ctx, db.CreateWaitlistInviteeParams{
+				EventID:   eventID,
+				Email:     entry.Email,
+				FirstName: entry.FirstName,
+				LastName:  entry.LastName,
+				ExpiresAt: entry.ClaimExpiresAt,
+			})
+			if errors.Is(err, pgx.ErrNoRows) {
+				// Invited some other way since joining
+				return q.LapseWaitlistEntry(ctx, entry.ID)
+			}
+			if err != nil {
+				return err
+			}
+			return q.SetWaitlistEntryInvitee(ctx, db.SetWaitlistEntryInviteeParams{
+				ID:        entry.ID,
+				InviteeID: pgtype.Int4{Int32: invitee.ID, Valid: true},
+			})
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return
+		}
+		if err != nil {
+			LogError(ctx, "Failed to promote waitlist entry", err)
+			return
+		}
+		if invitee.ID == 0 {
+			continue
+		}
+
+		api.publishInviteeState(ctx, invitee)
+		api.sendWaitlistPromotion(ctx, event, entry, token)
+		promoted++
+	}
+}
+
+// sendWaitlistPromotion sends a promoted entry the link to claim its seat
+func (api *API) sendWaitlistPromotion(ctx context.Context, event db.Event, entry db.WaitlistEntry, token string) {
+	claimURL := fmt.Sprintf("%s/waitlist/claim?token=%s", os.Getenv("BASE_URL"), token)
+
+	subject := fmt.Sprintf("A seat opened up for %s", event.Name)
+	message := fmt.Sprintf(`
+Hello!
+
+A seat has opened up for %s and it is yours if you claim it.
+
+Event: %s
+Start Time: %s
+Location: %s
+
+Claim your seat before %s: %s
+
+If you do not claim it in time, it goes to the next person on the waitlist.
+
+Best regards,
+EventPass Pro Team
+`, event.Name, event.Name, event.Date.Time.Format("2006-01-02 15:04"), event.Location, entry.ClaimExpiresAt.Time.Format("2006-01-02 15:04"), claimURL)
+
+	api.SendEventNotification(ctx, event.ID, "email", entry.Email, subject, message)
+}
+
+// lapseWaitlistInvitee ends the promotion of an expired waitlist invitee
+func (api *API) lapseWaitlistInvitee(ctx context.Context, invitee db.Invitee) {
+	entry, err := api.db.GetWaitlistEntryByInvitee(ctx, pgtype.Int4{Int32: invitee.ID, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return
+	}
+	if err == nil {
+		err = api.db.LapseWaitlistEntry(ctx, entry.ID)
+	}
+	if err != nil {
+		LogError(ctx, "Failed to lapse waitlist entry", err)
+	}
+}
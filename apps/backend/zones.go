@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"eventpass.pro/apps/backend/db"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// checkInZoneAccess records an admitted invitee entering another zone
+const checkInZoneAccess = "zone_access"
+
+var errUnknownZone = errors.New("unknown zone")
+
+// scanZone resolves the zone a scan is made at, from the zone parameter or
+// else from a configured gate, and stores it in source.ZoneID. Gates that are
+// not configured are free-text labels, so scans there have no zone and no
+// zone rules apply.
+func (api *API) scanZone(ctx context.Context, eventID int32, source *scanSource) (db.Zone, error) {
+	var zone db.Zone
+	var err error
+	switch {
+	case source.Zone != "":
+		zone, err = api.db.GetZoneByName(ctx, db.GetZoneByNameParams{EventID: eventID, Name: source.Zone})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.Zone{}, errUnknownZone
+		}
+	case source.Gate.Valid:
+		var gate db.Gate
+		gate, err = api.db.GetGateByName(ctx, db.GetGateByNameParams{EventID: eventID, Name: source.Gate.String})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.Zone{}, nil
+		}
+		if err != nil {
+			return db.Zone{}, err
+		}
+		zone, err = api.db.GetZone(ctx, gate.ZoneID)
+	default:
+		return db.Zone{}, nil
+	}
+	if err != nil {
+		return db.Zone{}, err
+	}
+
+	source.ZoneID = pgtype.Int4{Int32: zone.ID, Valid: true}
+	return zone, nil
+}
+
+// zoneDenial returns why the invitee may not enter the zone, or "" when they
+// may. Zones without tiers are open to every invitee.
+func zoneDenial(zone db.Zone, invitee db.Invitee) string {
+	if zone.ID == 0 || len(zone.Tiers) == 0 {
+		return ""
+	}
+	for _, tier := range zone.Tiers {
+		if invitee.Tier.Valid && strings.EqualFold(tier, invitee.Tier.String) {
+			return ""
+		}
+	}
+	if !invitee.Tier.Valid || invitee.Tier.String == "" {
+		return fmt.Sprintf("invitee has no tier with access to zone %s", zone.Name)
+	}
+	return fmt.Sprintf("tier %s has no access to zone %s", invitee.Tier.String, zone.Name)
+}
+
+type zoneRequest struct {
+	Name     string   `json:"name"`
+	Tiers    []string `json:"tiers"`
+	Capacity *int32   `json:"capacity"`
+}
+
+// normalize trims the zone name and drops blank and repeated tiers, reporting
+// whether the request is valid. A missing capacity is set to current.
+func (request *zoneRequest) normalize(current int32) bool {
+	request.Name = strings.TrimSpace(request.Name)
+	tiers := make([]string, 0, len(request.Tiers))
+	seen := map[string]bool{}
+	for _, tier := range request.Tiers {
+		tier = strings.TrimSpace(tier)
+		if tier == "" || seen[strings.ToLower(tier)] {
+			continue
+		}
+		seen[strings.ToLower(tier)] = true
+		tiers = append(tiers, tier)
+	}
+	request.Tiers = tiers
+	if request.Capacity == nil {
+		request.Capacity = &current
+	}
+	return request.Name != "" && len(request.Name) <= 64 && *request.Capacity >= 0
+}
+
+// ListZones returns the event's zones and the gates leading into them
+func (api *API) ListZones(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	zones, err := api.db.ListZonesByEvent(r.Context(), int32(eventID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	gates, err := api.db.ListGatesByEvent(r.Context(), int32(eventID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Zones []db.Zone `json:"zones"`
+		Gates []db.Gate `json:"gates"`
+	}{Zones: zones, Gates: gates})
+}
+
+// CreateZone defines an area of the venue, e.g. a VIP lounge, open to the
+// invitees of the listed tiers or to everyone when no tiers are listed. A
+// capacity above zero caps how many invitees may be inside at once.
+func (api *API) CreateZone(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	eventID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, int32(eventID)) {
+		return
+	}
+
+	var request zoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !request.normalize(0) {
+		http.Error(w, "Invalid zone name or capacity", http.StatusBadRequest)
+		return
+	}
+
+	zone, err := api.db.CreateZone(r.Context(), db.CreateZoneParams{
+		EventID:  int32(eventID),
+		Name:     request.Name,
+		Tiers:    request.Tiers,
+		Capacity: *request.Capacity,
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		http.Error(w, "Zone already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(zone)
+}
+
+// UpdateZone renames a zone and replaces the tiers allowed into it and,
+// when given, its capacity
+func (api *API) UpdateZone(w http.ResponseWriter, r *http.Request) {
+	zone, ok := api.zoneForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var request zoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !request.normalize(zone.Capacity) {
+		http.Error(w, "Invalid zone name or capacity", http.StatusBadRequest)
+		return
+	}
+
+	zone, err := api.db.UpdateZone(r.Context(), db.UpdateZoneParams{
+		ID:       zone.ID,
+		Name:     request.Name,
+		Tiers:    request.Tiers,
+		Capacity: *request.Capacity,
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		http.Error(w, "Zone already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(zone)
+}
+
+// DeleteZone removes a zone together with its gates. Past scans keep their
+// outcome but lose the zone.
+func (api *API) DeleteZone(w http.ResponseWriter, r *http.Request) {
+	zone, ok := api.zoneForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := api.db.DeleteZone(r.Context(), zone.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateGate adds a named scanning point leading into a zone. Scans with the
+// gate's name apply the zone's rules.
+func (api *API) CreateGate(w http.ResponseWriter, r *http.Request) {
+	zone, ok := api.zoneForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > 64 {
+		http.Error(w, "Invalid gate name", http.StatusBadRequest)
+		return
+	}
+
+	gate, err := api.db.CreateGate(r.Context(), db.CreateGateParams{
+		EventID: zone.EventID,
+		ZoneID:  zone.ID,
+		Name:    request.Name,
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		http.Error(w, "Gate already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(gate)
+}
+
+// DeleteGate removes a gate; scans with its name no longer apply zone rules
+func (api *API) DeleteGate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gateID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid gate ID", http.StatusBadRequest)
+		return
+	}
+
+	gate, err := api.db.GetGate(r.Context(), int32(gateID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Gate not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !api.checkEventAccess(w, r, gate.EventID) {
+		return
+	}
+
+	if err := api.db.DeleteGate(r.Context(), gate.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// zoneForRequest loads the zone named by the id route variable and checks
+// access to its event, writing the error response itself
+func (api *API) zoneForRequest(w http.ResponseWriter, r *http.Request) (db.Zone, bool) {
+	vars := mux.Vars(r)
+	zoneID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid zone ID", http.StatusBadRequest)
+		return db.Zone{}, false
+	}
+
+	zone, err := api.db.GetZone(r.Context(), int32(zoneID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Zone not found", http.StatusNotFound)
+		return db.Zone{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.Zone{}, false
+	}
+
+	if !api.checkEventAccess(w, r, zone.EventID) {
+		return db.Zone{}, false
+	}
+	return zone, true
+}